@@ -149,3 +149,585 @@ ADD CONSTRAINT fk_purchase_items_products FOREIGN KEY (product_id) REFERENCES pr
 ALTER TABLE price_change
 ADD CONSTRAINT fk_price_change_products FOREIGN KEY (product_id) REFERENCES products(id);
 
+
+
+-- Координаты магазинов для расчёта зон доставки по радиусу
+ALTER TABLE stores
+ADD COLUMN latitude DECIMAL(9, 6),
+ADD COLUMN longitude DECIMAL(9, 6);
+
+-- Вес товара в граммах для расчёта стоимости доставки
+ALTER TABLE products
+ADD COLUMN weight INT;
+
+-- Создание таблицы зон доставки
+CREATE TABLE delivery_zones (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ store_id INT NOT NULL,
+ name VARCHAR(255) NOT NULL,
+ city VARCHAR(255) NOT NULL DEFAULT '',
+ postal_prefix VARCHAR(20) NOT NULL DEFAULT '',
+ radius_km DECIMAL(8, 2) NOT NULL DEFAULT 0,
+ free_shipping_threshold DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ FOREIGN KEY (store_id) REFERENCES stores(id)
+);
+
+-- Создание таблицы способов доставки
+CREATE TABLE delivery_methods (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ code VARCHAR(50) NOT NULL,
+ name VARCHAR(255) NOT NULL
+);
+
+INSERT INTO delivery_methods (code, name) VALUES
+ ('courier', 'Курьер'),
+ ('pickup_point', 'Пункт выдачи'),
+ ('in_store_pickup', 'Самовывоз из магазина');
+
+-- Создание таблицы тарифов доставки
+CREATE TABLE delivery_rates (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ zone_id INT NOT NULL,
+ method_id INT NOT NULL,
+ max_weight INT NOT NULL DEFAULT 0,
+ max_order_value DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ price DECIMAL(10, 2) NOT NULL,
+ FOREIGN KEY (zone_id) REFERENCES delivery_zones(id),
+ FOREIGN KEY (method_id) REFERENCES delivery_methods(id)
+);
+
+-- Статус покупки (awaiting_pickup, completed, cancelled и т.д.)
+ALTER TABLE purchases
+ADD COLUMN status VARCHAR(50) NOT NULL DEFAULT 'new';
+
+-- Создание таблицы остатков по магазинам
+CREATE TABLE store_inventory (
+ store_id INT NOT NULL,
+ product_id INT NOT NULL,
+ quantity INT NOT NULL DEFAULT 0,
+ reserved INT NOT NULL DEFAULT 0,
+ PRIMARY KEY (store_id, product_id),
+ FOREIGN KEY (store_id) REFERENCES stores(id),
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ CHECK (reserved >= 0 AND reserved <= quantity)
+);
+
+-- Создание таблицы заказов на самовывоз
+CREATE TABLE pickup_orders (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ purchase_id INT NOT NULL,
+ customer_id INT NOT NULL,
+ store_id INT NOT NULL,
+ pickup_code VARCHAR(10) NOT NULL,
+ status VARCHAR(50) NOT NULL,
+ expires_at DATETIME NOT NULL,
+ collected_at DATETIME,
+ collected_by VARCHAR(255),
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ FOREIGN KEY (purchase_id) REFERENCES purchases(id),
+ FOREIGN KEY (customer_id) REFERENCES customers(id),
+ FOREIGN KEY (store_id) REFERENCES stores(id)
+);
+
+-- Код получения уникален среди активных заказов; коды выданных и отменённых заказов используются повторно
+CREATE UNIQUE INDEX uq_pickup_orders_code_reserved ON pickup_orders (pickup_code) WHERE status = 'reserved';
+CREATE INDEX idx_pickup_orders_status_expires ON pickup_orders (status, expires_at);
+
+-- Создание таблицы платежей
+CREATE TABLE payments (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ purchase_id INT NOT NULL,
+ provider VARCHAR(50) NOT NULL,
+ provider_payment_id VARCHAR(255) NOT NULL,
+ amount DECIMAL(10, 2) NOT NULL,
+ captured_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ currency VARCHAR(3) NOT NULL,
+ status VARCHAR(50) NOT NULL,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ UNIQUE (provider, provider_payment_id),
+ FOREIGN KEY (purchase_id) REFERENCES purchases(id)
+);
+
+-- Создание таблицы возвратов по платежам
+CREATE TABLE payment_refunds (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ payment_id INT NOT NULL,
+ provider_refund_id VARCHAR(255) NOT NULL,
+ amount DECIMAL(10, 2) NOT NULL,
+ reason TEXT,
+ idempotency_key VARCHAR(100), -- Например, return-<id заявки>; повтор не создаёт второй возврат
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (payment_id) REFERENCES payments(id),
+ UNIQUE (payment_id, idempotency_key)
+);
+
+-- Обработанные события вебхуков (для идемпотентности)
+CREATE TABLE payment_webhook_events (
+ provider VARCHAR(50) NOT NULL,
+ event_id VARCHAR(255) NOT NULL,
+ event_type VARCHAR(100) NOT NULL,
+ received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (provider, event_id)
+);
+
+-- Стоимость доставки и скидка по заказу (нужны для расчёта возвратов)
+ALTER TABLE purchases
+ADD COLUMN shipping_price DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ADD COLUMN discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+
+-- Создание таблицы заявок на возврат
+CREATE TABLE return_requests (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ purchase_id INT NOT NULL,
+ store_id INT,
+ status VARCHAR(50) NOT NULL,
+ refund_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+ payment_refund_id INT,
+ decided_by VARCHAR(255),
+ decision_note TEXT,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ FOREIGN KEY (purchase_id) REFERENCES purchases(id),
+ FOREIGN KEY (store_id) REFERENCES stores(id),
+ FOREIGN KEY (payment_refund_id) REFERENCES payment_refunds(id)
+);
+
+-- Создание таблицы позиций заявки на возврат
+CREATE TABLE return_request_items (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ return_request_id INT NOT NULL,
+ purchase_item_id INT NOT NULL,
+ product_id INT NOT NULL,
+ quantity INT NOT NULL,
+ price DECIMAL(10, 2) NOT NULL,
+ reason TEXT NOT NULL,
+ opened BOOLEAN NOT NULL DEFAULT FALSE,
+ disposition VARCHAR(50) NOT NULL,
+ FOREIGN KEY (return_request_id) REFERENCES return_requests(id),
+ FOREIGN KEY (purchase_item_id) REFERENCES purchase_items(id),
+ FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+-- Создание таблицы истории покупки
+CREATE TABLE purchase_history (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ purchase_id INT NOT NULL,
+ event VARCHAR(100) NOT NULL,
+ details TEXT,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (purchase_id) REFERENCES purchases(id)
+);
+
+-- Мягкое удаление справочников и клиентов
+ALTER TABLE products ADD COLUMN deleted_at DATETIME;
+ALTER TABLE categories ADD COLUMN deleted_at DATETIME;
+ALTER TABLE manufacturers ADD COLUMN deleted_at DATETIME;
+ALTER TABLE stores ADD COLUMN deleted_at DATETIME;
+ALTER TABLE customers ADD COLUMN deleted_at DATETIME;
+
+-- Иерархия категорий: родитель, slug и порядок внутри родителя
+ALTER TABLE categories
+ADD COLUMN parent_id INT,
+ADD COLUMN slug VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN position INT NOT NULL DEFAULT 0,
+ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ADD CONSTRAINT fk_categories_parent FOREIGN KEY (parent_id) REFERENCES categories(id),
+ADD CONSTRAINT uq_categories_store_slug UNIQUE (store_id, slug);
+
+CREATE INDEX idx_categories_parent ON categories (parent_id);
+
+-- Профиль бренда для страницы производителя
+ALTER TABLE manufacturers
+ADD COLUMN country VARCHAR(255),
+ADD COLUMN website VARCHAR(255),
+ADD COLUMN logo_url VARCHAR(255),
+ADD COLUMN description TEXT,
+ADD COLUMN authenticity_url VARCHAR(255),
+ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+
+-- Создание таблицы вариантов товара (цвет, сопротивление, крепость, объём)
+CREATE TABLE product_variants (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ product_id INT NOT NULL,
+ sku VARCHAR(100) NOT NULL UNIQUE,
+ price_override DECIMAL(10, 2),
+ stock INT NOT NULL DEFAULT 0,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ CHECK (stock >= 0)
+);
+
+-- Создание таблицы значений атрибутов вариантов
+CREATE TABLE product_variant_attributes (
+ variant_id INT NOT NULL,
+ name VARCHAR(50) NOT NULL,
+ value VARCHAR(255) NOT NULL,
+ PRIMARY KEY (variant_id, name),
+ FOREIGN KEY (variant_id) REFERENCES product_variants(id),
+ CHECK (name IN ('color', 'coil_resistance', 'nicotine_strength', 'volume'))
+);
+
+-- Позиция покупки может ссылаться на конкретный вариант
+ALTER TABLE purchase_items
+ADD COLUMN variant_id INT,
+ADD CONSTRAINT fk_purchase_items_variants FOREIGN KEY (variant_id) REFERENCES product_variants(id);
+
+-- Создание таблицы галереи изображений товара
+CREATE TABLE product_images (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ product_id INT NOT NULL,
+ storage_key VARCHAR(512) NOT NULL,
+ url VARCHAR(1024) NOT NULL,
+ thumbnail_key VARCHAR(512) NOT NULL,
+ thumbnail_url VARCHAR(1024) NOT NULL,
+ webp_key VARCHAR(512),
+ webp_url VARCHAR(1024),
+ position INT NOT NULL DEFAULT 0,
+ width INT NOT NULL,
+ height INT NOT NULL,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE INDEX idx_product_images_product ON product_images (product_id, position);
+
+-- Артикул товара для загрузки прайс-листов
+ALTER TABLE products
+ADD COLUMN sku VARCHAR(64),
+ADD CONSTRAINT uq_products_sku UNIQUE (sku);
+
+-- Создание таблицы поставщиков
+CREATE TABLE suppliers (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ name VARCHAR(255) NOT NULL,
+ contact_name VARCHAR(255),
+ email VARCHAR(255),
+ phone VARCHAR(50),
+ address VARCHAR(512),
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Создание таблицы заказов поставщикам
+CREATE TABLE supplier_orders (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ supplier_id INT NOT NULL,
+ store_id INT NOT NULL,
+ status VARCHAR(30) NOT NULL DEFAULT 'draft',
+ expected_at DATETIME,
+ notes TEXT,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+ FOREIGN KEY (store_id) REFERENCES stores(id)
+);
+
+-- Создание таблицы позиций заказа поставщику
+CREATE TABLE supplier_order_items (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ order_id INT NOT NULL,
+ product_id INT NOT NULL,
+ quantity INT NOT NULL,
+ unit_cost DECIMAL(10, 2) NOT NULL,
+ received_quantity INT NOT NULL DEFAULT 0,
+ FOREIGN KEY (order_id) REFERENCES supplier_orders(id),
+ FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+-- Создание таблицы приёмок товара
+CREATE TABLE goods_receipts (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ order_id INT NOT NULL,
+ received_by VARCHAR(255) NOT NULL,
+ notes TEXT,
+ received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (order_id) REFERENCES supplier_orders(id)
+);
+
+CREATE TABLE goods_receipt_items (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ receipt_id INT NOT NULL,
+ order_item_id INT NOT NULL,
+ quantity INT NOT NULL,
+ damaged INT NOT NULL DEFAULT 0,
+ note TEXT,
+ FOREIGN KEY (receipt_id) REFERENCES goods_receipts(id),
+ FOREIGN KEY (order_item_id) REFERENCES supplier_order_items(id)
+);
+
+-- Создание таблицы расхождений при приёмке (недостача, излишек, брак)
+CREATE TABLE supplier_order_discrepancies (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ order_id INT NOT NULL,
+ receipt_id INT,
+ order_item_id INT NOT NULL,
+ kind VARCHAR(20) NOT NULL,
+ quantity INT NOT NULL,
+ note TEXT,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (order_id) REFERENCES supplier_orders(id),
+ FOREIGN KEY (receipt_id) REFERENCES goods_receipts(id),
+ FOREIGN KEY (order_item_id) REFERENCES supplier_order_items(id)
+);
+
+-- Закупочная (средневзвешенная) цена товара и её история
+ALTER TABLE products
+ADD COLUMN cost_price DECIMAL(10, 2);
+
+CREATE TABLE product_cost_history (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ product_id INT NOT NULL,
+ receipt_id INT,
+ unit_cost DECIMAL(10, 2) NOT NULL,
+ cost_price DECIMAL(10, 2) NOT NULL,
+ changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ FOREIGN KEY (receipt_id) REFERENCES goods_receipts(id)
+);
+
+-- Создание журнала движения товара. Записи только добавляются;
+-- сумма движений по магазину и товару должна совпадать с store_inventory.quantity,
+-- а движений без магазина - с products.stock (или product_variants.stock для варианта)
+CREATE TABLE stock_movements (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ store_id INT,
+ product_id INT NOT NULL,
+ variant_id INT,
+ kind VARCHAR(20) NOT NULL,
+ quantity INT NOT NULL,
+ reference_type VARCHAR(30),
+ reference_id INT,
+ note TEXT,
+ created_by VARCHAR(255),
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (store_id) REFERENCES stores(id),
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ FOREIGN KEY (variant_id) REFERENCES product_variants(id),
+ CHECK (quantity <> 0),
+ CHECK (variant_id IS NULL OR store_id IS NULL)
+);
+
+CREATE INDEX idx_stock_movements_store_product ON stock_movements (store_id, product_id, created_at);
+
+CREATE SEQUENCE stock_transfer_seq;
+
+-- Начальные остатки, накопленные до появления журнала
+INSERT INTO stock_movements (store_id, product_id, kind, quantity, reference_type, note)
+SELECT store_id, product_id, 'adjustment', quantity, 'opening_balance', 'остаток на момент запуска журнала'
+FROM store_inventory WHERE quantity <> 0;
+
+INSERT INTO stock_movements (product_id, kind, quantity, reference_type, note)
+SELECT id, 'adjustment', stock, 'opening_balance', 'остаток на момент запуска журнала'
+FROM products WHERE COALESCE(stock, 0) <> 0;
+
+INSERT INTO stock_movements (product_id, variant_id, kind, quantity, reference_type, note)
+SELECT product_id, id, 'adjustment', stock, 'opening_balance', 'остаток на момент запуска журнала'
+FROM product_variants WHERE stock <> 0;
+
+-- Создание таблиц инвентаризации
+CREATE TABLE stocktakes (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ store_id INT NOT NULL,
+ status VARCHAR(20) NOT NULL DEFAULT 'open',
+ started_by VARCHAR(255) NOT NULL,
+ note TEXT,
+ completed_by VARCHAR(255),
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ completed_at DATETIME,
+ FOREIGN KEY (store_id) REFERENCES stores(id)
+);
+
+CREATE TABLE stocktake_counts (
+ stocktake_id INT NOT NULL,
+ product_id INT NOT NULL,
+ counted_quantity INT NOT NULL,
+ expected_quantity INT, -- Учётный остаток, фиксируется при завершении
+ counted_by VARCHAR(255) NOT NULL,
+ counted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ PRIMARY KEY (stocktake_id, product_id),
+ FOREIGN KEY (stocktake_id) REFERENCES stocktakes(id),
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ CHECK (counted_quantity >= 0)
+);
+
+-- Создание таблицы точек дозаказа: общая для товара (store_id IS NULL) или для магазина
+CREATE TABLE reorder_levels (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ product_id INT NOT NULL,
+ store_id INT,
+ min_quantity INT NOT NULL DEFAULT 0,
+ cover_days INT NOT NULL DEFAULT 14,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ FOREIGN KEY (store_id) REFERENCES stores(id),
+ CONSTRAINT uq_reorder_levels_product_store UNIQUE (product_id, store_id)
+);
+
+CREATE UNIQUE INDEX uq_reorder_levels_product_default ON reorder_levels (product_id) WHERE store_id IS NULL;
+
+-- Создание таблицы сигналов о низком остатке
+CREATE TABLE low_stock_alerts (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ store_id INT NOT NULL,
+ product_id INT NOT NULL,
+ available INT NOT NULL,
+ suggested_quantity INT NOT NULL,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ resolved_at DATETIME,
+ FOREIGN KEY (store_id) REFERENCES stores(id),
+ FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE INDEX idx_low_stock_alerts_open ON low_stock_alerts (store_id, product_id) WHERE resolved_at IS NULL;
+
+-- Создание таблицы подписок покупателей на появление товара и снижение цены
+CREATE TABLE product_subscriptions (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ customer_id INT NOT NULL,
+ product_id INT NOT NULL,
+ variant_id INT,
+ kind VARCHAR(20) NOT NULL,
+ target_price DECIMAL(10, 2),
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ fired_at DATETIME, -- Когда отправлено уведомление; после этого подписка не действует
+ FOREIGN KEY (customer_id) REFERENCES customers(id),
+ FOREIGN KEY (product_id) REFERENCES products(id),
+ FOREIGN KEY (variant_id) REFERENCES product_variants(id)
+);
+
+CREATE UNIQUE INDEX uq_product_subscriptions_active ON product_subscriptions (customer_id, product_id, COALESCE(variant_id, 0), kind) WHERE fired_at IS NULL;
+CREATE INDEX idx_product_subscriptions_product ON product_subscriptions (product_id, kind) WHERE fired_at IS NULL;
+
+-- Создание таблицы настроек уведомлений покупателей
+CREATE TABLE customer_notification_preferences (
+ customer_id INT PRIMARY KEY,
+ language VARCHAR(2) NOT NULL DEFAULT 'ru',
+ email_enabled BOOLEAN NOT NULL DEFAULT TRUE,
+ sms_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+ telegram_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+ telegram_chat_id VARCHAR(64),
+ FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+
+-- Создание таблицы очереди уведомлений
+CREATE TABLE notification_outbox (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ customer_id INT, -- Пусто для уведомлений сотрудникам
+ channel VARCHAR(20) NOT NULL,
+ recipient VARCHAR(255) NOT NULL,
+ template VARCHAR(50) NOT NULL,
+ subject VARCHAR(255) NOT NULL,
+ body TEXT NOT NULL,
+ status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ attempts INT NOT NULL DEFAULT 0,
+ last_error TEXT,
+ next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ sent_at DATETIME,
+ FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox (next_attempt_at) WHERE status = 'pending';
+
+-- Создание таблицы доменных событий (transactional outbox)
+CREATE TABLE domain_events (
+ id BIGINT PRIMARY KEY AUTO_INCREMENT,
+ event_type VARCHAR(100) NOT NULL,
+ aggregate_type VARCHAR(50) NOT NULL,
+ aggregate_id VARCHAR(64) NOT NULL,
+ payload JSONB NOT NULL,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_domain_events_aggregate ON domain_events (aggregate_type, aggregate_id, id);
+
+-- Создание таблицы подписчиков доменных событий
+CREATE TABLE event_subscribers (
+ name VARCHAR(100) PRIMARY KEY,
+ event_types TEXT[] NOT NULL,
+ registered_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Создание таблицы доставок доменных событий подписчикам
+CREATE TABLE event_deliveries (
+ subscriber VARCHAR(100) NOT NULL,
+ event_id BIGINT NOT NULL,
+ status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ attempts INT NOT NULL DEFAULT 0,
+ last_error TEXT,
+ next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ delivered_at DATETIME,
+ PRIMARY KEY (subscriber, event_id),
+ FOREIGN KEY (subscriber) REFERENCES event_subscribers(name),
+ FOREIGN KEY (event_id) REFERENCES domain_events(id)
+);
+
+CREATE INDEX idx_event_deliveries_pending ON event_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_event_deliveries_undelivered ON event_deliveries (subscriber, event_id) WHERE status <> 'delivered';
+
+-- Создание таблицы вебхуков партнёров
+CREATE TABLE webhooks (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ url VARCHAR(2048) NOT NULL,
+ event_types TEXT[] NOT NULL,
+ secret VARCHAR(255) NOT NULL, -- Ключ HMAC-подписи запросов
+ description VARCHAR(255),
+ active BOOLEAN NOT NULL DEFAULT TRUE,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Создание таблицы доставок вебхуков
+CREATE TABLE webhook_deliveries (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ webhook_id INT NOT NULL,
+ event_id BIGINT NOT NULL,
+ event_type VARCHAR(100) NOT NULL,
+ body TEXT NOT NULL, -- Тело запроса фиксируется при постановке в очередь, чтобы подпись совпадала во всех повторах
+ status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ attempts INT NOT NULL DEFAULT 0,
+ last_status_code INT,
+ last_error TEXT,
+ next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ delivered_at DATETIME,
+ FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+ FOREIGN KEY (event_id) REFERENCES domain_events(id),
+ CONSTRAINT uq_webhook_deliveries_event UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+-- Создание таблицы журнала попыток доставки вебхуков
+CREATE TABLE webhook_delivery_attempts (
+ id INT PRIMARY KEY AUTO_INCREMENT,
+ delivery_id INT NOT NULL,
+ status_code INT,
+ error TEXT,
+ duration_ms BIGINT NOT NULL,
+ attempted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+);
+
+-- Даты создания и изменения справочников, которые читают репозитории
+ALTER TABLE stores
+ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+
+ALTER TABLE products
+ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP;
+
+-- Покупатели заводятся магазином без пароля
+ALTER TABLE customers
+ADD COLUMN created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+ALTER COLUMN password DROP NOT NULL;
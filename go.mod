@@ -1,20 +1,13 @@
 module github.com/Dmitriy4565/VapeShop
 
-go 1.20
+go 1.21
 
 require (
-	github.com/lib/pq v1.10.9
- 	github.com/Dmitriy4565/VapeShop/internal/services/categoryService v1.1.0
- 	github.com/Dmitriy4565/VapeShop/internal/services/customerService v1.1.0
- 	github.com/Dmitriy4565/VapeShop/internal/services/deliveryService v1.1.0
- 	github.com/Dmitriy4565/VapeShop/internal/services/manufacturerService v1.1.0
- 	github.com/Dmitriy4565/VapeShop/internal/services/productService  v1.1.0
- 	github.com/Dmitriy4565/VapeShop/internal/services/purchaseService v1.1.0
- 	github.com/Dmitriy4565/VapeShop/internal/services/storeService  v1.1.0
 	github.com/gin-gonic/gin v1.10.0
+	github.com/go-playground/validator/v10 v10.20.0
+	github.com/lib/pq v1.10.9
 )
 
-
 require (
 	github.com/bytedance/sonic v1.11.6 // indirect
 	github.com/bytedance/sonic/loader v0.1.1 // indirect
@@ -22,10 +15,8 @@ require (
 	github.com/cloudwego/iasm v0.2.0 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.3 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
-	github.com/gin-gonic/gin v1.10.0 // indirect
 	github.com/go-playground/locales v0.14.1 // indirect
 	github.com/go-playground/universal-translator v0.18.1 // indirect
-	github.com/go-playground/validator/v10 v10.20.0 // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.7 // indirect
@@ -37,7 +28,7 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.8.0 // indirect
-	golang.org/x/crypto 	v0.23.0 // indirect
+	golang.org/x/crypto v0.23.0 // indirect
 	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
@@ -45,6 +36,4 @@ require (
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
-replace (
-	github.com/Dmitriy4565/VapeShop/cmd/server => ./cmd/server
-)
+replace github.com/Dmitriy4565/VapeShop/cmd/server => ./cmd/server
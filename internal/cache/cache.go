@@ -0,0 +1,18 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache - хранилище сериализованных значений с ограниченным временем жизни
+type Cache interface {
+	// Get возвращает значение по ключу; ok = false, если ключа нет или срок его жизни истёк
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set сохраняет значение; ttl = 0 - без ограничения срока жизни
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete удаляет ключи. Отсутствие ключа ошибкой не считается.
+	Delete(ctx context.Context, keys ...string) error
+	// DeletePrefix удаляет все ключи, начинающиеся с prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+}
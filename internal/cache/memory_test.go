@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	// Чтение делает a недавно использованной, поэтому вытесняется b
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Fatal("a не найдена")
+	}
+	c.Set(ctx, "c", []byte("3"), 0)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b не вытеснена")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s вытеснена", key)
+		}
+	}
+
+	// Перезапись существующего ключа не вытесняет другие
+	c.Set(ctx, "a", []byte("10"), 0)
+	value, ok, _ := c.Get(ctx, "a")
+	if !ok || string(value) != "10" {
+		t.Errorf("a = %q, %v, want 10", value, ok)
+	}
+	if _, ok, _ := c.Get(ctx, "c"); !ok {
+		t.Error("c вытеснена при перезаписи a")
+	}
+	if len(c.items) != 2 || c.order.Len() != 2 {
+		t.Errorf("записей = %d/%d, want 2", len(c.items), c.order.Len())
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(10)
+
+	c.Set(ctx, "short", []byte("1"), time.Millisecond)
+	c.Set(ctx, "forever", []byte("2"), 0)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Error("запись с истёкшим сроком возвращена")
+	}
+	if _, ok := c.items["short"]; ok {
+		t.Error("запись с истёкшим сроком не удалена")
+	}
+	if _, ok, _ := c.Get(ctx, "forever"); !ok {
+		t.Error("запись без срока жизни не найдена")
+	}
+}
+
+func TestMemoryCacheDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(10)
+	for _, key := range []string{"products:id:1", "products:id:2", "categories:tree:1"} {
+		c.Set(ctx, key, []byte("x"), 0)
+	}
+
+	c.Delete(ctx, "products:id:1", "нет такого")
+	if _, ok, _ := c.Get(ctx, "products:id:1"); ok {
+		t.Error("products:id:1 не удалена")
+	}
+
+	c.DeletePrefix(ctx, "products:")
+	if _, ok, _ := c.Get(ctx, "products:id:2"); ok {
+		t.Error("products:id:2 не удалена по префиксу")
+	}
+	if _, ok, _ := c.Get(ctx, "categories:tree:1"); !ok {
+		t.Error("удалена запись с другим префиксом")
+	}
+}
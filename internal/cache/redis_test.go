@@ -0,0 +1,282 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respStub - сервер RESP в памяти: понимает AUTH, SELECT, GET, SET, DEL и SCAN.
+// SCAN отдаёт по одному ключу за страницу, чтобы проверить проход по курсору.
+type respStub struct {
+	mu       sync.Mutex
+	values   map[string]string
+	ttls     map[string]string // Аргумент PX последнего SET
+	scan     []string          // Ключи, найденные SCAN с нулевым курсором
+	commands [][]string
+	conns    int
+}
+
+func newRESPStub(t *testing.T) (*respStub, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &respStub{values: map[string]string{}, ttls: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s, listener.Addr().String()
+}
+
+func (s *respStub) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, s.handle(args)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func (s *respStub) handle(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, args)
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "SET":
+		s.values[args[1]] = args[2]
+		delete(s.ttls, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			s.ttls[args[1]] = args[4]
+		}
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				delete(s.values, key)
+				deleted++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "SCAN":
+		// Как и Redis, SCAN возвращает ключи, существовавшие на начало прохода,
+		// даже если между страницами их удаляют
+		cursor, _ := strconv.Atoi(args[1])
+		if cursor == 0 {
+			s.scan = nil
+			for key := range s.values {
+				if ok, _ := path.Match(args[3], key); ok {
+					s.scan = append(s.scan, key)
+				}
+			}
+			sort.Strings(s.scan)
+		}
+		matched := s.scan
+		if cursor >= len(matched) {
+			return "*2\r\n" + bulk("0") + "*0\r\n"
+		}
+		next := strconv.Itoa(cursor + 1)
+		if cursor+1 >= len(matched) {
+			next = "0"
+		}
+		return "*2\r\n" + bulk(next) + "*1\r\n" + bulk(matched[cursor])
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func (s *respStub) ttl(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ttl, ok := s.ttls[key]
+	return ttl, ok
+}
+
+func (s *respStub) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *respStub) countCommands(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, args := range s.commands {
+		if strings.EqualFold(args[0], name) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	stub, addr := newRESPStub(t)
+	c := NewRedisCache(addr, "secret", 2, time.Second)
+	defer c.Close()
+
+	if _, ok, err := c.Get(ctx, "products:id:1"); ok || err != nil {
+		t.Fatalf("Get() отсутствующего ключа = %v, %v", ok, err)
+	}
+
+	if err := c.Set(ctx, "products:id:1", []byte("{\"id\":1}\r\n"), 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	value, ok, err := c.Get(ctx, "products:id:1")
+	if err != nil || !ok || string(value) != "{\"id\":1}\r\n" {
+		t.Fatalf("Get() = %q, %v, %v", value, ok, err)
+	}
+	if ttl, _ := stub.ttl("products:id:1"); ttl != "1500" {
+		t.Errorf("PX = %q, want 1500", ttl)
+	}
+
+	if err := c.Set(ctx, "categories:tree:1", []byte("[]"), 0); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if _, ok := stub.ttl("categories:tree:1"); ok {
+		t.Error("SET без срока жизни передал PX")
+	}
+
+	// Соединение переиспользуется: AUTH и SELECT выполняются один раз
+	if stub.connections() != 1 || stub.countCommands("AUTH") != 1 || stub.countCommands("SELECT") != 1 {
+		t.Errorf("соединений = %d, AUTH = %d, SELECT = %d, want по одному", stub.connections(), stub.countCommands("AUTH"), stub.countCommands("SELECT"))
+	}
+}
+
+func TestRedisCacheDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	stub, addr := newRESPStub(t)
+	c := NewRedisCache(addr, "", 0, time.Second)
+	defer c.Close()
+
+	for _, key := range []string{"products:id:1", "products:id:2", "products:category:3:true", "products*:x", "categories:tree:1"} {
+		if err := c.Set(ctx, key, []byte("x"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.DeletePrefix(ctx, "products:"); err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	for _, key := range []string{"products:id:1", "products:id:2", "products:category:3:true"} {
+		if _, ok, _ := c.Get(ctx, key); ok {
+			t.Errorf("%s не удалён", key)
+		}
+	}
+	for _, key := range []string{"products*:x", "categories:tree:1"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("%s удалён, хотя не подходит под префикс", key)
+		}
+	}
+	if stub.countCommands("SCAN") < 3 {
+		t.Errorf("SCAN вызван %d раз, want проход по всем страницам", stub.countCommands("SCAN"))
+	}
+
+	// Спецсимволы шаблона в префиксе сравниваются буквально
+	if err := c.DeletePrefix(ctx, "products*"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, "products*:x"); ok {
+		t.Error("products*:x не удалён")
+	}
+	if _, ok, _ := c.Get(ctx, "categories:tree:1"); !ok {
+		t.Error("categories:tree:1 удалён")
+	}
+}
+
+func TestRedisCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	_, addr := newRESPStub(t)
+
+	c := NewRedisCache(addr, "wrong", 0, time.Second)
+	defer c.Close()
+	var replyErr redisError
+	if _, _, err := c.Get(ctx, "key"); !errors.As(err, &replyErr) {
+		t.Errorf("Get() с неверным паролем error = %v, want ответ сервера", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+	unavailable := NewRedisCache(closedAddr, "", 0, time.Second)
+	if _, _, err := unavailable.Get(ctx, "key"); err == nil {
+		t.Error("Get() у недоступного сервера без ошибки")
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/Dmitriy4565/VapeShop/internal/utils"
+)
+
+type CatalogImportController struct {
+	importService services.CatalogImportService
+}
+
+func NewCatalogImportController(importService services.CatalogImportService) *CatalogImportController {
+	return &CatalogImportController{
+		importService: importService,
+	}
+}
+
+// ImportProductsHandler принимает multipart/form-data: файл в поле "file" и необязательное
+// сопоставление столбцов JSON-объектом в поле "mapping", например {"sku": "Артикул", "price": "Цена"}.
+// С параметром ?dry_run=true изменения не сохраняются, возвращается только отчёт.
+func (c *CatalogImportController) ImportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Файл не передан", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	opts := services.ImportOptions{
+		Format: tableFormat(r.FormValue("format"), header.Filename),
+		DryRun: r.URL.Query().Get("dry_run") == "true",
+	}
+	if storeID := r.FormValue("store_id"); storeID != "" {
+		if opts.StoreID, err = strconv.ParseInt(storeID, 10, 64); err != nil {
+			http.Error(w, "Некорректный ID магазина", http.StatusBadRequest)
+			return
+		}
+	}
+	if mapping := r.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			http.Error(w, "Некорректное сопоставление столбцов: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := c.importService.ImportProducts(r.Context(), file, opts)
+	if err != nil {
+		http.Error(w, err.Error(), importErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+// ExportProductsHandler отдаёт каталог файлом; формат задаётся параметром ?format=csv|xlsx
+func (c *CatalogImportController) ExportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = utils.FormatCSV
+	}
+
+	var contentType string
+	switch format {
+	case utils.FormatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case utils.FormatXLSX:
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		http.Error(w, utils.ErrUnsupportedFormat.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := services.ExportFilter{
+		Query:          query.Get("q"),
+		IncludeDeleted: query.Get("include_deleted") == "true",
+	}
+	var err error
+	for name, id := range map[string]*int64{"category_id": &filter.CategoryID, "manufacturer_id": &filter.ManufacturerID, "store_id": &filter.StoreID} {
+		if *id, err = optionalQueryID(r, name); err != nil {
+			http.Error(w, "Некорректный параметр "+name, http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="products.`+format+`"`)
+
+	// Ошибку после начала выгрузки уже не сообщить статусом: клиент получит оборванный файл
+	if err := c.importService.ExportProducts(r.Context(), w, format, filter); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// tableFormat определяет формат загружаемого файла: явно заданный или по расширению
+func tableFormat(format, filename string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+}
+
+func importErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrUnsupportedFormat), errors.Is(err, services.ErrImportEmpty), errors.Is(err, services.ErrImportColumns):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,18 +2,20 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/categoryService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type CategoryController struct {
-	categoryService *categoryService.CategoryService
+	categoryService services.CategoryService
 	validate        *validator.Validate
 }
 
-func NewCategoryController(categoryService *categoryService.CategoryService) *CategoryController {
+func NewCategoryController(categoryService services.CategoryService) *CategoryController {
 	return &CategoryController{
 		categoryService: categoryService,
 		validate:        validator.New(),
@@ -21,17 +23,34 @@ func NewCategoryController(categoryService *categoryService.CategoryService) *Ca
 }
 
 func (c *CategoryController) GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
-	categories, err := c.categoryService.GetAllCategories()
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	categories, err := c.categoryService.GetAllCategories(r.Context(), includeDeleted)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(categories)
+	writeCacheableJSON(w, r, categories, time.Time{})
+}
+
+func (c *CategoryController) GetCategoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	storeID, err := queryID(r, "store_id")
+	if err != nil {
+		http.Error(w, "ID магазина не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	tree, err := c.categoryService.GetCategoryTree(r.Context(), storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCacheableJSON(w, r, tree, time.Time{})
 }
 
 func (c *CategoryController) CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	var category categoryService.Category
+	var category services.Category
 	err := json.NewDecoder(r.Body).Decode(&category)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -44,9 +63,9 @@ func (c *CategoryController) CreateCategoryHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	newCategory, err := c.categoryService.CreateCategory(category)
+	newCategory, err := c.categoryService.CreateCategory(r.Context(), category)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), categoryErrorStatus(err))
 		return
 	}
 
@@ -54,7 +73,7 @@ func (c *CategoryController) CreateCategoryHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *CategoryController) UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	var category categoryService.Category
+	var category services.Category
 	err := json.NewDecoder(r.Body).Decode(&category)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -67,9 +86,32 @@ func (c *CategoryController) UpdateCategoryHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = c.categoryService.UpdateCategory(category)
+	err = c.categoryService.UpdateCategory(r.Context(), category)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), categoryErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *CategoryController) MoveCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var move services.CategoryMove
+	err := json.NewDecoder(r.Body).Decode(&move)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(move)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.categoryService.MoveCategory(r.Context(), move)
+	if err != nil {
+		http.Error(w, err.Error(), categoryErrorStatus(err))
 		return
 	}
 
@@ -77,17 +119,46 @@ func (c *CategoryController) UpdateCategoryHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *CategoryController) DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID категории не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID категории не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.categoryService.DeleteCategory(id)
+	err = c.categoryService.DeleteCategory(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), categoryErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (c *CategoryController) RestoreCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID категории не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.categoryService.RestoreCategory(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), categoryErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCategoryCycle), errors.Is(err, services.ErrCategoryStore):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCategorySlug):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteCacheableJSON(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 30, 15, 500_000_000, time.UTC)
+	value := map[string]any{"id": 7, "name": "Испаритель"}
+
+	first := httptest.NewRecorder()
+	writeCacheableJSON(first, httptest.NewRequest(http.MethodGet, "/products", nil), value, modified)
+	if first.Code != http.StatusOK || first.Body.Len() == 0 {
+		t.Fatalf("первый ответ = %d, тело %q", first.Code, first.Body)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" || first.Header().Get("Cache-Control") != "no-cache" || first.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("заголовки = %v", first.Header())
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Sun, 01 Mar 2026 12:30:15 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"тот же ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"слабый ETag в списке", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"любой ETag", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"другой ETag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"ETag важнее даты", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Sun, 01 Mar 2026 12:30:15 GMT"}, http.StatusOK},
+		{"не изменялось с той же секунды", map[string]string{"If-Modified-Since": "Sun, 01 Mar 2026 12:30:15 GMT"}, http.StatusNotModified},
+		{"изменилось позже", map[string]string{"If-Modified-Since": "Sun, 01 Mar 2026 12:30:14 GMT"}, http.StatusOK},
+		{"некорректная дата", map[string]string{"If-Modified-Since": "вчера"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/products", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			writeCacheableJSON(w, r, value, modified)
+
+			if w.Code != tt.want {
+				t.Fatalf("статус = %d, want %d", w.Code, tt.want)
+			}
+			if w.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), etag)
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("у ответа 304 есть тело: %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestWriteCacheableJSONWithoutLastModified(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/categories", nil)
+	r.Header.Set("If-Modified-Since", "Sun, 01 Mar 2026 12:30:15 GMT")
+	w := httptest.NewRecorder()
+	writeCacheableJSON(w, r, []int{1, 2}, time.Time{})
+
+	if w.Code != http.StatusOK {
+		t.Errorf("статус = %d, want 200: без даты изменения If-Modified-Since не учитывается", w.Code)
+	}
+	if w.Header().Get("Last-Modified") != "" {
+		t.Errorf("Last-Modified = %q, want пусто", w.Header().Get("Last-Modified"))
+	}
+
+	other := httptest.NewRecorder()
+	writeCacheableJSON(other, httptest.NewRequest(http.MethodGet, "/categories", nil), []int{1, 3}, time.Time{})
+	if other.Header().Get("ETag") == w.Header().Get("ETag") {
+		t.Error("ETag не зависит от содержимого")
+	}
+}
@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/customerService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type CustomerController struct {
-	customerService *customerService.CustomerService
+	customerService services.CustomerService
 	validate        *validator.Validate
 }
 
-func NewCustomerController(customerService *customerService.CustomerService) *CustomerController {
+func NewCustomerController(customerService services.CustomerService) *CustomerController {
 	return &CustomerController{
 		customerService: customerService,
 		validate:        validator.New(),
@@ -21,7 +22,8 @@ func NewCustomerController(customerService *customerService.CustomerService) *Cu
 }
 
 func (c *CustomerController) GetCustomersHandler(w http.ResponseWriter, r *http.Request) {
-	customers, err := c.customerService.GetAllCustomers()
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	customers, err := c.customerService.GetAllCustomers(r.Context(), includeDeleted)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -31,15 +33,15 @@ func (c *CustomerController) GetCustomersHandler(w http.ResponseWriter, r *http.
 }
 
 func (c *CustomerController) GetCustomerByIDHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID клиента не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID клиента не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	customer, err := c.customerService.GetCustomerByID(id)
+	customer, err := c.customerService.GetCustomerByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), customerErrorStatus(err))
 		return
 	}
 
@@ -47,7 +49,7 @@ func (c *CustomerController) GetCustomerByIDHandler(w http.ResponseWriter, r *ht
 }
 
 func (c *CustomerController) CreateCustomerHandler(w http.ResponseWriter, r *http.Request) {
-	var customer customerService.Customer
+	var customer services.Customer
 	err := json.NewDecoder(r.Body).Decode(&customer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -60,7 +62,7 @@ func (c *CustomerController) CreateCustomerHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	newCustomer, err := c.customerService.CreateCustomer(customer)
+	newCustomer, err := c.customerService.CreateCustomer(r.Context(), customer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -70,7 +72,7 @@ func (c *CustomerController) CreateCustomerHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *CustomerController) UpdateCustomerHandler(w http.ResponseWriter, r *http.Request) {
-	var customer customerService.Customer
+	var customer services.Customer
 	err := json.NewDecoder(r.Body).Decode(&customer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,9 +85,9 @@ func (c *CustomerController) UpdateCustomerHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = c.customerService.UpdateCustomer(customer)
+	err = c.customerService.UpdateCustomer(r.Context(), customer)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), customerErrorStatus(err))
 		return
 	}
 
@@ -93,17 +95,40 @@ func (c *CustomerController) UpdateCustomerHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *CustomerController) DeleteCustomerHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID клиента не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID клиента не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.customerService.DeleteCustomer(id)
+	err = c.customerService.DeleteCustomer(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), customerErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (c *CustomerController) RestoreCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID клиента не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.customerService.RestoreCustomer(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), customerErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func customerErrorStatus(err error) int {
+	if errors.Is(err, services.ErrCustomerNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/deliveryService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type DeliveryController struct {
-	deliveryService *deliveryService.DeliveryService
+	deliveryService services.DeliveryService
 	validate        *validator.Validate
 }
 
-func NewDeliveryController(deliveryService *deliveryService.DeliveryService) *DeliveryController {
+func NewDeliveryController(deliveryService services.DeliveryService) *DeliveryController {
 	return &DeliveryController{
 		deliveryService: deliveryService,
 		validate:        validator.New(),
@@ -21,7 +22,7 @@ func NewDeliveryController(deliveryService *deliveryService.DeliveryService) *De
 }
 
 func (c *DeliveryController) GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
-	deliveries, err := c.deliveryService.GetAllDeliveries()
+	deliveries, err := c.deliveryService.GetAllDeliveries(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -31,15 +32,15 @@ func (c *DeliveryController) GetDeliveriesHandler(w http.ResponseWriter, r *http
 }
 
 func (c *DeliveryController) GetDeliveryByIDHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID доставки не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID доставки не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	delivery, err := c.deliveryService.GetDeliveryByID(id)
+	delivery, err := c.deliveryService.GetDeliveryByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), deliveryErrorStatus(err))
 		return
 	}
 
@@ -47,7 +48,7 @@ func (c *DeliveryController) GetDeliveryByIDHandler(w http.ResponseWriter, r *ht
 }
 
 func (c *DeliveryController) CreateDeliveryHandler(w http.ResponseWriter, r *http.Request) {
-	var delivery deliveryService.Delivery
+	var delivery services.Delivery
 	err := json.NewDecoder(r.Body).Decode(&delivery)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -60,7 +61,7 @@ func (c *DeliveryController) CreateDeliveryHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	newDelivery, err := c.deliveryService.CreateDelivery(delivery)
+	newDelivery, err := c.deliveryService.CreateDelivery(r.Context(), delivery)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -70,7 +71,7 @@ func (c *DeliveryController) CreateDeliveryHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *DeliveryController) UpdateDeliveryHandler(w http.ResponseWriter, r *http.Request) {
-	var delivery deliveryService.Delivery
+	var delivery services.Delivery
 	err := json.NewDecoder(r.Body).Decode(&delivery)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,9 +84,32 @@ func (c *DeliveryController) UpdateDeliveryHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = c.deliveryService.UpdateDelivery(delivery)
+	err = c.deliveryService.UpdateDelivery(r.Context(), delivery)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), deliveryErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *DeliveryController) UpdateDeliveryStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var update services.DeliveryStatusUpdate
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(update)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.deliveryService.UpdateDeliveryStatus(r.Context(), update)
+	if err != nil {
+		http.Error(w, err.Error(), deliveryErrorStatus(err))
 		return
 	}
 
@@ -93,17 +117,24 @@ func (c *DeliveryController) UpdateDeliveryHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *DeliveryController) DeleteDeliveryHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID доставки не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID доставки не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.deliveryService.DeleteDelivery(id)
+	err = c.deliveryService.DeleteDelivery(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), deliveryErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func deliveryErrorStatus(err error) int {
+	if errors.Is(err, services.ErrDeliveryNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
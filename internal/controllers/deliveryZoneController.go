@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type DeliveryZoneController struct {
+	deliveryZoneService services.DeliveryZoneService
+	validate            *validator.Validate
+}
+
+func NewDeliveryZoneController(deliveryZoneService services.DeliveryZoneService) *DeliveryZoneController {
+	return &DeliveryZoneController{
+		deliveryZoneService: deliveryZoneService,
+		validate:            validator.New(),
+	}
+}
+
+func (c *DeliveryZoneController) GetZonesHandler(w http.ResponseWriter, r *http.Request) {
+	storeID, err := queryID(r, "store_id")
+	if err != nil {
+		http.Error(w, "ID магазина не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	zones, err := c.deliveryZoneService.GetZonesByStore(r.Context(), storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(zones)
+}
+
+func (c *DeliveryZoneController) CreateZoneHandler(w http.ResponseWriter, r *http.Request) {
+	var zone services.DeliveryZone
+	err := json.NewDecoder(r.Body).Decode(&zone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(zone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newZone, err := c.deliveryZoneService.CreateZone(r.Context(), zone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newZone)
+}
+
+func (c *DeliveryZoneController) DeleteZoneHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID зоны доставки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.deliveryZoneService.DeleteZone(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *DeliveryZoneController) GetMethodsHandler(w http.ResponseWriter, r *http.Request) {
+	methods, err := c.deliveryZoneService.GetAllMethods(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(methods)
+}
+
+func (c *DeliveryZoneController) CreateMethodHandler(w http.ResponseWriter, r *http.Request) {
+	var method services.DeliveryMethod
+	err := json.NewDecoder(r.Body).Decode(&method)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(method)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newMethod, err := c.deliveryZoneService.CreateMethod(r.Context(), method)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newMethod)
+}
+
+func (c *DeliveryZoneController) GetRatesHandler(w http.ResponseWriter, r *http.Request) {
+	zoneID, err := queryID(r, "zone_id")
+	if err != nil {
+		http.Error(w, "ID зоны доставки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	rates, err := c.deliveryZoneService.GetRatesByZone(r.Context(), zoneID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rates)
+}
+
+func (c *DeliveryZoneController) CreateRateHandler(w http.ResponseWriter, r *http.Request) {
+	var rate services.DeliveryRate
+	err := json.NewDecoder(r.Body).Decode(&rate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(rate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newRate, err := c.deliveryZoneService.CreateRate(r.Context(), rate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newRate)
+}
+
+func (c *DeliveryZoneController) DeleteRateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID тарифа не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.deliveryZoneService.DeleteRate(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *DeliveryZoneController) QuoteHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.QuoteRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	quote, err := c.deliveryZoneService.Quote(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), quoteErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(quote)
+}
+
+func quoteErrorStatus(err error) int {
+	if errors.Is(err, services.ErrProductNotFound) || errors.Is(err, services.ErrStoreNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
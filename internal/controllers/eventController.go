@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+)
+
+type EventController struct {
+	eventDispatcher services.EventDispatcher
+}
+
+func NewEventController(eventDispatcher services.EventDispatcher) *EventController {
+	return &EventController{
+		eventDispatcher: eventDispatcher,
+	}
+}
+
+func (c *EventController) GetFailedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	failed, err := c.eventDispatcher.GetFailedDeliveries(r.Context(), r.URL.Query().Get("subscriber"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(failed)
+}
+
+func (c *EventController) RetryDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	subscriber := r.URL.Query().Get("subscriber")
+	eventID, err := queryID(r, "event_id")
+	if subscriber == "" || err != nil {
+		http.Error(w, "Подписчик или ID события не указан", http.StatusBadRequest)
+		return
+	}
+
+	err = c.eventDispatcher.RetryDelivery(r.Context(), subscriber, eventID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrEventDeliveryNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Database - то, что нужно проверкам здоровья от базы данных; реализуется *db.DB
+type Database interface {
+	PingContext(ctx context.Context) error
+	PoolStats() db.PoolStats
+}
+
+type HealthController struct {
+	db           Database
+	readyTimeout time.Duration // Сколько ждать ответа БД в /readyz
+}
+
+func NewHealthController(db Database, readyTimeout time.Duration) *HealthController {
+	return &HealthController{
+		db:           db,
+		readyTimeout: readyTimeout,
+	}
+}
+
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthzHandler - проверка живости: процесс запущен и обрабатывает запросы. Зависимости
+// не проверяются, чтобы недоступность БД не приводила к перезапуску сервиса.
+func (c *HealthController) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(healthStatus{Status: "ok"})
+}
+
+// ReadyzHandler - проверка готовности: база данных отвечает за readyTimeout.
+// При недоступности БД возвращает 503, и балансировщик перестаёт слать запросы.
+func (c *HealthController) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), c.readyTimeout)
+	defer cancel()
+
+	if err := c.db.PingContext(ctx); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(healthStatus{Status: "unavailable", Error: err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(healthStatus{Status: "ok"})
+}
+
+// GetPoolStatsHandler отдаёт состояние пула соединений с БД
+func (c *HealthController) GetPoolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(c.db.PoolStats())
+}
@@ -2,18 +2,20 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/manufacturerService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type ManufacturerController struct {
-	manufacturerService *manufacturerService.ManufacturerService
+	manufacturerService services.ManufacturerService
 	validate            *validator.Validate
 }
 
-func NewManufacturerController(manufacturerService *manufacturerService.ManufacturerService) *ManufacturerController {
+func NewManufacturerController(manufacturerService services.ManufacturerService) *ManufacturerController {
 	return &ManufacturerController{
 		manufacturerService: manufacturerService,
 		validate:            validator.New(),
@@ -21,33 +23,50 @@ func NewManufacturerController(manufacturerService *manufacturerService.Manufact
 }
 
 func (c *ManufacturerController) GetManufacturersHandler(w http.ResponseWriter, r *http.Request) {
-	manufacturers, err := c.manufacturerService.GetAllManufacturers()
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	manufacturers, err := c.manufacturerService.GetAllManufacturers(r.Context(), includeDeleted)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(manufacturers)
+	writeCacheableJSON(w, r, manufacturers, time.Time{})
 }
 
 func (c *ManufacturerController) GetManufacturerByIDHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID производителя не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID производителя не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	manufacturer, err := c.manufacturerService.GetManufacturerByID(id)
+	manufacturer, err := c.manufacturerService.GetManufacturerByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), manufacturerErrorStatus(err))
 		return
 	}
 
-	json.NewEncoder(w).Encode(manufacturer)
+	writeCacheableJSON(w, r, manufacturer, manufacturer.UpdatedAt)
+}
+
+func (c *ManufacturerController) GetManufacturerSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID производителя не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	summary, err := c.manufacturerService.GetManufacturerSummary(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), manufacturerErrorStatus(err))
+		return
+	}
+
+	writeCacheableJSON(w, r, summary, time.Time{})
 }
 
 func (c *ManufacturerController) CreateManufacturerHandler(w http.ResponseWriter, r *http.Request) {
-	var manufacturer manufacturerService.Manufacturer
+	var manufacturer services.Manufacturer
 	err := json.NewDecoder(r.Body).Decode(&manufacturer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -60,7 +79,7 @@ func (c *ManufacturerController) CreateManufacturerHandler(w http.ResponseWriter
 		return
 	}
 
-	newManufacturer, err := c.manufacturerService.CreateManufacturer(manufacturer)
+	newManufacturer, err := c.manufacturerService.CreateManufacturer(r.Context(), manufacturer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -70,7 +89,7 @@ func (c *ManufacturerController) CreateManufacturerHandler(w http.ResponseWriter
 }
 
 func (c *ManufacturerController) UpdateManufacturerHandler(w http.ResponseWriter, r *http.Request) {
-	var manufacturer manufacturerService.Manufacturer
+	var manufacturer services.Manufacturer
 	err := json.NewDecoder(r.Body).Decode(&manufacturer)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,9 +102,9 @@ func (c *ManufacturerController) UpdateManufacturerHandler(w http.ResponseWriter
 		return
 	}
 
-	err = c.manufacturerService.UpdateManufacturer(manufacturer)
+	err = c.manufacturerService.UpdateManufacturer(r.Context(), manufacturer)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), manufacturerErrorStatus(err))
 		return
 	}
 
@@ -93,17 +112,40 @@ func (c *ManufacturerController) UpdateManufacturerHandler(w http.ResponseWriter
 }
 
 func (c *ManufacturerController) DeleteManufacturerHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID производителя не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID производителя не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.manufacturerService.DeleteManufacturer(id)
+	err = c.manufacturerService.DeleteManufacturer(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), manufacturerErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (c *ManufacturerController) RestoreManufacturerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID производителя не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.manufacturerService.RestoreManufacturer(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), manufacturerErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func manufacturerErrorStatus(err error) int {
+	if errors.Is(err, services.ErrManufacturerNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+const defaultOutboxLimit = 100
+
+type NotificationController struct {
+	notificationService services.NotificationService
+	validate            *validator.Validate
+}
+
+func NewNotificationController(notificationService services.NotificationService) *NotificationController {
+	return &NotificationController{
+		notificationService: notificationService,
+		validate:            validator.New(),
+	}
+}
+
+func (c *NotificationController) GetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	customerID, err := queryID(r, "customer_id")
+	if err != nil {
+		http.Error(w, "ID покупателя не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := c.notificationService.GetPreferences(r.Context(), customerID)
+	if err != nil {
+		http.Error(w, err.Error(), notificationErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(prefs)
+}
+
+func (c *NotificationController) SetPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var prefs services.NotificationPreferences
+	err := json.NewDecoder(r.Body).Decode(&prefs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(prefs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := c.notificationService.SetPreferences(r.Context(), prefs)
+	if err != nil {
+		http.Error(w, err.Error(), notificationErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (c *NotificationController) GetOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultOutboxLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	messages, err := c.notificationService.GetOutbox(r.Context(), r.URL.Query().Get("status"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
+
+func (c *NotificationController) RetryMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID уведомления не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.notificationService.RetryMessage(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), notificationErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func notificationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCustomerNotFound), errors.Is(err, services.ErrNotificationNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
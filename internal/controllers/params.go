@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// queryID читает числовой ID из параметра запроса name
+func queryID(r *http.Request, name string) (int64, error) {
+	return strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+}
+
+// optionalQueryID - queryID для необязательных фильтров: без параметра возвращает 0
+func optionalQueryID(r *http.Request, name string) (int64, error) {
+	if r.URL.Query().Get(name) == "" {
+		return 0, nil
+	}
+	return queryID(r, name)
+}
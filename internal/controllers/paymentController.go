@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/payments"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type PaymentController struct {
+	paymentService services.PaymentService
+	validate       *validator.Validate
+}
+
+func NewPaymentController(paymentService services.PaymentService) *PaymentController {
+	return &PaymentController{
+		paymentService: paymentService,
+		validate:       validator.New(),
+	}
+}
+
+func (c *PaymentController) CreatePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var payment services.Payment
+	err := json.NewDecoder(r.Body).Decode(&payment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(payment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newPayment, err := c.paymentService.CreatePayment(r.Context(), payment.PurchaseID)
+	if err != nil {
+		http.Error(w, err.Error(), paymentErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newPayment)
+}
+
+func (c *PaymentController) GetPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := optionalQueryID(r, "id")
+	if err != nil {
+		http.Error(w, "Некорректный ID платежа", http.StatusBadRequest)
+		return
+	}
+	if id != 0 {
+		payment, err := c.paymentService.GetPaymentByID(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), paymentErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(payment)
+		return
+	}
+
+	purchaseID, err := queryID(r, "purchase_id")
+	if err != nil {
+		http.Error(w, "ID платежа или покупки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	list, err := c.paymentService.GetPaymentsByPurchase(r.Context(), purchaseID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func (c *PaymentController) CaptureHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID платежа не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := c.paymentService.CapturePayment(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), paymentErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (c *PaymentController) RefundHandler(w http.ResponseWriter, r *http.Request) {
+	var refund services.PaymentRefund
+	err := json.NewDecoder(r.Body).Decode(&refund)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(refund)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newRefund, err := c.paymentService.RefundPayment(r.Context(), refund)
+	if err != nil {
+		http.Error(w, err.Error(), paymentErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newRefund)
+}
+
+// WebhookHandler принимает уведомления провайдера. Подпись считается по сырому телу запроса.
+func (c *PaymentController) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.paymentService.HandleWebhook(r.Context(), payload, r.Header.Get("X-Signature"))
+	if err != nil {
+		http.Error(w, err.Error(), paymentErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func paymentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPaymentNotFound), errors.Is(err, services.ErrPurchaseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPaymentInvalidState), errors.Is(err, services.ErrRefundExceedsCapture), errors.Is(err, services.ErrPurchaseAlreadyPaid), errors.Is(err, services.ErrPurchaseChanged):
+		return http.StatusConflict
+	case errors.Is(err, payments.ErrInvalidSignature):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type PickupController struct {
+	pickupService services.PickupService
+	validate      *validator.Validate
+}
+
+func NewPickupController(pickupService services.PickupService) *PickupController {
+	return &PickupController{
+		pickupService: pickupService,
+		validate:      validator.New(),
+	}
+}
+
+func (c *PickupController) CreatePickupOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var order services.PickupOrder
+	err := json.NewDecoder(r.Body).Decode(&order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newOrder, err := c.pickupService.CreatePickupOrder(r.Context(), order)
+	if err != nil {
+		http.Error(w, err.Error(), pickupErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newOrder)
+}
+
+func (c *PickupController) GetPickupOrderHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Код получения не указан", http.StatusBadRequest)
+		return
+	}
+
+	order, err := c.pickupService.GetPickupOrderByCode(r.Context(), code)
+	if err != nil {
+		http.Error(w, err.Error(), pickupErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (c *PickupController) CollectHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.CollectRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := c.pickupService.MarkCollected(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), pickupErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (c *PickupController) CancelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID заказа не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.pickupService.CancelPickupOrder(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), pickupErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func pickupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPickupNotFound), errors.Is(err, services.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPickupNotReserved), errors.Is(err, services.ErrInsufficientStock):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrAgeNotVerified):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -2,18 +2,20 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/productService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type ProductController struct {
-	productService *productService.ProductService
+	productService services.ProductService
 	validate       *validator.Validate
 }
 
-func NewProductController(productService *productService.ProductService) *ProductController {
+func NewProductController(productService services.ProductService) *ProductController {
 	return &ProductController{
 		productService: productService,
 		validate:       validator.New(),
@@ -21,33 +23,51 @@ func NewProductController(productService *productService.ProductService) *Produc
 }
 
 func (c *ProductController) GetProductsHandler(w http.ResponseWriter, r *http.Request) {
-	products, err := c.productService.GetAllProducts()
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	products, err := c.productService.GetAllProducts(r.Context(), includeDeleted)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(products)
+	writeCacheableJSON(w, r, products, time.Time{})
 }
 
 func (c *ProductController) GetProductByIDHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID продукта не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	product, err := c.productService.GetProductByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), productErrorStatus(err))
+		return
+	}
+
+	writeCacheableJSON(w, r, product, product.UpdatedAt)
+}
+
+func (c *ProductController) GetProductsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := queryID(r, "category_id")
+	if err != nil {
+		http.Error(w, "ID категории не указан или некорректен", http.StatusBadRequest)
 		return
 	}
+	includeDescendants := r.URL.Query().Get("include_descendants") != "false"
 
-	product, err := c.productService.GetProductByID(id)
+	products, err := c.productService.GetProductsByCategory(r.Context(), categoryID, includeDescendants)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(product)
+	writeCacheableJSON(w, r, products, time.Time{})
 }
 
 func (c *ProductController) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
-	var product productService.Product
+	var product services.Product
 	err := json.NewDecoder(r.Body).Decode(&product)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -60,7 +80,7 @@ func (c *ProductController) CreateProductHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	newProduct, err := c.productService.CreateProduct(product)
+	newProduct, err := c.productService.CreateProduct(r.Context(), product)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -70,7 +90,7 @@ func (c *ProductController) CreateProductHandler(w http.ResponseWriter, r *http.
 }
 
 func (c *ProductController) UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
-	var product productService.Product
+	var product services.Product
 	err := json.NewDecoder(r.Body).Decode(&product)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,9 +103,9 @@ func (c *ProductController) UpdateProductHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = c.productService.UpdateProduct(product)
+	err = c.productService.UpdateProduct(r.Context(), product)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), productErrorStatus(err))
 		return
 	}
 
@@ -93,17 +113,40 @@ func (c *ProductController) UpdateProductHandler(w http.ResponseWriter, r *http.
 }
 
 func (c *ProductController) DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID продукта не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.productService.DeleteProduct(id)
+	err = c.productService.DeleteProduct(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), productErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (c *ProductController) RestoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.productService.RestoreProduct(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), productErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func productErrorStatus(err error) int {
+	if errors.Is(err, services.ErrProductNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
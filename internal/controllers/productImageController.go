@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+const maxUploadMemory = 32 << 20
+
+type ProductImageController struct {
+	imageService services.ProductImageService
+	validate     *validator.Validate
+}
+
+func NewProductImageController(imageService services.ProductImageService) *ProductImageController {
+	return &ProductImageController{
+		imageService: imageService,
+		validate:     validator.New(),
+	}
+}
+
+func (c *ProductImageController) GetImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := queryID(r, "product_id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	images, err := c.imageService.GetImagesByProduct(r.Context(), productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(images)
+}
+
+// UploadImagesHandler принимает multipart/form-data с одним или несколькими файлами в поле "files"
+func (c *ProductImageController) UploadImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := queryID(r, "product_id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		http.Error(w, "Файлы не переданы", http.StatusBadRequest)
+		return
+	}
+
+	var images []services.ProductImage
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		image, err := c.imageService.UploadImage(r.Context(), productID, file)
+		file.Close()
+		if err != nil {
+			http.Error(w, header.Filename+": "+err.Error(), imageErrorStatus(err))
+			return
+		}
+		images = append(images, *image)
+	}
+
+	json.NewEncoder(w).Encode(images)
+}
+
+func (c *ProductImageController) ReorderImagesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProductID int64   `json:"productId" validate:"required"`
+		ImageIDs  []int64 `json:"imageIds" validate:"required,min=1"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.imageService.ReorderImages(r.Context(), req.ProductID, req.ImageIDs)
+	if err != nil {
+		http.Error(w, err.Error(), imageErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *ProductImageController) DeleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID изображения не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.imageService.DeleteImage(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), imageErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func imageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrImageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrImageUnsupported):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
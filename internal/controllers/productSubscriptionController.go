@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type ProductSubscriptionController struct {
+	subscriptionService services.ProductSubscriptionService
+	validate            *validator.Validate
+}
+
+func NewProductSubscriptionController(subscriptionService services.ProductSubscriptionService) *ProductSubscriptionController {
+	return &ProductSubscriptionController{
+		subscriptionService: subscriptionService,
+		validate:            validator.New(),
+	}
+}
+
+func (c *ProductSubscriptionController) GetSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	customerID, err := queryID(r, "customer_id")
+	if err != nil {
+		http.Error(w, "ID покупателя не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	includeFired := r.URL.Query().Get("include_fired") == "true"
+	subscriptions, err := c.subscriptionService.GetCustomerSubscriptions(r.Context(), customerID, includeFired)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func (c *ProductSubscriptionController) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var sub services.ProductSubscription
+	err := json.NewDecoder(r.Body).Decode(&sub)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(sub)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newSub, err := c.subscriptionService.Subscribe(r.Context(), sub)
+	if err != nil {
+		http.Error(w, err.Error(), subscriptionErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newSub)
+}
+
+func (c *ProductSubscriptionController) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID подписки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+	customerID, err := queryID(r, "customer_id")
+	if err != nil {
+		http.Error(w, "ID покупателя не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.subscriptionService.Unsubscribe(r.Context(), id, customerID)
+	if err != nil {
+		http.Error(w, err.Error(), subscriptionErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func subscriptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSubscriptionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSubscriptionTarget):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSubscriptionSatisfied):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type ProductVariantController struct {
+	variantService services.ProductVariantService
+	validate       *validator.Validate
+}
+
+func NewProductVariantController(variantService services.ProductVariantService) *ProductVariantController {
+	return &ProductVariantController{
+		variantService: variantService,
+		validate:       validator.New(),
+	}
+}
+
+func (c *ProductVariantController) GetProductPageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	page, err := c.variantService.GetProductPage(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+func (c *ProductVariantController) GetVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	if sku := r.URL.Query().Get("sku"); sku != "" {
+		variant, err := c.variantService.GetVariantBySKU(r.Context(), sku)
+		if err != nil {
+			http.Error(w, err.Error(), variantErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(variant)
+		return
+	}
+
+	productID, err := queryID(r, "product_id")
+	if err != nil {
+		http.Error(w, "ID продукта или артикул не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	variants, err := c.variantService.GetVariantsByProduct(r.Context(), productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(variants)
+}
+
+func (c *ProductVariantController) CreateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	var variant services.ProductVariant
+	err := json.NewDecoder(r.Body).Decode(&variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newVariant, err := c.variantService.CreateVariant(r.Context(), variant)
+	if err != nil {
+		http.Error(w, err.Error(), variantErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newVariant)
+}
+
+func (c *ProductVariantController) UpdateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	var variant services.ProductVariant
+	err := json.NewDecoder(r.Body).Decode(&variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(variant)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.variantService.UpdateVariant(r.Context(), variant)
+	if err != nil {
+		http.Error(w, err.Error(), variantErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *ProductVariantController) SetVariantStockHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID    int64 `json:"id" validate:"required"`
+		Stock int   `json:"stock" validate:"min=0"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.variantService.SetVariantStock(r.Context(), req.ID, req.Stock)
+	if err != nil {
+		http.Error(w, err.Error(), variantErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *ProductVariantController) DeleteVariantHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID варианта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.variantService.DeleteVariant(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func variantErrorStatus(err error) int {
+	if errors.Is(err, services.ErrVariantNotFound) || errors.Is(err, services.ErrProductNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/purchaseService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type PurchaseController struct {
-	purchaseService *purchaseService.PurchaseService
+	purchaseService services.PurchaseService
 	validate        *validator.Validate
 }
 
-func NewPurchaseController(purchaseService *purchaseService.PurchaseService) *PurchaseController {
+func NewPurchaseController(purchaseService services.PurchaseService) *PurchaseController {
 	return &PurchaseController{
 		purchaseService: purchaseService,
 		validate:        validator.New(),
@@ -21,7 +22,7 @@ func NewPurchaseController(purchaseService *purchaseService.PurchaseService) *Pu
 }
 
 func (c *PurchaseController) GetPurchasesHandler(w http.ResponseWriter, r *http.Request) {
-	purchases, err := c.purchaseService.GetAllPurchases()
+	purchases, err := c.purchaseService.GetAllPurchases(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -31,15 +32,15 @@ func (c *PurchaseController) GetPurchasesHandler(w http.ResponseWriter, r *http.
 }
 
 func (c *PurchaseController) GetPurchaseByIDHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID покупки не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID покупки не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	purchase, err := c.purchaseService.GetPurchaseByID(id)
+	purchase, err := c.purchaseService.GetPurchaseByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), purchaseErrorStatus(err))
 		return
 	}
 
@@ -47,7 +48,7 @@ func (c *PurchaseController) GetPurchaseByIDHandler(w http.ResponseWriter, r *ht
 }
 
 func (c *PurchaseController) CreatePurchaseHandler(w http.ResponseWriter, r *http.Request) {
-	var purchase purchaseService.Purchase
+	var purchase services.Purchase
 	err := json.NewDecoder(r.Body).Decode(&purchase)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -60,9 +61,9 @@ func (c *PurchaseController) CreatePurchaseHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	newPurchase, err := c.purchaseService.CreatePurchase(purchase)
+	newPurchase, err := c.purchaseService.CreatePurchase(r.Context(), purchase)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), purchaseErrorStatus(err))
 		return
 	}
 
@@ -70,7 +71,7 @@ func (c *PurchaseController) CreatePurchaseHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *PurchaseController) UpdatePurchaseHandler(w http.ResponseWriter, r *http.Request) {
-	var purchase purchaseService.Purchase
+	var purchase services.Purchase
 	err := json.NewDecoder(r.Body).Decode(&purchase)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,9 +84,9 @@ func (c *PurchaseController) UpdatePurchaseHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	err = c.purchaseService.UpdatePurchase(purchase)
+	err = c.purchaseService.UpdatePurchase(r.Context(), purchase)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), purchaseErrorStatus(err))
 		return
 	}
 
@@ -93,17 +94,27 @@ func (c *PurchaseController) UpdatePurchaseHandler(w http.ResponseWriter, r *htt
 }
 
 func (c *PurchaseController) DeletePurchaseHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID покупки не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID покупки не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.purchaseService.DeletePurchase(id)
+	err = c.purchaseService.DeletePurchase(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), purchaseErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func purchaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPurchaseNotFound), errors.Is(err, services.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPurchaseEmpty):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type ReorderController struct {
+	reorderService services.ReorderService
+	validate       *validator.Validate
+}
+
+func NewReorderController(reorderService services.ReorderService) *ReorderController {
+	return &ReorderController{
+		reorderService: reorderService,
+		validate:       validator.New(),
+	}
+}
+
+func (c *ReorderController) GetReorderLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := optionalQueryID(r, "product_id")
+	if err != nil {
+		http.Error(w, "Некорректный ID товара", http.StatusBadRequest)
+		return
+	}
+	storeID, err := optionalQueryID(r, "store_id")
+	if err != nil {
+		http.Error(w, "Некорректный ID магазина", http.StatusBadRequest)
+		return
+	}
+
+	levels, err := c.reorderService.GetReorderLevels(r.Context(), productID, storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(levels)
+}
+
+func (c *ReorderController) SetReorderLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var level services.ReorderLevel
+	err := json.NewDecoder(r.Body).Decode(&level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := c.reorderService.SetReorderLevel(r.Context(), level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(saved)
+}
+
+func (c *ReorderController) DeleteReorderLevelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID уровня дозаказа не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.reorderService.DeleteReorderLevel(r.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrReorderLevelNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *ReorderController) GetReorderSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	storeID, err := optionalQueryID(r, "store_id")
+	if err != nil {
+		http.Error(w, "Некорректный ID магазина", http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := c.reorderService.GetReorderSuggestions(r.Context(), storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(suggestions)
+}
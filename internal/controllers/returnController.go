@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type ReturnController struct {
+	returnService services.ReturnService
+	validate      *validator.Validate
+}
+
+func NewReturnController(returnService services.ReturnService) *ReturnController {
+	return &ReturnController{
+		returnService: returnService,
+		validate:      validator.New(),
+	}
+}
+
+func (c *ReturnController) CreateReturnHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.ReturnRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newReturn, err := c.returnService.CreateReturn(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), returnErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newReturn)
+}
+
+func (c *ReturnController) GetReturnsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := optionalQueryID(r, "id")
+	if err != nil {
+		http.Error(w, "Некорректный ID заявки", http.StatusBadRequest)
+		return
+	}
+	if id != 0 {
+		req, err := c.returnService.GetReturnByID(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), returnErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(req)
+		return
+	}
+
+	purchaseID, err := queryID(r, "purchase_id")
+	if err != nil {
+		http.Error(w, "ID заявки или покупки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	list, err := c.returnService.GetReturnsByPurchase(r.Context(), purchaseID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+func (c *ReturnController) ApproveReturnHandler(w http.ResponseWriter, r *http.Request) {
+	c.decide(w, r, c.returnService.ApproveReturn)
+}
+
+func (c *ReturnController) RejectReturnHandler(w http.ResponseWriter, r *http.Request) {
+	c.decide(w, r, c.returnService.RejectReturn)
+}
+
+func (c *ReturnController) decide(w http.ResponseWriter, r *http.Request, apply func(ctx context.Context, decision services.ReturnDecision) (*services.ReturnRequest, error)) {
+	var decision services.ReturnDecision
+	err := json.NewDecoder(r.Body).Decode(&decision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(decision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := apply(r.Context(), decision)
+	if err != nil {
+		http.Error(w, err.Error(), returnErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(req)
+}
+
+func (c *ReturnController) RetryRefundHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID заявки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	req, err := c.returnService.ProcessRefund(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), returnErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(req)
+}
+
+func (c *ReturnController) GetPurchaseHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	purchaseID, err := queryID(r, "purchase_id")
+	if err != nil {
+		http.Error(w, "ID покупки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	history, err := c.returnService.GetPurchaseHistory(r.Context(), purchaseID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(history)
+}
+
+func returnErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrReturnNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrReturnQuantity):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrReturnInvalidState), errors.Is(err, services.ErrNoRefundablePayment):
+		return http.StatusConflict
+	default:
+		return paymentErrorStatus(err)
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type StockController struct {
+	stockService services.StockService
+	validate     *validator.Validate
+}
+
+func NewStockController(stockService services.StockService) *StockController {
+	return &StockController{
+		stockService: stockService,
+		validate:     validator.New(),
+	}
+}
+
+// GetMovementsHandler возвращает журнал движений с фильтрами ?store_id, ?product_id, ?kind и ?limit
+func (c *StockController) GetMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := services.StockMovementFilter{Kind: query.Get("kind")}
+	var err error
+	if filter.StoreID, err = optionalQueryID(r, "store_id"); err != nil {
+		http.Error(w, "Некорректный store_id", http.StatusBadRequest)
+		return
+	}
+	if filter.ProductID, err = optionalQueryID(r, "product_id"); err != nil {
+		http.Error(w, "Некорректный product_id", http.StatusBadRequest)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	movements, err := c.stockService.GetMovements(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(movements)
+}
+
+func (c *StockController) TransferStockHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.TransferRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.stockService.TransferStock(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), stockErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *StockController) WriteOffHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.WriteOffRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	movement, err := c.stockService.WriteOff(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), stockErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(movement)
+}
+
+func (c *StockController) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	storeID, err := optionalQueryID(r, "store_id")
+	if err != nil {
+		http.Error(w, "Некорректный store_id", http.StatusBadRequest)
+		return
+	}
+
+	mismatches, err := c.stockService.Reconcile(r.Context(), storeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(mismatches)
+}
+
+func stockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSameStore):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInsufficientStock):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
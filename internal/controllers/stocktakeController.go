@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type StocktakeController struct {
+	stocktakeService services.StocktakeService
+	validate         *validator.Validate
+}
+
+func NewStocktakeController(stocktakeService services.StocktakeService) *StocktakeController {
+	return &StocktakeController{
+		stocktakeService: stocktakeService,
+		validate:         validator.New(),
+	}
+}
+
+func (c *StocktakeController) StartStocktakeHandler(w http.ResponseWriter, r *http.Request) {
+	var stocktake services.Stocktake
+	err := json.NewDecoder(r.Body).Decode(&stocktake)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(stocktake)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newStocktake, err := c.stocktakeService.StartStocktake(r.Context(), stocktake)
+	if err != nil {
+		http.Error(w, err.Error(), stocktakeErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(newStocktake)
+}
+
+func (c *StocktakeController) GetStocktakeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID инвентаризации не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	stocktake, err := c.stocktakeService.GetStocktake(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), stocktakeErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(stocktake)
+}
+
+func (c *StocktakeController) SubmitCountsHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.StocktakeCountsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.stocktakeService.SubmitCounts(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), stocktakeErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *StocktakeController) GetVarianceReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID инвентаризации не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	report, err := c.stocktakeService.GetVarianceReport(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), stocktakeErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func (c *StocktakeController) CompleteStocktakeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		StocktakeID int64  `json:"stocktakeId" validate:"required"`
+		StaffName   string `json:"staffName" validate:"required"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := c.stocktakeService.CompleteStocktake(r.Context(), req.StocktakeID, req.StaffName)
+	if err != nil {
+		http.Error(w, err.Error(), stocktakeErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+func (c *StocktakeController) CancelStocktakeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID инвентаризации не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.stocktakeService.CancelStocktake(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), stocktakeErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func stocktakeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrStocktakeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrStocktakeNoCounts):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrStocktakeNotOpen), errors.Is(err, services.ErrStocktakeAlreadyOpen), errors.Is(err, services.ErrStocktakeBelowReserved):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
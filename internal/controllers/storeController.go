@@ -2,18 +2,19 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/Dmitriy4565/VapeShop/internal/services/storeService"
+	"github.com/Dmitriy4565/VapeShop/internal/services"
 	"github.com/go-playground/validator/v10"
 )
 
 type StoreController struct {
-	storeService *storeService.StoreService
+	storeService services.StoreService
 	validate     *validator.Validate
 }
 
-func NewStoreController(storeService *storeService.StoreService) *StoreController {
+func NewStoreController(storeService services.StoreService) *StoreController {
 	return &StoreController{
 		storeService: storeService,
 		validate:     validator.New(),
@@ -21,7 +22,8 @@ func NewStoreController(storeService *storeService.StoreService) *StoreControlle
 }
 
 func (c *StoreController) GetStoresHandler(w http.ResponseWriter, r *http.Request) {
-	stores, err := c.storeService.GetAllStores()
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	stores, err := c.storeService.GetAllStores(r.Context(), includeDeleted)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -31,15 +33,15 @@ func (c *StoreController) GetStoresHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (c *StoreController) GetStoreByIDHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID магазина не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID магазина не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	store, err := c.storeService.GetStoreByID(id)
+	store, err := c.storeService.GetStoreByID(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), storeErrorStatus(err))
 		return
 	}
 
@@ -47,7 +49,7 @@ func (c *StoreController) GetStoreByIDHandler(w http.ResponseWriter, r *http.Req
 }
 
 func (c *StoreController) CreateStoreHandler(w http.ResponseWriter, r *http.Request) {
-	var store storeService.Store
+	var store services.Store
 	err := json.NewDecoder(r.Body).Decode(&store)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -60,7 +62,7 @@ func (c *StoreController) CreateStoreHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	newStore, err := c.storeService.CreateStore(store)
+	newStore, err := c.storeService.CreateStore(r.Context(), store)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -70,7 +72,7 @@ func (c *StoreController) CreateStoreHandler(w http.ResponseWriter, r *http.Requ
 }
 
 func (c *StoreController) UpdateStoreHandler(w http.ResponseWriter, r *http.Request) {
-	var store storeService.Store
+	var store services.Store
 	err := json.NewDecoder(r.Body).Decode(&store)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -83,9 +85,9 @@ func (c *StoreController) UpdateStoreHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = c.storeService.UpdateStore(store)
+	err = c.storeService.UpdateStore(r.Context(), store)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), storeErrorStatus(err))
 		return
 	}
 
@@ -93,17 +95,40 @@ func (c *StoreController) UpdateStoreHandler(w http.ResponseWriter, r *http.Requ
 }
 
 func (c *StoreController) DeleteStoreHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Query().Get("id")
-	if id == "" {
-		http.Error(w, "ID магазина не указан", http.StatusBadRequest)
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID магазина не указан или некорректен", http.StatusBadRequest)
 		return
 	}
 
-	err := c.storeService.DeleteStore(id)
+	err = c.storeService.DeleteStore(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), storeErrorStatus(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (c *StoreController) RestoreStoreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID магазина не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.storeService.RestoreStore(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), storeErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func storeErrorStatus(err error) int {
+	if errors.Is(err, services.ErrStoreNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
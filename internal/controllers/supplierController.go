@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type SupplierController struct {
+	supplierService services.SupplierService
+	validate        *validator.Validate
+}
+
+func NewSupplierController(supplierService services.SupplierService) *SupplierController {
+	return &SupplierController{
+		supplierService: supplierService,
+		validate:        validator.New(),
+	}
+}
+
+func (c *SupplierController) GetSuppliersHandler(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := c.supplierService.GetAllSuppliers(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+func (c *SupplierController) GetSupplierByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID поставщика не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	supplier, err := c.supplierService.GetSupplierByID(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), supplierErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(supplier)
+}
+
+func (c *SupplierController) CreateSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	var supplier services.Supplier
+	err := json.NewDecoder(r.Body).Decode(&supplier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(supplier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newSupplier, err := c.supplierService.CreateSupplier(r.Context(), supplier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newSupplier)
+}
+
+func (c *SupplierController) UpdateSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	var supplier services.Supplier
+	err := json.NewDecoder(r.Body).Decode(&supplier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(supplier)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.supplierService.UpdateSupplier(r.Context(), supplier)
+	if err != nil {
+		http.Error(w, err.Error(), supplierErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *SupplierController) DeleteSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID поставщика не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.supplierService.DeleteSupplier(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), supplierErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func supplierErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSupplierNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSupplierInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
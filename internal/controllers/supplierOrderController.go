@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+type SupplierOrderController struct {
+	orderService services.SupplierOrderService
+	validate     *validator.Validate
+}
+
+func NewSupplierOrderController(orderService services.SupplierOrderService) *SupplierOrderController {
+	return &SupplierOrderController{
+		orderService: orderService,
+		validate:     validator.New(),
+	}
+}
+
+// GetSupplierOrdersHandler возвращает заказ по ?id или список с фильтрами ?supplier_id и ?status
+func (c *SupplierOrderController) GetSupplierOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := optionalQueryID(r, "id")
+	if err != nil {
+		http.Error(w, "Некорректный ID заказа", http.StatusBadRequest)
+		return
+	}
+	if id != 0 {
+		order, err := c.orderService.GetSupplierOrderByID(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), supplierOrderErrorStatus(err))
+			return
+		}
+		json.NewEncoder(w).Encode(order)
+		return
+	}
+
+	supplierID, err := optionalQueryID(r, "supplier_id")
+	if err != nil {
+		http.Error(w, "Некорректный supplier_id", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := c.orderService.GetSupplierOrders(r.Context(), supplierID, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(orders)
+}
+
+func (c *SupplierOrderController) CreateSupplierOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var order services.SupplierOrder
+	err := json.NewDecoder(r.Body).Decode(&order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newOrder, err := c.orderService.CreateSupplierOrder(r.Context(), order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newOrder)
+}
+
+func (c *SupplierOrderController) SubmitSupplierOrderHandler(w http.ResponseWriter, r *http.Request) {
+	c.changeStatus(w, r, c.orderService.SubmitSupplierOrder)
+}
+
+func (c *SupplierOrderController) CancelSupplierOrderHandler(w http.ResponseWriter, r *http.Request) {
+	c.changeStatus(w, r, c.orderService.CancelSupplierOrder)
+}
+
+func (c *SupplierOrderController) CloseSupplierOrderHandler(w http.ResponseWriter, r *http.Request) {
+	c.changeStatus(w, r, c.orderService.CloseSupplierOrder)
+}
+
+func (c *SupplierOrderController) changeStatus(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, id int64) error) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID заказа не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = action(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), supplierOrderErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *SupplierOrderController) ReceiveGoodsHandler(w http.ResponseWriter, r *http.Request) {
+	var req services.GoodsReceiptRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	receipt, err := c.orderService.ReceiveGoods(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), supplierOrderErrorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(receipt)
+}
+
+func (c *SupplierOrderController) GetProductMarginHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID продукта не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	margin, err := c.orderService.GetProductMargin(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(margin)
+}
+
+func supplierOrderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSupplierOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSupplierOrderItemNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSupplierOrderStatus):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
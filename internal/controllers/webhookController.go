@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/go-playground/validator/v10"
+)
+
+const defaultWebhookDeliveriesLimit = 100
+
+type WebhookController struct {
+	webhookService services.WebhookService
+	validate       *validator.Validate
+}
+
+func NewWebhookController(webhookService services.WebhookService) *WebhookController {
+	return &WebhookController{
+		webhookService: webhookService,
+		validate:       validator.New(),
+	}
+}
+
+func (c *WebhookController) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := c.webhookService.GetWebhooks(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+func (c *WebhookController) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var webhook services.Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.validate.Struct(webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	newWebhook, err := c.webhookService.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(newWebhook)
+}
+
+func (c *WebhookController) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var webhook services.Webhook
+	err := json.NewDecoder(r.Body).Decode(&webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if webhook.ID == 0 {
+		http.Error(w, "ID вебхука не указан", http.StatusBadRequest)
+		return
+	}
+	err = c.validate.Struct(webhook)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.webhookService.UpdateWebhook(r.Context(), webhook)
+	if err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *WebhookController) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID вебхука не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.webhookService.DeleteWebhook(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *WebhookController) GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := optionalQueryID(r, "webhook_id")
+	if err != nil {
+		http.Error(w, "Некорректный ID вебхука", http.StatusBadRequest)
+		return
+	}
+
+	filter := services.WebhookDeliveryFilter{
+		WebhookID: webhookID,
+		Status:    r.URL.Query().Get("status"),
+		Limit:     defaultWebhookDeliveriesLimit,
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	deliveries, err := c.webhookService.GetDeliveries(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (c *WebhookController) GetDeliveryAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := queryID(r, "delivery_id")
+	if err != nil {
+		http.Error(w, "ID доставки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	attempts, err := c.webhookService.GetDeliveryAttempts(r.Context(), deliveryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(attempts)
+}
+
+func (c *WebhookController) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := queryID(r, "id")
+	if err != nil {
+		http.Error(w, "ID доставки не указан или некорректен", http.StatusBadRequest)
+		return
+	}
+
+	err = c.webhookService.Redeliver(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), webhookErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrWebhookDeliveryNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
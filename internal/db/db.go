@@ -1,29 +1,171 @@
 package db
 
 import (
- "database/sql"
- "fmt"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+	"time"
 
- _ "github.com/lib/pq" // Драйвер PostgreSQL
+	"github.com/lib/pq" // Драйвер PostgreSQL
 )
 
+// DB - пул соединений с основным сервером и, если настроены, с репликами для чтения
 type DB struct {
- *sql.DB
+	*sql.DB
+	replicas []*replica
+	next     atomic.Uint64 // Счётчик для выбора реплики по кругу
 }
 
-func NewDB(dbURL string) (*DB, error) {
- db, err := sql.Open("postgres", dbURL)
- if err != nil {
-  return nil, fmt.Errorf("error opening database connection: %w", err)
- }
+// PoolConfig - настройки пула соединений и ожидания базы данных при запуске
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnectTimeout  time.Duration // Сколько ждать, пока база данных станет доступна
 
- if err := db.Ping(); err != nil {
-  return nil, fmt.Errorf("error pinging database: %w", err)
- }
+	SlowQueryThreshold time.Duration                           // Запросы дольше порога пишутся в лог
+	ObserveQuery       func(op string, duration time.Duration) // Получает время каждого запроса ("query" или "exec"), если задан
+}
+
+// Задержка между попытками подключения при запуске: удваивается от минимальной до максимальной
+const (
+	connectRetryMinDelay = 500 * time.Millisecond
+	connectRetryMaxDelay = 10 * time.Second
+)
+
+// NewDB открывает пул соединений с основным сервером и ждёт, пока он ответит на ping. Пока
+// PostgreSQL поднимается (например, при одновременном запуске контейнеров), попытки
+// повторяются с растущей задержкой в пределах pool.ConnectTimeout.
+//
+// Для каждой реплики из replicaURLs открывается отдельный пул с теми же настройками.
+// Недоступная при запуске реплика не мешает старту: она исключена из чтения, пока её
+// не вернёт MonitorReplicas.
+func NewDB(ctx context.Context, dbURL string, replicaURLs []string, pool PoolConfig) (*DB, error) {
+	primary, err := openPool(dbURL, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := waitForDB(ctx, primary, pool.ConnectTimeout); err != nil {
+		primary.Close()
+		return nil, fmt.Errorf("error pinging database: %w", err)
+	}
+
+	db := &DB{DB: primary}
+	for _, replicaURL := range replicaURLs {
+		r, err := openReplica(ctx, replicaURL, pool)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica %s: %w", redactURL(replicaURL), err)
+		}
+		db.replicas = append(db.replicas, r)
+	}
+
+	return db, nil
+}
+
+func openPool(dbURL string, pool PoolConfig) (*sql.DB, error) {
+	connector, err := pq.NewConnector(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %w", err)
+	}
+	db := sql.OpenDB(slowQueryConnector{Connector: connector, threshold: pool.SlowQueryThreshold, observe: pool.ObserveQuery})
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	return db, nil
+}
 
- return &DB{db}, nil
+// redactURL скрывает пароль в строке подключения для логов
+func redactURL(dbURL string) string {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return "(некорректный URL)"
+	}
+	return u.Redacted()
+}
+
+func waitForDB(ctx context.Context, db *sql.DB, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := connectRetryMinDelay
+	for {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("база данных недоступна, повтор", "delay", delay.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > connectRetryMaxDelay {
+			delay = connectRetryMaxDelay
+		}
+	}
 }
 
 func (db *DB) Close() error {
- return db.DB.Close()
+	for _, r := range db.replicas {
+		r.db.Close()
+	}
+	return db.DB.Close()
+}
+
+// PoolStats - состояние пула соединений для мониторинга
+type PoolStats struct {
+	MaxOpenConnections int            `json:"maxOpenConnections"`
+	OpenConnections    int            `json:"openConnections"`
+	InUse              int            `json:"inUse"`
+	Idle               int            `json:"idle"`
+	WaitCount          int64          `json:"waitCount"`      // Сколько раз запрос ждал свободного соединения
+	WaitDurationMs     int64          `json:"waitDurationMs"` // Суммарное время ожидания
+	MaxIdleClosed      int64          `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64          `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64          `json:"maxLifetimeClosed"`
+	Replicas           []ReplicaStats `json:"replicas,omitempty"`
+}
+
+// ReplicaStats - состояние пула соединений с репликой
+type ReplicaStats struct {
+	URL             string `json:"url"` // Без пароля
+	Healthy         bool   `json:"healthy"`
+	OpenConnections int    `json:"openConnections"`
+	InUse           int    `json:"inUse"`
+	WaitCount       int64  `json:"waitCount"`
+}
+
+func (db *DB) PoolStats() PoolStats {
+	stats := db.Stats()
+	result := PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+	for _, r := range db.replicas {
+		replicaStats := r.db.Stats()
+		result.Replicas = append(result.Replicas, ReplicaStats{
+			URL:             redactURL(r.url),
+			Healthy:         r.healthy.Load(),
+			OpenConnections: replicaStats.OpenConnections,
+			InUse:           replicaStats.InUse,
+			WaitCount:       replicaStats.WaitCount,
+		})
+	}
+	return result
 }
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// replicaPingTimeout - сколько ждать ответа реплики при проверке здоровья
+const replicaPingTimeout = 2 * time.Second
+
+// replica - пул соединений с репликой и признак того, что она отвечает
+type replica struct {
+	url     string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+func openReplica(ctx context.Context, url string, pool PoolConfig) (*replica, error) {
+	conn, err := openPool(url, pool)
+	if err != nil {
+		return nil, err
+	}
+	r := &replica{url: url, db: conn}
+	r.check(ctx)
+	return r, nil
+}
+
+// check пингует реплику и обновляет признак здоровья; смена состояния пишется в лог
+func (r *replica) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+
+	err := r.db.PingContext(ctx)
+	if err != nil {
+		if r.healthy.Swap(false) {
+			slog.Warn("реплика исключена из чтения", "replica", redactURL(r.url), "error", err)
+		}
+		return
+	}
+	if !r.healthy.Swap(true) {
+		slog.Info("реплика доступна для чтения", "replica", redactURL(r.url))
+	}
+}
+
+// eject исключает реплику из чтения после ошибки соединения; вернёт её следующая
+// успешная проверка в MonitorReplicas
+func (r *replica) eject(err error) {
+	if r.healthy.Swap(false) {
+		slog.Warn("реплика исключена из чтения", "replica", redactURL(r.url), "error", err)
+	}
+}
+
+// MonitorReplicas периодически проверяет реплики: неотвечающие исключаются из чтения,
+// восстановившиеся возвращаются. Работает до отмены ctx.
+func (db *DB) MonitorReplicas(ctx context.Context, interval time.Duration) {
+	if len(db.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, r := range db.replicas {
+				r.check(ctx)
+			}
+		}
+	}
+}
+
+// Reader возвращает Querier для запросов только на чтение. Каждый запрос уходит на
+// следующую здоровую реплику по кругу; если реплик нет, ни одна не отвечает или в
+// рамках запроса уже была запись (см. WithSession), - на основной сервер.
+func (db *DB) Reader() Querier {
+	return readQuerier{db}
+}
+
+// pick выбирает пул для чтения
+func (db *DB) pick(ctx context.Context) (*sql.DB, *replica) {
+	if len(db.replicas) == 0 || primaryPinned(ctx) {
+		return db.DB, nil
+	}
+
+	start := db.next.Add(1)
+	for i := range db.replicas {
+		r := db.replicas[(start+uint64(i))%uint64(len(db.replicas))]
+		if r.healthy.Load() {
+			return r.db, r
+		}
+	}
+	return db.DB, nil
+}
+
+type readQuerier struct {
+	db *DB
+}
+
+// ExecContext изменяет данные, поэтому всегда выполняется на основном сервере
+func (q readQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return q.db.ExecContext(ctx, query, args...)
+}
+
+func (q readQuerier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	conn, r := q.db.pick(ctx)
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if r != nil && isConnError(err) {
+		r.eject(err)
+		return q.db.DB.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+// QueryRowContext откладывает ошибку до Scan, но ошибка соединения видна сразу через Row.Err:
+// тогда реплика исключается, а запрос повторяется на основном сервере
+func (q readQuerier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	conn, r := q.db.pick(ctx)
+	row := conn.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); r != nil && isConnError(err) {
+		r.eject(err)
+		return q.db.DB.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// isConnError отличает недоступность сервера от ошибок самого запроса
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+// Закрепление чтения за основным сервером. Middleware кладёт в контекст запроса сессию;
+// любое обращение к основному пулу (запись, транзакция) отмечает её, и дальнейшие чтения
+// этого запроса идут на основной сервер, чтобы не увидеть устаревшие данные реплики.
+type sessionKey struct{}
+
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession возвращает контекст с сессией для закрепления чтения после записи
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// PinPrimary направляет все дальнейшие чтения в рамках сессии на основной сервер
+func PinPrimary(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+func primaryPinned(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
+
+// Запросы через основной пул закрепляют сессию за ним: это запись или чтение,
+// которому нужны самые свежие данные
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	PinPrimary(ctx)
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	PinPrimary(ctx)
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	PinPrimary(ctx)
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	PinPrimary(ctx)
+	return db.DB.BeginTx(ctx, opts)
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// slowQueryConnector оборачивает соединения драйвера, пишет в лог запросы дольше порога
+// и передаёт время каждого запроса в observe (если задан). Так учитываются все запросы:
+// через репозитории, транзакции и *sql.DB в сервисах. Значения параметров не логируются -
+// в них бывают персональные данные.
+type slowQueryConnector struct {
+	driver.Connector
+	threshold time.Duration
+	observe   func(op string, duration time.Duration)
+}
+
+func (c slowQueryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryConn{Conn: conn, threshold: c.threshold, observe: c.observe}, nil
+}
+
+// slowQueryConn передаёт вызовы соединению драйвера, замеряя время QueryContext и
+// ExecContext. Для запросов время считается до получения первых строк.
+type slowQueryConn struct {
+	driver.Conn
+	threshold time.Duration
+	observe   func(op string, duration time.Duration)
+}
+
+func (c *slowQueryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.record(ctx, "query", start, query, len(args))
+	return rows, err
+}
+
+func (c *slowQueryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.record(ctx, "exec", start, query, len(args))
+	return result, err
+}
+
+func (c *slowQueryConn) record(ctx context.Context, op string, start time.Time, query string, args int) {
+	duration := time.Since(start)
+	if c.observe != nil {
+		c.observe(op, duration)
+	}
+	if duration < c.threshold {
+		return
+	}
+	slog.WarnContext(ctx, "медленный SQL-запрос",
+		"duration_ms", duration.Milliseconds(),
+		"query", strings.Join(strings.Fields(query), " "),
+		"args", args)
+}
+
+// Остальные необязательные интерфейсы драйвера передаются как есть, чтобы обёртка
+// не меняла поведение пула (проверку соединений, сброс сессии, транзакции с опциями)
+
+func (c *slowQueryConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *slowQueryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *slowQueryConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *slowQueryConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *slowQueryConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Querier - общие методы *sql.DB и *sql.Tx. Репозитории работают через него,
+// поэтому одни и те же запросы выполняются и на пуле соединений, и в транзакции.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// UnitOfWork выполняет изменения нескольких репозиториев в одной транзакции
+type UnitOfWork interface {
+	WithTx(ctx context.Context, fn func(tx Querier) error) error
+}
+
+// Conn - база данных для сервисов, которые пишут SQL сами, без репозиториев: запросы
+// вне транзакции и транзакции через WithTx. Реализуется *DB, поэтому каждая запись
+// закрепляет сессию за основным сервером.
+type Conn interface {
+	Querier
+	UnitOfWork
+}
+
+// WithTx открывает транзакцию и передаёт её в fn. Если fn вернула ошибку или запаниковала,
+// транзакция откатывается, иначе фиксируется.
+func (db *DB) WithTx(ctx context.Context, fn func(tx Querier) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Setup делает slog логгером по умолчанию. level - debug, info, warn или error
+// (неизвестное значение - info), format - json или text. Вывод стандартного пакета log
+// тоже идёт через этот логгер с уровнем info.
+func Setup(w io.Writer, level, format string) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// requestInfo - данные запроса, которые добавляются к каждой строке лога с его контекстом
+type requestInfo struct {
+	id        string
+	principal atomic.Pointer[string] // Заполняется после аутентификации, поэтому меняется на ходу
+}
+
+type requestKey struct{}
+
+// WithRequest кладёт в контекст ID запроса; строки лога с этим контекстом получат request_id
+func WithRequest(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestKey{}, &requestInfo{id: requestID})
+}
+
+// RequestID возвращает ID запроса из контекста или пустую строку
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// SetPrincipal запоминает, от чьего имени выполняется запрос (например, "customer:42");
+// дальнейшие строки лога этого запроса получат поле principal. Вызывается кодом
+// аутентификации, когда он установил пользователя.
+func SetPrincipal(ctx context.Context, principal string) {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		info.principal.Store(&principal)
+	}
+}
+
+// contextHandler добавляет к записи request_id и principal из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info, ok := ctx.Value(requestKey{}).(*requestInfo); ok {
+		record.AddAttrs(slog.String("request_id", info.id))
+		if principal := info.principal.Load(); principal != nil {
+			record.AddAttrs(slog.String("principal", *principal))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
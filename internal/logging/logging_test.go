@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"3f2c9a1b-7d4e", true},
+		{"req_42", true},
+		{strings.Repeat("a", 128), true},
+		{"", false},
+		{strings.Repeat("a", 129), false},
+		{"id with spaces", false},
+		{"id\nrequest_id=forged", false},
+		{`id"}`, false},
+		{"идентификатор", false},
+	}
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.want {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+// captureLog перенаправляет логгер по умолчанию в буфер на время теста
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var buf bytes.Buffer
+	Setup(&buf, "debug", "json")
+	return &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("строка лога %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestSetPrincipal(t *testing.T) {
+	buf := captureLog(t)
+
+	ctx := WithRequest(context.Background(), "req-1")
+	slog.InfoContext(ctx, "до входа")
+	SetPrincipal(ctx, "customer:42")
+	slog.InfoContext(ctx, "после входа")
+	// Без сессии запроса SetPrincipal ничего не делает
+	SetPrincipal(context.Background(), "customer:7")
+	slog.Info("вне запроса")
+
+	lines := logLines(t, buf)
+	if len(lines) != 3 {
+		t.Fatalf("строк = %d, want 3", len(lines))
+	}
+	if lines[0]["request_id"] != "req-1" || lines[0]["principal"] != nil {
+		t.Errorf("до входа: %v", lines[0])
+	}
+	if lines[1]["request_id"] != "req-1" || lines[1]["principal"] != "customer:42" {
+		t.Errorf("после входа: %v", lines[1])
+	}
+	if lines[2]["request_id"] != nil || lines[2]["principal"] != nil {
+		t.Errorf("вне запроса: %v", lines[2])
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool
+	}{
+		{"присланный ID", "client-id_1", true},
+		{"ID с переводом строки заменяется", "bad\nid", false},
+		{"без ID", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+			router := gin.New()
+			router.Use(Middleware())
+			router.GET("/metrics", func(c *gin.Context) {
+				SetPrincipal(c.Request.Context(), "metrics")
+				c.String(http.StatusInternalServerError, "база недоступна")
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.requestID != "" {
+				r.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			got := w.Header().Get(RequestIDHeader)
+			if tt.wantSame && got != tt.requestID {
+				t.Errorf("X-Request-ID = %q, want %q", got, tt.requestID)
+			}
+			if !tt.wantSame && (got == tt.requestID || !validRequestID(got)) {
+				t.Errorf("X-Request-ID = %q, want новый ID", got)
+			}
+
+			lines := logLines(t, buf)
+			entry := lines[len(lines)-1]
+			if entry["request_id"] != got || entry["principal"] != "metrics" || entry["level"] != "ERROR" {
+				t.Errorf("строка запроса = %v", entry)
+			}
+			if entry["status"] != float64(http.StatusInternalServerError) || entry["error"] != "база недоступна" {
+				t.Errorf("строка запроса = %v", entry)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLogsRecoveredPanic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := captureLog(t)
+
+	// Порядок как в main.go: Recovery после Middleware, иначе паника не попадёт в лог запроса
+	router := gin.New()
+	router.Use(Middleware(), gin.Recovery())
+	router.GET("/panic", func(c *gin.Context) {
+		panic("сбой обработчика")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	lines := logLines(t, buf)
+	entry := lines[len(lines)-1]
+	if entry["request_id"] != w.Header().Get(RequestIDHeader) || entry["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("строка запроса = %v", entry)
+	}
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Сколько байт текста ошибки 5xx попадает в лог
+const errorBodyLimit = 512
+
+// Middleware присваивает запросу ID (или берёт присланный в X-Request-ID, если он похож на
+// ID), возвращает его в ответе, кладёт в контекст запроса для логов контроллеров и сервисов
+// и по завершении пишет строку о запросе. Для ответов 5xx в строку попадает текст ошибки,
+// который обработчик отдал клиенту.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := WithRequest(c.Request.Context(), requestID)
+		c.Request = c.Request.WithContext(ctx)
+		writer := &errorCapture{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+			attrs = append(attrs, "error", strings.TrimSpace(writer.body.String()))
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		slog.Log(ctx, level, "HTTP-запрос", attrs...)
+	}
+}
+
+// errorCapture запоминает начало тела ответов с ошибкой сервера
+type errorCapture struct {
+	gin.ResponseWriter
+	body strings.Builder
+}
+
+func (w *errorCapture) Write(data []byte) (int, error) {
+	w.capture(string(data))
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorCapture) WriteString(s string) (int, error) {
+	w.capture(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *errorCapture) capture(s string) {
+	if w.Status() < http.StatusInternalServerError || w.body.Len() >= errorBodyLimit {
+		return
+	}
+	if rest := errorBodyLimit - w.body.Len(); len(s) > rest {
+		s = s[:rest]
+	}
+	w.body.WriteString(s)
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID пропускает только короткие ID из букв, цифр, '-' и '_', чтобы присланный
+// клиентом заголовок не мог подделать строки лога
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
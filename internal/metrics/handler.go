@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler отдаёт все метрики в текстовом формате Prometheus 0.0.4
+func (r *Registry) Handler(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	onCollect := append([]func(){}, r.onCollect...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, fn := range onCollect {
+		fn()
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(out)
+	}
+	out.Flush()
+}
+
+func (f *family) write(out *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	out.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+
+	// Ряды выводятся в постоянном порядке, чтобы выдачу было удобно сравнивать
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != typeHistogram {
+			writeSample(out, f.name, f.labels, s.labelValues, "", "", s.value)
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			writeSample(out, f.name+"_bucket", f.labels, s.labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(out, f.name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(out, f.name+"_sum", f.labels, s.labelValues, "", "", s.sum)
+		writeSample(out, f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+// writeSample пишет строку значения; extraName/extraValue - дополнительная метка (le у корзин)
+func writeSample(out *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	out.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		out.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(label + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		out.WriteByte('}')
+	}
+	out.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
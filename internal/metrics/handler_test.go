@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.Handler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := w.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("Content-Type = %q, want %q", got, contentType)
+	}
+	return w.Body.String()
+}
+
+func TestHandlerExposition(t *testing.T) {
+	r := NewRegistry()
+	orders := r.NewCounter("orders_total", "Заказы\nпо статусу", "status")
+	temperature := r.NewGauge("temperature", `Показатель с \ в описании`)
+	latency := r.NewHistogram("latency_seconds", "Время ответа", []float64{1, 0.1}, "route")
+
+	orders.Inc("paid")
+	orders.Add(2.5, "awaiting_payment")
+	orders.Add(-1, "paid") // Счётчик не уменьшается
+	temperature.Set(-3)
+	latency.Observe(0.05, "/products")
+	latency.Observe(0.5, "/products")
+	latency.Observe(7, "/products")
+
+	want := strings.Join([]string{
+		`# HELP orders_total Заказы\nпо статусу`,
+		`# TYPE orders_total counter`,
+		`orders_total{status="awaiting_payment"} 2.5`,
+		`orders_total{status="paid"} 1`,
+		`# HELP temperature Показатель с \\ в описании`,
+		`# TYPE temperature gauge`,
+		`temperature -3`,
+		`# HELP latency_seconds Время ответа`,
+		`# TYPE latency_seconds histogram`,
+		`latency_seconds_bucket{route="/products",le="0.1"} 1`,
+		`latency_seconds_bucket{route="/products",le="1"} 2`,
+		`latency_seconds_bucket{route="/products",le="+Inf"} 3`,
+		`latency_seconds_sum{route="/products"} 7.55`,
+		`latency_seconds_count{route="/products"} 3`,
+	}, "\n") + "\n"
+
+	if got := scrape(t, r); got != want {
+		t.Errorf("выдача:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHandlerLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("replica_up", "Доступность реплики", "replica")
+	g.Set(1, "host=\"db\"\\2\nx")
+	g.Set(math.Inf(1), "inf")
+	g.Set(math.NaN(), "nan")
+
+	got := scrape(t, r)
+	for _, line := range []string{
+		`replica_up{replica="host=\"db\"\\2\nx"} 1`,
+		`replica_up{replica="inf"} +Inf`,
+		`replica_up{replica="nan"} NaN`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("нет строки %s в выдаче:\n%s", line, got)
+		}
+	}
+
+	g.Reset()
+	if got := scrape(t, r); strings.Contains(got, "replica_up{") {
+		t.Errorf("после Reset остались ряды:\n%s", got)
+	}
+}
+
+func TestHandlerOnCollect(t *testing.T) {
+	r := NewRegistry()
+	connections := r.NewGauge("pool_connections", "Открытые соединения")
+	calls := 0
+	r.OnCollect(func() {
+		calls++
+		connections.Set(float64(calls * 10))
+	})
+
+	if got := scrape(t, r); !strings.Contains(got, "pool_connections 10\n") {
+		t.Errorf("значение не обновлено перед выдачей:\n%s", got)
+	}
+	if got := scrape(t, r); !strings.Contains(got, "pool_connections 20\n") {
+		t.Errorf("значение не обновлено перед второй выдачей:\n%s", got)
+	}
+}
+
+func TestRegistryDuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("requests_total", "Запросы")
+	defer func() {
+		if recover() == nil {
+			t.Error("повторная регистрация метрики без паники")
+		}
+	}()
+	r.NewGauge("requests_total", "Запросы")
+}
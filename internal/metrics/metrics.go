@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefBuckets - границы гистограмм по умолчанию, в секундах: от 5 мс до 10 с
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Типы метрик в текстовом формате Prometheus
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry хранит метрики и отдаёт их в текстовом формате Prometheus (см. Handler).
+// Метрики регистрируются при запуске; имена и наборы меток после этого не меняются.
+type Registry struct {
+	mu        sync.Mutex
+	families  []*family
+	names     map[string]bool
+	onCollect []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// OnCollect добавляет функцию, которая вызывается перед каждой выдачей метрик. В ней
+// обновляют значения, которые удобнее снять в момент запроса (статистика пула соединений).
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onCollect = append(r.onCollect, fn)
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name] {
+		panic("metrics: метрика " + f.name + " уже зарегистрирована")
+	}
+	r.names[f.name] = true
+	r.families = append(r.families, f)
+	return f
+}
+
+// NewCounter регистрирует счётчик с перечисленными метками
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(newFamily(name, help, typeCounter, labels, nil))}
+}
+
+// NewGauge регистрирует показатель с перечисленными метками
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(newFamily(name, help, typeGauge, labels, nil))}
+}
+
+// NewHistogram регистрирует гистограмму; buckets - верхние границы корзин по возрастанию
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{r.register(newFamily(name, help, typeHistogram, labels, buckets))}
+}
+
+// family - метрика со всеми её рядами (сочетаниями значений меток)
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64  // Значение счётчика или показателя
+	counts      []uint64 // Гистограмма: число наблюдений по корзинам (не накопительное)
+	count       uint64
+	sum         float64
+}
+
+func newFamily(name, help, kind string, labels []string, buckets []float64) *family {
+	return &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+}
+
+// get возвращает ряд для значений меток, создавая его при первом обращении.
+// Вызывается под f.mu.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic("metrics: у метрики " + f.name + " другое число меток")
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter - монотонно растущий счётчик
+type Counter struct {
+	f *family
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add увеличивает счётчик на v; отрицательные значения игнорируются
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+// Set задаёт значение счётчика, который уже накапливается в другом месте
+// (например, ожидания соединений в статистике пула)
+func (c *Counter) Set(v float64, labelValues ...string) {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.get(labelValues).value = v
+}
+
+// Gauge - значение, которое может расти и уменьшаться
+type Gauge struct {
+	f *family
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.get(labelValues).value = v
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.get(labelValues).value += v
+}
+
+// Reset удаляет все ряды; нужен, когда набор значений меток меняется (например, список реплик)
+func (g *Gauge) Reset() {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+// Histogram распределяет наблюдения по корзинам
+type Histogram struct {
+	f *family
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(labelValues)
+	i := sort.SearchFloat64s(h.f.buckets, v)
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
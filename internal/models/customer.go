@@ -5,7 +5,7 @@ import (
 )
 
 type Customer struct {
-	ID        int       `json:"id"`         // Уникальный идентификатор покупателя
+	ID        int64     `json:"id"`         // Уникальный идентификатор покупателя
 	FirstName string    `json:"first_name"` // Имя покупателя
 	LastName  string    `json:"last_name"`  // Фамилия покупателя
 	Email     string    `json:"email"`      // Электронная почта покупателя
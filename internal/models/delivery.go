@@ -5,7 +5,7 @@ import (
 )
 
 type Delivery struct {
-	ID           int       `json:"id" db:"id"`
+	ID           int64     `json:"id" db:"id"`
 	DeliveryType string    `json:"delivery_type" db:"delivery_type"`
 	Price        float64   `json:"price" db:"price"`
 	Description  string    `json:"description" db:"description"`
@@ -5,7 +5,7 @@ import (
 )
 
 type Manufacturer struct {
-	ID        int       `json:"id" db:"id"`
+	ID        int64     `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	Country   string    `json:"country" db:"country"`
 	Website   string    `json:"website" db:"website"`
@@ -5,18 +5,18 @@ import (
 )
 
 type Product struct {
-	ID             int       `json:"id" db:"id"`
+	ID             int64     `json:"id" db:"id"`
 	Name           string    `json:"name" db:"name"`
 	Description    string    `json:"description" db:"description"`
 	Price          float64   `json:"price" db:"price"`
 	ImageURL       string    `json:"image_url" db:"image_url"`
-	CategoryID     int       `json:"category_id" db:"category_id"`
-	ManufacturerID int       `json:"manufacturer_id" db:"manufacturer_id"`
+	CategoryID     int64     `json:"category_id" db:"category_id"`
+	ManufacturerID int64     `json:"manufacturer_id" db:"manufacturer_id"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
-func NewProduct(name, description string, price float64, imageURL string, categoryID, manufacturerID int) *Product {
+func NewProduct(name, description string, price float64, imageURL string, categoryID, manufacturerID int64) *Product {
 	return &Product{
 		Name:           name,
 		Description:    description,
@@ -29,7 +29,7 @@ func NewProduct(name, description string, price float64, imageURL string, catego
 	}
 }
 
-func (p *Product) Update(name, description string, price float64, imageURL string, categoryID, manufacturerID int) {
+func (p *Product) Update(name, description string, price float64, imageURL string, categoryID, manufacturerID int64) {
 	p.Name = name
 	p.Description = description
 	p.Price = price
@@ -5,18 +5,18 @@ import (
 )
 
 type Purchase struct {
-	ID         int       `json:"id" db:"id"`
-	CustomerID int       `json:"customer_id" db:"customer_id"`
-	ProductID  int       `json:"product_id" db:"product_id"`
+	ID         int64     `json:"id" db:"id"`
+	CustomerID int64     `json:"customer_id" db:"customer_id"`
+	ProductID  int64     `json:"product_id" db:"product_id"`
 	Quantity   int       `json:"quantity" db:"quantity"`
 	TotalPrice float64   `json:"total_price" db:"total_price"`
-	DeliveryID int       `json:"delivery_id" db:"delivery_id"`
+	DeliveryID int64     `json:"delivery_id" db:"delivery_id"`
 	Status     string    `json:"status" db:"status"`
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
 
-func NewPurchase(customerID, productID, quantity int, totalPrice float64, deliveryID, status string) *Purchase {
+func NewPurchase(customerID, productID int64, quantity int, totalPrice float64, deliveryID int64, status string) *Purchase {
 	return &Purchase{
 		CustomerID: customerID,
 		ProductID:  productID,
@@ -29,7 +29,7 @@ func NewPurchase(customerID, productID, quantity int, totalPrice float64, delive
 	}
 }
 
-func (p *Purchase) Update(customerID, productID, quantity int, totalPrice float64, deliveryID, status string) {
+func (p *Purchase) Update(customerID, productID int64, quantity int, totalPrice float64, deliveryID int64, status string) {
 	p.CustomerID = customerID
 	p.ProductID = productID
 	p.Quantity = quantity
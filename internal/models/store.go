@@ -5,7 +5,7 @@ import (
 )
 
 type Store struct {
-	ID        int       `json:"id" db:"id"`
+	ID        int64     `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	Address   string    `json:"address" db:"address"`
 	Phone     string    `json:"phone" db:"phone"`
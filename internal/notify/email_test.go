@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"mime"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPNotifierBuildMessage(t *testing.T) {
+	n := NewSMTPNotifier("localhost", 25, "", "", "shop@example.com")
+	raw := string(n.buildMessage(Message{To: "buyer@example.com", Subject: "Заказ №42 оплачен", Body: "Спасибо за покупку!"}))
+
+	header, body, ok := strings.Cut(raw, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("нет разделителя заголовков: %q", raw)
+	}
+	for _, want := range []string{"From: shop@example.com", "To: buyer@example.com", "Content-Type: text/plain; charset=utf-8", "Content-Transfer-Encoding: quoted-printable"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("в заголовках нет %q:\n%s", want, header)
+		}
+	}
+	for _, line := range strings.Split(header, "\r\n") {
+		if subject, ok := strings.CutPrefix(line, "Subject: "); ok {
+			decoded, err := new(mime.WordDecoder).DecodeHeader(subject)
+			if err != nil || decoded != "Заказ №42 оплачен" {
+				t.Errorf("Subject = %q (%v)", decoded, err)
+			}
+		}
+	}
+	if strings.Contains(body, "Спасибо") {
+		t.Errorf("текст не закодирован quoted-printable: %q", body)
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	// Сервер принимает соединение, но не присылает приветствие
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	n := NewSMTPNotifier("127.0.0.1", addr.Port, "", "", "shop@example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := n.Send(ctx, Message{To: "buyer@example.com", Body: "Текст"}); err == nil {
+		t.Fatal("Send() на молчащий сервер без ошибки")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() ждал %v, срок ctx не соблюдён", elapsed)
+	}
+}
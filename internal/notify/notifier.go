@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Каналы отправки уведомлений
+const (
+	ChannelEmail    = "email"
+	ChannelSMS      = "sms"
+	ChannelTelegram = "telegram"
+)
+
+// Message - сообщение получателю. To - адрес в канале отправки (email, телефон, chat id).
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier - канал отправки уведомлений
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogNotifier пишет уведомления в лог. Используется, пока внешние каналы не настроены.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "уведомление", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SMSNotifier отправляет SMS через HTTP-шлюз: POST JSON {to, from, text} с ключом в заголовке Authorization
+type SMSNotifier struct {
+	endpoint string
+	apiKey   string
+	sender   string
+	client   *http.Client
+}
+
+func NewSMSNotifier(endpoint, apiKey, sender string) *SMSNotifier {
+	return &SMSNotifier{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		sender:   sender,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *SMSNotifier) Send(ctx context.Context, msg Message) error {
+	// В SMS нет темы, поэтому отправляется только текст
+	payload, err := json.Marshal(map[string]string{
+		"to":   msg.To,
+		"from": n.sender,
+		"text": msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.apiKey)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS-шлюз ответил %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
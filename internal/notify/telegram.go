@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// TelegramNotifier отправляет сообщения от имени бота. Адрес получателя - chat id,
+// который покупатель получает, написав боту.
+type TelegramNotifier struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+func NewTelegramNotifier(token string) *TelegramNotifier {
+	return &TelegramNotifier{
+		apiURL: telegramAPIURL,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *TelegramNotifier) Send(ctx context.Context, msg Message) error {
+	text := msg.Body
+	if msg.Subject != "" {
+		text = msg.Subject + "\n\n" + msg.Body
+	}
+	payload, err := json.Marshal(map[string]string{
+		"chat_id": msg.To,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(n.apiURL, "/") + "/bot" + n.token + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return withoutURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return withoutURL(err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("Telegram ответил %d: %w", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("Telegram: %s", result.Description)
+	}
+	return nil
+}
+
+// withoutURL убирает из ошибки адрес запроса: в нём токен бота, а ошибка попадает
+// в лог и в last_error очереди уведомлений
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("Telegram: %s: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegramNotifierSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{"отправлено", `{"ok":true}`, false},
+		{"ошибка API", `{"ok":false,"description":"chat not found"}`, true},
+		{"не JSON", `bad gateway`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/botsecret-token/sendMessage" {
+					t.Errorf("path = %q", r.URL.Path)
+				}
+				json.NewDecoder(r.Body).Decode(&got)
+				w.Write([]byte(tt.response))
+			}))
+			defer srv.Close()
+
+			n := NewTelegramNotifier("secret-token")
+			n.apiURL = srv.URL + "/"
+			err := n.Send(context.Background(), Message{To: "100500", Subject: "Тема", Body: "Текст"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got["chat_id"] != "100500" || got["text"] != "Тема\n\nТекст" {
+				t.Errorf("payload = %v", got)
+			}
+		})
+	}
+}
+
+func TestTelegramNotifierHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // Соединение будет отклонено
+
+	n := NewTelegramNotifier("123456:secret-token")
+	n.apiURL = srv.URL
+	err := n.Send(context.Background(), Message{To: "1", Body: "Текст"})
+	if err == nil {
+		t.Fatal("Send() на закрытый сервер без ошибки")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Errorf("токен бота в ошибке: %v", err)
+	}
+}
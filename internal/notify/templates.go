@@ -0,0 +1,168 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"text/template"
+)
+
+// Языки шаблонов уведомлений
+const (
+	LangRU      = "ru"
+	LangEN      = "en"
+	DefaultLang = LangRU
+)
+
+// Шаблоны уведомлений
+const (
+	TemplateOrderConfirmation = "order_confirmation" // OrderData
+	TemplateShippingUpdate    = "shipping_update"    // ShippingData
+	TemplatePasswordReset     = "password_reset"     // PasswordResetData
+	TemplateBackInStock       = "back_in_stock"      // ProductData
+	TemplatePriceDrop         = "price_drop"         // ProductData
+	TemplateLowStock          = "low_stock"          // LowStockData
+)
+
+var ErrTemplateNotFound = errors.New("шаблон уведомления не найден")
+
+type OrderData struct {
+	PurchaseID int64
+	Total      float64
+	Currency   string
+}
+
+type ShippingData struct {
+	PurchaseID     int64
+	Status         string
+	TrackingNumber string
+}
+
+type PasswordResetData struct {
+	Name     string
+	ResetURL string
+}
+
+type ProductData struct {
+	ProductName string
+	Price       float64
+}
+
+type LowStockItem struct {
+	StoreID           int64
+	ProductID         int64
+	ProductName       string
+	Available         int
+	MinQuantity       int
+	SuggestedQuantity int
+}
+
+type LowStockData struct {
+	Items []LowStockItem
+}
+
+type messageTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// templateSources - тексты шаблонов по имени и языку: тема и тело
+var templateSources = map[string]map[string][2]string{
+	TemplateOrderConfirmation: {
+		LangRU: {
+			"Заказ №{{.PurchaseID}} оплачен",
+			"Спасибо за покупку! Заказ №{{.PurchaseID}} на сумму {{printf \"%.2f\" .Total}} {{.Currency}} оплачен и передан в сборку.",
+		},
+		LangEN: {
+			"Order #{{.PurchaseID}} confirmed",
+			"Thank you for your purchase! Order #{{.PurchaseID}} totalling {{printf \"%.2f\" .Total}} {{.Currency}} has been paid and is being prepared.",
+		},
+	},
+	TemplateShippingUpdate: {
+		LangRU: {
+			"Заказ №{{.PurchaseID}}: статус доставки изменён",
+			"Статус доставки заказа №{{.PurchaseID}}: {{.Status}}.{{if .TrackingNumber}} Трек-номер: {{.TrackingNumber}}.{{end}}",
+		},
+		LangEN: {
+			"Order #{{.PurchaseID}}: shipping update",
+			"Shipping status of order #{{.PurchaseID}}: {{.Status}}.{{if .TrackingNumber}} Tracking number: {{.TrackingNumber}}.{{end}}",
+		},
+	},
+	TemplatePasswordReset: {
+		LangRU: {
+			"Восстановление пароля",
+			"{{if .Name}}{{.Name}}, з{{else}}З{{end}}дравствуйте! Чтобы задать новый пароль, перейдите по ссылке: {{.ResetURL}}\nЕсли вы не запрашивали восстановление, просто проигнорируйте это письмо.",
+		},
+		LangEN: {
+			"Password reset",
+			"Hello{{if .Name}}, {{.Name}}{{end}}! To set a new password, follow this link: {{.ResetURL}}\nIf you did not request a reset, just ignore this message.",
+		},
+	},
+	TemplateBackInStock: {
+		LangRU: {
+			"{{.ProductName}} снова в наличии",
+			"Товар «{{.ProductName}}», который вы ждали, снова в продаже по цене {{printf \"%.2f\" .Price}}.",
+		},
+		LangEN: {
+			"{{.ProductName}} is back in stock",
+			"The item “{{.ProductName}}” you were waiting for is back in stock at {{printf \"%.2f\" .Price}}.",
+		},
+	},
+	TemplatePriceDrop: {
+		LangRU: {
+			"{{.ProductName}} подешевел",
+			"Цена на «{{.ProductName}}» снизилась до {{printf \"%.2f\" .Price}}.",
+		},
+		LangEN: {
+			"{{.ProductName}} price drop",
+			"The price of “{{.ProductName}}” has dropped to {{printf \"%.2f\" .Price}}.",
+		},
+	},
+	TemplateLowStock: {
+		LangRU: {
+			"Низкий остаток: {{len .Items}} поз.",
+			"{{range .Items}}Магазин {{.StoreID}}: {{.ProductName}} (#{{.ProductID}}) - свободно {{.Available}}, точка дозаказа {{.MinQuantity}}, рекомендуем заказать {{.SuggestedQuantity}}\n{{end}}",
+		},
+		LangEN: {
+			"Low stock: {{len .Items}} item(s)",
+			"{{range .Items}}Store {{.StoreID}}: {{.ProductName}} (#{{.ProductID}}) - available {{.Available}}, reorder point {{.MinQuantity}}, suggested order {{.SuggestedQuantity}}\n{{end}}",
+		},
+	},
+}
+
+var templates = parseTemplates()
+
+func parseTemplates() map[string]map[string]messageTemplate {
+	parsed := make(map[string]map[string]messageTemplate, len(templateSources))
+	for name, langs := range templateSources {
+		parsed[name] = make(map[string]messageTemplate, len(langs))
+		for lang, src := range langs {
+			parsed[name][lang] = messageTemplate{
+				subject: template.Must(template.New(name + "." + lang + ".subject").Parse(src[0])),
+				body:    template.Must(template.New(name + "." + lang + ".body").Parse(src[1])),
+			}
+		}
+	}
+	return parsed
+}
+
+// Render заполняет шаблон и возвращает сообщение без адресата.
+// Если шаблона на нужном языке нет, используется DefaultLang.
+func Render(name, lang string, data any) (Message, error) {
+	langs, ok := templates[name]
+	if !ok {
+		return Message{}, ErrTemplateNotFound
+	}
+	tmpl, ok := langs[lang]
+	if !ok {
+		tmpl = langs[DefaultLang]
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Subject: subject.String(), Body: body.String()}, nil
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		lang        string
+		data        any
+		wantSubject string
+		wantBody    string
+		wantErr     error
+	}{
+		{
+			name:        "подтверждение заказа",
+			template:    TemplateOrderConfirmation,
+			lang:        LangRU,
+			data:        OrderData{PurchaseID: 42, Total: 1999.5, Currency: "RUB"},
+			wantSubject: "Заказ №42 оплачен",
+			wantBody:    "Спасибо за покупку! Заказ №42 на сумму 1999.50 RUB оплачен и передан в сборку.",
+		},
+		{
+			name:        "английский шаблон",
+			template:    TemplatePriceDrop,
+			lang:        LangEN,
+			data:        ProductData{ProductName: "Salt 20", Price: 450},
+			wantSubject: "Salt 20 price drop",
+			wantBody:    "The price of “Salt 20” has dropped to 450.00.",
+		},
+		{
+			name:        "неизвестный язык - русский шаблон",
+			template:    TemplateBackInStock,
+			lang:        "de",
+			data:        ProductData{ProductName: "Salt 20", Price: 450},
+			wantSubject: "Salt 20 снова в наличии",
+			wantBody:    "Товар «Salt 20», который вы ждали, снова в продаже по цене 450.00.",
+		},
+		{
+			name:        "условный блок без трек-номера",
+			template:    TemplateShippingUpdate,
+			lang:        LangRU,
+			data:        ShippingData{PurchaseID: 7, Status: "в пути"},
+			wantSubject: "Заказ №7: статус доставки изменён",
+			wantBody:    "Статус доставки заказа №7: в пути.",
+		},
+		{
+			name:        "условный блок с трек-номером",
+			template:    TemplateShippingUpdate,
+			lang:        LangEN,
+			data:        ShippingData{PurchaseID: 7, Status: "shipped", TrackingNumber: "RA123"},
+			wantSubject: "Order #7: shipping update",
+			wantBody:    "Shipping status of order #7: shipped. Tracking number: RA123.",
+		},
+		{
+			name:        "список позиций",
+			template:    TemplateLowStock,
+			lang:        LangRU,
+			data:        LowStockData{Items: []LowStockItem{{StoreID: 1, ProductID: 5, ProductName: "Испаритель", Available: 2, MinQuantity: 5, SuggestedQuantity: 10}}},
+			wantSubject: "Низкий остаток: 1 поз.",
+			wantBody:    "Магазин 1: Испаритель (#5) - свободно 2, точка дозаказа 5, рекомендуем заказать 10\n",
+		},
+		{
+			name:     "неизвестный шаблон",
+			template: "welcome",
+			lang:     LangRU,
+			wantErr:  ErrTemplateNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Render(tt.template, tt.lang, tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Render() error = %v, want %v", err, tt.wantErr)
+			}
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.wantSubject)
+			}
+			if msg.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", msg.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRenderWrongData(t *testing.T) {
+	// Данные не того типа - ошибка выполнения шаблона, а не паника
+	if _, err := Render(TemplateOrderConfirmation, LangRU, ProductData{}); err == nil {
+		t.Error("Render() с чужими данными без ошибки")
+	}
+}
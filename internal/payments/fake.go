@@ -0,0 +1,142 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type fakePayment struct {
+	amount   float64
+	captured float64
+	refunded float64
+}
+
+// FakeProvider - локальный провайдер для разработки и тестов. Платежи хранятся в памяти,
+// вебхуки подписываются HMAC-SHA256 тем же секретом, что и проверяются.
+type FakeProvider struct {
+	secret []byte
+
+	mu       sync.Mutex
+	seq      int
+	payments map[string]*fakePayment
+	captures map[string]bool    // Ключи идемпотентности выполненных списаний
+	refunds  map[string]*Refund // По ключу идемпотентности
+}
+
+func NewFakeProvider(secret string) *FakeProvider {
+	return &FakeProvider{
+		secret:   []byte(secret),
+		payments: make(map[string]*fakePayment),
+		captures: make(map[string]bool),
+		refunds:  make(map[string]*Refund),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, amount float64, currency, reference string) (*Intent, error) {
+	if amount <= 0 {
+		return nil, errors.New("сумма платежа должна быть положительной")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	id := fmt.Sprintf("fake_pay_%d", p.seq)
+	p.payments[id] = &fakePayment{amount: amount}
+
+	return &Intent{
+		ProviderPaymentID: id,
+		Amount:            amount,
+		Currency:          currency,
+		ConfirmationURL:   "http://localhost/fake-pay/" + id + "?ref=" + reference,
+	}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, providerPaymentID string, amount float64, idempotencyKey string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.captures[idempotencyKey] && idempotencyKey != "" {
+		return nil
+	}
+
+	payment, ok := p.payments[providerPaymentID]
+	if !ok {
+		return errors.New("платёж не найден у провайдера")
+	}
+	if payment.captured+amount > payment.amount {
+		return errors.New("сумма списания превышает сумму платежа")
+	}
+	payment.captured += amount
+	if idempotencyKey != "" {
+		p.captures[idempotencyKey] = true
+	}
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, providerPaymentID string, amount float64, idempotencyKey string) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.refunds[idempotencyKey]; ok && idempotencyKey != "" {
+		return refund, nil
+	}
+
+	payment, ok := p.payments[providerPaymentID]
+	if !ok {
+		return nil, errors.New("платёж не найден у провайдера")
+	}
+	if payment.refunded+amount > payment.captured {
+		return nil, errors.New("сумма возврата превышает списанную сумму")
+	}
+	payment.refunded += amount
+
+	p.seq++
+	refund := &Refund{
+		ProviderRefundID: fmt.Sprintf("fake_ref_%d", p.seq),
+		Amount:           amount,
+	}
+	if idempotencyKey != "" {
+		p.refunds[idempotencyKey] = refund
+	}
+	return refund, nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// SignEvent сериализует событие и подписывает его, как это сделал бы настоящий провайдер.
+// Нужен, чтобы имитировать вебхуки при разработке.
+func (p *FakeProvider) SignEvent(event WebhookEvent) (payload []byte, signature string, err error) {
+	payload, err = json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, hex.EncodeToString(p.sign(payload)), nil
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,174 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeProviderPaymentFlow(t *testing.T) {
+	// Шаги применяются к одному платежу на 1000 по порядку
+	type step struct {
+		name    string
+		op      string // capture или refund
+		amount  float64
+		wantErr bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "полное списание и частичные возвраты",
+			steps: []step{
+				{"списание", "capture", 1000, false},
+				{"первый возврат", "refund", 300, false},
+				{"второй возврат", "refund", 700, false},
+				{"сверх списанного", "refund", 0.01, true},
+			},
+		},
+		{
+			name: "частичные списания",
+			steps: []step{
+				{"первое списание", "capture", 600, false},
+				{"сверх суммы платежа", "capture", 500, true},
+				{"остаток", "capture", 400, false},
+			},
+		},
+		{
+			name: "возврат до списания",
+			steps: []step{
+				{"возврат", "refund", 100, true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			p := NewFakeProvider("secret")
+			intent, err := p.CreateIntent(ctx, 1000, "RUB", "42")
+			if err != nil {
+				t.Fatalf("CreateIntent() error = %v", err)
+			}
+			if intent.Amount != 1000 || intent.Currency != "RUB" || intent.ProviderPaymentID == "" {
+				t.Fatalf("intent = %+v", intent)
+			}
+
+			refundIDs := map[string]bool{}
+			for _, st := range tt.steps {
+				switch st.op {
+				case "capture":
+					err = p.Capture(ctx, intent.ProviderPaymentID, st.amount, "")
+				case "refund":
+					var refund *Refund
+					refund, err = p.Refund(ctx, intent.ProviderPaymentID, st.amount, "")
+					if err == nil {
+						if refund.Amount != st.amount || refundIDs[refund.ProviderRefundID] {
+							t.Errorf("%s: refund = %+v", st.name, refund)
+						}
+						refundIDs[refund.ProviderRefundID] = true
+					}
+				}
+				if (err != nil) != st.wantErr {
+					t.Errorf("%s: error = %v, wantErr %v", st.name, err, st.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeProviderRefundIdempotency(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakeProvider("secret")
+	intent, err := p.CreateIntent(ctx, 1000, "RUB", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Capture(ctx, intent.ProviderPaymentID, 1000, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := p.Refund(ctx, intent.ProviderPaymentID, 600, "return-1")
+	if err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	// Повтор с тем же ключом не возвращает деньги ещё раз, иначе 600+600 превысили бы списанное
+	again, err := p.Refund(ctx, intent.ProviderPaymentID, 600, "return-1")
+	if err != nil || again.ProviderRefundID != first.ProviderRefundID {
+		t.Fatalf("повтор Refund() = %+v, %v, want %+v", again, err, first)
+	}
+	if _, err := p.Refund(ctx, intent.ProviderPaymentID, 600, "return-2"); err == nil {
+		t.Error("Refund() с новым ключом сверх списанного без ошибки")
+	}
+	if _, err := p.Refund(ctx, intent.ProviderPaymentID, 400, "return-2"); err != nil {
+		t.Errorf("Refund() остатка error = %v", err)
+	}
+}
+
+func TestFakeProviderCaptureIdempotency(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakeProvider("secret")
+	intent, err := p.CreateIntent(ctx, 1000, "RUB", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Capture(ctx, intent.ProviderPaymentID, 1000, "capture-5"); err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	// Повтор после сбоя записи у нас не списывает второй раз и не падает на превышении суммы
+	if err := p.Capture(ctx, intent.ProviderPaymentID, 1000, "capture-5"); err != nil {
+		t.Errorf("повтор Capture() error = %v", err)
+	}
+	if err := p.Capture(ctx, intent.ProviderPaymentID, 1000, "capture-6"); err == nil {
+		t.Error("Capture() с новым ключом сверх суммы платежа без ошибки")
+	}
+}
+
+func TestFakeProviderUnknownPayment(t *testing.T) {
+	ctx := context.Background()
+	p := NewFakeProvider("secret")
+	if err := p.Capture(ctx, "fake_pay_404", 1, ""); err == nil {
+		t.Error("Capture() неизвестного платежа без ошибки")
+	}
+	if _, err := p.Refund(ctx, "fake_pay_404", 1, ""); err == nil {
+		t.Error("Refund() неизвестного платежа без ошибки")
+	}
+	if _, err := p.CreateIntent(ctx, 0, "RUB", "1"); err == nil {
+		t.Error("CreateIntent() с нулевой суммой без ошибки")
+	}
+}
+
+func TestFakeProviderWebhook(t *testing.T) {
+	p := NewFakeProvider("secret")
+	event := WebhookEvent{ID: "evt_1", Type: EventPaymentSucceeded, ProviderPaymentID: "fake_pay_1", Amount: 1000}
+	payload, signature, err := p.SignEvent(event)
+	if err != nil {
+		t.Fatalf("SignEvent() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		provider  *FakeProvider
+		payload   []byte
+		signature string
+		wantErr   error
+	}{
+		{"верная подпись", p, payload, signature, nil},
+		{"другой секрет", NewFakeProvider("other"), payload, signature, ErrInvalidSignature},
+		{"изменённое тело", p, append([]byte(" "), payload...), signature, ErrInvalidSignature},
+		{"подпись не в hex", p, payload, "not-hex", ErrInvalidSignature},
+		{"пустая подпись", p, payload, "", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.provider.VerifyWebhook(tt.payload, tt.signature)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && *got != event {
+				t.Errorf("event = %+v, want %+v", *got, event)
+			}
+		})
+	}
+}
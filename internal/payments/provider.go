@@ -0,0 +1,47 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+// Типы событий, которые провайдер присылает в вебхуках
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventRefundSucceeded  = "refund.succeeded"
+)
+
+var ErrInvalidSignature = errors.New("неверная подпись вебхука")
+
+type Intent struct {
+	ProviderPaymentID string  `json:"providerPaymentId"`
+	Amount            float64 `json:"amount"`
+	Currency          string  `json:"currency"`
+	ConfirmationURL   string  `json:"confirmationUrl"` // Куда отправить покупателя для оплаты
+}
+
+type Refund struct {
+	ProviderRefundID string  `json:"providerRefundId"`
+	Amount           float64 `json:"amount"`
+}
+
+// WebhookEvent - событие провайдера после проверки подписи
+type WebhookEvent struct {
+	ID                string  `json:"id"` // Уникален у провайдера, используется для идемпотентности
+	Type              string  `json:"type"`
+	ProviderPaymentID string  `json:"providerPaymentId"`
+	Amount            float64 `json:"amount"`
+}
+
+// PaymentProvider - абстракция платёжного шлюза
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(ctx context.Context, amount float64, currency, reference string) (*Intent, error)
+	// Capture с уже использованным idempotencyKey ничего не списывает повторно
+	Capture(ctx context.Context, providerPaymentID string, amount float64, idempotencyKey string) error
+	// Refund с уже использованным idempotencyKey не возвращает деньги повторно, а отдаёт
+	// прежний возврат. Пустой ключ - без идемпотентности.
+	Refund(ctx context.Context, providerPaymentID string, amount float64, idempotencyKey string) (*Refund, error)
+	VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error)
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+type Category struct {
+	ID        int64      `json:"id"`
+	StoreID   int64      `json:"storeId" validate:"required"`
+	ParentID  int64      `json:"parentId,omitempty"` // 0 у корневых категорий
+	Name      string     `json:"name" validate:"required"`
+	Slug      string     `json:"slug"`
+	Position  int        `json:"position"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type CategoryRepository interface {
+	WithTx(tx db.Querier) CategoryRepository
+	List(ctx context.Context, includeDeleted bool) ([]Category, error)
+	ListByStore(ctx context.Context, storeID int64) ([]Category, error)
+	GetByID(ctx context.Context, id int64) (*Category, error)
+	DescendantIDs(ctx context.Context, id int64) ([]int64, error)
+	IsDescendant(ctx context.Context, id, ancestorID int64) (bool, error)
+	LockForMove(ctx context.Context, id, parentID int64) error
+	Create(ctx context.Context, category *Category) error
+	Update(ctx context.Context, category Category) error
+	Move(ctx context.Context, id, parentID int64, position int) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+}
+
+type CategoryRepositoryImpl struct {
+	db   db.Querier // Пул соединений или транзакция
+	read db.Querier // Для чтения каталога: реплики или та же транзакция
+}
+
+func NewCategoryRepository(db, read db.Querier) *CategoryRepositoryImpl {
+	return &CategoryRepositoryImpl{
+		db:   db,
+		read: read,
+	}
+}
+
+const categoryColumns = "id, store_id, COALESCE(parent_id, 0), name, slug, position, created_at, updated_at, deleted_at"
+
+func scanCategory(row scanner, category *Category) error {
+	return row.Scan(&category.ID, &category.StoreID, &category.ParentID, &category.Name, &category.Slug, &category.Position, &category.CreatedAt, &category.UpdatedAt, &category.DeletedAt)
+}
+
+func (r *CategoryRepositoryImpl) WithTx(tx db.Querier) CategoryRepository {
+	return NewCategoryRepository(tx, tx)
+}
+
+func (r *CategoryRepositoryImpl) List(ctx context.Context, includeDeleted bool) ([]Category, error) {
+	return queryList(ctx, r.read, scanCategory, "SELECT "+categoryColumns+" FROM categories"+notDeleted(includeDeleted)+" ORDER BY store_id, position, name")
+}
+
+func (r *CategoryRepositoryImpl) ListByStore(ctx context.Context, storeID int64) ([]Category, error) {
+	return queryList(ctx, r.read, scanCategory, "SELECT "+categoryColumns+" FROM categories WHERE store_id = $1 AND deleted_at IS NULL ORDER BY position, name", storeID)
+}
+
+func (r *CategoryRepositoryImpl) GetByID(ctx context.Context, id int64) (*Category, error) {
+	var category Category
+	if err := scanCategory(r.read.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories WHERE id = $1 AND deleted_at IS NULL", id), &category); err != nil {
+		return nil, notFound(err)
+	}
+	return &category, nil
+}
+
+// DescendantIDs возвращает ID категории и всех её неудалённых потомков; ErrNotFound, если категории нет
+func (r *CategoryRepositoryImpl) DescendantIDs(ctx context.Context, id int64) ([]int64, error) {
+	ids, err := queryList(ctx, r.read, func(row scanner, id *int64) error { return row.Scan(id) }, `WITH RECURSIVE tree AS (
+		SELECT id FROM categories WHERE id = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id WHERE c.deleted_at IS NULL
+	) SELECT id FROM tree`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrNotFound
+	}
+	return ids, nil
+}
+
+// IsDescendant сообщает, лежит ли категория id в поддереве ancestorID (включая её саму)
+func (r *CategoryRepositoryImpl) IsDescendant(ctx context.Context, id, ancestorID int64) (bool, error) {
+	var descendant bool
+	err := r.db.QueryRowContext(ctx, `WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id FROM categories WHERE id = $1
+		UNION ALL
+		SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+	) SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`, id, ancestorID).Scan(&descendant)
+	return descendant, err
+}
+
+// LockForMove блокирует FOR UPDATE категорию id, нового родителя parentID и всех его предков
+// в порядке ID. Вызывается в транзакции переноса до проверки на цикл: параллельный перенос,
+// затрагивающий те же ветви, дождётся фиксации и увидит новое дерево.
+func (r *CategoryRepositoryImpl) LockForMove(ctx context.Context, id, parentID int64) error {
+	_, err := queryList(ctx, r.db, func(row scanner, id *int64) error { return row.Scan(id) }, `WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id FROM categories WHERE id = $2
+		UNION ALL
+		SELECT c.id, c.parent_id FROM categories c JOIN ancestors a ON c.id = a.parent_id
+	) SELECT id FROM categories WHERE id = $1 OR id IN (SELECT id FROM ancestors) ORDER BY id FOR UPDATE`, id, parentID)
+	return err
+}
+
+// Create добавляет категорию; ErrDuplicate, если slug уже занят в магазине
+func (r *CategoryRepositoryImpl) Create(ctx context.Context, category *Category) error {
+	return duplicate(r.db.QueryRowContext(ctx, "INSERT INTO categories (store_id, parent_id, name, slug, position) VALUES ($1, NULLIF($2, 0), $3, $4, $5) RETURNING id, created_at, updated_at",
+		category.StoreID, category.ParentID, category.Name, category.Slug, category.Position).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt))
+}
+
+// Update меняет название и slug; родитель и позиция меняются через Move.
+// ErrDuplicate, если slug уже занят в магазине.
+func (r *CategoryRepositoryImpl) Update(ctx context.Context, category Category) error {
+	return duplicate(execOne(ctx, r.db, "UPDATE categories SET name = $1, slug = $2, updated_at = NOW() WHERE id = $3 AND deleted_at IS NULL", category.Name, category.Slug, category.ID))
+}
+
+// Move переносит категорию под parentID (0 - в корень) на позицию position
+func (r *CategoryRepositoryImpl) Move(ctx context.Context, id, parentID int64, position int) error {
+	return execOne(ctx, r.db, "UPDATE categories SET parent_id = NULLIF($1, 0), position = $2, updated_at = NOW() WHERE id = $3 AND deleted_at IS NULL", parentID, position, id)
+}
+
+func (r *CategoryRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	return softDelete(ctx, r.db, "categories", id)
+}
+
+func (r *CategoryRepositoryImpl) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, r.db, "categories", id)
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+type Customer struct {
+	ID        int64      `json:"id"`
+	FirstName string     `json:"firstName"`
+	LastName  string     `json:"lastName"`
+	Email     string     `json:"email"`
+	Phone     string     `json:"phone"`
+	Address   string     `json:"address"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type CustomerRepository interface {
+	WithTx(tx db.Querier) CustomerRepository
+	List(ctx context.Context, includeDeleted bool) ([]Customer, error)
+	GetByID(ctx context.Context, id int64) (*Customer, error)
+	Create(ctx context.Context, customer *Customer) error
+	Update(ctx context.Context, customer Customer) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+}
+
+type CustomerRepositoryImpl struct {
+	db db.Querier // Пул соединений или транзакция
+}
+
+func NewCustomerRepository(db db.Querier) *CustomerRepositoryImpl {
+	return &CustomerRepositoryImpl{
+		db: db,
+	}
+}
+
+const customerColumns = "id, first_name, last_name, email, COALESCE(phone, ''), COALESCE(address, ''), created_at, updated_at, deleted_at"
+
+func scanCustomer(row scanner, customer *Customer) error {
+	return row.Scan(&customer.ID, &customer.FirstName, &customer.LastName, &customer.Email, &customer.Phone, &customer.Address, &customer.CreatedAt, &customer.UpdatedAt, &customer.DeletedAt)
+}
+
+func (r *CustomerRepositoryImpl) WithTx(tx db.Querier) CustomerRepository {
+	return NewCustomerRepository(tx)
+}
+
+func (r *CustomerRepositoryImpl) List(ctx context.Context, includeDeleted bool) ([]Customer, error) {
+	return queryList(ctx, r.db, scanCustomer, "SELECT "+customerColumns+" FROM customers"+notDeleted(includeDeleted)+" ORDER BY id")
+}
+
+func (r *CustomerRepositoryImpl) GetByID(ctx context.Context, id int64) (*Customer, error) {
+	var customer Customer
+	if err := scanCustomer(r.db.QueryRowContext(ctx, "SELECT "+customerColumns+" FROM customers WHERE id = $1 AND deleted_at IS NULL", id), &customer); err != nil {
+		return nil, notFound(err)
+	}
+	return &customer, nil
+}
+
+func (r *CustomerRepositoryImpl) Create(ctx context.Context, customer *Customer) error {
+	return r.db.QueryRowContext(ctx, "INSERT INTO customers (first_name, last_name, email, phone, address) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at",
+		customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.Address).Scan(&customer.ID, &customer.CreatedAt, &customer.UpdatedAt)
+}
+
+func (r *CustomerRepositoryImpl) Update(ctx context.Context, customer Customer) error {
+	return execOne(ctx, r.db, "UPDATE customers SET first_name = $1, last_name = $2, email = $3, phone = $4, address = $5, updated_at = NOW() WHERE id = $6 AND deleted_at IS NULL",
+		customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.Address, customer.ID)
+}
+
+func (r *CustomerRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	return softDelete(ctx, r.db, "customers", id)
+}
+
+func (r *CustomerRepositoryImpl) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, r.db, "customers", id)
+}
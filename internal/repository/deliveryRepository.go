@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+type Delivery struct {
+	ID             int64     `json:"id"`
+	PurchaseID     int64     `json:"purchaseId,omitempty"`
+	Status         string    `json:"status"`
+	TrackingNumber string    `json:"trackingNumber,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type DeliveryRepository interface {
+	WithTx(tx db.Querier) DeliveryRepository
+	List(ctx context.Context) ([]Delivery, error)
+	GetByID(ctx context.Context, id int64) (*Delivery, error)
+	GetForUpdate(ctx context.Context, id int64) (*Delivery, error)
+	Create(ctx context.Context, delivery *Delivery) error
+	Update(ctx context.Context, delivery Delivery) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type DeliveryRepositoryImpl struct {
+	db db.Querier // Пул соединений или транзакция
+}
+
+func NewDeliveryRepository(db db.Querier) *DeliveryRepositoryImpl {
+	return &DeliveryRepositoryImpl{
+		db: db,
+	}
+}
+
+const deliveryColumns = "id, COALESCE(order_id, 0), status, COALESCE(tracking_number, ''), created_at, updated_at"
+
+func scanDelivery(row scanner, delivery *Delivery) error {
+	return row.Scan(&delivery.ID, &delivery.PurchaseID, &delivery.Status, &delivery.TrackingNumber, &delivery.CreatedAt, &delivery.UpdatedAt)
+}
+
+func (r *DeliveryRepositoryImpl) WithTx(tx db.Querier) DeliveryRepository {
+	return NewDeliveryRepository(tx)
+}
+
+func (r *DeliveryRepositoryImpl) List(ctx context.Context) ([]Delivery, error) {
+	return queryList(ctx, r.db, scanDelivery, "SELECT "+deliveryColumns+" FROM deliveries ORDER BY id")
+}
+
+func (r *DeliveryRepositoryImpl) GetByID(ctx context.Context, id int64) (*Delivery, error) {
+	var delivery Delivery
+	if err := scanDelivery(r.db.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1", id), &delivery); err != nil {
+		return nil, notFound(err)
+	}
+	return &delivery, nil
+}
+
+// GetForUpdate читает доставку с блокировкой строки до конца транзакции
+func (r *DeliveryRepositoryImpl) GetForUpdate(ctx context.Context, id int64) (*Delivery, error) {
+	var delivery Delivery
+	if err := scanDelivery(r.db.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1 FOR UPDATE", id), &delivery); err != nil {
+		return nil, notFound(err)
+	}
+	return &delivery, nil
+}
+
+func (r *DeliveryRepositoryImpl) Create(ctx context.Context, delivery *Delivery) error {
+	return r.db.QueryRowContext(ctx, "INSERT INTO deliveries (order_id, status, tracking_number) VALUES (NULLIF($1, 0), $2, NULLIF($3, '')) RETURNING id, created_at, updated_at",
+		delivery.PurchaseID, delivery.Status, delivery.TrackingNumber).Scan(&delivery.ID, &delivery.CreatedAt, &delivery.UpdatedAt)
+}
+
+func (r *DeliveryRepositoryImpl) Update(ctx context.Context, delivery Delivery) error {
+	return execOne(ctx, r.db, "UPDATE deliveries SET order_id = NULLIF($1, 0), status = $2, tracking_number = NULLIF($3, ''), updated_at = NOW() WHERE id = $4",
+		delivery.PurchaseID, delivery.Status, delivery.TrackingNumber, delivery.ID)
+}
+
+func (r *DeliveryRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	return execOne(ctx, r.db, "DELETE FROM deliveries WHERE id = $1", id)
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+type Manufacturer struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	Country         string     `json:"country"`
+	Website         string     `json:"website"`
+	LogoURL         string     `json:"logoUrl"`
+	Description     string     `json:"description"`
+	AuthenticityURL string     `json:"authenticityUrl"` // Страница проверки подлинности на сайте бренда
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	DeletedAt       *time.Time `json:"deletedAt,omitempty"`
+}
+
+type ManufacturerRepository interface {
+	WithTx(tx db.Querier) ManufacturerRepository
+	List(ctx context.Context, includeDeleted bool) ([]Manufacturer, error)
+	GetByID(ctx context.Context, id int64) (*Manufacturer, error)
+	Create(ctx context.Context, manufacturer *Manufacturer) error
+	Update(ctx context.Context, manufacturer Manufacturer) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+}
+
+type ManufacturerRepositoryImpl struct {
+	db   db.Querier // Пул соединений или транзакция
+	read db.Querier // Для страниц брендов: реплики или та же транзакция
+}
+
+func NewManufacturerRepository(db, read db.Querier) *ManufacturerRepositoryImpl {
+	return &ManufacturerRepositoryImpl{
+		db:   db,
+		read: read,
+	}
+}
+
+const manufacturerColumns = "id, name, COALESCE(country, ''), COALESCE(website, ''), COALESCE(logo_url, ''), COALESCE(description, ''), COALESCE(authenticity_url, ''), created_at, updated_at, deleted_at"
+
+func scanManufacturer(row scanner, manufacturer *Manufacturer) error {
+	return row.Scan(&manufacturer.ID, &manufacturer.Name, &manufacturer.Country, &manufacturer.Website, &manufacturer.LogoURL, &manufacturer.Description, &manufacturer.AuthenticityURL, &manufacturer.CreatedAt, &manufacturer.UpdatedAt, &manufacturer.DeletedAt)
+}
+
+func (r *ManufacturerRepositoryImpl) WithTx(tx db.Querier) ManufacturerRepository {
+	return NewManufacturerRepository(tx, tx)
+}
+
+func (r *ManufacturerRepositoryImpl) List(ctx context.Context, includeDeleted bool) ([]Manufacturer, error) {
+	return queryList(ctx, r.read, scanManufacturer, "SELECT "+manufacturerColumns+" FROM manufacturers"+notDeleted(includeDeleted)+" ORDER BY name")
+}
+
+func (r *ManufacturerRepositoryImpl) GetByID(ctx context.Context, id int64) (*Manufacturer, error) {
+	var manufacturer Manufacturer
+	if err := scanManufacturer(r.read.QueryRowContext(ctx, "SELECT "+manufacturerColumns+" FROM manufacturers WHERE id = $1 AND deleted_at IS NULL", id), &manufacturer); err != nil {
+		return nil, notFound(err)
+	}
+	return &manufacturer, nil
+}
+
+func (r *ManufacturerRepositoryImpl) Create(ctx context.Context, manufacturer *Manufacturer) error {
+	return r.db.QueryRowContext(ctx, "INSERT INTO manufacturers (name, country, website, logo_url, description, authenticity_url) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		manufacturer.Name, manufacturer.Country, manufacturer.Website, manufacturer.LogoURL, manufacturer.Description, manufacturer.AuthenticityURL).
+		Scan(&manufacturer.ID, &manufacturer.CreatedAt, &manufacturer.UpdatedAt)
+}
+
+func (r *ManufacturerRepositoryImpl) Update(ctx context.Context, manufacturer Manufacturer) error {
+	return execOne(ctx, r.db, "UPDATE manufacturers SET name = $1, country = $2, website = $3, logo_url = $4, description = $5, authenticity_url = $6, updated_at = NOW() WHERE id = $7 AND deleted_at IS NULL",
+		manufacturer.Name, manufacturer.Country, manufacturer.Website, manufacturer.LogoURL, manufacturer.Description, manufacturer.AuthenticityURL, manufacturer.ID)
+}
+
+func (r *ManufacturerRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	return softDelete(ctx, r.db, "manufacturers", id)
+}
+
+func (r *ManufacturerRepositoryImpl) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, r.db, "manufacturers", id)
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/lib/pq"
+)
+
+type Product struct {
+	ID             int64      `json:"id"`
+	ManufacturerID int64      `json:"manufacturerId,omitempty"`
+	CategoryID     int64      `json:"categoryId,omitempty"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Price          float64    `json:"price"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+}
+
+type ProductRepository interface {
+	WithTx(tx db.Querier) ProductRepository
+	List(ctx context.Context, includeDeleted bool) ([]Product, error)
+	ListByCategories(ctx context.Context, categoryIDs []int64) ([]Product, error)
+	GetByID(ctx context.Context, id int64) (*Product, error)
+	GetForUpdate(ctx context.Context, id int64) (*Product, error)
+	GetPrice(ctx context.Context, productID, variantID int64) (float64, error)
+	Create(ctx context.Context, product *Product) error
+	Update(ctx context.Context, product Product) error
+	RecordPriceChange(ctx context.Context, productID int64, oldPrice, newPrice float64) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+}
+
+type ProductRepositoryImpl struct {
+	db   db.Querier // Пул соединений или транзакция
+	read db.Querier // Для чтения каталога: реплики или та же транзакция
+}
+
+func NewProductRepository(db, read db.Querier) *ProductRepositoryImpl {
+	return &ProductRepositoryImpl{
+		db:   db,
+		read: read,
+	}
+}
+
+const productColumns = "id, COALESCE(manufacturer_id, 0), COALESCE(category_id, 0), name, COALESCE(description, ''), price, created_at, updated_at, deleted_at"
+
+func scanProduct(row scanner, product *Product) error {
+	return row.Scan(&product.ID, &product.ManufacturerID, &product.CategoryID, &product.Name, &product.Description, &product.Price, &product.CreatedAt, &product.UpdatedAt, &product.DeletedAt)
+}
+
+func (r *ProductRepositoryImpl) WithTx(tx db.Querier) ProductRepository {
+	return NewProductRepository(tx, tx)
+}
+
+func (r *ProductRepositoryImpl) List(ctx context.Context, includeDeleted bool) ([]Product, error) {
+	return queryList(ctx, r.read, scanProduct, "SELECT "+productColumns+" FROM products"+notDeleted(includeDeleted)+" ORDER BY id")
+}
+
+func (r *ProductRepositoryImpl) ListByCategories(ctx context.Context, categoryIDs []int64) ([]Product, error) {
+	return queryList(ctx, r.read, scanProduct, "SELECT "+productColumns+" FROM products WHERE category_id = ANY($1) AND deleted_at IS NULL ORDER BY id", pq.Array(categoryIDs))
+}
+
+func (r *ProductRepositoryImpl) GetByID(ctx context.Context, id int64) (*Product, error) {
+	var product Product
+	if err := scanProduct(r.read.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products WHERE id = $1 AND deleted_at IS NULL", id), &product); err != nil {
+		return nil, notFound(err)
+	}
+	return &product, nil
+}
+
+// GetForUpdate читает товар с блокировкой строки до конца транзакции
+func (r *ProductRepositoryImpl) GetForUpdate(ctx context.Context, id int64) (*Product, error) {
+	var product Product
+	if err := scanProduct(r.db.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products WHERE id = $1 FOR UPDATE", id), &product); err != nil {
+		return nil, notFound(err)
+	}
+	return &product, nil
+}
+
+// GetPrice возвращает цену продажи товара или его варианта (variantID 0 - товара целиком)
+func (r *ProductRepositoryImpl) GetPrice(ctx context.Context, productID, variantID int64) (float64, error) {
+	var price float64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(v.price_override, p.price)
+		FROM products p
+		LEFT JOIN product_variants v ON v.product_id = p.id AND v.id = $2
+		WHERE p.id = $1 AND p.deleted_at IS NULL AND ($2 = 0 OR v.id IS NOT NULL)`, productID, variantID).Scan(&price)
+	return price, notFound(err)
+}
+
+func (r *ProductRepositoryImpl) Create(ctx context.Context, product *Product) error {
+	return r.db.QueryRowContext(ctx, "INSERT INTO products (manufacturer_id, category_id, name, description, price) VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, $5) RETURNING id, created_at, updated_at",
+		product.ManufacturerID, product.CategoryID, product.Name, product.Description, product.Price).Scan(&product.ID, &product.CreatedAt, &product.UpdatedAt)
+}
+
+func (r *ProductRepositoryImpl) Update(ctx context.Context, product Product) error {
+	return execOne(ctx, r.db, "UPDATE products SET manufacturer_id = NULLIF($1, 0), category_id = NULLIF($2, 0), name = $3, description = $4, price = $5, updated_at = NOW() WHERE id = $6 AND deleted_at IS NULL",
+		product.ManufacturerID, product.CategoryID, product.Name, product.Description, product.Price, product.ID)
+}
+
+// RecordPriceChange записывает изменение цены в историю price_change
+func (r *ProductRepositoryImpl) RecordPriceChange(ctx context.Context, productID int64, oldPrice, newPrice float64) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO price_change (product_id, old_price, new_price) VALUES ($1, $2, $3)", productID, oldPrice, newPrice)
+	return err
+}
+
+func (r *ProductRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	return softDelete(ctx, r.db, "products", id)
+}
+
+func (r *ProductRepositoryImpl) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, r.db, "products", id)
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/lib/pq"
+)
+
+type Purchase struct {
+	ID             int64          `json:"id"`
+	CustomerID     int64          `json:"customerId,omitempty"`
+	Status         string         `json:"status"`
+	ShippingPrice  float64        `json:"shippingPrice"`
+	DiscountAmount float64        `json:"discountAmount"`
+	Items          []PurchaseItem `json:"items"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+}
+
+type PurchaseItem struct {
+	ID        int64   `json:"id"`
+	ProductID int64   `json:"productId" validate:"required"`
+	VariantID int64   `json:"variantId,omitempty"`
+	Quantity  int     `json:"quantity" validate:"required,gt=0"`
+	Price     float64 `json:"price"` // Цена на момент покупки
+}
+
+type PurchaseRepository interface {
+	WithTx(tx db.Querier) PurchaseRepository
+	List(ctx context.Context) ([]Purchase, error)
+	GetByID(ctx context.Context, id int64) (*Purchase, error)
+	Create(ctx context.Context, purchase *Purchase) error
+	Update(ctx context.Context, purchase Purchase) error
+	Delete(ctx context.Context, id int64) error
+	CheckoutStats(ctx context.Context, from, to time.Time, unpaid []string) (started, abandoned int, err error)
+}
+
+type PurchaseRepositoryImpl struct {
+	db db.Querier // Пул соединений или транзакция
+}
+
+func NewPurchaseRepository(db db.Querier) *PurchaseRepositoryImpl {
+	return &PurchaseRepositoryImpl{
+		db: db,
+	}
+}
+
+const purchaseColumns = "id, COALESCE(customer_id, 0), status, shipping_price, discount_amount, created_at, updated_at"
+
+func scanPurchase(row scanner, purchase *Purchase) error {
+	return row.Scan(&purchase.ID, &purchase.CustomerID, &purchase.Status, &purchase.ShippingPrice, &purchase.DiscountAmount, &purchase.CreatedAt, &purchase.UpdatedAt)
+}
+
+type purchaseItemRow struct {
+	purchaseID int64
+	item       PurchaseItem
+}
+
+const purchaseItemColumns = "purchase_id, id, product_id, COALESCE(variant_id, 0), quantity, price"
+
+func scanPurchaseItem(row scanner, r *purchaseItemRow) error {
+	return row.Scan(&r.purchaseID, &r.item.ID, &r.item.ProductID, &r.item.VariantID, &r.item.Quantity, &r.item.Price)
+}
+
+func (r *PurchaseRepositoryImpl) WithTx(tx db.Querier) PurchaseRepository {
+	return NewPurchaseRepository(tx)
+}
+
+func (r *PurchaseRepositoryImpl) List(ctx context.Context) ([]Purchase, error) {
+	purchases, err := queryList(ctx, r.db, scanPurchase, "SELECT "+purchaseColumns+" FROM purchases ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	return purchases, r.loadItems(ctx, purchases)
+}
+
+func (r *PurchaseRepositoryImpl) GetByID(ctx context.Context, id int64) (*Purchase, error) {
+	var purchase Purchase
+	if err := scanPurchase(r.db.QueryRowContext(ctx, "SELECT "+purchaseColumns+" FROM purchases WHERE id = $1", id), &purchase); err != nil {
+		return nil, notFound(err)
+	}
+	purchases := []Purchase{purchase}
+	if err := r.loadItems(ctx, purchases); err != nil {
+		return nil, err
+	}
+	return &purchases[0], nil
+}
+
+// loadItems заполняет позиции покупок одним запросом
+func (r *PurchaseRepositoryImpl) loadItems(ctx context.Context, purchases []Purchase) error {
+	if len(purchases) == 0 {
+		return nil
+	}
+	index := make(map[int64]int, len(purchases))
+	ids := make([]int64, len(purchases))
+	for i := range purchases {
+		purchases[i].Items = []PurchaseItem{}
+		index[purchases[i].ID] = i
+		ids[i] = purchases[i].ID
+	}
+
+	rows, err := queryList(ctx, r.db, scanPurchaseItem, "SELECT "+purchaseItemColumns+" FROM purchase_items WHERE purchase_id = ANY($1) ORDER BY id", pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		i := index[row.purchaseID]
+		purchases[i].Items = append(purchases[i].Items, row.item)
+	}
+	return nil
+}
+
+// Create сохраняет покупку вместе с позициями; ID и даты заполняются у purchase, ID - у её позиций
+func (r *PurchaseRepositoryImpl) Create(ctx context.Context, purchase *Purchase) error {
+	err := r.db.QueryRowContext(ctx, "INSERT INTO purchases (customer_id, status, shipping_price, discount_amount) VALUES (NULLIF($1, 0), $2, $3, $4) RETURNING id, created_at, updated_at",
+		purchase.CustomerID, purchase.Status, purchase.ShippingPrice, purchase.DiscountAmount).Scan(&purchase.ID, &purchase.CreatedAt, &purchase.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i := range purchase.Items {
+		item := &purchase.Items[i]
+		err := r.db.QueryRowContext(ctx, "INSERT INTO purchase_items (purchase_id, product_id, variant_id, quantity, price) VALUES ($1, $2, NULLIF($3, 0), $4, $5) RETURNING id",
+			purchase.ID, item.ProductID, item.VariantID, item.Quantity, item.Price).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update меняет покупателя, доставку и скидку. Статус меняется только вместе с
+// публикацией события, позиции после создания не меняются.
+func (r *PurchaseRepositoryImpl) Update(ctx context.Context, purchase Purchase) error {
+	return execOne(ctx, r.db, "UPDATE purchases SET customer_id = NULLIF($1, 0), shipping_price = $2, discount_amount = $3, updated_at = NOW() WHERE id = $4",
+		purchase.CustomerID, purchase.ShippingPrice, purchase.DiscountAmount, purchase.ID)
+}
+
+func (r *PurchaseRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM purchase_items WHERE purchase_id = $1", id); err != nil {
+		return err
+	}
+	return execOne(ctx, r.db, "DELETE FROM purchases WHERE id = $1", id)
+}
+
+// CheckoutStats считает покупки с оплатой (без самовывоза), созданные в [from, to), и сколько
+// из них до сих пор в одном из статусов unpaid
+func (r *PurchaseRepositoryImpl) CheckoutStats(ctx context.Context, from, to time.Time, unpaid []string) (started, abandoned int, err error) {
+	err = r.db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE p.status = ANY($3)) FROM purchases p
+		WHERE p.created_at >= $1 AND p.created_at < $2
+			AND NOT EXISTS (SELECT 1 FROM pickup_orders o WHERE o.purchase_id = p.id)`, from, to, pq.Array(unpaid)).Scan(&started, &abandoned)
+	return started, abandoned, err
+}
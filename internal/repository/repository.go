@@ -0,0 +1,97 @@
+// Package repository - доступ к таблицам агрегатов магазина. Каждый репозиторий работает
+// через db.Querier и перечисляет столбцы явно; WithTx возвращает копию репозитория,
+// выполняющую запросы в транзакции db.UnitOfWork.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/lib/pq"
+)
+
+// Ошибки репозиториев. Сервисы заменяют их своими.
+var (
+	ErrNotFound  = errors.New("запись не найдена")
+	ErrDuplicate = errors.New("запись с такими данными уже существует")
+)
+
+// pqUniqueViolation - код ошибки PostgreSQL при нарушении ограничения уникальности
+const pqUniqueViolation = "23505"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// notFound заменяет sql.ErrNoRows на ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// duplicate заменяет нарушение уникальности на ErrDuplicate
+func duplicate(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// queryList выполняет запрос и собирает строки через scan
+func queryList[T any](ctx context.Context, q db.Querier, scan func(scanner, *T) error, query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		var item T
+		if err := scan(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// notDeleted - условие отбора неудалённых записей для списков с includeDeleted
+func notDeleted(includeDeleted bool) string {
+	if includeDeleted {
+		return ""
+	}
+	return " WHERE deleted_at IS NULL"
+}
+
+// execOne выполняет изменение одной записи; ErrNotFound, если ни одна строка не затронута
+func execOne(ctx context.Context, q db.Querier, query string, args ...any) error {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// softDelete помечает запись удалённой; ErrNotFound, если её нет или она уже удалена
+func softDelete(ctx context.Context, q db.Querier, table string, id int64) error {
+	return execOne(ctx, q, "UPDATE "+table+" SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", id)
+}
+
+// restore снимает пометку об удалении; ErrNotFound, если запись не найдена среди удалённых
+func restore(ctx context.Context, q db.Querier, table string, id int64) error {
+	return execOne(ctx, q, "UPDATE "+table+" SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+}
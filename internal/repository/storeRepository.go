@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+type Store struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Address   string     `json:"address"`
+	Phone     string     `json:"phone"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type StoreRepository interface {
+	WithTx(tx db.Querier) StoreRepository
+	List(ctx context.Context, includeDeleted bool) ([]Store, error)
+	GetByID(ctx context.Context, id int64) (*Store, error)
+	Create(ctx context.Context, store *Store) error
+	Update(ctx context.Context, store Store) error
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+}
+
+type StoreRepositoryImpl struct {
+	db db.Querier // Пул соединений или транзакция
+}
+
+func NewStoreRepository(db db.Querier) *StoreRepositoryImpl {
+	return &StoreRepositoryImpl{
+		db: db,
+	}
+}
+
+const storeColumns = "id, name, COALESCE(address, ''), COALESCE(phone, ''), created_at, updated_at, deleted_at"
+
+func scanStore(row scanner, store *Store) error {
+	return row.Scan(&store.ID, &store.Name, &store.Address, &store.Phone, &store.CreatedAt, &store.UpdatedAt, &store.DeletedAt)
+}
+
+func (r *StoreRepositoryImpl) WithTx(tx db.Querier) StoreRepository {
+	return NewStoreRepository(tx)
+}
+
+func (r *StoreRepositoryImpl) List(ctx context.Context, includeDeleted bool) ([]Store, error) {
+	return queryList(ctx, r.db, scanStore, "SELECT "+storeColumns+" FROM stores"+notDeleted(includeDeleted)+" ORDER BY id")
+}
+
+func (r *StoreRepositoryImpl) GetByID(ctx context.Context, id int64) (*Store, error) {
+	var store Store
+	if err := scanStore(r.db.QueryRowContext(ctx, "SELECT "+storeColumns+" FROM stores WHERE id = $1 AND deleted_at IS NULL", id), &store); err != nil {
+		return nil, notFound(err)
+	}
+	return &store, nil
+}
+
+func (r *StoreRepositoryImpl) Create(ctx context.Context, store *Store) error {
+	return r.db.QueryRowContext(ctx, "INSERT INTO stores (name, address, phone) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at",
+		store.Name, store.Address, store.Phone).Scan(&store.ID, &store.CreatedAt, &store.UpdatedAt)
+}
+
+func (r *StoreRepositoryImpl) Update(ctx context.Context, store Store) error {
+	return execOne(ctx, r.db, "UPDATE stores SET name = $1, address = $2, phone = $3, updated_at = NOW() WHERE id = $4 AND deleted_at IS NULL",
+		store.Name, store.Address, store.Phone, store.ID)
+}
+
+func (r *StoreRepositoryImpl) Delete(ctx context.Context, id int64) error {
+	return softDelete(ctx, r.db, "stores", id)
+}
+
+func (r *StoreRepositoryImpl) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, r.db, "stores", id)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/cache"
+)
+
+// Префиксы ключей кэша каталога; сброс идёт по префиксу целиком
+const (
+	cacheCategories    = "catalog:categories:"
+	cacheProducts      = "catalog:products:"
+	cacheManufacturers = "catalog:manufacturers:"
+)
+
+// CatalogCache - кэш чтения категорий, товаров и производителей. Значения хранятся в JSON
+// и сбрасываются при изменениях каталога. Чтение с реплики сразу после сброса может
+// вернуть в кэш устаревшие данные, поэтому ttl держим коротким.
+type CatalogCache struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+func NewCatalogCache(cache cache.Cache, ttl time.Duration) *CatalogCache {
+	return &CatalogCache{
+		cache: cache,
+		ttl:   ttl,
+	}
+}
+
+// readThrough возвращает значение из кэша, а при промахе загружает его через load и
+// сохраняет. Ошибки кэша не мешают чтению: значение просто берётся из базы данных.
+func readThrough[T any](ctx context.Context, c *CatalogCache, key string, load func() (T, error)) (T, error) {
+	if data, ok, err := c.cache.Get(ctx, key); err != nil {
+		slog.WarnContext(ctx, "кэш каталога: ошибка чтения", "key", key, "error", err)
+	} else if ok {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			return value, nil
+		}
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	if data, err := json.Marshal(value); err == nil {
+		if err := c.cache.Set(ctx, key, data, c.ttl); err != nil {
+			slog.WarnContext(ctx, "кэш каталога: ошибка записи", "key", key, "error", err)
+		}
+	}
+	return value, nil
+}
+
+// invalidate сбрасывает всё, что хранится под перечисленными префиксами
+func (c *CatalogCache) invalidate(ctx context.Context, prefixes ...string) {
+	for _, prefix := range prefixes {
+		if err := c.cache.DeletePrefix(ctx, prefix); err != nil {
+			slog.ErrorContext(ctx, "кэш каталога: ошибка сброса", "prefix", prefix, "error", err)
+		}
+	}
+}
+
+// Товары входят в выборки по категориям и в сводки брендов, категории - в выборки товаров
+// с подкатегориями и в сводки брендов, поэтому их изменения сбрасывают и соседние префиксы.
+
+func (c *CatalogCache) invalidateCategories(ctx context.Context) {
+	c.invalidate(ctx, cacheCategories, cacheProducts, cacheManufacturers)
+}
+
+func (c *CatalogCache) invalidateProducts(ctx context.Context) {
+	c.invalidate(ctx, cacheProducts, cacheManufacturers)
+}
+
+func (c *CatalogCache) invalidateManufacturers(ctx context.Context) {
+	c.invalidate(ctx, cacheManufacturers)
+}
+
+// HandlePriceChanged сбрасывает товары при изменении цены (в том числе цены варианта)
+func (c *CatalogCache) HandlePriceChanged(ctx context.Context, event PriceChanged) {
+	c.invalidateProducts(ctx)
+}
+
+// HandleCatalogChanged сбрасывает товары после изменений в обход ProductService (импорт каталога)
+func (c *CatalogCache) HandleCatalogChanged(ctx context.Context) {
+	c.invalidateProducts(ctx)
+}
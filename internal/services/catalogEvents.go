@@ -0,0 +1,87 @@
+package services
+
+import "context"
+
+// StockIncreased - остаток товара (или варианта) вырос: приёмка, возврат, перемещение, корректировка
+type StockIncreased struct {
+	ProductID int64
+	VariantID int64 // 0, если изменился остаток товара, а не варианта
+	StoreID   int64 // 0 для остатков без привязки к магазину
+	Quantity  int   // На сколько вырос остаток
+}
+
+// PriceChanged - изменилась цена товара или варианта
+type PriceChanged struct {
+	ProductID int64
+	VariantID int64
+	OldPrice  float64
+	NewPrice  float64
+}
+
+type StockIncreasedHandler func(ctx context.Context, event StockIncreased)
+
+type PriceChangedHandler func(ctx context.Context, event PriceChanged)
+
+// CatalogChangedHandler вызывается после изменений товаров, о которых нет отдельного события
+// (создание и правка товаров при импорте каталога)
+type CatalogChangedHandler func(ctx context.Context)
+
+// catalogEmitter встраивается в сервисы, меняющие остатки и цены. Обработчики вызываются
+// после фиксации транзакции и не могут её откатить, поэтому ошибки они обрабатывают сами.
+// Регистрировать обработчики нужно при запуске, до обработки запросов.
+type catalogEmitter struct {
+	stockHandlers []StockIncreasedHandler
+	priceHandlers []PriceChangedHandler
+
+	catalogHandlers []CatalogChangedHandler
+}
+
+func (e *catalogEmitter) OnStockIncreased(handler StockIncreasedHandler) {
+	e.stockHandlers = append(e.stockHandlers, handler)
+}
+
+func (e *catalogEmitter) OnPriceChanged(handler PriceChangedHandler) {
+	e.priceHandlers = append(e.priceHandlers, handler)
+}
+
+func (e *catalogEmitter) OnCatalogChanged(handler CatalogChangedHandler) {
+	e.catalogHandlers = append(e.catalogHandlers, handler)
+}
+
+func (e *catalogEmitter) emitStockIncreased(ctx context.Context, events ...StockIncreased) {
+	for _, event := range events {
+		for _, handler := range e.stockHandlers {
+			handler(ctx, event)
+		}
+	}
+}
+
+func (e *catalogEmitter) emitPriceChanged(ctx context.Context, events ...PriceChanged) {
+	for _, event := range events {
+		for _, handler := range e.priceHandlers {
+			handler(ctx, event)
+		}
+	}
+}
+
+func (e *catalogEmitter) emitCatalogChanged(ctx context.Context) {
+	for _, handler := range e.catalogHandlers {
+		handler(ctx)
+	}
+}
+
+// catalogChanges накапливает события внутри транзакции, чтобы отправить их после фиксации
+type catalogChanges struct {
+	stock  []StockIncreased
+	prices []PriceChanged
+}
+
+func (c *catalogChanges) merge(other catalogChanges) {
+	c.stock = append(c.stock, other.stock...)
+	c.prices = append(c.prices, other.prices...)
+}
+
+func (e *catalogEmitter) emitChanges(ctx context.Context, changes catalogChanges) {
+	e.emitStockIncreased(ctx, changes.stock...)
+	e.emitPriceChanged(ctx, changes.prices...)
+}
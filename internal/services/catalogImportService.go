@@ -0,0 +1,542 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/utils"
+)
+
+// Поля товара, которые можно загрузить из таблицы. Они же - заголовки столбцов экспорта,
+// поэтому выгруженный файл загружается обратно без сопоставления столбцов.
+const (
+	ImportFieldSKU          = "sku"
+	ImportFieldName         = "name"
+	ImportFieldDescription  = "description"
+	ImportFieldPrice        = "price"
+	ImportFieldStock        = "stock"
+	ImportFieldCategory     = "category"
+	ImportFieldManufacturer = "manufacturer"
+	ImportFieldImageURL     = "image_url"
+)
+
+var importFields = []string{
+	ImportFieldSKU,
+	ImportFieldName,
+	ImportFieldDescription,
+	ImportFieldPrice,
+	ImportFieldStock,
+	ImportFieldCategory,
+	ImportFieldManufacturer,
+	ImportFieldImageURL,
+}
+
+// Действия над строкой файла в отчёте импорта
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+	ImportActionSkip   = "skip"
+	ImportActionError  = "error"
+)
+
+var (
+	ErrImportEmpty   = errors.New("файл не содержит строк с товарами")
+	ErrImportColumns = errors.New("некорректные столбцы файла")
+)
+
+// errImportDryRun откатывает транзакцию пробного импорта
+var errImportDryRun = errors.New("пробный импорт")
+
+// ImportOptions - параметры загрузки. Mapping сопоставляет поле товара с заголовком столбца
+// в файле; поля без сопоставления ищутся по собственному имени.
+type ImportOptions struct {
+	Format  string            `json:"format"`
+	Mapping map[string]string `json:"mapping"`
+	DryRun  bool              `json:"dryRun"`
+	StoreID int64             `json:"storeId"` // Магазин, в котором ищутся категории
+}
+
+type ImportRowResult struct {
+	Row       int      `json:"row"` // Номер строки в файле, начиная с 1 (заголовок - строка 1)
+	SKU       string   `json:"sku"`
+	Action    string   `json:"action"`
+	ProductID int64    `json:"productId,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool              `json:"dryRun"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ExportFilter - отбор товаров для выгрузки
+type ExportFilter struct {
+	CategoryID     int64
+	ManufacturerID int64
+	StoreID        int64
+	Query          string // Подстрока названия или артикула
+	IncludeDeleted bool
+}
+
+type CatalogImportService interface {
+	ImportProducts(ctx context.Context, body io.Reader, opts ImportOptions) (*ImportReport, error)
+	ExportProducts(ctx context.Context, w io.Writer, format string, filter ExportFilter) error
+}
+
+type CatalogImportServiceImpl struct {
+	catalogEmitter
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewCatalogImportService(db db.Conn) *CatalogImportServiceImpl {
+	return &CatalogImportServiceImpl{
+		db: db,
+	}
+}
+
+// importRow - разобранная строка файла; nil-поле означает, что значение не задано
+// и при обновлении товара не меняется
+type importRow struct {
+	sku            string
+	name           *string
+	description    *string
+	price          *float64
+	stock          *int
+	categoryID     *int64
+	manufacturerID *int64
+	imageURL       *string
+}
+
+// ImportProducts загружает товары из CSV/XLSX с обновлением по артикулу. Каждая строка
+// применяется в своей точке сохранения, поэтому ошибочные строки не мешают остальным.
+// В режиме DryRun все изменения выполняются и откатываются, а отчёт показывает,
+// что было бы создано, обновлено и почему строки отклонены.
+func (s *CatalogImportServiceImpl) ImportProducts(ctx context.Context, body io.Reader, opts ImportOptions) (*ImportReport, error) {
+	table, err := utils.ReadTable(body, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	if len(table) < 2 {
+		return nil, ErrImportEmpty
+	}
+
+	columns, err := importColumns(table[0], opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Rows: []ImportRowResult{}}
+	var changes catalogChanges
+	err = s.db.WithTx(ctx, func(tx db.Querier) error {
+		resolver := newCatalogResolver(tx, opts.StoreID)
+		for i, cells := range table[1:] {
+			result := ImportRowResult{Row: i + 2}
+			if isBlankRow(cells) {
+				result.Action = ImportActionSkip
+				report.Skipped++
+				report.Rows = append(report.Rows, result)
+				continue
+			}
+
+			row, rowErrors := parseImportRow(ctx, resolver, columns, cells)
+			result.SKU = row.sku
+			if len(rowErrors) == 0 {
+				var rowChanges catalogChanges
+				var err error
+				result.ProductID, result.Action, rowChanges, err = s.applyImportRow(ctx, tx, row)
+				if err != nil {
+					rowErrors = append(rowErrors, err.Error())
+				} else {
+					changes.merge(rowChanges)
+				}
+			}
+
+			if len(rowErrors) > 0 {
+				result.Action = ImportActionError
+				result.Errors = rowErrors
+				report.Failed++
+			} else if result.Action == ImportActionCreate {
+				report.Created++
+			} else {
+				report.Updated++
+			}
+			report.Rows = append(report.Rows, result)
+		}
+
+		// Пробный импорт откатывается
+		if opts.DryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errImportDryRun) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.emitChanges(ctx, changes)
+	if report.Created+report.Updated > 0 {
+		s.emitCatalogChanged(ctx)
+	}
+	return report, nil
+}
+
+// importColumns находит номер столбца для каждого поля. Заголовки сравниваются без учёта регистра.
+func importColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	for field := range mapping {
+		if !containsString(importFields, field) {
+			return nil, fmt.Errorf("%w: неизвестное поле %q в сопоставлении", ErrImportColumns, field)
+		}
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, title := range header {
+		positions[strings.ToLower(strings.TrimSpace(title))] = i
+	}
+
+	columns := make(map[string]int)
+	for _, field := range importFields {
+		title := field
+		if mapped, ok := mapping[field]; ok {
+			title = mapped
+		}
+		if idx, ok := positions[strings.ToLower(strings.TrimSpace(title))]; ok {
+			columns[field] = idx
+		} else if _, ok := mapping[field]; ok {
+			return nil, fmt.Errorf("%w: нет столбца %q для поля %s", ErrImportColumns, title, field)
+		}
+	}
+
+	if _, ok := columns[ImportFieldSKU]; !ok {
+		return nil, fmt.Errorf("%w: нет столбца с артикулом (sku)", ErrImportColumns)
+	}
+	return columns, nil
+}
+
+func isBlankRow(cells []string) bool {
+	for _, cell := range cells {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseImportRow(ctx context.Context, resolver *catalogResolver, columns map[string]int, cells []string) (importRow, []string) {
+	value := func(field string) (string, bool) {
+		idx, ok := columns[field]
+		if !ok || idx >= len(cells) {
+			return "", false
+		}
+		v := strings.TrimSpace(cells[idx])
+		return v, v != ""
+	}
+
+	var row importRow
+	var rowErrors []string
+
+	row.sku, _ = value(ImportFieldSKU)
+	if row.sku == "" {
+		rowErrors = append(rowErrors, "не указан артикул")
+	}
+	if v, ok := value(ImportFieldName); ok {
+		row.name = &v
+	}
+	if v, ok := value(ImportFieldDescription); ok {
+		row.description = &v
+	}
+	if v, ok := value(ImportFieldImageURL); ok {
+		row.imageURL = &v
+	}
+
+	if v, ok := value(ImportFieldPrice); ok {
+		// Цены из русских прайс-листов приходят с десятичной запятой и пробелами в разрядах
+		price, err := strconv.ParseFloat(strings.ReplaceAll(strings.ReplaceAll(v, " ", ""), ",", "."), 64)
+		if err != nil || price < 0 {
+			rowErrors = append(rowErrors, fmt.Sprintf("некорректная цена %q", v))
+		} else {
+			price = roundMoney(price)
+			row.price = &price
+		}
+	}
+	if v, ok := value(ImportFieldStock); ok {
+		stock, err := strconv.Atoi(v)
+		if err != nil || stock < 0 {
+			rowErrors = append(rowErrors, fmt.Sprintf("некорректный остаток %q", v))
+		} else {
+			row.stock = &stock
+		}
+	}
+
+	if v, ok := value(ImportFieldCategory); ok {
+		id, err := resolver.category(ctx, v)
+		if err != nil {
+			rowErrors = append(rowErrors, err.Error())
+		} else {
+			row.categoryID = &id
+		}
+	}
+	if v, ok := value(ImportFieldManufacturer); ok {
+		id, err := resolver.manufacturer(ctx, v)
+		if err != nil {
+			rowErrors = append(rowErrors, err.Error())
+		} else {
+			row.manufacturerID = &id
+		}
+	}
+
+	return row, rowErrors
+}
+
+// applyImportRow создаёт или обновляет товар по артикулу. Товар, помеченный удалённым,
+// при повторной загрузке восстанавливается. Изменение цены записывается в price_change,
+// изменение остатка - движением в журнал stock_movements.
+func (s *CatalogImportServiceImpl) applyImportRow(ctx context.Context, tx db.Querier, row importRow) (id int64, action string, changes catalogChanges, err error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT import_row"); err != nil {
+		return 0, "", changes, err
+	}
+	defer func() {
+		if err != nil {
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row"); rbErr != nil {
+				err = rbErr
+			}
+			return
+		}
+		_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row")
+	}()
+
+	var oldPrice float64
+	var oldStock int
+	action = ImportActionUpdate
+	err = tx.QueryRowContext(ctx, "SELECT id, price, COALESCE(stock, 0) FROM products WHERE sku = $1 FOR UPDATE", row.sku).Scan(&id, &oldPrice, &oldStock)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if row.name == nil || row.price == nil {
+			return 0, "", changes, errors.New("для нового товара нужны название и цена")
+		}
+		// Остаток нового товара заводится приходом по журналу ниже
+		err = tx.QueryRowContext(ctx, `INSERT INTO products (sku, name, description, price, stock, category_id, manufacturer_id, image_url)
+			VALUES ($1, $2, COALESCE($3, ''), $4, 0, $5, $6, $7) RETURNING id`,
+			row.sku, *row.name, row.description, *row.price, row.categoryID, row.manufacturerID, row.imageURL).Scan(&id)
+		if err != nil {
+			return 0, "", changes, err
+		}
+		action = ImportActionCreate
+	case err != nil:
+		return 0, "", changes, err
+	default:
+		_, err = tx.ExecContext(ctx, `UPDATE products SET
+				name = COALESCE($1, name),
+				description = COALESCE($2, description),
+				price = COALESCE($3, price),
+				category_id = COALESCE($4, category_id),
+				manufacturer_id = COALESCE($5, manufacturer_id),
+				image_url = COALESCE($6, image_url),
+				deleted_at = NULL
+			WHERE id = $7`,
+			row.name, row.description, row.price, row.categoryID, row.manufacturerID, row.imageURL, id)
+		if err != nil {
+			return 0, "", changes, err
+		}
+
+		if row.price != nil && *row.price != oldPrice {
+			_, err = tx.ExecContext(ctx, "INSERT INTO price_change (product_id, old_price, new_price) VALUES ($1, $2, $3)", id, oldPrice, *row.price)
+			if err != nil {
+				return 0, "", changes, err
+			}
+			change := PriceChanged{ProductID: id, OldPrice: oldPrice, NewPrice: *row.price}
+			if err = publishPriceChanged(ctx, tx, change); err != nil {
+				return 0, "", changes, err
+			}
+			changes.prices = append(changes.prices, change)
+		}
+	}
+
+	// Остаток из файла не перезаписывается, а доводится движением по журналу на разницу
+	if row.stock != nil && *row.stock != oldStock {
+		kind := MovementAdjustment
+		if action == ImportActionCreate {
+			kind = MovementReceipt
+		}
+		err = applyCatalogStockMovement(ctx, tx, StockMovement{
+			ProductID: id, Kind: kind, Quantity: *row.stock - oldStock,
+			ReferenceType: MovementRefCatalogImport, Note: "импорт каталога",
+		})
+		if err != nil {
+			return 0, "", changes, err
+		}
+		if *row.stock > oldStock {
+			changes.stock = append(changes.stock, StockIncreased{ProductID: id, Quantity: *row.stock - oldStock})
+		}
+	}
+	return id, action, changes, nil
+}
+
+// catalogResolver находит категории и производителей по названию, запоминая результаты на время импорта
+type catalogResolver struct {
+	q             queryer
+	storeID       int64
+	categories    map[string]int64
+	manufacturers map[string]int64
+}
+
+func newCatalogResolver(q queryer, storeID int64) *catalogResolver {
+	return &catalogResolver{
+		q:             q,
+		storeID:       storeID,
+		categories:    make(map[string]int64),
+		manufacturers: make(map[string]int64),
+	}
+}
+
+func (r *catalogResolver) category(ctx context.Context, name string) (int64, error) {
+	key := strings.ToLower(name)
+	if id, ok := r.categories[key]; ok {
+		return id, nil
+	}
+
+	query := "SELECT id FROM categories WHERE LOWER(name) = $1 AND deleted_at IS NULL"
+	args := []any{key}
+	if r.storeID != 0 {
+		query += " AND store_id = $2"
+		args = append(args, r.storeID)
+	}
+
+	id, err := r.resolveOne(ctx, query+" LIMIT 2", args...)
+	switch {
+	case errors.Is(err, errAmbiguousName):
+		return 0, fmt.Errorf("категория %q есть в нескольких магазинах, укажите магазин", name)
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, fmt.Errorf("категория %q не найдена", name)
+	case err != nil:
+		return 0, err
+	}
+	r.categories[key] = id
+	return id, nil
+}
+
+func (r *catalogResolver) manufacturer(ctx context.Context, name string) (int64, error) {
+	key := strings.ToLower(name)
+	if id, ok := r.manufacturers[key]; ok {
+		return id, nil
+	}
+
+	id, err := r.resolveOne(ctx, "SELECT id FROM manufacturers WHERE LOWER(name) = $1 AND deleted_at IS NULL LIMIT 2", key)
+	switch {
+	case errors.Is(err, errAmbiguousName):
+		return 0, fmt.Errorf("найдено несколько производителей %q", name)
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, fmt.Errorf("производитель %q не найден", name)
+	case err != nil:
+		return 0, err
+	}
+	r.manufacturers[key] = id
+	return id, nil
+}
+
+var errAmbiguousName = errors.New("неоднозначное название")
+
+func (r *catalogResolver) resolveOne(ctx context.Context, query string, args ...any) (int64, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return 0, sql.ErrNoRows
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, errAmbiguousName
+	}
+}
+
+// ExportProducts построчно выгружает отфильтрованный каталог, не загружая его в память целиком
+func (s *CatalogImportServiceImpl) ExportProducts(ctx context.Context, w io.Writer, format string, filter ExportFilter) error {
+	query := `SELECT COALESCE(p.sku, ''), p.name, COALESCE(p.description, ''), p.price, COALESCE(p.stock, 0),
+			COALESCE(c.name, ''), COALESCE(m.name, ''), COALESCE(p.image_url, '')
+		FROM products p
+		LEFT JOIN categories c ON c.id = p.category_id
+		LEFT JOIN manufacturers m ON m.id = p.manufacturer_id
+		WHERE 1 = 1`
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if !filter.IncludeDeleted {
+		query += " AND p.deleted_at IS NULL"
+	}
+	if filter.CategoryID != 0 {
+		query += " AND p.category_id = " + arg(filter.CategoryID)
+	}
+	if filter.ManufacturerID != 0 {
+		query += " AND p.manufacturer_id = " + arg(filter.ManufacturerID)
+	}
+	if filter.StoreID != 0 {
+		query += " AND c.store_id = " + arg(filter.StoreID)
+	}
+	if filter.Query != "" {
+		pattern := arg("%" + strings.ToLower(filter.Query) + "%")
+		query += " AND (LOWER(p.name) LIKE " + pattern + " OR LOWER(p.sku) LIKE " + pattern + ")"
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY p.id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw, err := utils.NewTableWriter(w, format)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteRow(importFields); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var sku, name, description, category, manufacturer, imageURL string
+		var price float64
+		var stock int
+		if err := rows.Scan(&sku, &name, &description, &price, &stock, &category, &manufacturer, &imageURL); err != nil {
+			return err
+		}
+
+		err := tw.WriteRow([]string{sku, name, description, strconv.FormatFloat(price, 'f', 2, 64), strconv.Itoa(stock), category, manufacturer, imageURL})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -2,89 +2,259 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"time"
+	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Category struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+var (
+	ErrCategoryNotFound = errors.New("категория не найдена")
+	ErrCategoryCycle    = errors.New("нельзя переместить категорию внутрь её собственного поддерева")
+	ErrCategoryStore    = errors.New("родительская категория принадлежит другому магазину")
+	ErrCategorySlug     = errors.New("категория с таким slug уже есть в магазине")
+)
+
+// categorySlugMaxAttempts - сколько суффиксов перебрать для занятого slug, сгенерированного из названия
+const categorySlugMaxAttempts = 10
+
+type Category = repository.Category
+
+// CategoryNode - категория с вложенными подкатегориями для выдачи дерева
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// CategoryMove - перенос категории под другого родителя и/или на другую позицию
+type CategoryMove struct {
+	ID       int64 `json:"id" validate:"required"`
+	ParentID int64 `json:"parentId"`
+	Position int   `json:"position"`
 }
 
 type CategoryService interface {
-	GetAllCategories(ctx context.Context) ([]Category, error)
-	GetCategoryByID(ctx context.Context, id string) (*Category, error)
+	GetAllCategories(ctx context.Context, includeDeleted bool) ([]Category, error)
+	GetCategoryByID(ctx context.Context, id int64) (*Category, error)
+	GetCategoryTree(ctx context.Context, storeID int64) ([]*CategoryNode, error)
+	GetDescendantIDs(ctx context.Context, id int64) ([]int64, error)
 	CreateCategory(ctx context.Context, category Category) (*Category, error)
 	UpdateCategory(ctx context.Context, category Category) error
-	DeleteCategory(ctx context.Context, id string) error
+	MoveCategory(ctx context.Context, move CategoryMove) error
+	DeleteCategory(ctx context.Context, id int64) error
+	RestoreCategory(ctx context.Context, id int64) error
 }
 
 type CategoryServiceImpl struct {
-	db *db.DB // Ссылка на объект базы данных
+	uow        db.UnitOfWork
+	categories repository.CategoryRepository
+	cache      *CatalogCache
 }
 
-func NewCategoryService(db *db.DB) *CategoryServiceImpl {
+func NewCategoryService(uow db.UnitOfWork, categories repository.CategoryRepository, cache *CatalogCache) *CategoryServiceImpl {
 	return &CategoryServiceImpl{
-		db: db,
+		uow:        uow,
+		categories: categories,
+		cache:      cache,
 	}
 }
 
-func (s *CategoryServiceImpl) GetAllCategories(ctx context.Context) ([]Category, error) {
-	rows, err := s.db.QueryContext(ctx, "SELECT * FROM categories")
-	if err != nil {
-		return nil, err
+// categoryError заменяет repository.ErrNotFound на ErrCategoryNotFound
+func categoryError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrCategoryNotFound
 	}
-	defer rows.Close()
+	return err
+}
+
+func (s *CategoryServiceImpl) GetAllCategories(ctx context.Context, includeDeleted bool) ([]Category, error) {
+	return readThrough(ctx, s.cache, fmt.Sprintf("%sall:%t", cacheCategories, includeDeleted), func() ([]Category, error) {
+		return s.categories.List(ctx, includeDeleted)
+	})
+}
 
-	var categories []Category
-	for rows.Next() {
-		var category Category
-		if err := rows.Scan(&category.ID, &category.Name, &category.CreatedAt, &category.UpdatedAt); err != nil {
+func (s *CategoryServiceImpl) GetCategoryByID(ctx context.Context, id int64) (*Category, error) {
+	category, err := readThrough(ctx, s.cache, fmt.Sprintf("%sid:%d", cacheCategories, id), func() (*Category, error) {
+		return s.categories.GetByID(ctx, id)
+	})
+	return category, categoryError(err)
+}
+
+// GetCategoryTree возвращает дерево категорий магазина. Подкатегории удалённой категории
+// в дерево не попадают, даже если сами не удалены.
+func (s *CategoryServiceImpl) GetCategoryTree(ctx context.Context, storeID int64) ([]*CategoryNode, error) {
+	return readThrough(ctx, s.cache, fmt.Sprintf("%stree:%d", cacheCategories, storeID), func() ([]*CategoryNode, error) {
+		categories, err := s.categories.ListByStore(ctx, storeID)
+		if err != nil {
 			return nil, err
 		}
-		categories = append(categories, category)
-	}
+		return buildCategoryTree(categories), nil
+	})
+}
 
-	return categories, nil
+// GetDescendantIDs возвращает ID категории и всех её потомков
+func (s *CategoryServiceImpl) GetDescendantIDs(ctx context.Context, id int64) ([]int64, error) {
+	ids, err := s.categories.DescendantIDs(ctx, id)
+	return ids, categoryError(err)
 }
 
-func (s *CategoryServiceImpl) GetCategoryByID(ctx context.Context, id string) (*Category, error) {
-	var category Category
-	err := s.db.QueryRowContext(ctx, "SELECT * FROM categories WHERE id = $1", id).Scan(&category.ID, &category.Name, &category.CreatedAt, &category.UpdatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("категория не найдена")
+func (s *CategoryServiceImpl) CreateCategory(ctx context.Context, category Category) (*Category, error) {
+	if category.ParentID != 0 {
+		if err := checkParentStore(ctx, s.categories, category.ParentID, category.StoreID); err != nil {
+			return nil, err
 		}
+	}
+	err := saveWithSlug(&category, func() error { return s.categories.Create(ctx, &category) })
+	if err != nil {
 		return nil, err
 	}
+	s.cache.invalidateCategories(ctx)
 	return &category, nil
 }
 
-func (s *CategoryServiceImpl) CreateCategory(ctx context.Context, category Category) (*Category, error) {
-	result, err := s.db.ExecContext(ctx, "INSERT INTO categories (name) VALUES ($1)", category.Name)
+// UpdateCategory меняет название и slug. Родитель и позиция меняются через MoveCategory.
+func (s *CategoryServiceImpl) UpdateCategory(ctx context.Context, category Category) error {
+	if err := saveWithSlug(&category, func() error { return s.categories.Update(ctx, category) }); err != nil {
+		return categoryError(err)
+	}
+	s.cache.invalidateCategories(ctx)
+	return nil
+}
+
+// MoveCategory переносит категорию под нового родителя (ParentID 0 - в корень).
+// Перенос в собственное поддерево отклоняется, чтобы в дереве не появилось циклов.
+// Категория и ветвь нового родителя блокируются, проверка и перенос выполняются в одной транзакции.
+func (s *CategoryServiceImpl) MoveCategory(ctx context.Context, move CategoryMove) error {
+	err := s.uow.WithTx(ctx, func(tx db.Querier) error {
+		categories := s.categories.WithTx(tx)
+		if err := categories.LockForMove(ctx, move.ID, move.ParentID); err != nil {
+			return err
+		}
+		category, err := categories.GetByID(ctx, move.ID)
+		if err != nil {
+			return categoryError(err)
+		}
+
+		if move.ParentID != 0 {
+			if move.ParentID == move.ID {
+				return ErrCategoryCycle
+			}
+			if err := checkParentStore(ctx, categories, move.ParentID, category.StoreID); err != nil {
+				return err
+			}
+
+			cycle, err := categories.IsDescendant(ctx, move.ParentID, move.ID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return ErrCategoryCycle
+			}
+		}
+
+		return categoryError(categories.Move(ctx, move.ID, move.ParentID, move.Position))
+	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	s.cache.invalidateCategories(ctx)
+	return nil
+}
+
+func (s *CategoryServiceImpl) DeleteCategory(ctx context.Context, id int64) error {
+	if err := s.categories.Delete(ctx, id); err != nil {
+		return categoryError(err)
+	}
+	s.cache.invalidateCategories(ctx)
+	return nil
+}
+
+func (s *CategoryServiceImpl) RestoreCategory(ctx context.Context, id int64) error {
+	if err := s.categories.Restore(ctx, id); err != nil {
+		return categoryError(err)
+	}
+	s.cache.invalidateCategories(ctx)
+	return nil
+}
+
+// saveWithSlug сохраняет категорию через save. Если slug не задан, он строится из названия,
+// а при совпадении с существующим получает суффикс "-2", "-3" и т. д.
+// Занятый slug, заданный явно, - ErrCategorySlug.
+func saveWithSlug(category *Category, save func() error) error {
+	if category.Slug != "" {
+		err := save()
+		if errors.Is(err, repository.ErrDuplicate) {
+			return ErrCategorySlug
+		}
+		return err
+	}
+
+	base := slugify(category.Name)
+	for attempt := 1; attempt <= categorySlugMaxAttempts; attempt++ {
+		category.Slug = base
+		if attempt > 1 {
+			category.Slug = fmt.Sprintf("%s-%d", base, attempt)
+		}
+		if err := save(); !errors.Is(err, repository.ErrDuplicate) {
+			return err
+		}
 	}
+	return ErrCategorySlug
+}
 
-	lastInsertID, err := result.LastInsertId()
+func checkParentStore(ctx context.Context, categories repository.CategoryRepository, parentID, storeID int64) error {
+	parent, err := categories.GetByID(ctx, parentID)
 	if err != nil {
-		return nil, err
+		return categoryError(err)
 	}
-	category.ID = lastInsertID
-	return &category, nil
+	if parent.StoreID != storeID {
+		return ErrCategoryStore
+	}
+	return nil
 }
 
-func (s *CategoryServiceImpl) UpdateCategory(ctx context.Context, category Category) error {
-	_, err := s.db.ExecContext(ctx, "UPDATE categories SET name = $1 WHERE id = $2", category.Name, category.ID)
-	return err
+// buildCategoryTree собирает дерево из плоского списка, сохраняя порядок списка
+func buildCategoryTree(categories []Category) []*CategoryNode {
+	nodes := make(map[int64]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if parent, ok := nodes[category.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		} else if category.ParentID == 0 {
+			roots = append(roots, node)
+		}
+	}
+	return roots
 }
 
-func (s *CategoryServiceImpl) DeleteCategory(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, "DELETE FROM categories WHERE id = $1", id)
-	return err
+var (
+	slugTranslit = map[rune]string{
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+		'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+		'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+		'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+		'я': "ya",
+	}
+	slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// slugify делает из названия латинский slug: "Жидкости для POD" -> "zhidkosti-dlya-pod"
+func slugify(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if latin, ok := slugTranslit[r]; ok {
+			b.WriteString(latin)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return strings.Trim(slugInvalid.ReplaceAllString(b.String(), "-"), "-")
 }
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/cache"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"кириллица", "Жидкости для POD", "zhidkosti-dlya-pod"},
+		{"ё, ъ и ь", "Съёмный мундштук", "semnyy-mundshtuk"},
+		{"цифры и латиница", "Salt 20 mg", "salt-20-mg"},
+		{"знаки препинания схлопываются", "  Испарители / койлы!!  ", "ispariteli-koyly"},
+		{"щ, ц, ю, я", "Щётка-цыплёнок Юля", "schetka-tsyplenok-yulya"},
+		{"только знаки", "???", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slugify(tt.in); got != tt.want {
+				t.Errorf("slugify(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveWithSlug(t *testing.T) {
+	tests := []struct {
+		name     string
+		slug     string
+		taken    int // Сколько первых вариантов slug заняты
+		want     string
+		wantErr  error
+		attempts int
+	}{
+		{"свободный slug из названия", "", 0, "zhidkosti", nil, 1},
+		{"суффикс при совпадении", "", 2, "zhidkosti-3", nil, 3},
+		{"все суффиксы заняты", "", categorySlugMaxAttempts, "", ErrCategorySlug, categorySlugMaxAttempts},
+		{"явный slug свободен", "liquids", 0, "liquids", nil, 1},
+		{"явный slug занят", "liquids", 1, "", ErrCategorySlug, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category := Category{Name: "Жидкости", Slug: tt.slug}
+			attempts := 0
+			err := saveWithSlug(&category, func() error {
+				attempts++
+				if attempts <= tt.taken {
+					return repository.ErrDuplicate
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("saveWithSlug() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("попыток = %d, want %d", attempts, tt.attempts)
+			}
+			if err == nil && category.Slug != tt.want {
+				t.Errorf("slug = %q, want %q", category.Slug, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveCategory(t *testing.T) {
+	categoryColumns := []string{"id", "store_id", "parent_id", "name", "slug", "position", "created_at", "updated_at", "deleted_at"}
+
+	tests := []struct {
+		name       string
+		move       CategoryMove
+		parentShop int64 // Магазин нового родителя
+		descendant bool  // Новый родитель лежит в поддереве переносимой категории
+		wantErr    error
+	}{
+		{"перенос под другую ветку", CategoryMove{ID: 1, ParentID: 2}, 1, false, nil},
+		{"перенос в корень", CategoryMove{ID: 1}, 1, false, nil},
+		{"под саму себя", CategoryMove{ID: 1, ParentID: 1}, 1, false, ErrCategoryCycle},
+		{"под своего потомка", CategoryMove{ID: 1, ParentID: 2}, 1, true, ErrCategoryCycle},
+		{"под категорию другого магазина", CategoryMove{ID: 1, ParentID: 2}, 2, false, ErrCategoryStore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			var queries []string
+			stub.on("FOR UPDATE", func(args []any) (*stubRows, error) {
+				queries = append(queries, "lock")
+				return rowsOf([]string{"id"}, []driver.Value{args[0]}), nil
+			})
+			stub.on("FROM categories WHERE id = $1 AND deleted_at IS NULL", func(args []any) (*stubRows, error) {
+				queries = append(queries, "get")
+				store := int64(1)
+				if args[0] == tt.move.ParentID && args[0] != tt.move.ID {
+					store = tt.parentShop
+				}
+				return rowsOf(categoryColumns, []driver.Value{args[0], store, int64(0), "Жидкости", "zhidkosti", int64(0), time.Now(), time.Now(), nil}), nil
+			})
+			stub.rows("SELECT EXISTS (SELECT 1 FROM ancestors", []string{"exists"}, []driver.Value{tt.descendant})
+
+			repo := repository.NewCategoryRepository(conn, conn)
+			s := NewCategoryService(stubUnitOfWork{conn}, repo, NewCatalogCache(cache.NewMemoryCache(10), time.Minute))
+			err := s.MoveCategory(context.Background(), tt.move)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveCategory() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(queries) == 0 || queries[0] != "lock" {
+				t.Errorf("запросы = %v: категории не заблокированы до проверки", queries)
+			}
+			if moved := len(stub.executed("SET parent_id")) > 0; moved != (tt.wantErr == nil) {
+				t.Errorf("категория перенесена = %v", moved)
+			}
+		})
+	}
+}
@@ -3,93 +3,76 @@ package services
 import (
 	"context"
 	"errors"
-	"time"
 
-	"database/sql"
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Customer struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Phone     string    `json:"phone"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-}
+type Customer = repository.Customer
 
 type CustomerService interface {
-	GetAllCustomers() ([]Customer, error)
-	GetCustomerByID(id string) (*Customer, error)
-	CreateCustomer(customer Customer) (*Customer, error)
-	UpdateCustomer(customer Customer) error
-	DeleteCustomer(id string) error
+	GetAllCustomers(ctx context.Context, includeDeleted bool) ([]Customer, error)
+	GetCustomerByID(ctx context.Context, id int64) (*Customer, error)
+	CreateCustomer(ctx context.Context, customer Customer) (*Customer, error)
+	UpdateCustomer(ctx context.Context, customer Customer) error
+	DeleteCustomer(ctx context.Context, id int64) error
+	RestoreCustomer(ctx context.Context, id int64) error
 }
 
 type CustomerServiceImpl struct {
-	db *sql.DB // Ссылка на объект базы данных
+	uow       db.UnitOfWork
+	customers repository.CustomerRepository
 }
 
-func NewCustomerService(db *sql.DB) *CustomerServiceImpl {
+func NewCustomerService(uow db.UnitOfWork, customers repository.CustomerRepository) *CustomerServiceImpl {
 	return &CustomerServiceImpl{
-		db: db,
+		uow:       uow,
+		customers: customers,
 	}
 }
 
-func (s *CustomerServiceImpl) GetAllCustomers() ([]Customer, error) {
-	rows, err := s.db.QueryContext(context.Background(), "SELECT * FROM customers")
-	if err != nil {
-		return nil, err
+// customerError заменяет repository.ErrNotFound на ErrCustomerNotFound
+func customerError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrCustomerNotFound
 	}
-	defer rows.Close()
+	return err
+}
 
-	var customers []Customer
-	for rows.Next() {
-		var customer Customer
-		if err := rows.Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Phone, &customer.Address, &customer.CreatedAt, &customer.UpdatedAt); err != nil {
-			return nil, err
-		}
-		customers = append(customers, customer)
-	}
+func (s *CustomerServiceImpl) GetAllCustomers(ctx context.Context, includeDeleted bool) ([]Customer, error) {
+	return s.customers.List(ctx, includeDeleted)
+}
 
-	return customers, nil
+func (s *CustomerServiceImpl) GetCustomerByID(ctx context.Context, id int64) (*Customer, error) {
+	customer, err := s.customers.GetByID(ctx, id)
+	return customer, customerError(err)
 }
 
-func (s *CustomerServiceImpl) GetCustomerByID(id string) (*Customer, error) {
-	var customer Customer
-	err := s.db.QueryRowContext(context.Background(), "SELECT * FROM customers WHERE id = $1", id).Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Phone, &customer.Address, &customer.CreatedAt, &customer.UpdatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("клиент не найден")
+// CreateCustomer регистрирует покупателя и публикует CustomerRegistered в той же транзакции
+func (s *CustomerServiceImpl) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	err := s.uow.WithTx(ctx, func(tx db.Querier) error {
+		if err := s.customers.WithTx(tx).Create(ctx, &customer); err != nil {
+			return err
 		}
+		return publishEvent(ctx, tx, EventCustomerRegistered, AggregateCustomer, customer.ID, CustomerRegisteredPayload{
+			CustomerID: EventID(customer.ID),
+			Email:      customer.Email,
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &customer, nil
 }
 
-func (s *CustomerServiceImpl) CreateCustomer(customer Customer) (*Customer, error) {
-	ctx := context.Background()
-	result, err := s.db.ExecContext(ctx, "INSERT INTO customers (name, email, phone, address) VALUES ($1, $2, $3, $4)", customer.Name, customer.Email, customer.Phone, customer.Address)
-	if err != nil {
-		return nil, err
-	}
-
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-	customer.ID = lastInsertID
-	return &customer, nil
+func (s *CustomerServiceImpl) UpdateCustomer(ctx context.Context, customer Customer) error {
+	return customerError(s.customers.Update(ctx, customer))
 }
 
-func (s *CustomerServiceImpl) UpdateCustomer(customer Customer) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "UPDATE customers SET name = $1, email = $2, phone = $3, address = $4 WHERE id = $5", customer.Name, customer.Email, customer.Phone, customer.Address, customer.ID)
-	return err
+func (s *CustomerServiceImpl) DeleteCustomer(ctx context.Context, id int64) error {
+	return customerError(s.customers.Delete(ctx, id))
 }
 
-func (s *CustomerServiceImpl) DeleteCustomer(id string) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "DELETE FROM customers WHERE id = $1", id)
-	return err
+func (s *CustomerServiceImpl) RestoreCustomer(ctx context.Context, id int64) error {
+	return customerError(s.customers.Restore(ctx, id))
 }
@@ -1,95 +1,114 @@
-package services //блять я рот ебал этих бд, не забудь потом пройтись по всему коду и заменить
+package services
 
 import (
 	"context"
 	"errors"
-	"time"
 
-	"database/sql"
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Delivery struct {
-	ID         string    `json:"id"`
-	CustomerID string    `json:"customerId"`
-	StoreID    string    `json:"storeId"`
-	Address    string    `json:"address"`
-	Status     string    `json:"status"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+type Delivery = repository.Delivery
+
+var ErrDeliveryNotFound = errors.New("доставка не найдена")
+
+type DeliveryStatusUpdate struct {
+	ID             int64  `json:"id" validate:"required"`
+	Status         string `json:"status" validate:"required"`
+	TrackingNumber string `json:"trackingNumber,omitempty"` // Пусто - оставить прежний трек-номер
 }
 
 type DeliveryService interface {
-	GetAllDeliveries() ([]Delivery, error)
-	GetDeliveryByID(id string) (*Delivery, error)
-	CreateDelivery(delivery Delivery) (*Delivery, error)
-	UpdateDelivery(delivery Delivery) error
-	DeleteDelivery(id string) error
+	GetAllDeliveries(ctx context.Context) ([]Delivery, error)
+	GetDeliveryByID(ctx context.Context, id int64) (*Delivery, error)
+	CreateDelivery(ctx context.Context, delivery Delivery) (*Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery Delivery) error
+	UpdateDeliveryStatus(ctx context.Context, update DeliveryStatusUpdate) error
+	DeleteDelivery(ctx context.Context, id int64) error
 }
 
 type DeliveryServiceImpl struct {
-	db *sql.DB // Ссылка на объект базы данных
+	uow        db.UnitOfWork
+	deliveries repository.DeliveryRepository
+	purchases  repository.PurchaseRepository
 }
 
-func NewDeliveryService(db *sql.DB) *DeliveryServiceImpl {
+func NewDeliveryService(uow db.UnitOfWork, deliveries repository.DeliveryRepository, purchases repository.PurchaseRepository) *DeliveryServiceImpl {
 	return &DeliveryServiceImpl{
-		db: db,
+		uow:        uow,
+		deliveries: deliveries,
+		purchases:  purchases,
 	}
 }
 
-func (s *DeliveryServiceImpl) GetAllDeliveries() ([]Delivery, error) {
-	rows, err := s.db.QueryContext(context.Background(), "SELECT * FROM deliveries")
-	if err != nil {
-		return nil, err
+// deliveryError заменяет repository.ErrNotFound на ErrDeliveryNotFound
+func deliveryError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrDeliveryNotFound
 	}
-	defer rows.Close()
+	return err
+}
 
-	var deliveries []Delivery
-	for rows.Next() {
-		var delivery Delivery
-		if err := rows.Scan(&delivery.ID, &delivery.CustomerID, &delivery.StoreID, &delivery.Address, &delivery.Status, &delivery.CreatedAt, &delivery.UpdatedAt); err != nil {
-			return nil, err
-		}
-		deliveries = append(deliveries, delivery)
-	}
+func (s *DeliveryServiceImpl) GetAllDeliveries(ctx context.Context) ([]Delivery, error) {
+	return s.deliveries.List(ctx)
+}
 
-	return deliveries, nil
+func (s *DeliveryServiceImpl) GetDeliveryByID(ctx context.Context, id int64) (*Delivery, error) {
+	delivery, err := s.deliveries.GetByID(ctx, id)
+	return delivery, deliveryError(err)
 }
 
-func (s *DeliveryServiceImpl) GetDeliveryByID(id string) (*Delivery, error) {
-	var delivery Delivery
-	err := s.db.QueryRowContext(context.Background(), "SELECT * FROM deliveries WHERE id = $1", id).Scan(&delivery.ID, &delivery.CustomerID, &delivery.StoreID, &delivery.Address, &delivery.Status, &delivery.CreatedAt, &delivery.UpdatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("доставка не найдена")
-		}
+func (s *DeliveryServiceImpl) CreateDelivery(ctx context.Context, delivery Delivery) (*Delivery, error) {
+	if err := s.deliveries.Create(ctx, &delivery); err != nil {
 		return nil, err
 	}
 	return &delivery, nil
 }
 
-func (s *DeliveryServiceImpl) CreateDelivery(delivery Delivery) (*Delivery, error) {
-	ctx := context.Background()
-	result, err := s.db.ExecContext(ctx, "INSERT INTO deliveries (customerId, storeId, address, status) VALUES ($1, $2, $3, $4)", delivery.CustomerID, delivery.StoreID, delivery.Address, delivery.Status)
-	if err != nil {
-		return nil, err
-	}
-
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-	delivery.ID = lastInsertID
-	return &delivery, nil
+func (s *DeliveryServiceImpl) UpdateDelivery(ctx context.Context, delivery Delivery) error {
+	return deliveryError(s.deliveries.Update(ctx, delivery))
 }
 
-func (s *DeliveryServiceImpl) UpdateDelivery(delivery Delivery) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "UPDATE deliveries SET customerId = $1, storeId = $2, address = $3, status = $4 WHERE id = $5", delivery.CustomerID, delivery.StoreID, delivery.Address, delivery.Status, delivery.ID)
-	return err
+func (s *DeliveryServiceImpl) DeleteDelivery(ctx context.Context, id int64) error {
+	return deliveryError(s.deliveries.Delete(ctx, id))
 }
 
-func (s *DeliveryServiceImpl) DeleteDelivery(id string) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "DELETE FROM deliveries WHERE id = $1", id)
-	return err
+// UpdateDeliveryStatus меняет статус и трек-номер доставки и публикует DeliveryStatusChanged
+func (s *DeliveryServiceImpl) UpdateDeliveryStatus(ctx context.Context, update DeliveryStatusUpdate) error {
+	err := s.uow.WithTx(ctx, func(tx db.Querier) error {
+		deliveries := s.deliveries.WithTx(tx)
+		delivery, err := deliveries.GetForUpdate(ctx, update.ID)
+		if err != nil {
+			return err
+		}
+
+		event := DeliveryStatusChangedPayload{
+			DeliveryID: EventID(delivery.ID),
+			PurchaseID: EventID(delivery.PurchaseID),
+			OldStatus:  delivery.Status,
+			NewStatus:  update.Status,
+		}
+		if delivery.PurchaseID != 0 {
+			purchase, err := s.purchases.WithTx(tx).GetByID(ctx, delivery.PurchaseID)
+			if err != nil {
+				return err
+			}
+			event.CustomerID = EventID(purchase.CustomerID)
+		}
+
+		delivery.Status = update.Status
+		if update.TrackingNumber != "" {
+			delivery.TrackingNumber = update.TrackingNumber
+		}
+		event.TrackingNumber = delivery.TrackingNumber
+		if err := deliveries.Update(ctx, *delivery); err != nil {
+			return err
+		}
+
+		if event.OldStatus == event.NewStatus {
+			return nil
+		}
+		return publishEvent(ctx, tx, EventDeliveryStatusChanged, AggregateDelivery, delivery.ID, event)
+	})
+	return deliveryError(err)
 }
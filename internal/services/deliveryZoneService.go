@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Способы доставки
+const (
+	DeliveryMethodCourier       = "courier"
+	DeliveryMethodPickupPoint   = "pickup_point"
+	DeliveryMethodInStorePickup = "in_store_pickup"
+)
+
+type DeliveryZone struct {
+	ID                    int64     `json:"id"`
+	StoreID               int64     `json:"storeId" validate:"required"`
+	Name                  string    `json:"name" validate:"required"`
+	City                  string    `json:"city"`
+	PostalPrefix          string    `json:"postalPrefix"`
+	RadiusKm              float64   `json:"radiusKm"`
+	FreeShippingThreshold float64   `json:"freeShippingThreshold"` // 0 - бесплатной доставки нет
+	CreatedAt             time.Time `json:"createdAt"`
+	UpdatedAt             time.Time `json:"updatedAt"`
+}
+
+type DeliveryMethod struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code" validate:"required,oneof=courier pickup_point in_store_pickup"`
+	Name string `json:"name" validate:"required"`
+}
+
+// DeliveryRate - строка тарифной сетки: цена доставки способом MethodID в зоне ZoneID
+// для заказов с весом до MaxWeight грамм и суммой до MaxOrderValue (0 - без ограничения).
+type DeliveryRate struct {
+	ID            int64   `json:"id"`
+	ZoneID        int64   `json:"zoneId" validate:"required"`
+	MethodID      int64   `json:"methodId" validate:"required"`
+	MaxWeight     int     `json:"maxWeight"`
+	MaxOrderValue float64 `json:"maxOrderValue"`
+	Price         float64 `json:"price"`
+}
+
+type QuoteItem struct {
+	ProductID int64 `json:"productId" validate:"required"`
+	Quantity  int   `json:"quantity" validate:"required,min=1"`
+}
+
+type QuoteRequest struct {
+	StoreID    int64       `json:"storeId" validate:"required"`
+	City       string      `json:"city"`
+	PostalCode string      `json:"postalCode"`
+	Latitude   float64     `json:"latitude"`
+	Longitude  float64     `json:"longitude"`
+	Items      []QuoteItem `json:"items" validate:"required,min=1,dive"`
+}
+
+type QuoteOption struct {
+	ZoneID       int64   `json:"zoneId"`
+	MethodID     int64   `json:"methodId"`
+	MethodCode   string  `json:"methodCode"`
+	MethodName   string  `json:"methodName"`
+	Price        float64 `json:"price"`
+	FreeShipping bool    `json:"freeShipping"`
+}
+
+type Quote struct {
+	OrderValue  float64       `json:"orderValue"`
+	OrderWeight int           `json:"orderWeight"`
+	Options     []QuoteOption `json:"options"`
+}
+
+type DeliveryZoneService interface {
+	GetZonesByStore(ctx context.Context, storeID int64) ([]DeliveryZone, error)
+	CreateZone(ctx context.Context, zone DeliveryZone) (*DeliveryZone, error)
+	DeleteZone(ctx context.Context, id int64) error
+	GetAllMethods(ctx context.Context) ([]DeliveryMethod, error)
+	CreateMethod(ctx context.Context, method DeliveryMethod) (*DeliveryMethod, error)
+	GetRatesByZone(ctx context.Context, zoneID int64) ([]DeliveryRate, error)
+	CreateRate(ctx context.Context, rate DeliveryRate) (*DeliveryRate, error)
+	DeleteRate(ctx context.Context, id int64) error
+	Quote(ctx context.Context, req QuoteRequest) (*Quote, error)
+}
+
+type DeliveryZoneServiceImpl struct {
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewDeliveryZoneService(db db.Conn) *DeliveryZoneServiceImpl {
+	return &DeliveryZoneServiceImpl{
+		db: db,
+	}
+}
+
+func (s *DeliveryZoneServiceImpl) GetZonesByStore(ctx context.Context, storeID int64) ([]DeliveryZone, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, store_id, name, city, postal_prefix, radius_km, free_shipping_threshold, created_at, updated_at FROM delivery_zones WHERE store_id = $1", storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []DeliveryZone
+	for rows.Next() {
+		var zone DeliveryZone
+		if err := rows.Scan(&zone.ID, &zone.StoreID, &zone.Name, &zone.City, &zone.PostalPrefix, &zone.RadiusKm, &zone.FreeShippingThreshold, &zone.CreatedAt, &zone.UpdatedAt); err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, rows.Err()
+}
+
+func (s *DeliveryZoneServiceImpl) CreateZone(ctx context.Context, zone DeliveryZone) (*DeliveryZone, error) {
+	err := s.db.QueryRowContext(ctx, "INSERT INTO delivery_zones (store_id, name, city, postal_prefix, radius_km, free_shipping_threshold) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+		zone.StoreID, zone.Name, zone.City, zone.PostalPrefix, zone.RadiusKm, zone.FreeShippingThreshold).Scan(&zone.ID, &zone.CreatedAt, &zone.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (s *DeliveryZoneServiceImpl) DeleteZone(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM delivery_zones WHERE id = $1", id)
+	return err
+}
+
+func (s *DeliveryZoneServiceImpl) GetAllMethods(ctx context.Context) ([]DeliveryMethod, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, code, name FROM delivery_methods")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var methods []DeliveryMethod
+	for rows.Next() {
+		var method DeliveryMethod
+		if err := rows.Scan(&method.ID, &method.Code, &method.Name); err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+
+	return methods, rows.Err()
+}
+
+func (s *DeliveryZoneServiceImpl) CreateMethod(ctx context.Context, method DeliveryMethod) (*DeliveryMethod, error) {
+	err := s.db.QueryRowContext(ctx, "INSERT INTO delivery_methods (code, name) VALUES ($1, $2) RETURNING id", method.Code, method.Name).Scan(&method.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &method, nil
+}
+
+func (s *DeliveryZoneServiceImpl) GetRatesByZone(ctx context.Context, zoneID int64) ([]DeliveryRate, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, zone_id, method_id, max_weight, max_order_value, price FROM delivery_rates WHERE zone_id = $1", zoneID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []DeliveryRate
+	for rows.Next() {
+		var rate DeliveryRate
+		if err := rows.Scan(&rate.ID, &rate.ZoneID, &rate.MethodID, &rate.MaxWeight, &rate.MaxOrderValue, &rate.Price); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *DeliveryZoneServiceImpl) CreateRate(ctx context.Context, rate DeliveryRate) (*DeliveryRate, error) {
+	err := s.db.QueryRowContext(ctx, "INSERT INTO delivery_rates (zone_id, method_id, max_weight, max_order_value, price) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		rate.ZoneID, rate.MethodID, rate.MaxWeight, rate.MaxOrderValue, rate.Price).Scan(&rate.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (s *DeliveryZoneServiceImpl) DeleteRate(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM delivery_rates WHERE id = $1", id)
+	return err
+}
+
+// Quote считает стоимость доставки корзины всеми доступными способами.
+// Сумма и вес заказа берутся из таблицы товаров, а не из запроса.
+func (s *DeliveryZoneServiceImpl) Quote(ctx context.Context, req QuoteRequest) (*Quote, error) {
+	quote := &Quote{Options: []QuoteOption{}}
+	for _, item := range req.Items {
+		var price float64
+		var weight int
+		err := s.db.QueryRowContext(ctx, "SELECT price, COALESCE(weight, 0) FROM products WHERE id = $1 AND deleted_at IS NULL", item.ProductID).Scan(&price, &weight)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrProductNotFound
+			}
+			return nil, err
+		}
+		quote.OrderValue += price * float64(item.Quantity)
+		quote.OrderWeight += weight * item.Quantity
+	}
+
+	var storeLat, storeLon sql.NullFloat64
+	err := s.db.QueryRowContext(ctx, "SELECT latitude, longitude FROM stores WHERE id = $1 AND deleted_at IS NULL", req.StoreID).Scan(&storeLat, &storeLon)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrStoreNotFound
+		}
+		return nil, err
+	}
+
+	zones, err := s.GetZonesByStore(ctx, req.StoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := s.GetAllMethods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	methodsByID := make(map[int64]DeliveryMethod, len(methods))
+	for _, method := range methods {
+		methodsByID[method.ID] = method
+	}
+
+	// Для каждого способа доставки берём самый дешёвый подходящий тариф среди всех зон
+	best := make(map[int64]QuoteOption)
+	for _, zone := range zones {
+		if !zoneMatches(zone, req, storeLat, storeLon) {
+			continue
+		}
+
+		rates, err := s.GetRatesByZone(ctx, zone.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rate := range rates {
+			if !rateMatches(rate, quote.OrderWeight, quote.OrderValue) {
+				continue
+			}
+			method, ok := methodsByID[rate.MethodID]
+			if !ok {
+				continue
+			}
+
+			option := QuoteOption{
+				ZoneID:     zone.ID,
+				MethodID:   method.ID,
+				MethodCode: method.Code,
+				MethodName: method.Name,
+				Price:      rate.Price,
+			}
+			if method.Code == DeliveryMethodInStorePickup || (zone.FreeShippingThreshold > 0 && quote.OrderValue >= zone.FreeShippingThreshold) {
+				option.Price = 0
+				option.FreeShipping = true
+			}
+
+			if current, ok := best[method.ID]; !ok || option.Price < current.Price {
+				best[method.ID] = option
+			}
+		}
+	}
+
+	for _, option := range best {
+		quote.Options = append(quote.Options, option)
+	}
+	sort.Slice(quote.Options, func(i, j int) bool {
+		return quote.Options[i].Price < quote.Options[j].Price
+	})
+
+	return quote, nil
+}
+
+// zoneMatches проверяет, попадает ли адрес доставки в зону: по городу,
+// по префиксу почтового индекса или по расстоянию от магазина.
+func zoneMatches(zone DeliveryZone, req QuoteRequest, storeLat, storeLon sql.NullFloat64) bool {
+	if zone.City != "" && strings.EqualFold(strings.TrimSpace(zone.City), strings.TrimSpace(req.City)) {
+		return true
+	}
+	if zone.PostalPrefix != "" && strings.HasPrefix(req.PostalCode, zone.PostalPrefix) {
+		return true
+	}
+	if zone.RadiusKm > 0 && storeLat.Valid && storeLon.Valid && (req.Latitude != 0 || req.Longitude != 0) {
+		return distanceKm(storeLat.Float64, storeLon.Float64, req.Latitude, req.Longitude) <= zone.RadiusKm
+	}
+	return false
+}
+
+func rateMatches(rate DeliveryRate, weight int, value float64) bool {
+	if rate.MaxWeight > 0 && weight > rate.MaxWeight {
+		return false
+	}
+	if rate.MaxOrderValue > 0 && value > rate.MaxOrderValue {
+		return false
+	}
+	return true
+}
+
+// distanceKm - расстояние между двумя точками по формуле гаверсинусов
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
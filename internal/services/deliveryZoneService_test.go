@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestZoneMatches(t *testing.T) {
+	// Магазин в центре Москвы; точка примерно в 5 км к северу
+	storeLat := sql.NullFloat64{Float64: 55.7558, Valid: true}
+	storeLon := sql.NullFloat64{Float64: 37.6173, Valid: true}
+
+	tests := []struct {
+		name     string
+		zone     DeliveryZone
+		req      QuoteRequest
+		lat, lon sql.NullFloat64
+		want     bool
+	}{
+		{"город без учёта регистра и пробелов", DeliveryZone{City: "Москва"}, QuoteRequest{City: " москва "}, storeLat, storeLon, true},
+		{"другой город", DeliveryZone{City: "Москва"}, QuoteRequest{City: "Казань"}, storeLat, storeLon, false},
+		{"префикс индекса", DeliveryZone{PostalPrefix: "101"}, QuoteRequest{PostalCode: "101000"}, storeLat, storeLon, true},
+		{"другой индекс", DeliveryZone{PostalPrefix: "101"}, QuoteRequest{PostalCode: "420000"}, storeLat, storeLon, false},
+		{"в радиусе", DeliveryZone{RadiusKm: 10}, QuoteRequest{Latitude: 55.8008, Longitude: 37.6173}, storeLat, storeLon, true},
+		{"за радиусом", DeliveryZone{RadiusKm: 3}, QuoteRequest{Latitude: 55.8008, Longitude: 37.6173}, storeLat, storeLon, false},
+		{"радиус без координат адреса", DeliveryZone{RadiusKm: 10}, QuoteRequest{}, storeLat, storeLon, false},
+		{"радиус без координат магазина", DeliveryZone{RadiusKm: 10}, QuoteRequest{Latitude: 55.8, Longitude: 37.6}, sql.NullFloat64{}, sql.NullFloat64{}, false},
+		{"пустая зона", DeliveryZone{}, QuoteRequest{City: "Москва", PostalCode: "101000"}, storeLat, storeLon, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zoneMatches(tt.zone, tt.req, tt.lat, tt.lon); got != tt.want {
+				t.Errorf("zoneMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   DeliveryRate
+		weight int
+		value  float64
+		want   bool
+	}{
+		{"без ограничений", DeliveryRate{}, 100000, 1e6, true},
+		{"вес на границе", DeliveryRate{MaxWeight: 1000}, 1000, 0, true},
+		{"тяжелее", DeliveryRate{MaxWeight: 1000}, 1001, 0, false},
+		{"сумма на границе", DeliveryRate{MaxOrderValue: 5000}, 0, 5000, true},
+		{"дороже", DeliveryRate{MaxOrderValue: 5000}, 0, 5000.01, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rateMatches(tt.rate, tt.weight, tt.value); got != tt.want {
+				t.Errorf("rateMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	zoneColumns := []string{"id", "store_id", "name", "city", "postal_prefix", "radius_km", "free_shipping_threshold", "created_at", "updated_at"}
+	rateColumns := []string{"id", "zone_id", "method_id", "max_weight", "max_order_value", "price"}
+
+	tests := []struct {
+		name        string
+		quantity    int
+		wantValue   float64
+		wantOptions []QuoteOption
+	}{
+		{
+			name:      "самый дешёвый тариф по каждому способу",
+			quantity:  1,
+			wantValue: 1000,
+			wantOptions: []QuoteOption{
+				{ZoneID: 1, MethodID: 3, MethodCode: DeliveryMethodInStorePickup, MethodName: "Самовывоз", Price: 0, FreeShipping: true},
+				{ZoneID: 2, MethodID: 1, MethodCode: DeliveryMethodCourier, MethodName: "Курьер", Price: 250},
+				{ZoneID: 1, MethodID: 2, MethodCode: DeliveryMethodPickupPoint, MethodName: "ПВЗ", Price: 300},
+			},
+		},
+		{
+			name:      "бесплатная доставка от порога зоны и тарифы по весу",
+			quantity:  3,
+			wantValue: 3000,
+			wantOptions: []QuoteOption{
+				{ZoneID: 1, MethodID: 1, MethodCode: DeliveryMethodCourier, MethodName: "Курьер", Price: 0, FreeShipping: true},
+				{ZoneID: 1, MethodID: 3, MethodCode: DeliveryMethodInStorePickup, MethodName: "Самовывоз", Price: 0, FreeShipping: true},
+				{ZoneID: 1, MethodID: 2, MethodCode: DeliveryMethodPickupPoint, MethodName: "ПВЗ", Price: 0, FreeShipping: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			now := time.Now()
+			stub.rows("FROM products", []string{"price", "weight"}, []driver.Value{1000.0, int64(500)})
+			stub.rows("FROM stores", []string{"latitude", "longitude"}, []driver.Value{55.7558, 37.6173})
+			stub.rows("FROM delivery_zones", zoneColumns,
+				[]driver.Value{int64(1), int64(1), "Москва", "Москва", "", 0.0, 2500.0, now, now},
+				[]driver.Value{int64(2), int64(1), "Центр", "", "101", 0.0, 0.0, now, now},
+				[]driver.Value{int64(3), int64(1), "Казань", "Казань", "", 0.0, 0.0, now, now},
+			)
+			stub.rows("FROM delivery_methods", []string{"id", "code", "name"},
+				[]driver.Value{int64(1), DeliveryMethodCourier, "Курьер"},
+				[]driver.Value{int64(2), DeliveryMethodPickupPoint, "ПВЗ"},
+				[]driver.Value{int64(3), DeliveryMethodInStorePickup, "Самовывоз"},
+			)
+			stub.on("FROM delivery_rates", func(args []any) (*stubRows, error) {
+				switch args[0] {
+				case int64(1):
+					return rowsOf(rateColumns,
+						[]driver.Value{int64(11), int64(1), int64(1), int64(1000), 0.0, 400.0},
+						[]driver.Value{int64(12), int64(1), int64(1), int64(0), 0.0, 600.0},
+						[]driver.Value{int64(13), int64(1), int64(2), int64(0), 0.0, 300.0},
+						[]driver.Value{int64(14), int64(1), int64(3), int64(0), 0.0, 100.0},
+					), nil
+				case int64(2):
+					// Только для лёгких заказов
+					return rowsOf(rateColumns, []driver.Value{int64(21), int64(2), int64(1), int64(1000), 0.0, 250.0}), nil
+				}
+				return rowsOf(rateColumns, []driver.Value{int64(31), int64(3), int64(1), int64(0), 0.0, 10.0}), nil
+			})
+
+			s := NewDeliveryZoneService(stubUnitOfWork{conn})
+			quote, err := s.Quote(context.Background(), QuoteRequest{
+				StoreID:    1,
+				City:       "Москва",
+				PostalCode: "101000",
+				Items:      []QuoteItem{{ProductID: 7, Quantity: tt.quantity}},
+			})
+			if err != nil {
+				t.Fatalf("Quote() error = %v", err)
+			}
+			if quote.OrderValue != tt.wantValue {
+				t.Errorf("OrderValue = %v, want %v", quote.OrderValue, tt.wantValue)
+			}
+			if quote.OrderWeight != 500*tt.quantity {
+				t.Errorf("OrderWeight = %v, want %v", quote.OrderWeight, 500*tt.quantity)
+			}
+			assertQuoteOptions(t, quote.Options, tt.wantOptions)
+		})
+	}
+}
+
+func TestQuoteSkipsDeleted(t *testing.T) {
+	tests := []struct {
+		name         string
+		productFound bool
+		storeFound   bool
+		wantErr      error
+	}{
+		{"удалённый товар", false, true, ErrProductNotFound},
+		{"закрытый магазин", true, false, ErrStoreNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			// Заглушка отвечает только на запросы с фильтром удалённых строк
+			product := rowsOf([]string{"price", "weight"})
+			if tt.productFound {
+				product = rowsOf([]string{"price", "weight"}, []driver.Value{1000.0, int64(500)})
+			}
+			stub.on("FROM products WHERE id = $1 AND deleted_at IS NULL", func([]any) (*stubRows, error) { return product, nil })
+			stub.on("FROM stores WHERE id = $1 AND deleted_at IS NULL", func([]any) (*stubRows, error) {
+				if !tt.storeFound {
+					return rowsOf([]string{"latitude", "longitude"}), nil
+				}
+				return rowsOf([]string{"latitude", "longitude"}, []driver.Value{55.7558, 37.6173}), nil
+			})
+
+			s := NewDeliveryZoneService(stubUnitOfWork{conn})
+			_, err := s.Quote(context.Background(), QuoteRequest{StoreID: 1, City: "Москва", Items: []QuoteItem{{ProductID: 7, Quantity: 1}}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Quote() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// assertQuoteOptions сравнивает варианты без учёта порядка среди вариантов с одинаковой ценой
+func assertQuoteOptions(t *testing.T, got, want []QuoteOption) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("options = %+v, want %+v", got, want)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Price < got[i-1].Price {
+			t.Errorf("options не отсортированы по цене: %+v", got)
+		}
+	}
+	byMethod := make(map[int64]QuoteOption, len(got))
+	for _, option := range got {
+		byMethod[option.MethodID] = option
+	}
+	for _, option := range want {
+		if byMethod[option.MethodID] != option {
+			t.Errorf("option %d = %+v, want %+v", option.MethodID, byMethod[option.MethodID], option)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы доменных событий
+const (
+	EventPurchaseCreated       = "purchase.created"
+	EventPurchaseStatusChanged = "purchase.status_changed"
+	EventPriceChanged          = "product.price_changed"
+	EventStockChanged          = "product.stock_changed"
+	EventCustomerRegistered    = "customer.registered"
+	EventDeliveryStatusChanged = "delivery.status_changed"
+)
+
+// Агрегаты событий: события одного агрегата доставляются подписчику в порядке публикации
+const (
+	AggregatePurchase = "purchase"
+	AggregateProduct  = "product"
+	AggregateCustomer = "customer"
+	AggregateDelivery = "delivery"
+)
+
+// DomainEvent - событие из таблицы domain_events. Payload - JSON одной из структур *Payload ниже.
+type DomainEvent struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateID   string          `json:"aggregateId"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+// Decode разбирает данные события в структуру, соответствующую его типу
+func (e DomainEvent) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EventID - ID в данных события. В JSON пишется строкой, как до перехода на числовые ID,
+// а 0 (ссылки нет) - пустой строкой. Читаются и строки, и числа, поэтому события,
+// записанные раньше (в том числе с пустым customerId у гостевых заказов), разбираются как прежде.
+type EventID int64
+
+func (id EventID) MarshalJSON() ([]byte, error) {
+	if id == 0 {
+		return []byte(`""`), nil
+	}
+	return []byte(`"` + strconv.FormatInt(int64(id), 10) + `"`), nil
+}
+
+func (id *EventID) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	if text == "" || text == "null" {
+		*id = 0
+		return nil
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("некорректный ID в событии: %s", data)
+	}
+	*id = EventID(value)
+	return nil
+}
+
+type PurchaseCreatedPayload struct {
+	PurchaseID EventID `json:"purchaseId"`
+	CustomerID EventID `json:"customerId"`
+	Status     string  `json:"status"`
+}
+
+type PurchaseStatusChangedPayload struct {
+	PurchaseID EventID `json:"purchaseId"`
+	CustomerID EventID `json:"customerId"`
+	OldStatus  string  `json:"oldStatus"`
+	NewStatus  string  `json:"newStatus"`
+}
+
+type DeliveryStatusChangedPayload struct {
+	DeliveryID     EventID `json:"deliveryId"`
+	PurchaseID     EventID `json:"purchaseId,omitempty"`
+	CustomerID     EventID `json:"customerId,omitempty"`
+	OldStatus      string  `json:"oldStatus"`
+	NewStatus      string  `json:"newStatus"`
+	TrackingNumber string  `json:"trackingNumber,omitempty"`
+}
+
+type PriceChangedPayload struct {
+	ProductID EventID `json:"productId"`
+	VariantID EventID `json:"variantId,omitempty"`
+	OldPrice  float64 `json:"oldPrice"`
+	NewPrice  float64 `json:"newPrice"`
+}
+
+type StockChangedPayload struct {
+	ProductID EventID `json:"productId"`
+	VariantID EventID `json:"variantId,omitempty"`
+	StoreID   EventID `json:"storeId,omitempty"`
+	Delta     int     `json:"delta"`  // Изменение остатка, отрицательное при списании
+	Reason    string  `json:"reason"` // Вид движения по журналу
+}
+
+type CustomerRegisteredPayload struct {
+	CustomerID EventID `json:"customerId"`
+	Email      string  `json:"email"`
+}
+
+// publishEvent записывает событие в таблицу domain_events и ставит его в очередь доставки
+// каждому подписчику этого типа. Вызывается в транзакции изменения: событие фиксируется
+// вместе с ним и не публикуется, если транзакция откатится. aggregate_id общий для агрегатов
+// всех типов, поэтому хранится строкой.
+func publishEvent(ctx context.Context, db execer, eventType, aggregateType string, aggregateID int64, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `WITH event AS (
+			INSERT INTO domain_events (event_type, aggregate_type, aggregate_id, payload) VALUES ($1, $2, $3, $4) RETURNING id
+		)
+		INSERT INTO event_deliveries (subscriber, event_id)
+		SELECT s.name, event.id FROM event, event_subscribers s WHERE $1 = ANY(s.event_types)`,
+		eventType, aggregateType, strconv.FormatInt(aggregateID, 10), data)
+	return err
+}
+
+func publishPriceChanged(ctx context.Context, db execer, change PriceChanged) error {
+	return publishEvent(ctx, db, EventPriceChanged, AggregateProduct, change.ProductID, PriceChangedPayload{
+		ProductID: EventID(change.ProductID),
+		VariantID: EventID(change.VariantID),
+		OldPrice:  change.OldPrice,
+		NewPrice:  change.NewPrice,
+	})
+}
+
+func publishStockChanged(ctx context.Context, db execer, payload StockChangedPayload) error {
+	if payload.Delta == 0 {
+		return nil
+	}
+	return publishEvent(ctx, db, EventStockChanged, AggregateProduct, int64(payload.ProductID), payload)
+}
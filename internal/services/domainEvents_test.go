@@ -0,0 +1,43 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEventIDDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    PurchaseStatusChangedPayload
+		wantErr bool
+	}{
+		{"строковые ID", `{"purchaseId":"42","customerId":"7","newStatus":"paid"}`, PurchaseStatusChangedPayload{PurchaseID: 42, CustomerID: 7, NewStatus: "paid"}, false},
+		{"гостевой заказ из старого события", `{"purchaseId":"42","customerId":"","newStatus":"paid"}`, PurchaseStatusChangedPayload{PurchaseID: 42, NewStatus: "paid"}, false},
+		{"числовые ID", `{"purchaseId":42,"customerId":null}`, PurchaseStatusChangedPayload{PurchaseID: 42}, false},
+		{"не число", `{"purchaseId":"abc"}`, PurchaseStatusChangedPayload{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got PurchaseStatusChangedPayload
+			err := DomainEvent{Payload: json.RawMessage(tt.payload)}.Decode(&got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventIDEncode(t *testing.T) {
+	data, err := json.Marshal(PurchaseCreatedPayload{PurchaseID: 42, Status: PurchaseStatusAwaitingPayment})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"purchaseId":"42","customerId":"","status":"awaiting_payment"}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/lib/pq"
+)
+
+// Статусы доставки события подписчику
+const (
+	EventDeliveryPending   = "pending"
+	EventDeliveryDelivered = "delivered"
+	EventDeliveryFailed    = "failed" // Исчерпаны попытки; следующие события агрегата ждут ручного повтора
+)
+
+const eventBatchSize = 100
+
+var ErrEventDeliveryNotFound = errors.New("доставка события не найдена")
+
+// DomainEventHandler обрабатывает событие в транзакции доставки: изменения в БД фиксируются
+// вместе с отметкой о доставке, а при ошибке откатываются, и событие будет доставлено повторно.
+// Внешние действия (отправка запросов) могут повториться, поэтому обработчик должен быть идемпотентным.
+// Действия, которые нельзя откатить (счётчики метрик), обработчик откладывает через afterCommit.
+type DomainEventHandler func(ctx context.Context, tx db.Querier, event DomainEvent) error
+
+type commitHooksKey struct{}
+
+// afterCommit откладывает fn до фиксации транзакции доставки события. Если обработчик вернёт
+// ошибку или транзакция откатится, fn не выполняется. Вне диспетчера fn выполняется сразу.
+func afterCommit(ctx context.Context, fn func()) {
+	if hooks, ok := ctx.Value(commitHooksKey{}).(*[]func()); ok {
+		*hooks = append(*hooks, fn)
+		return
+	}
+	fn()
+}
+
+type FailedEventDelivery struct {
+	Subscriber string      `json:"subscriber"`
+	Event      DomainEvent `json:"event"`
+	Attempts   int         `json:"attempts"`
+	LastError  string      `json:"lastError"`
+}
+
+type EventDispatcher interface {
+	Subscribe(name string, handler DomainEventHandler, eventTypes ...string)
+	Register(ctx context.Context) error
+	Dispatch(ctx context.Context) (int, error)
+	GetFailedDeliveries(ctx context.Context, subscriber string) ([]FailedEventDelivery, error)
+	RetryDelivery(ctx context.Context, subscriber string, eventID int64) error
+	RunDispatcher(ctx context.Context, interval time.Duration)
+}
+
+type eventSubscriber struct {
+	handler    DomainEventHandler
+	eventTypes []string
+}
+
+type EventDispatcherImpl struct {
+	db          db.Conn // Ссылка на объект базы данных
+	maxAttempts int     // После стольких неудачных попыток доставка помечается failed
+	subscribers map[string]eventSubscriber
+}
+
+func NewEventDispatcher(db db.Conn, maxAttempts int) *EventDispatcherImpl {
+	return &EventDispatcherImpl{
+		db:          db,
+		maxAttempts: maxAttempts,
+		subscribers: make(map[string]eventSubscriber),
+	}
+}
+
+// Subscribe добавляет подписчика. Имя подписчика хранится в БД вместе с очередью его доставок,
+// поэтому его нельзя менять между запусками. Подписываться нужно до вызова Register.
+func (d *EventDispatcherImpl) Subscribe(name string, handler DomainEventHandler, eventTypes ...string) {
+	d.subscribers[name] = eventSubscriber{handler: handler, eventTypes: eventTypes}
+}
+
+// Register сохраняет подписчиков в БД. Начиная с этого момента publishEvent ставит
+// им в очередь новые события; более ранние события подписчик не получает.
+func (d *EventDispatcherImpl) Register(ctx context.Context) error {
+	for name, sub := range d.subscribers {
+		_, err := d.db.ExecContext(ctx, `INSERT INTO event_subscribers (name, event_types) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET event_types = EXCLUDED.event_types`, name, pq.Array(sub.eventTypes))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *EventDispatcherImpl) subscriberNames() []string {
+	names := make([]string, 0, len(d.subscribers))
+	for name := range d.subscribers {
+		names = append(names, name)
+	}
+	return names
+}
+
+const eventColumns = "e.id, e.event_type, e.aggregate_type, e.aggregate_id, e.payload, e.created_at"
+
+func scanDomainEvent(row interface{ Scan(...any) error }, e *DomainEvent, extra ...any) error {
+	return row.Scan(append([]any{&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &e.Payload, &e.CreatedAt}, extra...)...)
+}
+
+type pendingDelivery struct {
+	subscriber string
+	attempts   int
+	event      DomainEvent
+}
+
+// Dispatch доставляет очередную пачку событий. Событие берётся, только если все более ранние
+// события того же агрегата уже доставлены этому подписчику, поэтому порядок внутри агрегата
+// сохраняется даже при повторах. Доставки блокируются до конца транзакции (SKIP LOCKED),
+// и несколько экземпляров сервиса не обработают одно событие одновременно.
+// Действия, отложенные обработчиками через afterCommit, выполняются после фиксации.
+// Возвращает число доставленных событий.
+func (d *EventDispatcherImpl) Dispatch(ctx context.Context) (int, error) {
+	delivered := 0
+	var committed []func()
+	err := d.db.WithTx(ctx, func(tx db.Querier) error {
+		rows, err := tx.QueryContext(ctx, "SELECT "+eventColumns+`, d.subscriber, d.attempts
+			FROM event_deliveries d
+			JOIN domain_events e ON e.id = d.event_id
+			WHERE d.status = $1 AND d.next_attempt_at <= NOW() AND d.subscriber = ANY($2)
+				AND NOT EXISTS (
+					SELECT 1 FROM event_deliveries pd
+					JOIN domain_events pe ON pe.id = pd.event_id
+					WHERE pd.subscriber = d.subscriber AND pd.status <> $3
+						AND pe.aggregate_type = e.aggregate_type AND pe.aggregate_id = e.aggregate_id AND pe.id < e.id
+				)
+			ORDER BY e.id
+			LIMIT $4
+			FOR UPDATE OF d SKIP LOCKED`, EventDeliveryPending, pq.Array(d.subscriberNames()), EventDeliveryDelivered, eventBatchSize)
+		if err != nil {
+			return err
+		}
+		var batch []pendingDelivery
+		for rows.Next() {
+			var p pendingDelivery
+			if err := scanDomainEvent(rows, &p.event, &p.subscriber, &p.attempts); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, p := range batch {
+			hooks, handleErr, err := d.handle(ctx, tx, p)
+			if err != nil {
+				return err
+			}
+			if handleErr == nil {
+				committed = append(committed, hooks...)
+				_, err = tx.ExecContext(ctx, "UPDATE event_deliveries SET status = $1, attempts = attempts + 1, last_error = NULL, delivered_at = NOW() WHERE subscriber = $2 AND event_id = $3",
+					EventDeliveryDelivered, p.subscriber, p.event.ID)
+				delivered++
+			} else {
+				status := EventDeliveryPending
+				if p.attempts+1 >= d.maxAttempts {
+					status = EventDeliveryFailed
+				}
+				_, err = tx.ExecContext(ctx, "UPDATE event_deliveries SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE subscriber = $4 AND event_id = $5",
+					status, handleErr.Error(), time.Now().Add(outboxRetryDelay(p.attempts+1)), p.subscriber, p.event.ID)
+				slog.WarnContext(ctx, "подписчик не обработал событие", "subscriber", p.subscriber, "event_id", p.event.ID, "event_type", p.event.Type, "attempt", p.attempts+1, "error", handleErr)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, fn := range committed {
+		fn()
+	}
+	return delivered, nil
+}
+
+// handle вызывает обработчик внутри точки сохранения, чтобы его ошибка откатила только
+// его собственные изменения. hooks - действия, отложенные обработчиком до фиксации,
+// handleErr - ошибка обработчика, err - ошибка БД.
+func (d *EventDispatcherImpl) handle(ctx context.Context, tx db.Querier, p pendingDelivery) (hooks []func(), handleErr, err error) {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT event_delivery"); err != nil {
+		return nil, nil, err
+	}
+	handlerCtx := context.WithValue(ctx, commitHooksKey{}, &hooks)
+	if handleErr = d.subscribers[p.subscriber].handler(handlerCtx, tx, p.event); handleErr != nil {
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT event_delivery"); err != nil {
+			return nil, nil, err
+		}
+		return nil, handleErr, nil
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT event_delivery")
+	return hooks, nil, err
+}
+
+func (d *EventDispatcherImpl) GetFailedDeliveries(ctx context.Context, subscriber string) ([]FailedEventDelivery, error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT "+eventColumns+`, d.subscriber, d.attempts, COALESCE(d.last_error, '')
+		FROM event_deliveries d
+		JOIN domain_events e ON e.id = d.event_id
+		WHERE d.status = $1 AND ($2 = '' OR d.subscriber = $2)
+		ORDER BY e.id`, EventDeliveryFailed, subscriber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failed := []FailedEventDelivery{}
+	for rows.Next() {
+		var f FailedEventDelivery
+		if err := scanDomainEvent(rows, &f.Event, &f.Subscriber, &f.Attempts, &f.LastError); err != nil {
+			return nil, err
+		}
+		failed = append(failed, f)
+	}
+
+	return failed, rows.Err()
+}
+
+// RetryDelivery возвращает в очередь доставку, для которой исчерпаны попытки
+func (d *EventDispatcherImpl) RetryDelivery(ctx context.Context, subscriber string, eventID int64) error {
+	result, err := d.db.ExecContext(ctx, "UPDATE event_deliveries SET status = $1, attempts = 0, next_attempt_at = NOW() WHERE subscriber = $2 AND event_id = $3 AND status = $4",
+		EventDeliveryPending, subscriber, eventID, EventDeliveryFailed)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrEventDeliveryNotFound
+	}
+	return nil
+}
+
+// RunDispatcher периодически вызывает Dispatch, пока не отменён ctx
+func (d *EventDispatcherImpl) RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Разбираем очередь пачками, пока она не опустеет
+			for {
+				n, err := d.Dispatch(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "ошибка доставки событий", "error", err)
+					break
+				}
+				if n < eventBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+func TestDispatchAfterCommit(t *testing.T) {
+	errHandler := errors.New("обработчик не справился")
+	errUpdate := errors.New("соединение потеряно")
+
+	tests := []struct {
+		name       string
+		handlerErr error
+		updateErr  error // Ошибка отметки о доставке - транзакция откатывается
+		wantErr    error
+		wantHook   bool
+	}{
+		{"событие обработано", nil, nil, nil, true},
+		{"ошибка обработчика", errHandler, nil, nil, false},
+		{"транзакция откатилась", nil, errUpdate, errUpdate, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.rows("FROM event_deliveries d", []string{"id", "event_type", "aggregate_type", "aggregate_id", "payload", "created_at", "subscriber", "attempts"},
+				[]driver.Value{int64(1), EventPurchaseCreated, "purchase", "42", []byte(`{"purchaseId":"42"}`), time.Now(), "metrics", int64(0)})
+			if tt.updateErr != nil {
+				stub.on("UPDATE event_deliveries", func([]any) (*stubRows, error) { return nil, tt.updateErr })
+			}
+
+			d := NewEventDispatcher(stubUnitOfWork{conn}, 3)
+			hookRuns := 0
+			markedBeforeHook := false
+			d.Subscribe("metrics", func(ctx context.Context, tx db.Querier, event DomainEvent) error {
+				afterCommit(ctx, func() {
+					hookRuns++
+					markedBeforeHook = len(stub.executed("UPDATE event_deliveries")) > 0
+				})
+				return tt.handlerErr
+			}, EventPurchaseCreated)
+
+			delivered, err := d.Dispatch(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Dispatch() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantHook {
+				if hookRuns != 1 || !markedBeforeHook || delivered != 1 {
+					t.Errorf("выполнено отложенных действий = %d, после отметки о доставке = %v, доставлено = %d", hookRuns, markedBeforeHook, delivered)
+				}
+			} else if hookRuns != 0 {
+				t.Errorf("отложенное действие выполнено %d раз, хотя доставка не зафиксирована", hookRuns)
+			}
+		})
+	}
+}
+
+func TestAfterCommitOutsideDispatcher(t *testing.T) {
+	ran := false
+	afterCommit(context.Background(), func() { ran = true })
+	if !ran {
+		t.Error("вне диспетчера действие не выполнено сразу")
+	}
+}
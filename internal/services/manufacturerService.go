@@ -3,91 +3,215 @@ package services
 import (
 	"context"
 	"errors"
-	"time"
+	"fmt"
 
-	"database/sql"
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Manufacturer struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Country   string    `json:"country"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+var ErrManufacturerNotFound = errors.New("производитель не найден")
+
+type Manufacturer = repository.Manufacturer
+
+// BrandCategoryCount - количество товаров бренда в категории
+type BrandCategoryCount struct {
+	CategoryID   int64  `json:"categoryId"`
+	CategoryName string `json:"categoryName"`
+	Count        int    `json:"count"`
+}
+
+// BrandItem - товар или жидкость бренда в сводке
+type BrandItem struct {
+	Kind         string  `json:"kind"` // product или liquid
+	ID           int64   `json:"id"`
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	ImageURL     string  `json:"imageUrl"`
+	SoldQuantity int     `json:"soldQuantity,omitempty"`
 }
 
+// ManufacturerSummary - данные для страницы бренда
+type ManufacturerSummary struct {
+	Manufacturer     Manufacturer         `json:"manufacturer"`
+	ProductCount     int                  `json:"productCount"`
+	LiquidCount      int                  `json:"liquidCount"`
+	CountsByCategory []BrandCategoryCount `json:"countsByCategory"`
+	MinPrice         float64              `json:"minPrice"`
+	MaxPrice         float64              `json:"maxPrice"`
+	TopSellers       []BrandItem          `json:"topSellers"`
+	NewArrivals      []BrandItem          `json:"newArrivals"`
+}
+
+const brandSummaryLimit = 5
+
 type ManufacturerService interface {
-	GetAllManufacturers() ([]Manufacturer, error)
-	GetManufacturerByID(id string) (*Manufacturer, error)
-	CreateManufacturer(manufacturer Manufacturer) (*Manufacturer, error)
-	UpdateManufacturer(manufacturer Manufacturer) error
-	DeleteManufacturer(id string) error
+	GetAllManufacturers(ctx context.Context, includeDeleted bool) ([]Manufacturer, error)
+	GetManufacturerByID(ctx context.Context, id int64) (*Manufacturer, error)
+	GetManufacturerSummary(ctx context.Context, id int64) (*ManufacturerSummary, error)
+	CreateManufacturer(ctx context.Context, manufacturer Manufacturer) (*Manufacturer, error)
+	UpdateManufacturer(ctx context.Context, manufacturer Manufacturer) error
+	DeleteManufacturer(ctx context.Context, id int64) error
+	RestoreManufacturer(ctx context.Context, id int64) error
 }
 
 type ManufacturerServiceImpl struct {
-	db *sql.DB // Ссылка на объект базы данных
+	manufacturers repository.ManufacturerRepository
+	read          db.Querier // Для сводки по бренду: реплики, если они настроены
+	cache         *CatalogCache
 }
 
-func NewManufacturerService(db *sql.DB) *ManufacturerServiceImpl {
+func NewManufacturerService(manufacturers repository.ManufacturerRepository, read db.Querier, cache *CatalogCache) *ManufacturerServiceImpl {
 	return &ManufacturerServiceImpl{
-		db: db,
+		manufacturers: manufacturers,
+		read:          read,
+		cache:         cache,
 	}
 }
 
-func (s *ManufacturerServiceImpl) GetAllManufacturers() ([]Manufacturer, error) {
-	rows, err := s.db.QueryContext(context.Background(), "SELECT * FROM manufacturers")
+// manufacturerError заменяет repository.ErrNotFound на ErrManufacturerNotFound
+func manufacturerError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrManufacturerNotFound
+	}
+	return err
+}
+
+func (s *ManufacturerServiceImpl) GetAllManufacturers(ctx context.Context, includeDeleted bool) ([]Manufacturer, error) {
+	return readThrough(ctx, s.cache, fmt.Sprintf("%sall:%t", cacheManufacturers, includeDeleted), func() ([]Manufacturer, error) {
+		return s.manufacturers.List(ctx, includeDeleted)
+	})
+}
+
+func (s *ManufacturerServiceImpl) GetManufacturerByID(ctx context.Context, id int64) (*Manufacturer, error) {
+	return readThrough(ctx, s.cache, fmt.Sprintf("%sid:%d", cacheManufacturers, id), func() (*Manufacturer, error) {
+		manufacturer, err := s.manufacturers.GetByID(ctx, id)
+		return manufacturer, manufacturerError(err)
+	})
+}
+
+// GetManufacturerSummary собирает сводку для страницы бренда по товарам (manufacturer_id)
+// и жидкостям (brand_id). Топ продаж считается по позициям покупок.
+func (s *ManufacturerServiceImpl) GetManufacturerSummary(ctx context.Context, id int64) (*ManufacturerSummary, error) {
+	return readThrough(ctx, s.cache, fmt.Sprintf("%ssummary:%d", cacheManufacturers, id), func() (*ManufacturerSummary, error) {
+		return s.buildSummary(ctx, id)
+	})
+}
+
+func (s *ManufacturerServiceImpl) buildSummary(ctx context.Context, id int64) (*ManufacturerSummary, error) {
+	manufacturer, err := s.manufacturers.GetByID(ctx, id)
+	if err != nil {
+		return nil, manufacturerError(err)
+	}
+	summary := &ManufacturerSummary{
+		Manufacturer:     *manufacturer,
+		CountsByCategory: []BrandCategoryCount{},
+		TopSellers:       []BrandItem{},
+		NewArrivals:      []BrandItem{},
+	}
+
+	err = s.read.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM products WHERE manufacturer_id = $1 AND deleted_at IS NULL), (SELECT COUNT(*) FROM liquids WHERE brand_id = $1)", id).
+		Scan(&summary.ProductCount, &summary.LiquidCount)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var manufacturers []Manufacturer
+	err = s.read.QueryRowContext(ctx, `SELECT COALESCE(MIN(price), 0), COALESCE(MAX(price), 0) FROM (
+		SELECT price FROM products WHERE manufacturer_id = $1 AND deleted_at IS NULL
+		UNION ALL
+		SELECT price FROM liquids WHERE brand_id = $1
+	) prices`, id).Scan(&summary.MinPrice, &summary.MaxPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.read.QueryContext(ctx, `SELECT c.id, c.name, COUNT(*) FROM products p
+		JOIN categories c ON c.id = p.category_id
+		WHERE p.manufacturer_id = $1 AND p.deleted_at IS NULL
+		GROUP BY c.id, c.name ORDER BY COUNT(*) DESC, c.name`, id)
+	if err != nil {
+		return nil, err
+	}
 	for rows.Next() {
-		var manufacturer Manufacturer
-		if err := rows.Scan(&manufacturer.ID, &manufacturer.Name, &manufacturer.Country, &manufacturer.CreatedAt, &manufacturer.UpdatedAt); err != nil {
+		var count BrandCategoryCount
+		if err := rows.Scan(&count.CategoryID, &count.CategoryName, &count.Count); err != nil {
+			rows.Close()
 			return nil, err
 		}
-		manufacturers = append(manufacturers, manufacturer)
+		summary.CountsByCategory = append(summary.CountsByCategory, count)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return manufacturers, nil
-}
-
-func (s *ManufacturerServiceImpl) GetManufacturerByID(id string) (*Manufacturer, error) {
-	var manufacturer Manufacturer
-	err := s.db.QueryRowContext(context.Background(), "SELECT * FROM manufacturers WHERE id = $1", id).Scan(&manufacturer.ID, &manufacturer.Name, &manufacturer.Country, &manufacturer.CreatedAt, &manufacturer.UpdatedAt)
+	summary.TopSellers, err = s.queryBrandItems(ctx, `SELECT 'product', p.id, p.name, p.price, COALESCE(p.image_url, ''), SUM(pi.quantity) FROM products p
+		JOIN purchase_items pi ON pi.product_id = p.id
+		WHERE p.manufacturer_id = $1 AND p.deleted_at IS NULL
+		GROUP BY p.id, p.name, p.price, p.image_url
+		ORDER BY SUM(pi.quantity) DESC LIMIT $2`, id, brandSummaryLimit)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("производитель не найден")
-		}
 		return nil, err
 	}
-	return &manufacturer, nil
-}
 
-func (s *ManufacturerServiceImpl) CreateManufacturer(manufacturer Manufacturer) (*Manufacturer, error) {
-	ctx := context.Background()
-	result, err := s.db.ExecContext(ctx, "INSERT INTO manufacturers (name, country) VALUES ($1, $2)", manufacturer.Name, manufacturer.Country)
+	summary.NewArrivals, err = s.queryBrandItems(ctx, `SELECT kind, id, name, price, image_url, 0 FROM (
+		SELECT 'product' AS kind, id, name, price, COALESCE(image_url, '') AS image_url, 0 AS liquid FROM products WHERE manufacturer_id = $1 AND is_new AND deleted_at IS NULL
+		UNION ALL
+		SELECT 'liquid', id, name, price, COALESCE(image_url, ''), 1 FROM liquids WHERE brand_id = $1
+	) items ORDER BY liquid, id DESC LIMIT $2`, id, brandSummaryLimit)
 	if err != nil {
 		return nil, err
 	}
 
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
+	return summary, nil
+}
+
+func (s *ManufacturerServiceImpl) CreateManufacturer(ctx context.Context, manufacturer Manufacturer) (*Manufacturer, error) {
+	if err := s.manufacturers.Create(ctx, &manufacturer); err != nil {
 		return nil, err
 	}
-	manufacturer.ID = lastInsertID
+	s.cache.invalidateManufacturers(ctx)
 	return &manufacturer, nil
 }
 
-func (s *ManufacturerServiceImpl) UpdateManufacturer(manufacturer Manufacturer) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "UPDATE manufacturers SET name = $1, country = $2 WHERE id = $3", manufacturer.Name, manufacturer.Country, manufacturer.ID)
-	return err
+func (s *ManufacturerServiceImpl) UpdateManufacturer(ctx context.Context, manufacturer Manufacturer) error {
+	if err := s.manufacturers.Update(ctx, manufacturer); err != nil {
+		return manufacturerError(err)
+	}
+	s.cache.invalidateManufacturers(ctx)
+	return nil
 }
 
-func (s *ManufacturerServiceImpl) DeleteManufacturer(id string) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "DELETE FROM manufacturers WHERE id = $1", id)
-	return err
+func (s *ManufacturerServiceImpl) DeleteManufacturer(ctx context.Context, id int64) error {
+	if err := s.manufacturers.Delete(ctx, id); err != nil {
+		return manufacturerError(err)
+	}
+	s.cache.invalidateManufacturers(ctx)
+	return nil
+}
+
+func (s *ManufacturerServiceImpl) RestoreManufacturer(ctx context.Context, id int64) error {
+	if err := s.manufacturers.Restore(ctx, id); err != nil {
+		return manufacturerError(err)
+	}
+	s.cache.invalidateManufacturers(ctx)
+	return nil
+}
+
+func (s *ManufacturerServiceImpl) queryBrandItems(ctx context.Context, query string, args ...any) ([]BrandItem, error) {
+	rows, err := s.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []BrandItem{}
+	for rows.Next() {
+		var item BrandItem
+		if err := rows.Scan(&item.Kind, &item.ID, &item.Name, &item.Price, &item.ImageURL, &item.SoldQuantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
 }
@@ -0,0 +1,418 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/notify"
+	"github.com/lib/pq"
+)
+
+// Статусы сообщений в очереди отправки
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed" // Исчерпаны попытки; сообщение можно отправить повторно вручную
+)
+
+const (
+	outboxBatchSize     = 50
+	outboxMaxRetryDelay = 6 * time.Hour
+	outboxSendTimeout   = 30 * time.Second // Ограничение на отправку одного сообщения
+)
+
+var (
+	ErrNotificationNotFound = errors.New("уведомление не найдено")
+	ErrCustomerNotFound     = errors.New("покупатель не найден")
+)
+
+// dbtx - часть db.Querier для чтения и записи
+type dbtx interface {
+	queryer
+	execer
+}
+
+// NotificationPreferences - каналы, по которым покупатель получает уведомления.
+// Пока покупатель их не настроил, уведомления приходят только на email на русском языке.
+type NotificationPreferences struct {
+	CustomerID     int64  `json:"customerId" validate:"required"`
+	Language       string `json:"language" validate:"required,oneof=ru en"`
+	Email          bool   `json:"email"`
+	SMS            bool   `json:"sms"`
+	Telegram       bool   `json:"telegram"`
+	TelegramChatID string `json:"telegramChatId,omitempty" validate:"required_if=Telegram true"`
+}
+
+// OutboxMessage - сообщение в очереди отправки. Текст заполняется при постановке в очередь,
+// поэтому повторная отправка не зависит от изменений шаблонов и данных.
+type OutboxMessage struct {
+	ID            int64      `json:"id"`
+	CustomerID    int64      `json:"customerId,omitempty"`
+	Channel       string     `json:"channel"`
+	Recipient     string     `json:"recipient"`
+	Template      string     `json:"template"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"lastError,omitempty"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+}
+
+type NotificationService interface {
+	GetPreferences(ctx context.Context, customerID int64) (*NotificationPreferences, error)
+	SetPreferences(ctx context.Context, prefs NotificationPreferences) (*NotificationPreferences, error)
+	DeleteCustomerPreferences(ctx context.Context, tx dbtx, customerIDs []int64) (func(ctx context.Context), error)
+	NotifyCustomer(ctx context.Context, customerID int64, template string, data any) error
+	NotifyAddress(ctx context.Context, channel, to, lang, template string, data any) error
+	GetOutbox(ctx context.Context, status string, limit int) ([]OutboxMessage, error)
+	RetryMessage(ctx context.Context, id int64) error
+	DeliverPending(ctx context.Context) (int, error)
+	RunOutboxWorker(ctx context.Context, interval time.Duration)
+	HandleEvent(ctx context.Context, tx db.Querier, event DomainEvent) error
+}
+
+type NotificationServiceImpl struct {
+	db          db.Conn // Ссылка на объект базы данных
+	channels    map[string]notify.Notifier
+	maxAttempts int // После стольких неудачных попыток сообщение помечается failed
+}
+
+func NewNotificationService(db db.Conn, channels map[string]notify.Notifier, maxAttempts int) *NotificationServiceImpl {
+	return &NotificationServiceImpl{
+		db:          db,
+		channels:    channels,
+		maxAttempts: maxAttempts,
+	}
+}
+
+const preferencesSQL = `SELECT c.email, COALESCE(c.phone, ''), COALESCE(p.language, 'ru'), COALESCE(p.email_enabled, TRUE),
+		COALESCE(p.sms_enabled, FALSE), COALESCE(p.telegram_enabled, FALSE), COALESCE(p.telegram_chat_id, '')
+	FROM customers c
+	LEFT JOIN customer_notification_preferences p ON p.customer_id = c.id
+	WHERE c.id = $1 AND c.deleted_at IS NULL`
+
+type customerContacts struct {
+	email string
+	phone string
+	prefs NotificationPreferences
+}
+
+func loadCustomerContacts(ctx context.Context, q queryer, customerID int64) (*customerContacts, error) {
+	c := customerContacts{prefs: NotificationPreferences{CustomerID: customerID}}
+	err := q.QueryRowContext(ctx, preferencesSQL, customerID).Scan(&c.email, &c.phone, &c.prefs.Language,
+		&c.prefs.Email, &c.prefs.SMS, &c.prefs.Telegram, &c.prefs.TelegramChatID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *NotificationServiceImpl) GetPreferences(ctx context.Context, customerID int64) (*NotificationPreferences, error) {
+	c, err := loadCustomerContacts(ctx, s.db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return &c.prefs, nil
+}
+
+func (s *NotificationServiceImpl) SetPreferences(ctx context.Context, prefs NotificationPreferences) (*NotificationPreferences, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND deleted_at IS NULL)", prefs.CustomerID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrCustomerNotFound
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO customer_notification_preferences (customer_id, language, email_enabled, sms_enabled, telegram_enabled, telegram_chat_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		ON CONFLICT (customer_id) DO UPDATE SET language = EXCLUDED.language, email_enabled = EXCLUDED.email_enabled,
+			sms_enabled = EXCLUDED.sms_enabled, telegram_enabled = EXCLUDED.telegram_enabled, telegram_chat_id = EXCLUDED.telegram_chat_id`,
+		prefs.CustomerID, prefs.Language, prefs.Email, prefs.SMS, prefs.Telegram, prefs.TelegramChatID)
+	if err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// DeleteCustomerPreferences удаляет в транзакции tx настройки уведомлений покупателей.
+// Вызывается при окончательном удалении покупателей.
+func (s *NotificationServiceImpl) DeleteCustomerPreferences(ctx context.Context, tx dbtx, customerIDs []int64) (func(ctx context.Context), error) {
+	_, err := tx.ExecContext(ctx, "DELETE FROM customer_notification_preferences WHERE customer_id = ANY($1)", pq.Array(customerIDs))
+	return nil, err
+}
+
+func (s *NotificationServiceImpl) NotifyCustomer(ctx context.Context, customerID int64, template string, data any) error {
+	_, err := enqueueCustomerNotification(ctx, s.db, customerID, template, data)
+	return err
+}
+
+func (s *NotificationServiceImpl) NotifyAddress(ctx context.Context, channel, to, lang, template string, data any) error {
+	return enqueueAddressNotification(ctx, s.db, channel, to, lang, template, data)
+}
+
+// enqueueCustomerNotification ставит уведомление в очередь по всем каналам, включённым у покупателя.
+// Вызывается в транзакции изменения, из-за которого отправляется уведомление, - тогда сообщение
+// не потеряется и не уйдёт, если транзакция откатится. Возвращает число поставленных сообщений.
+func enqueueCustomerNotification(ctx context.Context, db dbtx, customerID int64, template string, data any) (int, error) {
+	c, err := loadCustomerContacts(ctx, db, customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	msg, err := notify.Render(template, c.prefs.Language, data)
+	if err != nil {
+		return 0, err
+	}
+
+	recipients := map[string]string{}
+	if c.prefs.Email && c.email != "" {
+		recipients[notify.ChannelEmail] = c.email
+	}
+	if c.prefs.SMS && c.phone != "" {
+		recipients[notify.ChannelSMS] = c.phone
+	}
+	if c.prefs.Telegram && c.prefs.TelegramChatID != "" {
+		recipients[notify.ChannelTelegram] = c.prefs.TelegramChatID
+	}
+
+	for channel, to := range recipients {
+		msg.To = to
+		if err := insertOutboxMessage(ctx, db, customerID, channel, template, msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(recipients), nil
+}
+
+// enqueueAddressNotification ставит в очередь уведомление на произвольный адрес, например сотруднику магазина
+func enqueueAddressNotification(ctx context.Context, db execer, channel, to, lang, template string, data any) error {
+	msg, err := notify.Render(template, lang, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return insertOutboxMessage(ctx, db, 0, channel, template, msg)
+}
+
+func insertOutboxMessage(ctx context.Context, db execer, customerID int64, channel, template string, msg notify.Message) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO notification_outbox (customer_id, channel, recipient, template, subject, body)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)`,
+		customerID, channel, msg.To, template, msg.Subject, msg.Body)
+	return err
+}
+
+const outboxColumns = "id, COALESCE(customer_id, 0), channel, recipient, template, subject, body, status, attempts, COALESCE(last_error, ''), next_attempt_at, created_at, sent_at"
+
+func scanOutboxMessage(row interface{ Scan(...any) error }, m *OutboxMessage) error {
+	return row.Scan(&m.ID, &m.CustomerID, &m.Channel, &m.Recipient, &m.Template, &m.Subject, &m.Body, &m.Status,
+		&m.Attempts, &m.LastError, &m.NextAttemptAt, &m.CreatedAt, &m.SentAt)
+}
+
+func (s *NotificationServiceImpl) GetOutbox(ctx context.Context, status string, limit int) ([]OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+outboxColumns+" FROM notification_outbox WHERE ($1 = '' OR status = $1) ORDER BY id DESC LIMIT $2", status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+	for rows.Next() {
+		var m OutboxMessage
+		if err := scanOutboxMessage(rows, &m); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// RetryMessage возвращает в очередь сообщение, для которого исчерпаны попытки отправки
+func (s *NotificationServiceImpl) RetryMessage(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE notification_outbox SET status = $1, attempts = 0, next_attempt_at = NOW() WHERE id = $2 AND status = $3",
+		NotificationPending, id, NotificationFailed)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// DeliverPending отправляет сообщения, время попытки которых наступило. Сообщения блокируются
+// до конца транзакции (SKIP LOCKED), поэтому несколько экземпляров сервиса не отправят одно сообщение
+// одновременно. Если процесс упадёт после отправки, но до фиксации, сообщение уйдёт повторно:
+// доставка «хотя бы один раз». Возвращает число отправленных сообщений.
+func (s *NotificationServiceImpl) DeliverPending(ctx context.Context) (int, error) {
+	sent := 0
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		rows, err := tx.QueryContext(ctx, "SELECT "+outboxColumns+` FROM notification_outbox
+			WHERE status = $1 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED`, NotificationPending, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		var batch []OutboxMessage
+		for rows.Next() {
+			var m OutboxMessage
+			if err := scanOutboxMessage(rows, &m); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, m := range batch {
+			sendErr := s.send(ctx, m)
+			if sendErr == nil {
+				_, err = tx.ExecContext(ctx, "UPDATE notification_outbox SET status = $1, attempts = attempts + 1, last_error = NULL, sent_at = NOW() WHERE id = $2",
+					NotificationSent, m.ID)
+				sent++
+			} else {
+				status := NotificationPending
+				if m.Attempts+1 >= s.maxAttempts {
+					status = NotificationFailed
+				}
+				_, err = tx.ExecContext(ctx, "UPDATE notification_outbox SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $4",
+					status, sendErr.Error(), time.Now().Add(outboxRetryDelay(m.Attempts+1)), m.ID)
+				slog.WarnContext(ctx, "не удалось отправить уведомление", "notification_id", m.ID, "channel", m.Channel, "attempt", m.Attempts+1, "error", sendErr)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+func (s *NotificationServiceImpl) send(ctx context.Context, m OutboxMessage) error {
+	notifier, ok := s.channels[m.Channel]
+	if !ok {
+		return fmt.Errorf("канал %s не настроен", m.Channel)
+	}
+	ctx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+	defer cancel()
+	return notifier.Send(ctx, notify.Message{To: m.Recipient, Subject: m.Subject, Body: m.Body})
+}
+
+// outboxRetryDelay - экспоненциальная задержка перед следующей попыткой: 1, 2, 4... минуты, не больше outboxMaxRetryDelay
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxRetryDelay {
+		return outboxMaxRetryDelay
+	}
+	return delay
+}
+
+// NotificationEventTypes - доменные события, по которым покупателю отправляются уведомления
+var NotificationEventTypes = []string{EventPurchaseStatusChanged, EventDeliveryStatusChanged}
+
+// HandleEvent ставит в очередь уведомления покупателю по доменным событиям
+func (s *NotificationServiceImpl) HandleEvent(ctx context.Context, tx db.Querier, event DomainEvent) error {
+	var err error
+	switch event.Type {
+	case EventPurchaseStatusChanged:
+		err = s.handlePurchaseStatusChanged(ctx, tx, event)
+	case EventDeliveryStatusChanged:
+		err = s.handleDeliveryStatusChanged(ctx, tx, event)
+	}
+	// Удалённому покупателю уведомления не отправляются
+	if errors.Is(err, ErrCustomerNotFound) {
+		return nil
+	}
+	return err
+}
+
+// handlePurchaseStatusChanged ставит в очередь подтверждение заказа, когда он оплачен
+func (s *NotificationServiceImpl) handlePurchaseStatusChanged(ctx context.Context, tx db.Querier, event DomainEvent) error {
+	var payload PurchaseStatusChangedPayload
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	if payload.NewStatus != PurchaseStatusPaid || payload.CustomerID == 0 {
+		return nil
+	}
+
+	data := notify.OrderData{PurchaseID: int64(payload.PurchaseID)}
+	err := tx.QueryRowContext(ctx, "SELECT amount, currency FROM payments WHERE purchase_id = $1 ORDER BY id DESC LIMIT 1", data.PurchaseID).Scan(&data.Total, &data.Currency)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = enqueueCustomerNotification(ctx, tx, int64(payload.CustomerID), notify.TemplateOrderConfirmation, data)
+	return err
+}
+
+// handleDeliveryStatusChanged сообщает покупателю о новом статусе доставки
+func (s *NotificationServiceImpl) handleDeliveryStatusChanged(ctx context.Context, tx db.Querier, event DomainEvent) error {
+	var payload DeliveryStatusChangedPayload
+	if err := event.Decode(&payload); err != nil {
+		return err
+	}
+	if payload.CustomerID == 0 {
+		return nil
+	}
+
+	_, err := enqueueCustomerNotification(ctx, tx, int64(payload.CustomerID), notify.TemplateShippingUpdate, notify.ShippingData{
+		PurchaseID:     int64(payload.PurchaseID),
+		Status:         payload.NewStatus,
+		TrackingNumber: payload.TrackingNumber,
+	})
+	return err
+}
+
+// RunOutboxWorker периодически вызывает DeliverPending, пока не отменён ctx
+func (s *NotificationServiceImpl) RunOutboxWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Отправляем пачками, пока очередь не опустеет
+			for {
+				n, err := s.DeliverPending(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "ошибка отправки уведомлений", "error", err)
+					break
+				}
+				if n < outboxBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/notify"
+)
+
+// recordingNotifier запоминает отправленные сообщения и возвращает err
+type recordingNotifier struct {
+	sent        []notify.Message
+	hasDeadline bool
+	err         error
+}
+
+func (n *recordingNotifier) Send(ctx context.Context, msg notify.Message) error {
+	_, n.hasDeadline = ctx.Deadline()
+	n.sent = append(n.sent, msg)
+	return n.err
+}
+
+func TestDeliverPending(t *testing.T) {
+	columns := []string{"id", "customer_id", "channel", "recipient", "template", "subject", "body", "status", "attempts", "last_error", "next_attempt_at", "created_at", "sent_at"}
+	message := func(id int64, channel string, attempts int64) []driver.Value {
+		return []driver.Value{id, int64(9), channel, "buyer@example.com", notify.TemplateOrderConfirmation, "Тема", "Текст", NotificationPending, attempts, "", time.Now(), time.Now(), nil}
+	}
+
+	tests := []struct {
+		name       string
+		sendErr    error
+		channel    string
+		attempts   int64
+		wantSent   int
+		wantStatus string
+	}{
+		{"отправлено", nil, notify.ChannelEmail, 0, 1, NotificationSent},
+		{"ошибка канала - повтор позже", errors.New("сервер недоступен"), notify.ChannelEmail, 0, 0, NotificationPending},
+		{"последняя попытка", errors.New("сервер недоступен"), notify.ChannelEmail, 2, 0, NotificationFailed},
+		{"канал не настроен", nil, notify.ChannelSMS, 0, 0, NotificationPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.rows("FROM notification_outbox", columns, message(1, tt.channel, tt.attempts))
+
+			email := &recordingNotifier{err: tt.sendErr}
+			s := NewNotificationService(stubUnitOfWork{conn}, map[string]notify.Notifier{notify.ChannelEmail: email}, 3)
+			sent, err := s.DeliverPending(context.Background())
+			if err != nil {
+				t.Fatalf("DeliverPending() error = %v", err)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("sent = %d, want %d", sent, tt.wantSent)
+			}
+			if tt.channel == notify.ChannelEmail {
+				if len(email.sent) != 1 || email.sent[0].To != "buyer@example.com" || email.sent[0].Subject != "Тема" {
+					t.Errorf("отправлено %+v", email.sent)
+				}
+				if !email.hasDeadline {
+					t.Error("отправка без срока в ctx")
+				}
+			}
+
+			updates := stub.executed("UPDATE notification_outbox SET status")
+			if len(updates) != 1 || updates[0].args[0] != tt.wantStatus {
+				t.Errorf("обновления = %+v, want статус %s", updates, tt.wantStatus)
+			}
+		})
+	}
+}
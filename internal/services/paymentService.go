@@ -0,0 +1,381 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/logging"
+	"github.com/Dmitriy4565/VapeShop/internal/payments"
+)
+
+// Статусы платежа
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusAuthorized        = "authorized"
+	PaymentStatusCapturing         = "capturing" // Списание начато, ответ провайдера ещё не записан
+	PaymentStatusCaptured          = "captured"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+	PaymentStatusRefunded          = "refunded"
+)
+
+var (
+	ErrPaymentNotFound      = errors.New("платёж не найден")
+	ErrPaymentInvalidState  = errors.New("операция недоступна в текущем статусе платежа")
+	ErrRefundExceedsCapture = errors.New("сумма возврата превышает доступную к возврату")
+	ErrPurchaseAlreadyPaid  = errors.New("покупка уже оплачена")
+	ErrPurchaseChanged      = errors.New("сумма покупки изменилась во время оплаты, повторите оплату")
+)
+
+type Payment struct {
+	ID                int64     `json:"id"`
+	PurchaseID        int64     `json:"purchaseId" validate:"required"`
+	Provider          string    `json:"provider"`
+	ProviderPaymentID string    `json:"providerPaymentId"`
+	Amount            float64   `json:"amount"`
+	CapturedAmount    float64   `json:"capturedAmount"`
+	RefundedAmount    float64   `json:"refundedAmount"`
+	Currency          string    `json:"currency"`
+	Status            string    `json:"status"`
+	ConfirmationURL   string    `json:"confirmationUrl,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+type PaymentRefund struct {
+	ID               int64     `json:"id"`
+	PaymentID        int64     `json:"paymentId" validate:"required"`
+	ProviderRefundID string    `json:"providerRefundId"`
+	Amount           float64   `json:"amount" validate:"required,gt=0"`
+	Reason           string    `json:"reason"`
+	IdempotencyKey   string    `json:"idempotencyKey,omitempty"` // Повтор с тем же ключом вернёт уже сделанный возврат
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+type PaymentService interface {
+	CreatePayment(ctx context.Context, purchaseID int64) (*Payment, error)
+	GetPaymentByID(ctx context.Context, id int64) (*Payment, error)
+	GetPaymentsByPurchase(ctx context.Context, purchaseID int64) ([]Payment, error)
+	CapturePayment(ctx context.Context, id int64) (*Payment, error)
+	RefundPayment(ctx context.Context, refund PaymentRefund) (*PaymentRefund, error)
+	HandleWebhook(ctx context.Context, payload []byte, signature string) error
+}
+
+type PaymentServiceImpl struct {
+	db       db.Conn // Ссылка на объект базы данных
+	provider payments.PaymentProvider
+	currency string
+}
+
+func NewPaymentService(db db.Conn, provider payments.PaymentProvider, currency string) *PaymentServiceImpl {
+	return &PaymentServiceImpl{
+		db:       db,
+		provider: provider,
+		currency: currency,
+	}
+}
+
+const paymentColumns = "id, purchase_id, provider, provider_payment_id, amount, captured_amount, refunded_amount, currency, status, created_at, updated_at"
+
+func scanPayment(row interface{ Scan(...any) error }, payment *Payment) error {
+	return row.Scan(&payment.ID, &payment.PurchaseID, &payment.Provider, &payment.ProviderPaymentID, &payment.Amount, &payment.CapturedAmount, &payment.RefundedAmount, &payment.Currency, &payment.Status, &payment.CreatedAt, &payment.UpdatedAt)
+}
+
+// CreatePayment создаёт платёжное намерение у провайдера на сумму покупки: позиции
+// за вычетом скидки плюс доставка. Провайдер вызывается вне транзакции, поэтому сумма
+// и отсутствие оплаты проверяются дважды: до вызова и под блокировкой покупки при
+// записи платежа. Намерение, которое не удалось записать, остаётся у провайдера
+// неоплаченным - деньги по нему не списываются.
+func (s *PaymentServiceImpl) CreatePayment(ctx context.Context, purchaseID int64) (*Payment, error) {
+	var amount float64
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var err error
+		amount, err = payableAmount(ctx, tx, purchaseID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	intent, err := s.provider.CreateIntent(ctx, amount, s.currency, strconv.FormatInt(purchaseID, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	payment := Payment{
+		PurchaseID:        purchaseID,
+		Provider:          s.provider.Name(),
+		ProviderPaymentID: intent.ProviderPaymentID,
+		Amount:            intent.Amount,
+		Currency:          intent.Currency,
+		Status:            PaymentStatusPending,
+		ConfirmationURL:   intent.ConfirmationURL,
+	}
+	err = s.db.WithTx(ctx, func(tx db.Querier) error {
+		// Пока создавалось намерение, покупку могли оплатить или изменить её состав
+		current, err := payableAmount(ctx, tx, purchaseID)
+		if err != nil {
+			return err
+		}
+		if current != amount {
+			return ErrPurchaseChanged
+		}
+
+		err = tx.QueryRowContext(ctx, "INSERT INTO payments (purchase_id, provider, provider_payment_id, amount, currency, status) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at",
+			payment.PurchaseID, payment.Provider, payment.ProviderPaymentID, payment.Amount, payment.Currency, payment.Status).Scan(&payment.ID, &payment.CreatedAt, &payment.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return setPurchaseStatus(ctx, tx, purchaseID, PurchaseStatusAwaitingPayment, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// payableAmount блокирует покупку до конца транзакции и возвращает сумму к оплате
+// (как purchaseTotal). Параллельные оформления одной покупки выполняются по очереди,
+// и второе увидит активный платёж первого.
+func payableAmount(ctx context.Context, tx db.Querier, purchaseID int64) (float64, error) {
+	var discount, shipping float64
+	err := tx.QueryRowContext(ctx, "SELECT discount_amount, shipping_price FROM purchases WHERE id = $1 FOR UPDATE", purchaseID).Scan(&discount, &shipping)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrPurchaseNotFound
+		}
+		return 0, err
+	}
+
+	var items float64
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(quantity * price), 0) FROM purchase_items WHERE purchase_id = $1", purchaseID).Scan(&items)
+	if err != nil {
+		return 0, err
+	}
+	amount := roundMoney(items - discount + shipping)
+	if items <= 0 || amount <= 0 {
+		return 0, errors.New("в покупке нет позиций для оплаты")
+	}
+
+	var active bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM payments WHERE purchase_id = $1 AND status IN ($2, $3, $4, $5))", purchaseID, PaymentStatusAuthorized, PaymentStatusCapturing, PaymentStatusCaptured, PaymentStatusPartiallyRefunded).Scan(&active)
+	if err != nil {
+		return 0, err
+	}
+	if active {
+		return 0, ErrPurchaseAlreadyPaid
+	}
+	return amount, nil
+}
+
+func (s *PaymentServiceImpl) GetPaymentByID(ctx context.Context, id int64) (*Payment, error) {
+	var payment Payment
+	err := scanPayment(s.db.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE id = $1", id), &payment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (s *PaymentServiceImpl) GetPaymentsByPurchase(ctx context.Context, purchaseID int64) ([]Payment, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE purchase_id = $1 ORDER BY created_at", purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Payment
+	for rows.Next() {
+		var payment Payment
+		if err := scanPayment(rows, &payment); err != nil {
+			return nil, err
+		}
+		list = append(list, payment)
+	}
+
+	return list, rows.Err()
+}
+
+// CapturePayment списывает ранее авторизованную сумму целиком. Платёж сначала
+// переводится в capturing, поэтому параллельный вызов его не подхватит, а провайдер
+// вызывается уже вне транзакции. Платёж в capturing (вызов прервался после начала
+// списания) можно списать повторно: списание идёт с ключом идемпотентности платежа,
+// и деньги дважды не спишутся.
+func (s *PaymentServiceImpl) CapturePayment(ctx context.Context, id int64) (*Payment, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE payments SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3", PaymentStatusCapturing, id, PaymentStatusAuthorized)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := s.GetPaymentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 0 && payment.Status != PaymentStatusCapturing {
+		return nil, ErrPaymentInvalidState
+	}
+
+	if err := s.provider.Capture(ctx, payment.ProviderPaymentID, payment.Amount, fmt.Sprintf("capture-%d", payment.ID)); err != nil {
+		return nil, err
+	}
+
+	payment.CapturedAmount = payment.Amount
+	payment.Status = PaymentStatusCaptured
+	payment.UpdatedAt = time.Now()
+	_, err = s.db.ExecContext(ctx, "UPDATE payments SET captured_amount = $1, status = $2, updated_at = $3 WHERE id = $4 AND status = $5", payment.CapturedAmount, payment.Status, payment.UpdatedAt, payment.ID, PaymentStatusCapturing)
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// RefundPayment возвращает покупателю часть или всю списанную сумму. Если указан
+// IdempotencyKey и возврат с этим ключом уже был, возвращается он, а не новый.
+func (s *PaymentServiceImpl) RefundPayment(ctx context.Context, refund PaymentRefund) (*PaymentRefund, error) {
+	result := &refund
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		payment, err := lockPayment(ctx, tx, "id = $1", refund.PaymentID)
+		if err != nil {
+			return err
+		}
+
+		// Блокировка платежа выстраивает повторы с одним ключом в очередь: второй увидит первый
+		if refund.IdempotencyKey != "" {
+			var existing PaymentRefund
+			err := tx.QueryRowContext(ctx, "SELECT id, payment_id, provider_refund_id, amount, COALESCE(reason, ''), idempotency_key, created_at FROM payment_refunds WHERE payment_id = $1 AND idempotency_key = $2", payment.ID, refund.IdempotencyKey).
+				Scan(&existing.ID, &existing.PaymentID, &existing.ProviderRefundID, &existing.Amount, &existing.Reason, &existing.IdempotencyKey, &existing.CreatedAt)
+			if err == nil {
+				result = &existing
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		if payment.Status != PaymentStatusCaptured && payment.Status != PaymentStatusPartiallyRefunded {
+			return ErrPaymentInvalidState
+		}
+
+		refund.Amount = roundMoney(refund.Amount)
+		available := roundMoney(payment.CapturedAmount - payment.RefundedAmount)
+		if refund.Amount > available {
+			return ErrRefundExceedsCapture
+		}
+
+		providerRefund, err := s.provider.Refund(ctx, payment.ProviderPaymentID, refund.Amount, refund.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+		refund.ProviderRefundID = providerRefund.ProviderRefundID
+
+		err = tx.QueryRowContext(ctx, "INSERT INTO payment_refunds (payment_id, provider_refund_id, amount, reason, idempotency_key) VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id, created_at",
+			refund.PaymentID, refund.ProviderRefundID, refund.Amount, refund.Reason, refund.IdempotencyKey).Scan(&refund.ID, &refund.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		refunded := roundMoney(payment.RefundedAmount + refund.Amount)
+		status, purchaseStatus := PaymentStatusPartiallyRefunded, PurchaseStatusPartiallyRefunded
+		if refunded >= payment.CapturedAmount {
+			status, purchaseStatus = PaymentStatusRefunded, PurchaseStatusRefunded
+		}
+
+		now := time.Now()
+		_, err = tx.ExecContext(ctx, "UPDATE payments SET refunded_amount = $1, status = $2, updated_at = $3 WHERE id = $4", refunded, status, now, payment.ID)
+		if err != nil {
+			return err
+		}
+		return setPurchaseStatus(ctx, tx, payment.PurchaseID, purchaseStatus, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// HandleWebhook проверяет подпись и применяет событие провайдера. Повторная доставка
+// того же события ничего не меняет: идентификаторы обработанных событий сохраняются.
+func (s *PaymentServiceImpl) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := s.provider.VerifyWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+	// Подпись проверена: дальнейшие строки лога запроса относятся к провайдеру
+	logging.SetPrincipal(ctx, "provider:"+s.provider.Name())
+
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		result, err := tx.ExecContext(ctx, "INSERT INTO payment_webhook_events (provider, event_id, event_type) VALUES ($1, $2, $3) ON CONFLICT (provider, event_id) DO NOTHING", s.provider.Name(), event.ID, event.Type)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return nil // событие уже обработано
+		}
+
+		payment, err := lockPayment(ctx, tx, "provider = $1 AND provider_payment_id = $2", s.provider.Name(), event.ProviderPaymentID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		switch event.Type {
+		case payments.EventPaymentSucceeded:
+			if payment.Status != PaymentStatusPending {
+				break
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE payments SET status = $1, updated_at = $2 WHERE id = $3", PaymentStatusAuthorized, now, payment.ID)
+			if err != nil {
+				return err
+			}
+			err = setPurchaseStatus(ctx, tx, payment.PurchaseID, PurchaseStatusPaid, now)
+		case payments.EventPaymentFailed:
+			if payment.Status != PaymentStatusPending {
+				break
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE payments SET status = $1, updated_at = $2 WHERE id = $3", PaymentStatusFailed, now, payment.ID)
+			if err != nil {
+				return err
+			}
+			err = setPurchaseStatus(ctx, tx, payment.PurchaseID, PurchaseStatusPaymentFailed, now)
+		case payments.EventRefundSucceeded:
+			// Возвраты фиксируются синхронно в RefundPayment, событие только подтверждает их
+		}
+		return err
+	})
+}
+
+// lockPayment выбирает платёж по условию where и блокирует его до конца транзакции
+func lockPayment(ctx context.Context, tx db.Querier, where string, args ...any) (*Payment, error) {
+	var payment Payment
+	err := scanPayment(tx.QueryRowContext(ctx, "SELECT "+paymentColumns+" FROM payments WHERE "+where+" FOR UPDATE", args...), &payment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// roundMoney округляет сумму до копеек
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
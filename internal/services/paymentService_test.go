@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/payments"
+)
+
+var paymentTestColumns = []string{"id", "purchase_id", "provider", "provider_payment_id", "amount", "captured_amount", "refunded_amount", "currency", "status", "created_at", "updated_at"}
+
+func TestCreatePayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		found      bool
+		amount     float64
+		active     bool
+		changed    bool // Состав покупки меняется, пока создаётся намерение
+		wantErr    error
+		wantIntent bool
+	}{
+		{"новый платёж", true, 1234.567, false, false, nil, true},
+		{"покупка не найдена", false, 0, false, false, ErrPurchaseNotFound, false},
+		{"уже оплачена", true, 1000, true, false, ErrPurchaseAlreadyPaid, false},
+		{"сумма изменилась", true, 1000, false, true, ErrPurchaseChanged, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.on("FROM purchases WHERE id = $1 FOR UPDATE", func(args []any) (*stubRows, error) {
+				if !tt.found {
+					return rowsOf([]string{"discount_amount", "shipping_price"}), nil
+				}
+				return rowsOf([]string{"discount_amount", "shipping_price"}, []driver.Value{0.0, 0.0}), nil
+			})
+			calls := 0
+			stub.on("SUM(quantity * price)", func([]any) (*stubRows, error) {
+				calls++
+				amount := tt.amount
+				if tt.changed && calls > 1 {
+					amount += 100
+				}
+				return rowsOf([]string{"sum"}, []driver.Value{amount}), nil
+			})
+			stub.rows("SELECT EXISTS (SELECT 1 FROM payments", []string{"exists"}, []driver.Value{tt.active})
+			stub.rows("INSERT INTO payments", []string{"id", "created_at", "updated_at"}, []driver.Value{int64(5), time.Now(), time.Now()})
+			stub.rows("SELECT status, COALESCE(customer_id", []string{"status", "customer_id"}, []driver.Value{PurchaseStatusAwaitingPayment, int64(9)})
+
+			s := NewPaymentService(stubUnitOfWork{conn}, payments.NewFakeProvider("secret"), "RUB")
+			payment, err := s.CreatePayment(context.Background(), 42)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreatePayment() error = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.wantIntent {
+				if len(stub.executed("INSERT INTO payments")) != 0 {
+					t.Error("платёж сохранён, хотя не должен был")
+				}
+				return
+			}
+			if payment.ID != 5 || payment.Amount != 1234.57 || payment.Status != PaymentStatusPending || payment.Provider != "fake" {
+				t.Errorf("payment = %+v", payment)
+			}
+		})
+	}
+}
+
+func TestCapturePayment(t *testing.T) {
+	tests := []struct {
+		name           string
+		claimed        int64  // Строк, переведённых из authorized в capturing
+		status         string // Статус платежа после попытки захвата
+		capturedBefore bool   // Прерванный вызов успел списать деньги, но не записал результат
+		wantErr        error
+		wantCapture    bool
+	}{
+		{"авторизованный платёж", 1, PaymentStatusCapturing, false, nil, true},
+		{"повтор прерванного списания", 0, PaymentStatusCapturing, true, nil, true},
+		{"уже списан", 0, PaymentStatusCaptured, false, ErrPaymentInvalidState, false},
+		{"ещё не оплачен", 0, PaymentStatusPending, false, ErrPaymentInvalidState, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			provider := payments.NewFakeProvider("secret")
+			intent, err := provider.CreateIntent(ctx, 1000, "RUB", "42")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.capturedBefore {
+				if err := provider.Capture(ctx, intent.ProviderPaymentID, 1000, "capture-5"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stub, conn := newSQLStub(t)
+			stub.rows("SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3", []string{"affected"}, []driver.Value{tt.claimed})
+			stub.rows("FROM payments WHERE id = $1", paymentTestColumns,
+				[]driver.Value{int64(5), int64(42), "fake", intent.ProviderPaymentID, 1000.0, 0.0, 0.0, "RUB", tt.status, time.Now(), time.Now()})
+
+			s := NewPaymentService(stubUnitOfWork{conn}, provider, "RUB")
+			payment, err := s.CapturePayment(ctx, 5)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CapturePayment() error = %v, want %v", err, tt.wantErr)
+			}
+			captured := stub.executed("UPDATE payments SET captured_amount")
+			if !tt.wantCapture {
+				if len(captured) != 0 {
+					t.Error("списание записано, хотя не должно было")
+				}
+				return
+			}
+			if len(captured) != 1 || payment.Status != PaymentStatusCaptured || payment.CapturedAmount != 1000 {
+				t.Errorf("payment = %+v, записей списания = %d", payment, len(captured))
+			}
+		})
+	}
+}
+
+// TestFullReturnRefundsPaidAmount проверяет, что полный возврат заказа со скидкой и доставкой
+// возвращает ровно оплаченную сумму: платёж и возврат считаются по одной формуле
+func TestFullReturnRefundsPaidAmount(t *testing.T) {
+	ctx := context.Background()
+	items := []ReturnItem{{Price: 500, Quantity: 2}, {Price: 250, Quantity: 1}} // 1250
+	const discount, shipping = 100.0, 300.0
+
+	stub, conn := newSQLStub(t)
+	stub.rows("FROM purchases WHERE id = $1 FOR UPDATE", []string{"discount_amount", "shipping_price"}, []driver.Value{discount, shipping})
+	stub.rows("SUM(quantity * price)", []string{"sum"}, []driver.Value{1250.0})
+	stub.rows("SELECT EXISTS (SELECT 1 FROM payments", []string{"exists"}, []driver.Value{false})
+	stub.rows("INSERT INTO payments", []string{"id", "created_at", "updated_at"}, []driver.Value{int64(5), time.Now(), time.Now()})
+	stub.rows("SELECT status, COALESCE(customer_id", []string{"status", "customer_id"}, []driver.Value{PurchaseStatusAwaitingPayment, int64(9)})
+
+	s := NewPaymentService(stubUnitOfWork{conn}, payments.NewFakeProvider("secret"), "RUB")
+	payment, err := s.CreatePayment(ctx, 42)
+	if err != nil {
+		t.Fatalf("CreatePayment() error = %v", err)
+	}
+	if payment.Amount != 1450 {
+		t.Fatalf("сумма платежа = %v, want 1450 (позиции - скидка + доставка)", payment.Amount)
+	}
+
+	// Провайдер подтвердил оплату, платёж списан
+	status := PaymentStatusAuthorized
+	var capturedAmount float64
+	stub.on("FROM payments WHERE id = $1", func([]any) (*stubRows, error) {
+		return rowsOf(paymentTestColumns, []driver.Value{payment.ID, int64(42), "fake", payment.ProviderPaymentID, payment.Amount, capturedAmount, 0.0, "RUB", status, time.Now(), time.Now()}), nil
+	})
+	stub.on("SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3", func([]any) (*stubRows, error) {
+		status = PaymentStatusCapturing
+		return rowsOf([]string{"affected"}, []driver.Value{int64(1)}), nil
+	})
+	if _, err := s.CapturePayment(ctx, payment.ID); err != nil {
+		t.Fatalf("CapturePayment() error = %v", err)
+	}
+	status, capturedAmount = PaymentStatusCaptured, payment.Amount
+
+	stub.rows("FROM purchases p LEFT JOIN purchase_items pi", []string{"sum", "discount_amount", "shipping_price"}, []driver.Value{1250.0, discount, shipping})
+	stub.rows("SELECT COALESCE(SUM(quantity), 0) FROM purchase_items", []string{"sum"}, []driver.Value{int64(3)})
+	stub.rows("FROM return_request_items ri JOIN return_requests r", []string{"sum"}, []driver.Value{int64(3)})
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	amount, err := calculateReturnRefund(ctx, tx, &ReturnRequest{ID: 7, PurchaseID: 42, Items: items})
+	if err != nil {
+		t.Fatalf("calculateReturnRefund() error = %v", err)
+	}
+	if amount != payment.Amount {
+		t.Errorf("возврат = %v, want оплаченные %v", amount, payment.Amount)
+	}
+
+	stub.rows("FROM payment_refunds WHERE payment_id", []string{"id", "payment_id", "provider_refund_id", "amount", "reason", "idempotency_key", "created_at"})
+	stub.rows("INSERT INTO payment_refunds", []string{"id", "created_at"}, []driver.Value{int64(11), time.Now()})
+	refund, err := s.RefundPayment(ctx, PaymentRefund{PaymentID: payment.ID, Amount: amount, IdempotencyKey: "return-7"})
+	if err != nil {
+		t.Fatalf("RefundPayment() error = %v", err)
+	}
+	if refund.Amount != payment.Amount {
+		t.Errorf("возвращено %v, want %v", refund.Amount, payment.Amount)
+	}
+}
+
+func TestHandleWebhookMatchesProvider(t *testing.T) {
+	provider := payments.NewFakeProvider("secret")
+
+	tests := []struct {
+		name       string
+		owner      string // Провайдер, которому принадлежит платёж с этим provider_payment_id
+		wantErr    error
+		wantStatus bool
+	}{
+		{"платёж этого провайдера", "fake", nil, true},
+		{"платёж другого провайдера", "other", ErrPaymentNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.on("FROM payments WHERE provider = $1 AND provider_payment_id = $2 FOR UPDATE", func(args []any) (*stubRows, error) {
+				if args[0] != tt.owner {
+					return rowsOf(paymentTestColumns), nil
+				}
+				return rowsOf(paymentTestColumns, []driver.Value{int64(5), int64(42), tt.owner, args[1], 1000.0, 0.0, 0.0, "RUB", PaymentStatusPending, time.Now(), time.Now()}), nil
+			})
+			stub.rows("SELECT status, COALESCE(customer_id", []string{"status", "customer_id"}, []driver.Value{PurchaseStatusAwaitingPayment, int64(9)})
+
+			payload, signature, err := provider.SignEvent(payments.WebhookEvent{ID: "evt_1", Type: payments.EventPaymentSucceeded, ProviderPaymentID: "fake_pay_1", Amount: 1000})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewPaymentService(stubUnitOfWork{conn}, provider, "RUB")
+			err = s.HandleWebhook(context.Background(), payload, signature)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("HandleWebhook() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := len(stub.executed("UPDATE payments SET status")) > 0; got != tt.wantStatus {
+				t.Errorf("статус платежа изменён = %v, want %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
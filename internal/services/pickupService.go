@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Статусы заказа на самовывоз
+const (
+	PickupStatusReserved  = "reserved"
+	PickupStatusCollected = "collected"
+	PickupStatusCancelled = "cancelled"
+)
+
+const (
+	pickupCodeAlphabet    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // без похожих символов 0/O и 1/I
+	pickupCodeLength      = 6
+	pickupCodeMaxAttempts = 5
+)
+
+var (
+	ErrPickupNotFound    = errors.New("заказ на самовывоз не найден")
+	ErrPickupNotReserved = errors.New("заказ уже выдан или отменён")
+	ErrAgeNotVerified    = errors.New("выдача возможна только после проверки возраста")
+	ErrInsufficientStock = errors.New("недостаточно товара в магазине")
+)
+
+type PickupItem struct {
+	ProductID int64   `json:"productId" validate:"required"`
+	Quantity  int     `json:"quantity" validate:"required,min=1"`
+	Price     float64 `json:"price"`
+}
+
+type PickupOrder struct {
+	ID          int64        `json:"id"`
+	PurchaseID  int64        `json:"purchaseId"`
+	CustomerID  int64        `json:"customerId" validate:"required"`
+	StoreID     int64        `json:"storeId" validate:"required"`
+	PickupCode  string       `json:"pickupCode"`
+	Status      string       `json:"status"`
+	Items       []PickupItem `json:"items" validate:"required,min=1,dive"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	CollectedAt *time.Time   `json:"collectedAt,omitempty"`
+	CollectedBy string       `json:"collectedBy,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+type CollectRequest struct {
+	PickupCode  string `json:"pickupCode" validate:"required"`
+	AgeVerified bool   `json:"ageVerified"`
+	StaffName   string `json:"staffName" validate:"required"`
+}
+
+type PickupService interface {
+	CreatePickupOrder(ctx context.Context, order PickupOrder) (*PickupOrder, error)
+	GetPickupOrderByCode(ctx context.Context, code string) (*PickupOrder, error)
+	MarkCollected(ctx context.Context, req CollectRequest) (*PickupOrder, error)
+	CancelPickupOrder(ctx context.Context, id int64) error
+	CancelExpired(ctx context.Context) (int, error)
+	RunExpiryWorker(ctx context.Context, interval time.Duration)
+}
+
+type PickupServiceImpl struct {
+	db         db.Conn       // Ссылка на объект базы данных
+	holdPeriod time.Duration // Срок хранения заказа в магазине
+}
+
+func NewPickupService(db db.Conn, holdPeriod time.Duration) *PickupServiceImpl {
+	return &PickupServiceImpl{
+		db:         db,
+		holdPeriod: holdPeriod,
+	}
+}
+
+// CreatePickupOrder оформляет покупку с самовывозом: резервирует товар на складе
+// выбранного магазина и выдаёт короткий код получения. Всё в одной транзакции.
+func (s *PickupServiceImpl) CreatePickupOrder(ctx context.Context, order PickupOrder) (*PickupOrder, error) {
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		err := tx.QueryRowContext(ctx, "INSERT INTO purchases (customer_id, status) VALUES ($1, $2) RETURNING id", order.CustomerID, PurchaseStatusAwaitingPickup).Scan(&order.PurchaseID)
+		if err != nil {
+			return err
+		}
+		err = publishEvent(ctx, tx, EventPurchaseCreated, AggregatePurchase, order.PurchaseID, PurchaseCreatedPayload{
+			PurchaseID: EventID(order.PurchaseID),
+			CustomerID: EventID(order.CustomerID),
+			Status:     PurchaseStatusAwaitingPickup,
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, item := range order.Items {
+			err := tx.QueryRowContext(ctx, "SELECT price FROM products WHERE id = $1 AND deleted_at IS NULL", item.ProductID).Scan(&order.Items[i].Price)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return ErrProductNotFound
+				}
+				return err
+			}
+
+			result, err := tx.ExecContext(ctx, "UPDATE store_inventory SET reserved = reserved + $1 WHERE store_id = $2 AND product_id = $3 AND quantity - reserved >= $1", item.Quantity, order.StoreID, item.ProductID)
+			if err != nil {
+				return err
+			}
+			affected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if affected == 0 {
+				return ErrInsufficientStock
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO purchase_items (purchase_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)", order.PurchaseID, item.ProductID, item.Quantity, order.Items[i].Price)
+			if err != nil {
+				return err
+			}
+		}
+
+		order.Status = PickupStatusReserved
+		order.ExpiresAt = time.Now().Add(s.holdPeriod)
+		return insertPickupOrder(ctx, tx, &order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetPickupOrderByCode ищет активный заказ: коды выданных и отменённых заказов могут достаться новым
+func (s *PickupServiceImpl) GetPickupOrderByCode(ctx context.Context, code string) (*PickupOrder, error) {
+	return s.getPickupOrder(ctx, s.db, "pickup_code = $1 AND status = $2", code, PickupStatusReserved)
+}
+
+// MarkCollected отмечает заказ выданным. Сотрудник обязан подтвердить проверку возраста.
+func (s *PickupServiceImpl) MarkCollected(ctx context.Context, req CollectRequest) (*PickupOrder, error) {
+	if !req.AgeVerified {
+		return nil, ErrAgeNotVerified
+	}
+
+	var order *PickupOrder
+	now := time.Now()
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var err error
+		order, err = s.getPickupOrder(ctx, tx, "pickup_code = $1 AND status = $2", req.PickupCode, PickupStatusReserved)
+		if err != nil {
+			return err
+		}
+
+		err = changePickupStatus(ctx, tx, "UPDATE pickup_orders SET status = $1, collected_at = $2, collected_by = $3, updated_at = $2 WHERE id = $4 AND status = $5", PickupStatusCollected, now, req.StaffName, order.ID, PickupStatusReserved)
+		if err != nil {
+			return err
+		}
+
+		// Резерв превращается в списание: товар физически уходит из магазина
+		for _, item := range order.Items {
+			_, err := tx.ExecContext(ctx, "UPDATE store_inventory SET quantity = quantity - $1, reserved = reserved - $1 WHERE store_id = $2 AND product_id = $3", item.Quantity, order.StoreID, item.ProductID)
+			if err != nil {
+				return err
+			}
+			err = recordStockMovement(ctx, tx, StockMovement{
+				StoreID: order.StoreID, ProductID: item.ProductID, Kind: MovementSale, Quantity: -item.Quantity,
+				ReferenceType: MovementRefPickupOrder, ReferenceID: order.ID, CreatedBy: req.StaffName,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return setPurchaseStatus(ctx, tx, order.PurchaseID, PurchaseStatusCompleted, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order.Status = PickupStatusCollected
+	order.CollectedAt = &now
+	order.CollectedBy = req.StaffName
+	order.UpdatedAt = now
+	return order, nil
+}
+
+func (s *PickupServiceImpl) CancelPickupOrder(ctx context.Context, id int64) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		order, err := s.getPickupOrder(ctx, tx, "id = $1", id)
+		if err != nil {
+			return err
+		}
+		if order.Status != PickupStatusReserved {
+			return ErrPickupNotReserved
+		}
+
+		return cancelPickupOrder(ctx, tx, order)
+	})
+}
+
+// CancelExpired отменяет все невыкупленные заказы с истёкшим сроком хранения
+// и возвращает зарезервированный товар в свободный остаток.
+func (s *PickupServiceImpl) CancelExpired(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM pickup_orders WHERE status = $1 AND expires_at < $2", PickupStatusReserved, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, id := range ids {
+		err := s.CancelPickupOrder(ctx, id)
+		if errors.Is(err, ErrPickupNotReserved) {
+			continue // заказ успели выдать, пока мы его обрабатывали
+		}
+		if err != nil {
+			return cancelled, err
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+// RunExpiryWorker периодически вызывает CancelExpired, пока не отменён ctx
+func (s *PickupServiceImpl) RunExpiryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.CancelExpired(ctx); err != nil {
+				slog.ErrorContext(ctx, "ошибка автоотмены заказов на самовывоз", "error", err)
+			} else if n > 0 {
+				slog.InfoContext(ctx, "автоматически отменены заказы на самовывоз", "count", n)
+			}
+		}
+	}
+}
+
+// queryer - часть db.Querier для чтения
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getPickupOrder возвращает заказ с позициями по условию where
+func (s *PickupServiceImpl) getPickupOrder(ctx context.Context, q queryer, where string, args ...any) (*PickupOrder, error) {
+	var order PickupOrder
+	var collectedAt sql.NullTime
+	var collectedBy sql.NullString
+	err := q.QueryRowContext(ctx, "SELECT id, purchase_id, customer_id, store_id, pickup_code, status, expires_at, collected_at, collected_by, created_at, updated_at FROM pickup_orders WHERE "+where, args...).
+		Scan(&order.ID, &order.PurchaseID, &order.CustomerID, &order.StoreID, &order.PickupCode, &order.Status, &order.ExpiresAt, &collectedAt, &collectedBy, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPickupNotFound
+		}
+		return nil, err
+	}
+	if collectedAt.Valid {
+		order.CollectedAt = &collectedAt.Time
+	}
+	order.CollectedBy = collectedBy.String
+
+	rows, err := q.QueryContext(ctx, "SELECT product_id, quantity, price FROM purchase_items WHERE purchase_id = $1", order.PurchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item PickupItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+		order.Items = append(order.Items, item)
+	}
+
+	return &order, rows.Err()
+}
+
+func cancelPickupOrder(ctx context.Context, tx db.Querier, order *PickupOrder) error {
+	now := time.Now()
+	err := changePickupStatus(ctx, tx, "UPDATE pickup_orders SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4", PickupStatusCancelled, now, order.ID, PickupStatusReserved)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range order.Items {
+		_, err := tx.ExecContext(ctx, "UPDATE store_inventory SET reserved = reserved - $1 WHERE store_id = $2 AND product_id = $3", item.Quantity, order.StoreID, item.ProductID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setPurchaseStatus(ctx, tx, order.PurchaseID, PurchaseStatusCancelled, now)
+}
+
+// changePickupStatus выполняет смену статуса, условную по текущему статусу заказа,
+// чтобы параллельные выдача и автоотмена не обработали один заказ дважды
+func changePickupStatus(ctx context.Context, tx db.Querier, query string, args ...any) error {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrPickupNotReserved
+	}
+	return nil
+}
+
+// insertPickupOrder сохраняет заказ со случайным кодом получения. Код уникален среди
+// активных заказов (частичный уникальный индекс uq_pickup_orders_code_reserved); при
+// совпадении вставка пропускается, и берётся новый код.
+func insertPickupOrder(ctx context.Context, tx db.Querier, order *PickupOrder) error {
+	for attempt := 0; attempt < pickupCodeMaxAttempts; attempt++ {
+		code, err := newPickupCode()
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `INSERT INTO pickup_orders (purchase_id, customer_id, store_id, pickup_code, status, expires_at) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (pickup_code) WHERE status = 'reserved' DO NOTHING
+			RETURNING id, created_at, updated_at`,
+			order.PurchaseID, order.CustomerID, order.StoreID, code, order.Status, order.ExpiresAt).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // код занят другим активным заказом
+		}
+		if err != nil {
+			return err
+		}
+		order.PickupCode = code
+		return nil
+	}
+	return errors.New("не удалось сгенерировать код получения")
+}
+
+// newPickupCode возвращает случайный код из pickupCodeAlphabet
+func newPickupCode() (string, error) {
+	code := make([]byte, pickupCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(pickupCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = pickupCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPickupCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code, err := newPickupCode()
+		if err != nil {
+			t.Fatalf("newPickupCode() error = %v", err)
+		}
+		if len(code) != pickupCodeLength {
+			t.Fatalf("len(%q) = %d, want %d", code, len(code), pickupCodeLength)
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(pickupCodeAlphabet, c) {
+				t.Fatalf("код %q содержит символ %q не из алфавита", code, c)
+			}
+		}
+	}
+}
+
+func TestInsertPickupOrder(t *testing.T) {
+	columns := []string{"id", "created_at", "updated_at"}
+	tests := []struct {
+		name      string
+		conflicts int // Сколько первых кодов заняты
+		wantErr   bool
+	}{
+		{"код свободен", 0, false},
+		{"повтор после занятого кода", 2, false},
+		{"все попытки заняты", pickupCodeMaxAttempts, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			var codes []string
+			stub.on("INSERT INTO pickup_orders", func(args []any) (*stubRows, error) {
+				codes = append(codes, args[3].(string))
+				if len(codes) <= tt.conflicts {
+					return rowsOf(columns), nil // ON CONFLICT DO NOTHING: строка не вставлена
+				}
+				return rowsOf(columns, []driver.Value{int64(42), time.Now(), time.Now()}), nil
+			})
+
+			tx, err := conn.BeginTx(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			order := PickupOrder{PurchaseID: 1, CustomerID: 2, StoreID: 3, Status: PickupStatusReserved}
+			err = insertPickupOrder(context.Background(), tx, &order)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("insertPickupOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(codes) != pickupCodeMaxAttempts {
+					t.Errorf("попыток = %d, want %d", len(codes), pickupCodeMaxAttempts)
+				}
+				return
+			}
+			if order.ID != 42 || order.PickupCode != codes[len(codes)-1] {
+				t.Errorf("order = %+v, последний код %q", order, codes[len(codes)-1])
+			}
+			if len(codes) != tt.conflicts+1 {
+				t.Errorf("попыток = %d, want %d", len(codes), tt.conflicts+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Регистрация декодеров поддерживаемых форматов
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/storage"
+	"github.com/Dmitriy4565/VapeShop/internal/utils"
+	"github.com/lib/pq"
+)
+
+const (
+	maxImageSize      = 10 << 20 // 10 МБ
+	thumbnailMaxSide  = 320
+	thumbnailQuality  = 85
+	webPQuality       = 80
+	thumbnailMimeType = "image/jpeg"
+)
+
+var (
+	ErrImageNotFound    = errors.New("изображение не найдено")
+	ErrImageTooLarge    = errors.New("файл изображения слишком большой")
+	ErrImageUnsupported = errors.New("неподдерживаемый формат изображения")
+)
+
+var imageFormatExt = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+}
+
+type ProductImage struct {
+	ID           int64     `json:"id"`
+	ProductID    int64     `json:"productId"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnailUrl"`
+	WebPURL      string    `json:"webpUrl,omitempty"`
+	Position     int       `json:"position"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	key          string
+	thumbnailKey string
+	webPKey      string
+}
+
+type ProductImageService interface {
+	GetImagesByProduct(ctx context.Context, productID int64) ([]ProductImage, error)
+	UploadImage(ctx context.Context, productID int64, body io.Reader) (*ProductImage, error)
+	ReorderImages(ctx context.Context, productID int64, imageIDs []int64) error
+	DeleteImage(ctx context.Context, id int64) error
+	DeleteProductImages(ctx context.Context, tx dbtx, productIDs []int64) (func(ctx context.Context), error)
+}
+
+type ProductImageServiceImpl struct {
+	db      db.Conn // Ссылка на объект базы данных
+	storage storage.Storage
+}
+
+func NewProductImageService(db db.Conn, storage storage.Storage) *ProductImageServiceImpl {
+	return &ProductImageServiceImpl{
+		db:      db,
+		storage: storage,
+	}
+}
+
+const productImageColumns = "id, product_id, url, thumbnail_url, COALESCE(webp_url, ''), position, width, height, created_at, storage_key, thumbnail_key, COALESCE(webp_key, '')"
+
+func scanProductImage(row interface{ Scan(...any) error }, img *ProductImage) error {
+	return row.Scan(&img.ID, &img.ProductID, &img.URL, &img.ThumbnailURL, &img.WebPURL, &img.Position, &img.Width, &img.Height, &img.CreatedAt, &img.key, &img.thumbnailKey, &img.webPKey)
+}
+
+func (s *ProductImageServiceImpl) GetImagesByProduct(ctx context.Context, productID int64) ([]ProductImage, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+productImageColumns+" FROM product_images WHERE product_id = $1 ORDER BY position, id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []ProductImage{}
+	for rows.Next() {
+		var img ProductImage
+		if err := scanProductImage(rows, &img); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+
+	return images, rows.Err()
+}
+
+// UploadImage сохраняет оригинал, уменьшенную копию и (если доступен cwebp) WebP-версию,
+// добавляя изображение в конец галереи товара
+func (s *ProductImageServiceImpl) UploadImage(ctx context.Context, productID int64, body io.Reader) (*ProductImage, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, ErrImageTooLarge
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrImageUnsupported
+	}
+	ext, ok := imageFormatExt[format]
+	if !ok {
+		return nil, ErrImageUnsupported
+	}
+
+	var exists bool
+	err = s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM products WHERE id = $1 AND deleted_at IS NULL)", productID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New("продукт не найден")
+	}
+
+	base := fmt.Sprintf("products/%d/%d", productID, time.Now().UnixNano())
+	img := &ProductImage{
+		ProductID:    productID,
+		Width:        src.Bounds().Dx(),
+		Height:       src.Bounds().Dy(),
+		key:          base + ext,
+		thumbnailKey: base + "_thumb.jpg",
+	}
+
+	thumb, err := utils.EncodeJPEG(utils.Thumbnail(src, thumbnailMaxSide), thumbnailQuality)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded := []string{}
+	cleanup := func() {
+		for _, key := range uploaded {
+			if err := s.storage.Delete(ctx, key); err != nil {
+				slog.WarnContext(ctx, "не удалось удалить файл", "key", key, "error", err)
+			}
+		}
+	}
+
+	if img.URL, err = s.storage.Put(ctx, img.key, bytes.NewReader(data), "image/"+format); err != nil {
+		return nil, err
+	}
+	uploaded = append(uploaded, img.key)
+
+	if img.ThumbnailURL, err = s.storage.Put(ctx, img.thumbnailKey, bytes.NewReader(thumb), thumbnailMimeType); err != nil {
+		cleanup()
+		return nil, err
+	}
+	uploaded = append(uploaded, img.thumbnailKey)
+
+	webP, err := utils.EncodeWebP(data, webPQuality)
+	switch {
+	case err == nil:
+		img.webPKey = base + ".webp"
+		if img.WebPURL, err = s.storage.Put(ctx, img.webPKey, bytes.NewReader(webP), "image/webp"); err != nil {
+			cleanup()
+			return nil, err
+		}
+		uploaded = append(uploaded, img.webPKey)
+	case errors.Is(err, utils.ErrWebPUnavailable):
+		// WebP - необязательная версия, без кодировщика просто не создаём её
+	default:
+		slog.WarnContext(ctx, "не удалось создать WebP", "product_id", productID, "error", err)
+	}
+
+	err = s.db.QueryRowContext(ctx, `INSERT INTO product_images (product_id, storage_key, url, thumbnail_key, thumbnail_url, webp_key, webp_url, position, width, height)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), (SELECT COALESCE(MAX(position), -1) + 1 FROM product_images WHERE product_id = $1), $8, $9)
+		RETURNING id, position, created_at`,
+		img.ProductID, img.key, img.URL, img.thumbnailKey, img.ThumbnailURL, img.webPKey, img.WebPURL, img.Width, img.Height).Scan(&img.ID, &img.Position, &img.CreatedAt)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	if err := s.syncMainImage(ctx, s.db, productID); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// ReorderImages задаёт порядок галереи: imageIDs - все изображения товара в нужном порядке.
+// Первое изображение становится основным (products.image_url).
+func (s *ProductImageServiceImpl) ReorderImages(ctx context.Context, productID int64, imageIDs []int64) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM product_images WHERE product_id = $1", productID).Scan(&count); err != nil {
+			return err
+		}
+		if count != len(imageIDs) {
+			return errors.New("нужно передать все изображения товара")
+		}
+
+		for position, id := range imageIDs {
+			result, err := tx.ExecContext(ctx, "UPDATE product_images SET position = $1 WHERE id = $2 AND product_id = $3", position, id, productID)
+			if err != nil {
+				return err
+			}
+			if affected, err := result.RowsAffected(); err != nil {
+				return err
+			} else if affected == 0 {
+				return ErrImageNotFound
+			}
+		}
+
+		return s.syncMainImage(ctx, tx, productID)
+	})
+}
+
+func (s *ProductImageServiceImpl) DeleteImage(ctx context.Context, id int64) error {
+	var img ProductImage
+	err := scanProductImage(s.db.QueryRowContext(ctx, "SELECT "+productImageColumns+" FROM product_images WHERE id = $1", id), &img)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrImageNotFound
+		}
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM product_images WHERE id = $1", id); err != nil {
+		return err
+	}
+	s.deleteFiles(ctx, img)
+
+	return s.syncMainImage(ctx, s.db, img.ProductID)
+}
+
+// DeleteProductImages удаляет в транзакции tx все изображения товаров и возвращает удаление
+// их файлов, которое выполняется после фиксации. Вызывается при окончательном удалении товаров.
+func (s *ProductImageServiceImpl) DeleteProductImages(ctx context.Context, tx dbtx, productIDs []int64) (func(ctx context.Context), error) {
+	rows, err := tx.QueryContext(ctx, "DELETE FROM product_images WHERE product_id = ANY($1) RETURNING storage_key, thumbnail_key, COALESCE(webp_key, '')", pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []ProductImage
+	for rows.Next() {
+		var img ProductImage
+		if err := rows.Scan(&img.key, &img.thumbnailKey, &img.webPKey); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) {
+		for _, img := range images {
+			s.deleteFiles(ctx, img)
+		}
+	}, nil
+}
+
+// deleteFiles удаляет файлы изображения из хранилища. Ошибки только логируются:
+// запись в БД уже удалена, а осиротевший файл не мешает работе магазина.
+func (s *ProductImageServiceImpl) deleteFiles(ctx context.Context, img ProductImage) {
+	for _, key := range []string{img.key, img.thumbnailKey, img.webPKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.storage.Delete(ctx, key); err != nil {
+			slog.WarnContext(ctx, "не удалось удалить файл", "key", key, "error", err)
+		}
+	}
+}
+
+// syncMainImage прописывает в products.image_url первое изображение галереи
+func (s *ProductImageServiceImpl) syncMainImage(ctx context.Context, db execer, productID int64) error {
+	_, err := db.ExecContext(ctx, "UPDATE products SET image_url = (SELECT url FROM product_images WHERE product_id = $1 ORDER BY position, id LIMIT 1) WHERE id = $1", productID)
+	return err
+}
@@ -1,95 +1,142 @@
-package services //заменить s.db на фактическое подключение к бд, но это в конце после маина
+package services
 
 import (
 	"context"
 	"errors"
-	"time"
+	"fmt"
 
-	"database/sql"
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Product struct {
-	ID             string    `json:"id"`
-	ManufacturerID string    `json:"manufacturerId"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	Price          float64   `json:"price"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
-}
+type Product = repository.Product
+
+var ErrProductNotFound = errors.New("продукт не найден")
 
 type ProductService interface {
-	GetAllProducts() ([]Product, error)
-	GetProductByID(id string) (*Product, error)
-	CreateProduct(product Product) (*Product, error)
-	UpdateProduct(product Product) error
-	DeleteProduct(id string) error
+	GetAllProducts(ctx context.Context, includeDeleted bool) ([]Product, error)
+	GetProductByID(ctx context.Context, id int64) (*Product, error)
+	GetProductsByCategory(ctx context.Context, categoryID int64, includeDescendants bool) ([]Product, error)
+	CreateProduct(ctx context.Context, product Product) (*Product, error)
+	UpdateProduct(ctx context.Context, product Product) error
+	DeleteProduct(ctx context.Context, id int64) error
+	RestoreProduct(ctx context.Context, id int64) error
 }
 
 type ProductServiceImpl struct {
-	db *sql.DB // Ссылка на объект базы данных
+	catalogEmitter
+	uow        db.UnitOfWork
+	products   repository.ProductRepository
+	categories repository.CategoryRepository
+	cache      *CatalogCache
 }
 
-func NewProductService(db *sql.DB) *ProductServiceImpl {
+func NewProductService(uow db.UnitOfWork, products repository.ProductRepository, categories repository.CategoryRepository, cache *CatalogCache) *ProductServiceImpl {
 	return &ProductServiceImpl{
-		db: db,
+		uow:        uow,
+		products:   products,
+		categories: categories,
+		cache:      cache,
 	}
 }
 
-func (s *ProductServiceImpl) GetAllProducts() ([]Product, error) {
-	rows, err := s.db.QueryContext(context.Background(), "SELECT * FROM products")
-	if err != nil {
-		return nil, err
+// productError заменяет repository.ErrNotFound на ErrProductNotFound
+func productError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrProductNotFound
 	}
-	defer rows.Close()
+	return err
+}
+
+func (s *ProductServiceImpl) GetAllProducts(ctx context.Context, includeDeleted bool) ([]Product, error) {
+	return readThrough(ctx, s.cache, fmt.Sprintf("%sall:%t", cacheProducts, includeDeleted), func() ([]Product, error) {
+		return s.products.List(ctx, includeDeleted)
+	})
+}
+
+// GetProductsByCategory возвращает товары категории, а с includeDescendants - и всех её подкатегорий
+func (s *ProductServiceImpl) GetProductsByCategory(ctx context.Context, categoryID int64, includeDescendants bool) ([]Product, error) {
+	key := fmt.Sprintf("%scategory:%d:%t", cacheProducts, categoryID, includeDescendants)
+	return readThrough(ctx, s.cache, key, func() ([]Product, error) {
+		return s.listByCategory(ctx, categoryID, includeDescendants)
+	})
+}
 
-	var products []Product
-	for rows.Next() {
-		var product Product
-		if err := rows.Scan(&product.ID, &product.ManufacturerID, &product.Name, &product.Description, &product.Price, &product.CreatedAt, &product.UpdatedAt); err != nil {
+func (s *ProductServiceImpl) listByCategory(ctx context.Context, categoryID int64, includeDescendants bool) ([]Product, error) {
+	categoryIDs := []int64{categoryID}
+	if includeDescendants {
+		ids, err := s.categories.DescendantIDs(ctx, categoryID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
 			return nil, err
 		}
-		products = append(products, product)
+		categoryIDs = ids
 	}
+	return s.products.ListByCategories(ctx, categoryIDs)
+}
 
-	return products, nil
+func (s *ProductServiceImpl) GetProductByID(ctx context.Context, id int64) (*Product, error) {
+	product, err := readThrough(ctx, s.cache, fmt.Sprintf("%sid:%d", cacheProducts, id), func() (*Product, error) {
+		return s.products.GetByID(ctx, id)
+	})
+	return product, productError(err)
 }
 
-func (s *ProductServiceImpl) GetProductByID(id string) (*Product, error) {
-	var product Product
-	err := s.db.QueryRowContext(context.Background(), "SELECT * FROM products WHERE id = $1", id).Scan(&product.ID, &product.ManufacturerID, &product.Name, &product.Description, &product.Price, &product.CreatedAt, &product.UpdatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("продукт не найден")
-		}
+func (s *ProductServiceImpl) CreateProduct(ctx context.Context, product Product) (*Product, error) {
+	if err := s.products.Create(ctx, &product); err != nil {
 		return nil, err
 	}
+	s.cache.invalidateProducts(ctx)
 	return &product, nil
 }
 
-func (s *ProductServiceImpl) CreateProduct(product Product) (*Product, error) {
-	ctx := context.Background()
-	result, err := s.db.ExecContext(ctx, "INSERT INTO products (manufacturerId, name, description, price) VALUES ($1, $2, $3, $4)", product.ManufacturerID, product.Name, product.Description, product.Price)
+// UpdateProduct обновляет товар; изменение цены записывается в price_change
+func (s *ProductServiceImpl) UpdateProduct(ctx context.Context, product Product) error {
+	change := PriceChanged{ProductID: product.ID, NewPrice: product.Price}
+	err := s.uow.WithTx(ctx, func(tx db.Querier) error {
+		products := s.products.WithTx(tx)
+		old, err := products.GetForUpdate(ctx, product.ID)
+		if err != nil {
+			return err
+		}
+		change.OldPrice = old.Price
+
+		if err := products.Update(ctx, product); err != nil {
+			return err
+		}
+		if change.NewPrice == change.OldPrice {
+			return nil
+		}
+		if err := products.RecordPriceChange(ctx, product.ID, change.OldPrice, change.NewPrice); err != nil {
+			return err
+		}
+		return publishPriceChanged(ctx, tx, change)
+	})
 	if err != nil {
-		return nil, err
+		return productError(err)
 	}
+	s.cache.invalidateProducts(ctx)
 
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
+	if change.NewPrice != change.OldPrice {
+		s.emitPriceChanged(ctx, change)
 	}
-	product.ID = lastInsertID
-	return &product, nil
+	return nil
 }
 
-func (s *ProductServiceImpl) UpdateProduct(product Product) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "UPDATE products SET manufacturerId = $1, name = $2, description = $3, price = $4 WHERE id = $5", product.ManufacturerID, product.Name, product.Description, product.Price, product.ID)
-	return err
+func (s *ProductServiceImpl) DeleteProduct(ctx context.Context, id int64) error {
+	if err := s.products.Delete(ctx, id); err != nil {
+		return productError(err)
+	}
+	s.cache.invalidateProducts(ctx)
+	return nil
 }
 
-func (s *ProductServiceImpl) DeleteProduct(id string) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "DELETE FROM products WHERE id = $1", id)
-	return err
+func (s *ProductServiceImpl) RestoreProduct(ctx context.Context, id int64) error {
+	if err := s.products.Restore(ctx, id); err != nil {
+		return productError(err)
+	}
+	s.cache.invalidateProducts(ctx)
+	return nil
 }
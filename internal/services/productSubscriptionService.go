@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/notify"
+	"github.com/lib/pq"
+)
+
+// Виды подписок покупателя на товар
+const (
+	SubscriptionBackInStock = "back_in_stock"
+	SubscriptionPriceBelow  = "price_below"
+)
+
+var (
+	ErrSubscriptionNotFound  = errors.New("подписка не найдена")
+	ErrSubscriptionTarget    = errors.New("для подписки на снижение цены нужна целевая цена")
+	ErrSubscriptionSatisfied = errors.New("условие подписки уже выполнено")
+)
+
+// ProductSubscription - подписка покупателя на появление товара или снижение цены.
+// После отправки уведомления подписка закрывается (FiredAt) и больше не срабатывает.
+type ProductSubscription struct {
+	ID          int64      `json:"id"`
+	CustomerID  int64      `json:"customerId" validate:"required"`
+	ProductID   int64      `json:"productId" validate:"required"`
+	VariantID   int64      `json:"variantId,omitempty"`
+	Kind        string     `json:"kind" validate:"required,oneof=back_in_stock price_below"`
+	TargetPrice *float64   `json:"targetPrice,omitempty" validate:"omitempty,gt=0"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	FiredAt     *time.Time `json:"firedAt,omitempty"`
+}
+
+type ProductSubscriptionService interface {
+	Subscribe(ctx context.Context, sub ProductSubscription) (*ProductSubscription, error)
+	Unsubscribe(ctx context.Context, id, customerID int64) error
+	GetCustomerSubscriptions(ctx context.Context, customerID int64, includeFired bool) ([]ProductSubscription, error)
+	DeleteCustomerSubscriptions(ctx context.Context, tx dbtx, customerIDs []int64) (func(ctx context.Context), error)
+	HandleStockIncreased(ctx context.Context, event StockIncreased)
+	HandlePriceChanged(ctx context.Context, event PriceChanged)
+}
+
+type ProductSubscriptionServiceImpl struct {
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewProductSubscriptionService(db db.Conn) *ProductSubscriptionServiceImpl {
+	return &ProductSubscriptionServiceImpl{
+		db: db,
+	}
+}
+
+// Доступность товара: свободный остаток в магазинах, общий остаток или остаток любого варианта
+const productAvailableSQL = `(EXISTS (SELECT 1 FROM store_inventory si WHERE si.product_id = p.id AND si.quantity - si.reserved > 0)
+	OR COALESCE(p.stock, 0) > 0
+	OR EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id AND pv.stock > 0))`
+
+// subscriptionStateSQL выбирает текущее состояние подписки: доступен ли товар (вариант) и его цена
+const subscriptionStateSQL = `SELECT
+		CASE WHEN s.variant_id IS NULL THEN ` + productAvailableSQL + ` ELSE COALESCE(v.stock, 0) > 0 END,
+		CASE WHEN s.variant_id IS NULL THEN p.price ELSE COALESCE(v.price_override, p.price) END`
+
+// Subscribe оформляет подписку. Повторная подписка на то же событие заменяет целевую цену.
+// Если условие уже выполнено (товар в наличии, цена ниже целевой), подписка не создаётся.
+func (s *ProductSubscriptionServiceImpl) Subscribe(ctx context.Context, sub ProductSubscription) (*ProductSubscription, error) {
+	if sub.Kind == SubscriptionPriceBelow && sub.TargetPrice == nil {
+		return nil, ErrSubscriptionTarget
+	}
+	if sub.Kind == SubscriptionBackInStock {
+		sub.TargetPrice = nil
+	}
+
+	var available bool
+	var price float64
+	err := s.db.QueryRowContext(ctx, subscriptionStateSQL+`
+		FROM (SELECT $1::int AS product_id, NULLIF($2, 0)::int AS variant_id) s
+		JOIN products p ON p.id = s.product_id AND p.deleted_at IS NULL
+		LEFT JOIN product_variants v ON v.id = s.variant_id AND v.product_id = s.product_id
+		WHERE s.variant_id IS NULL OR v.id IS NOT NULL`, sub.ProductID, sub.VariantID).Scan(&available, &price)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("продукт не найден")
+		}
+		return nil, err
+	}
+	if (sub.Kind == SubscriptionBackInStock && available) || (sub.Kind == SubscriptionPriceBelow && price <= *sub.TargetPrice) {
+		return nil, ErrSubscriptionSatisfied
+	}
+
+	err = s.db.QueryRowContext(ctx, `INSERT INTO product_subscriptions (customer_id, product_id, variant_id, kind, target_price) VALUES ($1, $2, NULLIF($3, 0), $4, $5)
+		ON CONFLICT (customer_id, product_id, COALESCE(variant_id, 0), kind) WHERE fired_at IS NULL
+		DO UPDATE SET target_price = EXCLUDED.target_price
+		RETURNING id, created_at`,
+		sub.CustomerID, sub.ProductID, sub.VariantID, sub.Kind, sub.TargetPrice).Scan(&sub.ID, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *ProductSubscriptionServiceImpl) Unsubscribe(ctx context.Context, id, customerID int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM product_subscriptions WHERE id = $1 AND customer_id = $2 AND fired_at IS NULL", id, customerID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+func (s *ProductSubscriptionServiceImpl) GetCustomerSubscriptions(ctx context.Context, customerID int64, includeFired bool) ([]ProductSubscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, customer_id, product_id, COALESCE(variant_id, 0), kind, target_price, created_at, fired_at
+		FROM product_subscriptions WHERE customer_id = $1 AND ($2 OR fired_at IS NULL)
+		ORDER BY created_at DESC`, customerID, includeFired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []ProductSubscription{}
+	for rows.Next() {
+		var sub ProductSubscription
+		if err := rows.Scan(&sub.ID, &sub.CustomerID, &sub.ProductID, &sub.VariantID, &sub.Kind, &sub.TargetPrice, &sub.CreatedAt, &sub.FiredAt); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// DeleteCustomerSubscriptions удаляет в транзакции tx все подписки покупателей.
+// Вызывается при окончательном удалении покупателей.
+func (s *ProductSubscriptionServiceImpl) DeleteCustomerSubscriptions(ctx context.Context, tx dbtx, customerIDs []int64) (func(ctx context.Context), error) {
+	_, err := tx.ExecContext(ctx, "DELETE FROM product_subscriptions WHERE customer_id = ANY($1)", pq.Array(customerIDs))
+	return nil, err
+}
+
+// HandleStockIncreased уведомляет подписчиков товара, который снова можно купить.
+// Доступность перепроверяется по базе: рост остатка ещё не означает, что товар свободен.
+func (s *ProductSubscriptionServiceImpl) HandleStockIncreased(ctx context.Context, event StockIncreased) {
+	s.fire(ctx, SubscriptionBackInStock, notify.TemplateBackInStock, event.ProductID)
+}
+
+// HandlePriceChanged уведомляет подписчиков, чья целевая цена достигнута
+func (s *ProductSubscriptionServiceImpl) HandlePriceChanged(ctx context.Context, event PriceChanged) {
+	if event.NewPrice >= event.OldPrice {
+		return
+	}
+	s.fire(ctx, SubscriptionPriceBelow, notify.TemplatePriceDrop, event.ProductID)
+}
+
+type firedSubscription struct {
+	id         int64
+	customerID int64
+	data       notify.ProductData
+}
+
+// fire ставит в очередь уведомления по сработавшим подпискам товара. Подписка закрывается
+// в одной транзакции с постановкой в очередь, поэтому параллельные события не пришлют
+// уведомление дважды, а отправку с повторами берёт на себя очередь.
+func (s *ProductSubscriptionServiceImpl) fire(ctx context.Context, kind, template string, productID int64) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, customer_id, name, price FROM (
+			SELECT s.id, s.customer_id, p.name, s.target_price, state.*
+			FROM product_subscriptions s
+			JOIN customers c ON c.id = s.customer_id AND c.deleted_at IS NULL
+			JOIN products p ON p.id = s.product_id AND p.deleted_at IS NULL
+			LEFT JOIN product_variants v ON v.id = s.variant_id
+			CROSS JOIN LATERAL (`+subscriptionStateSQL+`) AS state (available, price)
+			WHERE s.product_id = $1 AND s.kind = $2 AND s.fired_at IS NULL
+		) candidates
+		WHERE CASE WHEN $2 = $3 THEN available ELSE price <= target_price END`, productID, kind, SubscriptionBackInStock)
+	if err != nil {
+		slog.ErrorContext(ctx, "ошибка поиска подписок на товар", "product_id", productID, "error", err)
+		return
+	}
+
+	var fired []firedSubscription
+	for rows.Next() {
+		var f firedSubscription
+		if err := rows.Scan(&f.id, &f.customerID, &f.data.ProductName, &f.data.Price); err != nil {
+			slog.ErrorContext(ctx, "ошибка чтения подписки на товар", "product_id", productID, "error", err)
+			rows.Close()
+			return
+		}
+		fired = append(fired, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "ошибка поиска подписок на товар", "product_id", productID, "error", err)
+		return
+	}
+
+	for _, f := range fired {
+		if err := s.fireOne(ctx, template, f); err != nil {
+			slog.ErrorContext(ctx, "не удалось поставить в очередь уведомление по подписке", "subscription_id", f.id, "error", err)
+		}
+	}
+}
+
+func (s *ProductSubscriptionServiceImpl) fireOne(ctx context.Context, template string, f firedSubscription) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		result, err := tx.ExecContext(ctx, "UPDATE product_subscriptions SET fired_at = NOW() WHERE id = $1 AND fired_at IS NULL", f.id)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		if _, err := enqueueCustomerNotification(ctx, tx, f.customerID, template, f.data); err != nil {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Атрибуты, по которым различаются варианты товара
+const (
+	VariantAttrColor            = "color"
+	VariantAttrCoilResistance   = "coil_resistance"
+	VariantAttrNicotineStrength = "nicotine_strength"
+	VariantAttrVolume           = "volume"
+)
+
+var ErrVariantNotFound = errors.New("вариант товара не найден")
+
+type ProductVariant struct {
+	ID            int64             `json:"id"`
+	ProductID     int64             `json:"productId" validate:"required"`
+	SKU           string            `json:"sku" validate:"required"`
+	PriceOverride *float64          `json:"priceOverride,omitempty"` // Пусто - действует цена товара
+	Price         float64           `json:"price"`                   // Итоговая цена варианта
+	Stock         int               `json:"stock" validate:"min=0"`
+	Attributes    map[string]string `json:"attributes" validate:"dive,keys,oneof=color coil_resistance nicotine_strength volume,endkeys,required"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+// ProductPage - товар со всеми вариантами и возможными значениями атрибутов для выбора
+type ProductPage struct {
+	Product  Product             `json:"product"`
+	Variants []ProductVariant    `json:"variants"`
+	Options  map[string][]string `json:"options"` // атрибут -> доступные значения
+	InStock  bool                `json:"inStock"`
+}
+
+type ProductVariantService interface {
+	GetVariantsByProduct(ctx context.Context, productID int64) ([]ProductVariant, error)
+	GetVariantBySKU(ctx context.Context, sku string) (*ProductVariant, error)
+	GetProductPage(ctx context.Context, productID int64) (*ProductPage, error)
+	CreateVariant(ctx context.Context, variant ProductVariant) (*ProductVariant, error)
+	UpdateVariant(ctx context.Context, variant ProductVariant) error
+	SetVariantStock(ctx context.Context, id int64, stock int) error
+	DeleteVariant(ctx context.Context, id int64) error
+}
+
+type ProductVariantServiceImpl struct {
+	catalogEmitter
+	db             db.Conn // Ссылка на объект базы данных
+	productService ProductService
+}
+
+func NewProductVariantService(db db.Conn, productService ProductService) *ProductVariantServiceImpl {
+	return &ProductVariantServiceImpl{
+		db:             db,
+		productService: productService,
+	}
+}
+
+const variantColumns = "v.id, v.product_id, v.sku, v.price_override, COALESCE(v.price_override, p.price), v.stock, v.created_at, v.updated_at"
+
+func (s *ProductVariantServiceImpl) GetVariantsByProduct(ctx context.Context, productID int64) ([]ProductVariant, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+variantColumns+" FROM product_variants v JOIN products p ON p.id = v.product_id WHERE v.product_id = $1 ORDER BY v.id", productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []ProductVariant
+	for rows.Next() {
+		var variant ProductVariant
+		if err := scanVariant(rows, &variant); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range variants {
+		variants[i].Attributes, err = s.getAttributes(ctx, variants[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+func (s *ProductVariantServiceImpl) GetVariantBySKU(ctx context.Context, sku string) (*ProductVariant, error) {
+	var variant ProductVariant
+	err := scanVariant(s.db.QueryRowContext(ctx, "SELECT "+variantColumns+" FROM product_variants v JOIN products p ON p.id = v.product_id WHERE v.sku = $1", sku), &variant)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+
+	variant.Attributes, err = s.getAttributes(ctx, variant.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// GetProductPage собирает карточку товара: сам товар, его варианты и значения
+// атрибутов, из которых покупатель выбирает нужный вариант
+func (s *ProductVariantServiceImpl) GetProductPage(ctx context.Context, productID int64) (*ProductPage, error) {
+	product, err := s.productService.GetProductByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := s.GetVariantsByProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ProductPage{
+		Product:  *product,
+		Variants: variants,
+		Options:  map[string][]string{},
+	}
+	if page.Variants == nil {
+		page.Variants = []ProductVariant{}
+	}
+
+	seen := map[string]map[string]bool{}
+	for _, variant := range variants {
+		if variant.Stock > 0 {
+			page.InStock = true
+		}
+		for name, value := range variant.Attributes {
+			if seen[name] == nil {
+				seen[name] = map[string]bool{}
+			}
+			if !seen[name][value] {
+				seen[name][value] = true
+				page.Options[name] = append(page.Options[name], value)
+			}
+		}
+	}
+	for name := range page.Options {
+		sort.Strings(page.Options[name])
+	}
+
+	return page, nil
+}
+
+func (s *ProductVariantServiceImpl) CreateVariant(ctx context.Context, variant ProductVariant) (*ProductVariant, error) {
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		// Вариант нельзя завести у удалённого товара
+		err := tx.QueryRowContext(ctx, "SELECT COALESCE($1, price) FROM products WHERE id = $2 AND deleted_at IS NULL", variant.PriceOverride, variant.ProductID).Scan(&variant.Price)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrProductNotFound
+			}
+			return err
+		}
+
+		// Начальный остаток заводится приходом по журналу
+		err = tx.QueryRowContext(ctx, "INSERT INTO product_variants (product_id, sku, price_override, stock) VALUES ($1, $2, $3, 0) RETURNING id, created_at, updated_at",
+			variant.ProductID, variant.SKU, variant.PriceOverride).Scan(&variant.ID, &variant.CreatedAt, &variant.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = applyCatalogStockMovement(ctx, tx, StockMovement{ProductID: variant.ProductID, VariantID: variant.ID, Kind: MovementReceipt, Quantity: variant.Stock})
+		if err != nil {
+			return err
+		}
+
+		return replaceAttributes(ctx, tx, variant.ID, variant.Attributes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (s *ProductVariantServiceImpl) UpdateVariant(ctx context.Context, variant ProductVariant) error {
+	var old *lockedVariant
+	var newPrice float64
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var err error
+		old, err = lockVariant(ctx, tx, variant.ID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, "UPDATE product_variants SET sku = $1, price_override = $2, updated_at = NOW() WHERE id = $3 RETURNING product_id",
+			variant.SKU, variant.PriceOverride, variant.ID).Scan(&variant.ProductID)
+		if err != nil {
+			return err
+		}
+
+		if err := replaceAttributes(ctx, tx, variant.ID, variant.Attributes); err != nil {
+			return err
+		}
+
+		newPrice = old.basePrice
+		if variant.PriceOverride != nil {
+			newPrice = *variant.PriceOverride
+		}
+		if newPrice != old.price {
+			err := publishPriceChanged(ctx, tx, PriceChanged{ProductID: variant.ProductID, VariantID: variant.ID, OldPrice: old.price, NewPrice: newPrice})
+			if err != nil {
+				return err
+			}
+		}
+		return applyCatalogStockMovement(ctx, tx, StockMovement{ProductID: variant.ProductID, VariantID: variant.ID, Kind: MovementAdjustment, Quantity: variant.Stock - old.stock})
+	})
+	if err != nil {
+		return err
+	}
+
+	if newPrice != old.price {
+		s.emitPriceChanged(ctx, PriceChanged{ProductID: variant.ProductID, VariantID: variant.ID, OldPrice: old.price, NewPrice: newPrice})
+	}
+	if variant.Stock > old.stock {
+		s.emitStockIncreased(ctx, StockIncreased{ProductID: variant.ProductID, VariantID: variant.ID, Quantity: variant.Stock - old.stock})
+	}
+	return nil
+}
+
+func (s *ProductVariantServiceImpl) SetVariantStock(ctx context.Context, id int64, stock int) error {
+	if stock < 0 {
+		return errors.New("остаток не может быть отрицательным")
+	}
+
+	var old *lockedVariant
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var err error
+		old, err = lockVariant(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		// Новый остаток не перезаписывается, а доводится движением по журналу на разницу
+		return applyCatalogStockMovement(ctx, tx, StockMovement{ProductID: old.productID, VariantID: id, Kind: MovementAdjustment, Quantity: stock - old.stock})
+	})
+	if err != nil {
+		return err
+	}
+
+	if stock > old.stock {
+		s.emitStockIncreased(ctx, StockIncreased{ProductID: old.productID, VariantID: id, Quantity: stock - old.stock})
+	}
+	return nil
+}
+
+// lockedVariant - состояние варианта до изменения, нужное для событий об остатке и цене
+type lockedVariant struct {
+	productID int64
+	stock     int
+	price     float64 // Итоговая цена варианта
+	basePrice float64 // Цена товара
+}
+
+// lockVariant блокирует вариант до конца транзакции. Варианты удалённых товаров не меняются:
+// для них возвращается ErrVariantNotFound.
+func lockVariant(ctx context.Context, tx db.Querier, id int64) (*lockedVariant, error) {
+	var v lockedVariant
+	err := tx.QueryRowContext(ctx, "SELECT v.product_id, v.stock, COALESCE(v.price_override, p.price), p.price FROM product_variants v JOIN products p ON p.id = v.product_id WHERE v.id = $1 AND p.deleted_at IS NULL FOR UPDATE OF v", id).
+		Scan(&v.productID, &v.stock, &v.price, &v.basePrice)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *ProductVariantServiceImpl) DeleteVariant(ctx context.Context, id int64) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM product_variant_attributes WHERE variant_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM product_variants WHERE id = $1", id); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *ProductVariantServiceImpl) getAttributes(ctx context.Context, variantID int64) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, value FROM product_variant_attributes WHERE variant_id = $1", variantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := map[string]string{}
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		attributes[name] = value
+	}
+
+	return attributes, rows.Err()
+}
+
+func scanVariant(row interface{ Scan(...any) error }, variant *ProductVariant) error {
+	var priceOverride sql.NullFloat64
+	err := row.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &priceOverride, &variant.Price, &variant.Stock, &variant.CreatedAt, &variant.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if priceOverride.Valid {
+		variant.PriceOverride = &priceOverride.Float64
+	}
+	return nil
+}
+
+func replaceAttributes(ctx context.Context, tx db.Querier, variantID int64, attributes map[string]string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM product_variant_attributes WHERE variant_id = $1", variantID); err != nil {
+		return err
+	}
+	for name, value := range attributes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO product_variant_attributes (variant_id, name, value) VALUES ($1, $2, $3)", variantID, name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,95 +1,241 @@
-package services //заменить s.db на фактическое подключение к бд, но это в конце после маина
+package services
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"log/slog"
 	"time"
 
-	"database/sql"
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Purchase struct {
-	ID         string    `json:"id"`
-	CustomerID string    `json:"customerId"`
-	StoreID    string    `json:"storeId"`
-	ProductID  string    `json:"productId"`
-	Quantity   int       `json:"quantity"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
-}
+// Статусы покупки
+const (
+	PurchaseStatusAwaitingPayment   = "awaiting_payment"
+	PurchaseStatusPaid              = "paid"
+	PurchaseStatusPaymentFailed     = "payment_failed"
+	PurchaseStatusAwaitingPickup    = "awaiting_pickup"
+	PurchaseStatusCompleted         = "completed"
+	PurchaseStatusCancelled         = "cancelled"
+	PurchaseStatusPartiallyRefunded = "partially_refunded"
+	PurchaseStatusRefunded          = "refunded"
+)
+
+type (
+	Purchase     = repository.Purchase
+	PurchaseItem = repository.PurchaseItem
+)
+
+var (
+	ErrPurchaseNotFound = errors.New("покупка не найдена")
+	ErrPurchaseEmpty    = errors.New("в покупке нет позиций")
+)
+
+// checkoutStatsWindow - за какой период считается доля брошенных покупок
+const checkoutStatsWindow = 24 * time.Hour
 
 type PurchaseService interface {
-	GetAllPurchases() ([]Purchase, error)
-	GetPurchaseByID(id string) (*Purchase, error)
-	CreatePurchase(purchase Purchase) (*Purchase, error)
-	UpdatePurchase(purchase Purchase) error
-	DeletePurchase(id string) error
+	GetAllPurchases(ctx context.Context) ([]Purchase, error)
+	GetPurchaseByID(ctx context.Context, id int64) (*Purchase, error)
+	CreatePurchase(ctx context.Context, purchase Purchase) (*Purchase, error)
+	UpdatePurchase(ctx context.Context, purchase Purchase) error
+	DeletePurchase(ctx context.Context, id int64) error
+	HandleEvent(ctx context.Context, tx db.Querier, event DomainEvent) error
+	RefreshMetrics(ctx context.Context) error
+	RunMetricsWorker(ctx context.Context, interval time.Duration)
 }
 
 type PurchaseServiceImpl struct {
-	db *sql.DB // Ссылка на объект базы данных
+	uow          db.UnitOfWork
+	purchases    repository.PurchaseRepository
+	products     repository.ProductRepository
+	metrics      *ShopMetrics
+	abandonAfter time.Duration // Неоплаченная дольше этого покупка считается брошенной
 }
 
-func NewPurchaseService(db *sql.DB) *PurchaseServiceImpl {
+func NewPurchaseService(uow db.UnitOfWork, purchases repository.PurchaseRepository, products repository.ProductRepository, metrics *ShopMetrics, abandonAfter time.Duration) *PurchaseServiceImpl {
 	return &PurchaseServiceImpl{
-		db: db,
+		uow:          uow,
+		purchases:    purchases,
+		products:     products,
+		metrics:      metrics,
+		abandonAfter: abandonAfter,
 	}
 }
 
-func (s *PurchaseServiceImpl) GetAllPurchases() ([]Purchase, error) {
-	rows, err := s.db.QueryContext(context.Background(), "SELECT * FROM purchases")
-	if err != nil {
-		return nil, err
+// purchaseError заменяет repository.ErrNotFound на ErrPurchaseNotFound
+func purchaseError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrPurchaseNotFound
+	}
+	return err
+}
+
+func (s *PurchaseServiceImpl) GetAllPurchases(ctx context.Context) ([]Purchase, error) {
+	return s.purchases.List(ctx)
+}
+
+func (s *PurchaseServiceImpl) GetPurchaseByID(ctx context.Context, id int64) (*Purchase, error) {
+	purchase, err := s.purchases.GetByID(ctx, id)
+	return purchase, purchaseError(err)
+}
+
+// CreatePurchase оформляет покупку в статусе ожидания оплаты. Цены позиций берутся
+// из каталога в той же транзакции, что и запись покупки и публикация PurchaseCreated.
+func (s *PurchaseServiceImpl) CreatePurchase(ctx context.Context, purchase Purchase) (*Purchase, error) {
+	if len(purchase.Items) == 0 {
+		return nil, ErrPurchaseEmpty
 	}
-	defer rows.Close()
+	purchase.Status = PurchaseStatusAwaitingPayment
+
+	err := s.uow.WithTx(ctx, func(tx db.Querier) error {
+		products := s.products.WithTx(tx)
+		for i := range purchase.Items {
+			item := &purchase.Items[i]
+			price, err := products.GetPrice(ctx, item.ProductID, item.VariantID)
+			if err != nil {
+				return err
+			}
+			item.Price = price
+		}
 
-	var purchases []Purchase
-	for rows.Next() {
-		var purchase Purchase
-		if err := rows.Scan(&purchase.ID, &purchase.CustomerID, &purchase.StoreID, &purchase.ProductID, &purchase.Quantity, &purchase.CreatedAt, &purchase.UpdatedAt); err != nil {
-			return nil, err
+		if err := s.purchases.WithTx(tx).Create(ctx, &purchase); err != nil {
+			return err
 		}
-		purchases = append(purchases, purchase)
+		return publishEvent(ctx, tx, EventPurchaseCreated, AggregatePurchase, purchase.ID, PurchaseCreatedPayload{
+			PurchaseID: EventID(purchase.ID),
+			CustomerID: EventID(purchase.CustomerID),
+			Status:     purchase.Status,
+		})
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrProductNotFound
 	}
+	if err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+func (s *PurchaseServiceImpl) UpdatePurchase(ctx context.Context, purchase Purchase) error {
+	return purchaseError(s.purchases.Update(ctx, purchase))
+}
 
-	return purchases, nil
+func (s *PurchaseServiceImpl) DeletePurchase(ctx context.Context, id int64) error {
+	err := s.uow.WithTx(ctx, func(tx db.Querier) error {
+		return s.purchases.WithTx(tx).Delete(ctx, id)
+	})
+	return purchaseError(err)
 }
 
-func (s *PurchaseServiceImpl) GetPurchaseByID(id string) (*Purchase, error) {
-	var purchase Purchase
-	err := s.db.QueryRowContext(context.Background(), "SELECT * FROM purchases WHERE id = $1", id).Scan(&purchase.ID, &purchase.CustomerID, &purchase.StoreID, &purchase.ProductID, &purchase.Quantity, &purchase.CreatedAt, &purchase.UpdatedAt)
+// setPurchaseStatus меняет статус покупки в транзакции и публикует PurchaseStatusChanged,
+// если статус действительно изменился
+func setPurchaseStatus(ctx context.Context, tx db.Querier, purchaseID int64, status string, now time.Time) error {
+	var oldStatus string
+	var customerID int64
+	err := tx.QueryRowContext(ctx, "SELECT status, COALESCE(customer_id, 0) FROM purchases WHERE id = $1 FOR UPDATE", purchaseID).Scan(&oldStatus, &customerID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("покупка не найдена")
+			return ErrPurchaseNotFound
 		}
-		return nil, err
+		return err
 	}
-	return &purchase, nil
+
+	if _, err := tx.ExecContext(ctx, "UPDATE purchases SET status = $1, updated_at = $2 WHERE id = $3", status, now, purchaseID); err != nil {
+		return err
+	}
+	if oldStatus == status {
+		return nil
+	}
+	return publishEvent(ctx, tx, EventPurchaseStatusChanged, AggregatePurchase, purchaseID, PurchaseStatusChangedPayload{
+		PurchaseID: EventID(purchaseID),
+		CustomerID: EventID(customerID),
+		OldStatus:  oldStatus,
+		NewStatus:  status,
+	})
 }
 
-func (s *PurchaseServiceImpl) CreatePurchase(purchase Purchase) (*Purchase, error) {
-	ctx := context.Background()
-	result, err := s.db.ExecContext(ctx, "INSERT INTO purchases (customerId, storeId, productId, quantity) VALUES ($1, $2, $3, $4)", purchase.CustomerID, purchase.StoreID, purchase.ProductID, purchase.Quantity)
-	if err != nil {
-		return nil, err
+// PurchaseMetricsEventTypes - доменные события, по которым считаются заказы и выручка
+var PurchaseMetricsEventTypes = []string{EventPurchaseCreated, EventPurchaseStatusChanged}
+
+// HandleEvent обновляет счётчики заказов и выручки. Счётчики не откатываются вместе с
+// транзакцией доставки, поэтому меняются через afterCommit - только после её фиксации.
+func (s *PurchaseServiceImpl) HandleEvent(ctx context.Context, tx db.Querier, event DomainEvent) error {
+	switch event.Type {
+	case EventPurchaseCreated:
+		var payload PurchaseCreatedPayload
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		afterCommit(ctx, func() { s.metrics.ordersCreated.Inc(payload.Status) })
+	case EventPurchaseStatusChanged:
+		var payload PurchaseStatusChangedPayload
+		if err := event.Decode(&payload); err != nil {
+			return err
+		}
+		// Самовывоз оплачивается при выдаче заказа
+		paid := payload.NewStatus == PurchaseStatusPaid ||
+			payload.OldStatus == PurchaseStatusAwaitingPickup && payload.NewStatus == PurchaseStatusCompleted
+		if !paid {
+			return nil
+		}
+		purchase, err := s.purchases.WithTx(tx).GetByID(ctx, int64(payload.PurchaseID))
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		total := purchaseTotal(purchase)
+		afterCommit(ctx, func() { s.metrics.revenue.Add(total) })
 	}
+	return nil
+}
 
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
+// purchaseTotal - сумма позиций с доставкой за вычетом скидки
+func purchaseTotal(purchase *Purchase) float64 {
+	total := purchase.ShippingPrice - purchase.DiscountAmount
+	for _, item := range purchase.Items {
+		total += float64(item.Quantity) * item.Price
 	}
-	purchase.ID = lastInsertID
-	return &purchase, nil
+	return total
 }
 
-func (s *PurchaseServiceImpl) UpdatePurchase(purchase Purchase) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "UPDATE purchases SET customerId = $1, storeId = $2, productId = $3, quantity = $4 WHERE id = $5", purchase.CustomerID, purchase.StoreID, purchase.ProductID, purchase.Quantity, purchase.ID)
-	return err
+// RefreshMetrics пересчитывает брошенные покупки: оформленные за checkoutStatsWindow до
+// порога abandonAfter и так и не оплаченные
+func (s *PurchaseServiceImpl) RefreshMetrics(ctx context.Context) error {
+	to := time.Now().Add(-s.abandonAfter)
+	started, abandoned, err := s.purchases.CheckoutStats(ctx, to.Add(-checkoutStatsWindow), to,
+		[]string{PurchaseStatusAwaitingPayment, PurchaseStatusPaymentFailed})
+	if err != nil {
+		return err
+	}
+
+	ratio := 0.0
+	if started > 0 {
+		ratio = float64(abandoned) / float64(started)
+	}
+	s.metrics.checkoutsAbandoned.Set(float64(abandoned))
+	s.metrics.abandonmentRatio.Set(ratio)
+	return nil
 }
 
-func (s *PurchaseServiceImpl) DeletePurchase(id string) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "DELETE FROM purchases WHERE id = $1", id)
-	return err
+// RunMetricsWorker пересчитывает показатели покупок при запуске и затем с интервалом
+// interval. Работает до отмены ctx.
+func (s *PurchaseServiceImpl) RunMetricsWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RefreshMetrics(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "ошибка пересчёта показателей покупок", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
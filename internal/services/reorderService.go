@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/notify"
+)
+
+var ErrReorderLevelNotFound = errors.New("уровень дозаказа не найден")
+
+// ReorderLevel - точка дозаказа товара. Без StoreID действует во всех магазинах,
+// уровень конкретного магазина имеет приоритет.
+type ReorderLevel struct {
+	ID          int64     `json:"id"`
+	ProductID   int64     `json:"productId" validate:"required"`
+	StoreID     int64     `json:"storeId,omitempty"`
+	MinQuantity int       `json:"minQuantity" validate:"min=0"`        // Сигнал, когда свободный остаток опустится до этого значения
+	CoverDays   int       `json:"coverDays" validate:"required,min=1"` // На сколько дней продаж рассчитывать дозаказ
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ReorderSuggestion struct {
+	StoreID           int64    `json:"storeId"`
+	ProductID         int64    `json:"productId"`
+	ProductName       string   `json:"productName"`
+	Available         int      `json:"available"` // Остаток за вычетом резерва
+	OnOrder           int      `json:"onOrder"`   // Ещё не принято по открытым заказам поставщикам
+	MinQuantity       int      `json:"minQuantity"`
+	DailySales        float64  `json:"dailySales"`
+	SuggestedQuantity int      `json:"suggestedQuantity"`
+	LastSupplierID    int64    `json:"lastSupplierId,omitempty"`
+	LastUnitCost      *float64 `json:"lastUnitCost,omitempty"`
+}
+
+type ReorderService interface {
+	GetReorderLevels(ctx context.Context, productID, storeID int64) ([]ReorderLevel, error)
+	SetReorderLevel(ctx context.Context, level ReorderLevel) (*ReorderLevel, error)
+	DeleteReorderLevel(ctx context.Context, id int64) error
+	GetReorderSuggestions(ctx context.Context, storeID int64) ([]ReorderSuggestion, error)
+	CheckLowStock(ctx context.Context) (int, error)
+	RunLowStockWorker(ctx context.Context, interval time.Duration)
+}
+
+type ReorderServiceImpl struct {
+	db             db.Conn // Ссылка на объект базы данных
+	alertRecipient string  // Кому отправлять сигналы о низком остатке
+	velocityDays   int     // За сколько последних дней считать скорость продаж
+	metrics        *ShopMetrics
+}
+
+func NewReorderService(db db.Conn, alertRecipient string, velocityDays int, metrics *ShopMetrics) *ReorderServiceImpl {
+	return &ReorderServiceImpl{
+		db:             db,
+		alertRecipient: alertRecipient,
+		velocityDays:   velocityDays,
+		metrics:        metrics,
+	}
+}
+
+func (s *ReorderServiceImpl) GetReorderLevels(ctx context.Context, productID, storeID int64) ([]ReorderLevel, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, product_id, COALESCE(store_id, 0), min_quantity, cover_days, updated_at FROM reorder_levels
+		WHERE ($1 = 0 OR product_id = $1) AND ($2 = 0 OR store_id = $2)
+		ORDER BY product_id, store_id NULLS FIRST`, productID, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := []ReorderLevel{}
+	for rows.Next() {
+		var level ReorderLevel
+		if err := rows.Scan(&level.ID, &level.ProductID, &level.StoreID, &level.MinQuantity, &level.CoverDays, &level.UpdatedAt); err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, rows.Err()
+}
+
+// SetReorderLevel создаёт или заменяет уровень дозаказа товара (в магазине или общий)
+func (s *ReorderServiceImpl) SetReorderLevel(ctx context.Context, level ReorderLevel) (*ReorderLevel, error) {
+	// NULL не участвует в уникальном ключе, поэтому для общего уровня отдельный частичный индекс
+	conflict := "(product_id, store_id)"
+	if level.StoreID == 0 {
+		conflict = "(product_id) WHERE store_id IS NULL"
+	}
+	query := `INSERT INTO reorder_levels (product_id, store_id, min_quantity, cover_days) VALUES ($1, NULLIF($2, 0), $3, $4)
+		ON CONFLICT ` + conflict + ` DO UPDATE SET min_quantity = EXCLUDED.min_quantity, cover_days = EXCLUDED.cover_days, updated_at = NOW()
+		RETURNING id, updated_at`
+
+	err := s.db.QueryRowContext(ctx, query, level.ProductID, level.StoreID, level.MinQuantity, level.CoverDays).Scan(&level.ID, &level.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &level, nil
+}
+
+func (s *ReorderServiceImpl) DeleteReorderLevel(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM reorder_levels WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrReorderLevelNotFound
+	}
+	return nil
+}
+
+// GetReorderSuggestions возвращает товары, свободный остаток которых опустился до точки дозаказа,
+// с рекомендуемым количеством. Скорость продаж считается по purchase_items за velocityDays:
+// заказы на самовывоз относятся к своему магазину, остальные делятся поровну между магазинами,
+// где для товара задан уровень дозаказа.
+func (s *ReorderServiceImpl) GetReorderSuggestions(ctx context.Context, storeID int64) ([]ReorderSuggestion, error) {
+	rows, err := s.db.QueryContext(ctx, `WITH levels AS (
+			SELECT st.id AS store_id, rl.product_id, rl.min_quantity, rl.cover_days
+			FROM reorder_levels rl
+			JOIN stores st ON (rl.store_id IS NULL OR st.id = rl.store_id) AND st.deleted_at IS NULL
+			WHERE rl.store_id IS NOT NULL
+				OR NOT EXISTS (SELECT 1 FROM reorder_levels o WHERE o.store_id = st.id AND o.product_id = rl.product_id)
+		),
+		sales AS (
+			SELECT pi.product_id, po.store_id, SUM(pi.quantity) AS quantity
+			FROM purchase_items pi
+			JOIN purchases p ON p.id = pi.purchase_id
+			LEFT JOIN pickup_orders po ON po.purchase_id = p.id
+			WHERE p.created_at >= NOW() - make_interval(days => $1) AND p.status NOT IN ($2, $3)
+			GROUP BY pi.product_id, po.store_id
+		),
+		demand AS (
+			SELECT l.*,
+				COALESCE((SELECT quantity FROM sales WHERE sales.product_id = l.product_id AND sales.store_id = l.store_id), 0)
+				+ COALESCE((SELECT quantity FROM sales WHERE sales.product_id = l.product_id AND sales.store_id IS NULL), 0)::float
+					/ COUNT(*) OVER (PARTITION BY l.product_id) AS sold
+			FROM levels l
+		)
+		SELECT d.store_id, d.product_id, pr.name, COALESCE(si.quantity - si.reserved, 0), d.min_quantity, d.cover_days, d.sold,
+			COALESCE((SELECT SUM(soi.quantity - soi.received_quantity) FROM supplier_order_items soi JOIN supplier_orders so ON so.id = soi.order_id
+				WHERE so.store_id = d.store_id AND soi.product_id = d.product_id AND so.status IN ($4, $5) AND soi.received_quantity < soi.quantity), 0),
+			COALESCE(last.supplier_id, 0), last.unit_cost
+		FROM demand d
+		JOIN products pr ON pr.id = d.product_id AND pr.deleted_at IS NULL
+		LEFT JOIN store_inventory si ON si.store_id = d.store_id AND si.product_id = d.product_id
+		LEFT JOIN LATERAL (
+			SELECT so.supplier_id, soi.unit_cost FROM supplier_order_items soi JOIN supplier_orders so ON so.id = soi.order_id
+			WHERE soi.product_id = d.product_id AND so.status <> $6 ORDER BY so.created_at DESC LIMIT 1
+		) last ON TRUE
+		WHERE COALESCE(si.quantity - si.reserved, 0) <= d.min_quantity AND ($7 = 0 OR d.store_id = $7)
+		ORDER BY d.store_id, pr.name`,
+		s.velocityDays, PurchaseStatusCancelled, PurchaseStatusPaymentFailed,
+		SupplierOrderOrdered, SupplierOrderPartiallyReceived, SupplierOrderCancelled, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []ReorderSuggestion{}
+	for rows.Next() {
+		var sg ReorderSuggestion
+		var coverDays int
+		var sold float64
+		if err := rows.Scan(&sg.StoreID, &sg.ProductID, &sg.ProductName, &sg.Available, &sg.MinQuantity, &coverDays, &sold, &sg.OnOrder, &sg.LastSupplierID, &sg.LastUnitCost); err != nil {
+			return nil, err
+		}
+		sg.DailySales = math.Round(sold/float64(s.velocityDays)*100) / 100
+		sg.SuggestedQuantity = suggestedQuantity(sg, coverDays, sold/float64(s.velocityDays))
+		suggestions = append(suggestions, sg)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// suggestedQuantity - сколько заказать, чтобы после поставки остаток покрыл точку дозаказа
+// и продажи на coverDays дней вперёд (не меньше одной единицы сверх точки дозаказа)
+func suggestedQuantity(sg ReorderSuggestion, coverDays int, dailySales float64) int {
+	cover := int(math.Ceil(dailySales * float64(coverDays)))
+	if cover < 1 {
+		cover = 1
+	}
+	suggested := sg.MinQuantity + cover - sg.Available - sg.OnOrder
+	if suggested < 0 {
+		return 0
+	}
+	return suggested
+}
+
+// lowStockKey - товар в магазине, по которому есть сигнал о низком остатке
+type lowStockKey struct {
+	storeID   int64
+	productID int64
+}
+
+// CheckLowStock отправляет сигнал о товарах, впервые опустившихся до точки дозаказа,
+// и закрывает сигналы по товарам, остаток которых восстановился. Повторно о том же
+// товаре сигнал приходит только после восстановления остатка. Возвращает число новых сигналов
+// и обновляет показатель vapeshop_low_stock_items.
+func (s *ReorderServiceImpl) CheckLowStock(ctx context.Context) (int, error) {
+	suggestions, err := s.GetReorderSuggestions(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var fresh []ReorderSuggestion
+	low := map[lowStockKey]bool{}
+	err = s.db.WithTx(ctx, func(tx db.Querier) error {
+		open := map[lowStockKey]bool{}
+		rows, err := tx.QueryContext(ctx, "SELECT store_id, product_id FROM low_stock_alerts WHERE resolved_at IS NULL FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var key lowStockKey
+			if err := rows.Scan(&key.storeID, &key.productID); err != nil {
+				rows.Close()
+				return err
+			}
+			open[key] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, sg := range suggestions {
+			key := lowStockKey{sg.StoreID, sg.ProductID}
+			low[key] = true
+			if open[key] {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO low_stock_alerts (store_id, product_id, available, suggested_quantity) VALUES ($1, $2, $3, $4)",
+				sg.StoreID, sg.ProductID, sg.Available, sg.SuggestedQuantity)
+			if err != nil {
+				return err
+			}
+			fresh = append(fresh, sg)
+		}
+
+		for key := range open {
+			if low[key] {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE low_stock_alerts SET resolved_at = NOW() WHERE store_id = $1 AND product_id = $2 AND resolved_at IS NULL", key.storeID, key.productID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Уведомление ставится в очередь в той же транзакции, что и сигналы, поэтому не потеряется
+		if len(fresh) == 0 {
+			return nil
+		}
+		return enqueueAddressNotification(ctx, tx, notify.ChannelEmail, s.alertRecipient, notify.DefaultLang, notify.TemplateLowStock, lowStockData(fresh))
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.metrics.lowStockItems.Set(float64(len(low)))
+	return len(fresh), nil
+}
+
+func lowStockData(suggestions []ReorderSuggestion) notify.LowStockData {
+	data := notify.LowStockData{Items: make([]notify.LowStockItem, 0, len(suggestions))}
+	for _, sg := range suggestions {
+		data.Items = append(data.Items, notify.LowStockItem{
+			StoreID:           sg.StoreID,
+			ProductID:         sg.ProductID,
+			ProductName:       sg.ProductName,
+			Available:         sg.Available,
+			MinQuantity:       sg.MinQuantity,
+			SuggestedQuantity: sg.SuggestedQuantity,
+		})
+	}
+	return data
+}
+
+// RunLowStockWorker периодически вызывает CheckLowStock, пока не отменён ctx
+func (s *ReorderServiceImpl) RunLowStockWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.CheckLowStock(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "ошибка проверки низких остатков", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "новые сигналы о низком остатке", "count", n)
+			}
+		}
+	}
+}
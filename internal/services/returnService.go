@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Статусы заявки на возврат
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRefunding = "refunding" // Возврат денег начат; ProcessRefund можно повторить
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusRefunded  = "refunded"
+)
+
+// Что делать с возвращённым товаром
+const (
+	ReturnDispositionRestock  = "restock"
+	ReturnDispositionWriteOff = "write_off" // вскрытые жидкости обратно в продажу не идут
+)
+
+// productTypeLiquid - значение products.vape_type у жидкостей
+const productTypeLiquid = "liquid"
+
+var (
+	ErrReturnNotFound      = errors.New("заявка на возврат не найдена")
+	ErrReturnInvalidState  = errors.New("операция недоступна в текущем статусе заявки")
+	ErrReturnQuantity      = errors.New("количество к возврату превышает купленное")
+	ErrNoRefundablePayment = errors.New("у покупки нет оплаты, по которой можно сделать возврат")
+)
+
+type ReturnItem struct {
+	ID             int64   `json:"id"`
+	PurchaseItemID int64   `json:"purchaseItemId" validate:"required"`
+	ProductID      int64   `json:"productId"`
+	Quantity       int     `json:"quantity" validate:"required,min=1"`
+	Price          float64 `json:"price"`
+	Reason         string  `json:"reason" validate:"required"`
+	Opened         bool    `json:"opened"`
+	Disposition    string  `json:"disposition"`
+}
+
+type ReturnRequest struct {
+	ID              int64        `json:"id"`
+	PurchaseID      int64        `json:"purchaseId" validate:"required"`
+	StoreID         int64        `json:"storeId,omitempty"`
+	Status          string       `json:"status"`
+	Items           []ReturnItem `json:"items" validate:"required,min=1,dive"`
+	RefundAmount    float64      `json:"refundAmount"`
+	PaymentRefundID int64        `json:"paymentRefundId,omitempty"`
+	DecidedBy       string       `json:"decidedBy,omitempty"`
+	DecisionNote    string       `json:"decisionNote,omitempty"`
+	CreatedAt       time.Time    `json:"createdAt"`
+	UpdatedAt       time.Time    `json:"updatedAt"`
+}
+
+// ReturnDecision - решение сотрудника по заявке
+type ReturnDecision struct {
+	ReturnID  int64  `json:"returnId" validate:"required"`
+	StoreID   int64  `json:"storeId"` // Магазин, куда физически вернули товар (нужен при одобрении)
+	StaffName string `json:"staffName" validate:"required"`
+	Note      string `json:"note"`
+}
+
+type PurchaseHistoryEntry struct {
+	ID         int64     `json:"id"`
+	PurchaseID int64     `json:"purchaseId"`
+	Event      string    `json:"event"`
+	Details    string    `json:"details"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ReturnService interface {
+	CreateReturn(ctx context.Context, req ReturnRequest) (*ReturnRequest, error)
+	GetReturnByID(ctx context.Context, id int64) (*ReturnRequest, error)
+	GetReturnsByPurchase(ctx context.Context, purchaseID int64) ([]ReturnRequest, error)
+	ApproveReturn(ctx context.Context, decision ReturnDecision) (*ReturnRequest, error)
+	RejectReturn(ctx context.Context, decision ReturnDecision) (*ReturnRequest, error)
+	ProcessRefund(ctx context.Context, id int64) (*ReturnRequest, error)
+	GetPurchaseHistory(ctx context.Context, purchaseID int64) ([]PurchaseHistoryEntry, error)
+}
+
+type ReturnServiceImpl struct {
+	catalogEmitter
+	db             db.Conn // Ссылка на объект базы данных
+	paymentService PaymentService
+}
+
+func NewReturnService(db db.Conn, paymentService PaymentService) *ReturnServiceImpl {
+	return &ReturnServiceImpl{
+		db:             db,
+		paymentService: paymentService,
+	}
+}
+
+// CreateReturn регистрирует заявку покупателя. Количество по каждой позиции проверяется
+// с учётом уже поданных и не отклонённых заявок.
+func (s *ReturnServiceImpl) CreateReturn(ctx context.Context, req ReturnRequest) (*ReturnRequest, error) {
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		for i, item := range req.Items {
+			var purchased, alreadyReturned int
+			var liquid bool
+			err := tx.QueryRowContext(ctx, `SELECT pi.product_id, pi.quantity, pi.price, COALESCE(p.vape_type, '') = $3
+				FROM purchase_items pi JOIN products p ON p.id = pi.product_id
+				WHERE pi.id = $1 AND pi.purchase_id = $2 FOR UPDATE OF pi`, item.PurchaseItemID, req.PurchaseID, productTypeLiquid).
+				Scan(&req.Items[i].ProductID, &purchased, &req.Items[i].Price, &liquid)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return errors.New("позиция покупки не найдена")
+				}
+				return err
+			}
+
+			err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(ri.quantity), 0) FROM return_request_items ri JOIN return_requests r ON r.id = ri.return_request_id WHERE ri.purchase_item_id = $1 AND r.status <> $2", item.PurchaseItemID, ReturnStatusRejected).Scan(&alreadyReturned)
+			if err != nil {
+				return err
+			}
+			if item.Quantity > purchased-alreadyReturned {
+				return ErrReturnQuantity
+			}
+
+			req.Items[i].Disposition = returnDisposition(item.Opened, liquid)
+		}
+
+		req.Status = ReturnStatusRequested
+		err := tx.QueryRowContext(ctx, "INSERT INTO return_requests (purchase_id, status) VALUES ($1, $2) RETURNING id, created_at, updated_at", req.PurchaseID, req.Status).Scan(&req.ID, &req.CreatedAt, &req.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		for i, item := range req.Items {
+			err := tx.QueryRowContext(ctx, "INSERT INTO return_request_items (return_request_id, purchase_item_id, product_id, quantity, price, reason, opened, disposition) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+				req.ID, item.PurchaseItemID, item.ProductID, item.Quantity, item.Price, item.Reason, item.Opened, item.Disposition).Scan(&req.Items[i].ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return addPurchaseHistory(ctx, tx, req.PurchaseID, "return_requested", fmt.Sprintf("заявка на возврат #%d, позиций: %d", req.ID, len(req.Items)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (s *ReturnServiceImpl) GetReturnByID(ctx context.Context, id int64) (*ReturnRequest, error) {
+	return getReturn(ctx, s.db, id, false)
+}
+
+func (s *ReturnServiceImpl) GetReturnsByPurchase(ctx context.Context, purchaseID int64) ([]ReturnRequest, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM return_requests WHERE purchase_id = $1 ORDER BY created_at", purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var list []ReturnRequest
+	for _, id := range ids {
+		req, err := getReturn(ctx, s.db, id, false)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *req)
+	}
+	return list, nil
+}
+
+// ApproveReturn одобряет заявку: товар возвращается на остаток магазина или списывается,
+// считается сумма к возврату, после чего деньги возвращаются через платёжный сервис.
+func (s *ReturnServiceImpl) ApproveReturn(ctx context.Context, decision ReturnDecision) (*ReturnRequest, error) {
+	if decision.StoreID == 0 {
+		return nil, errors.New("не указан магазин, принявший возврат")
+	}
+
+	var req *ReturnRequest
+	var restocked []StockIncreased
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var err error
+		req, err = getReturn(ctx, tx, decision.ReturnID, true)
+		if err != nil {
+			return err
+		}
+		if req.Status != ReturnStatusRequested {
+			return ErrReturnInvalidState
+		}
+
+		for _, item := range req.Items {
+			if item.Disposition != ReturnDispositionRestock {
+				continue
+			}
+			err := applyStockMovement(ctx, tx, StockMovement{
+				StoreID: decision.StoreID, ProductID: item.ProductID, Kind: MovementReturn, Quantity: item.Quantity,
+				ReferenceType: MovementRefReturn, ReferenceID: req.ID, CreatedBy: decision.StaffName,
+			})
+			if err != nil {
+				return err
+			}
+			restocked = append(restocked, StockIncreased{ProductID: item.ProductID, StoreID: decision.StoreID, Quantity: item.Quantity})
+		}
+
+		refundAmount, err := calculateReturnRefund(ctx, tx, req)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		_, err = tx.ExecContext(ctx, "UPDATE return_requests SET status = $1, store_id = $2, refund_amount = $3, decided_by = $4, decision_note = $5, updated_at = $6 WHERE id = $7",
+			ReturnStatusApproved, decision.StoreID, refundAmount, decision.StaffName, decision.Note, now, req.ID)
+		if err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("заявка на возврат #%d одобрена (%s), к возврату %.2f", req.ID, decision.StaffName, refundAmount)
+		return addPurchaseHistory(ctx, tx, req.PurchaseID, "return_approved", details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.emitStockIncreased(ctx, restocked...)
+
+	// Возврат денег вне транзакции: при ошибке провайдера заявка остаётся в статусе
+	// approved или refunding, и возврат можно повторить через ProcessRefund
+	return s.ProcessRefund(ctx, req.ID)
+}
+
+func (s *ReturnServiceImpl) RejectReturn(ctx context.Context, decision ReturnDecision) (*ReturnRequest, error) {
+	var req *ReturnRequest
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var err error
+		req, err = getReturn(ctx, tx, decision.ReturnID, true)
+		if err != nil {
+			return err
+		}
+		if req.Status != ReturnStatusRequested {
+			return ErrReturnInvalidState
+		}
+
+		req.Status = ReturnStatusRejected
+		req.DecidedBy = decision.StaffName
+		req.DecisionNote = decision.Note
+		req.UpdatedAt = time.Now()
+		_, err = tx.ExecContext(ctx, "UPDATE return_requests SET status = $1, decided_by = $2, decision_note = $3, updated_at = $4 WHERE id = $5", req.Status, req.DecidedBy, req.DecisionNote, req.UpdatedAt, req.ID)
+		if err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("заявка на возврат #%d отклонена (%s): %s", req.ID, decision.StaffName, decision.Note)
+		return addPurchaseHistory(ctx, tx, req.PurchaseID, "return_rejected", details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ProcessRefund возвращает деньги по одобренной заявке. Заявка сначала переводится
+// в refunding, поэтому параллельный вызов её не подхватит. Заявку в refunding (вызов
+// прервался после начала возврата) можно обработать повторно: возврат платежа идёт
+// с ключом идемпотентности заявки, и деньги дважды не вернутся.
+func (s *ReturnServiceImpl) ProcessRefund(ctx context.Context, id int64) (*ReturnRequest, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE return_requests SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3", ReturnStatusRefunding, id, ReturnStatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := getReturn(ctx, s.db, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if claimed == 0 && req.Status != ReturnStatusRefunding {
+		return nil, ErrReturnInvalidState
+	}
+
+	var paymentID int64
+	err = s.db.QueryRowContext(ctx, "SELECT id FROM payments WHERE purchase_id = $1 AND status IN ($2, $3) ORDER BY created_at DESC LIMIT 1", req.PurchaseID, PaymentStatusCaptured, PaymentStatusPartiallyRefunded).Scan(&paymentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRefundablePayment
+		}
+		return nil, err
+	}
+
+	refund, err := s.paymentService.RefundPayment(ctx, PaymentRefund{
+		PaymentID:      paymentID,
+		Amount:         req.RefundAmount,
+		Reason:         fmt.Sprintf("возврат по заявке #%d", req.ID),
+		IdempotencyKey: fmt.Sprintf("return-%d", req.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	concurrent := false
+	err = s.db.WithTx(ctx, func(tx db.Querier) error {
+		req.Status = ReturnStatusRefunded
+		req.PaymentRefundID = refund.ID
+		req.UpdatedAt = time.Now()
+		result, err := tx.ExecContext(ctx, "UPDATE return_requests SET status = $1, payment_refund_id = $2, updated_at = $3 WHERE id = $4 AND status = $5", req.Status, req.PaymentRefundID, req.UpdatedAt, req.ID, ReturnStatusRefunding)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			// Параллельный вызов уже завершил возврат по этой заявке
+			concurrent = true
+			return nil
+		}
+
+		details := fmt.Sprintf("по заявке на возврат #%d возвращено %.2f (возврат платежа #%d)", req.ID, refund.Amount, refund.ID)
+		return addPurchaseHistory(ctx, tx, req.PurchaseID, "refund_issued", details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if concurrent {
+		return getReturn(ctx, s.db, id, false)
+	}
+	return req, nil
+}
+
+func (s *ReturnServiceImpl) GetPurchaseHistory(ctx context.Context, purchaseID int64) ([]PurchaseHistoryEntry, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, purchase_id, event, details, created_at FROM purchase_history WHERE purchase_id = $1 ORDER BY created_at, id", purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []PurchaseHistoryEntry
+	for rows.Next() {
+		var entry PurchaseHistoryEntry
+		if err := rows.Scan(&entry.ID, &entry.PurchaseID, &entry.Event, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
+
+// calculateReturnRefund загружает суммы заказа и считает возврат по заявке (см. returnRefundAmount)
+func calculateReturnRefund(ctx context.Context, tx db.Querier, req *ReturnRequest) (float64, error) {
+	var orderTotal, discount, shipping float64
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(pi.quantity * pi.price), 0), p.discount_amount, p.shipping_price FROM purchases p LEFT JOIN purchase_items pi ON pi.purchase_id = p.id WHERE p.id = $1 GROUP BY p.id, p.discount_amount, p.shipping_price", req.PurchaseID).
+		Scan(&orderTotal, &discount, &shipping)
+	if err != nil {
+		return 0, err
+	}
+
+	var purchasedQty, returnedQty int
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(quantity), 0) FROM purchase_items WHERE purchase_id = $1", req.PurchaseID).Scan(&purchasedQty)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(ri.quantity), 0) FROM return_request_items ri JOIN return_requests r ON r.id = ri.return_request_id WHERE r.purchase_id = $1 AND (r.status IN ($2, $3, $4) OR r.id = $5)", req.PurchaseID, ReturnStatusApproved, ReturnStatusRefunding, ReturnStatusRefunded, req.ID).Scan(&returnedQty)
+	if err != nil {
+		return 0, err
+	}
+
+	return returnRefundAmount(req.Items, orderTotal, discount, shipping, returnedQty >= purchasedQty), nil
+}
+
+// returnRefundAmount - сумма к возврату: стоимость возвращаемых позиций минус пропорциональная
+// часть скидки заказа. Доставка возвращается, только если после этой заявки из заказа
+// возвращено всё (allReturned).
+func returnRefundAmount(items []ReturnItem, orderTotal, discount, shipping float64, allReturned bool) float64 {
+	var itemsValue float64
+	for _, item := range items {
+		itemsValue += item.Price * float64(item.Quantity)
+	}
+
+	refund := itemsValue
+	if orderTotal > 0 {
+		refund -= discount * itemsValue / orderTotal
+	}
+	if allReturned {
+		refund += shipping
+	}
+
+	if refund < 0 {
+		refund = 0
+	}
+	return roundMoney(refund)
+}
+
+// returnDisposition решает судьбу возвращённого товара: вскрытая жидкость списывается,
+// остальное возвращается в продажу
+func returnDisposition(opened, liquid bool) string {
+	if opened && liquid {
+		return ReturnDispositionWriteOff
+	}
+	return ReturnDispositionRestock
+}
+
+func getReturn(ctx context.Context, q queryer, id int64, forUpdate bool) (*ReturnRequest, error) {
+	query := "SELECT id, purchase_id, COALESCE(store_id, 0), status, refund_amount, COALESCE(payment_refund_id, 0), COALESCE(decided_by, ''), COALESCE(decision_note, ''), created_at, updated_at FROM return_requests WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var req ReturnRequest
+	err := q.QueryRowContext(ctx, query, id).Scan(&req.ID, &req.PurchaseID, &req.StoreID, &req.Status, &req.RefundAmount, &req.PaymentRefundID, &req.DecidedBy, &req.DecisionNote, &req.CreatedAt, &req.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrReturnNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT id, purchase_item_id, product_id, quantity, price, reason, opened, disposition FROM return_request_items WHERE return_request_id = $1", req.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item ReturnItem
+		if err := rows.Scan(&item.ID, &item.PurchaseItemID, &item.ProductID, &item.Quantity, &item.Price, &item.Reason, &item.Opened, &item.Disposition); err != nil {
+			return nil, err
+		}
+		req.Items = append(req.Items, item)
+	}
+
+	return &req, rows.Err()
+}
+
+// addPurchaseHistory добавляет запись в историю покупки в рамках текущей транзакции
+func addPurchaseHistory(ctx context.Context, tx db.Querier, purchaseID int64, event, details string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO purchase_history (purchase_id, event, details) VALUES ($1, $2, $3)", purchaseID, event, details)
+	return err
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReturnDisposition(t *testing.T) {
+	tests := []struct {
+		name           string
+		opened, liquid bool
+		want           string
+	}{
+		{"вскрытая жидкость", true, true, ReturnDispositionWriteOff},
+		{"невскрытая жидкость", false, true, ReturnDispositionRestock},
+		{"вскрытое устройство", true, false, ReturnDispositionRestock},
+		{"невскрытое устройство", false, false, ReturnDispositionRestock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := returnDisposition(tt.opened, tt.liquid); got != tt.want {
+				t.Errorf("returnDisposition(%v, %v) = %q, want %q", tt.opened, tt.liquid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReturnRefundAmount(t *testing.T) {
+	items := []ReturnItem{{Price: 500, Quantity: 2}, {Price: 250, Quantity: 1}} // 1250
+
+	tests := []struct {
+		name        string
+		items       []ReturnItem
+		orderTotal  float64
+		discount    float64
+		shipping    float64
+		allReturned bool
+		want        float64
+	}{
+		{"без скидки и доставки", items, 2500, 0, 300, false, 1250},
+		{"пропорциональная часть скидки", items, 2500, 500, 300, false, 1000},
+		{"последний возврат с доставкой", items, 1250, 100, 300, true, 1450},
+		{"округление до копеек", []ReturnItem{{Price: 100, Quantity: 1}}, 300, 100, 0, false, 66.67},
+		{"скидка больше суммы", items, 1250, 5000, 0, false, 0},
+		{"пустой заказ", nil, 0, 0, 300, true, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := returnRefundAmount(tt.items, tt.orderTotal, tt.discount, tt.shipping, tt.allReturned)
+			if got != tt.want {
+				t.Errorf("returnRefundAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// refundRecorder - платёжный сервис, который только запоминает возвраты
+type refundRecorder struct {
+	PaymentService
+	refunds []PaymentRefund
+}
+
+func (r *refundRecorder) RefundPayment(ctx context.Context, refund PaymentRefund) (*PaymentRefund, error) {
+	r.refunds = append(r.refunds, refund)
+	refund.ID = 77
+	return &refund, nil
+}
+
+func TestProcessRefund(t *testing.T) {
+	tests := []struct {
+		name       string
+		claimed    int64  // Сколько строк перевёл в refunding первый UPDATE
+		status     string // Статус заявки после него
+		wantErr    error
+		wantRefund bool
+	}{
+		{"одобренная заявка", 1, ReturnStatusRefunding, nil, true},
+		{"повтор прерванного возврата", 0, ReturnStatusRefunding, nil, true},
+		{"уже возвращено", 0, ReturnStatusRefunded, ErrReturnInvalidState, false},
+		{"ещё не одобрена", 0, ReturnStatusRequested, ErrReturnInvalidState, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.rows("SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3", []string{"affected"}, []driver.Value{tt.claimed})
+			stub.rows("FROM return_requests WHERE id = $1", []string{"id", "purchase_id", "store_id", "status", "refund_amount", "payment_refund_id", "decided_by", "decision_note", "created_at", "updated_at"},
+				[]driver.Value{int64(3), int64(42), int64(1), tt.status, 1450.0, int64(0), "Анна", "", time.Now(), time.Now()})
+			stub.rows("FROM return_request_items", []string{"id", "purchase_item_id", "product_id", "quantity", "price", "reason", "opened", "disposition"})
+			stub.rows("SELECT id FROM payments", []string{"id"}, []driver.Value{int64(5)})
+
+			payments := &refundRecorder{}
+			s := NewReturnService(stubUnitOfWork{conn}, payments)
+			req, err := s.ProcessRefund(context.Background(), 3)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProcessRefund() error = %v, want %v", err, tt.wantErr)
+			}
+			if !tt.wantRefund {
+				if len(payments.refunds) != 0 {
+					t.Errorf("возврат выполнен, хотя не должен был: %+v", payments.refunds)
+				}
+				return
+			}
+
+			if len(payments.refunds) != 1 {
+				t.Fatalf("возвратов = %d, want 1", len(payments.refunds))
+			}
+			refund := payments.refunds[0]
+			if refund.PaymentID != 5 || refund.Amount != 1450 || refund.IdempotencyKey != "return-3" {
+				t.Errorf("refund = %+v", refund)
+			}
+			if req.Status != ReturnStatusRefunded || req.PaymentRefundID != 77 {
+				t.Errorf("req = %+v", req)
+			}
+			if len(stub.executed("INSERT INTO purchase_history")) != 1 {
+				t.Error("возврат не записан в историю покупки")
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"github.com/Dmitriy4565/VapeShop/internal/metrics"
+)
+
+// ShopMetrics - бизнес-показатели магазина для /metrics. Заказы и выручка считаются по
+// доменным событиям (см. PurchaseServiceImpl.HandleEvent): диспетчер доставляет событие
+// одному экземпляру сервиса, поэтому сумма счётчиков по экземплярам не завышена.
+type ShopMetrics struct {
+	ordersCreated      *metrics.Counter
+	revenue            *metrics.Counter
+	checkoutsAbandoned *metrics.Gauge
+	abandonmentRatio   *metrics.Gauge
+	lowStockItems      *metrics.Gauge
+}
+
+func NewShopMetrics(reg *metrics.Registry) *ShopMetrics {
+	return &ShopMetrics{
+		ordersCreated: reg.NewCounter("vapeshop_orders_created_total",
+			"Оформленные покупки по начальному статусу (awaiting_payment - с оплатой, awaiting_pickup - самовывоз)", "status"),
+		revenue: reg.NewCounter("vapeshop_revenue_total",
+			"Выручка в валюте магазина: оплаченные покупки и выданные заказы самовывоза"),
+		checkoutsAbandoned: reg.NewGauge("vapeshop_checkouts_abandoned",
+			"Покупки с оплатой за сутки до порога брошенной корзины, так и не оплаченные"),
+		abandonmentRatio: reg.NewGauge("vapeshop_checkout_abandonment_ratio",
+			"Доля брошенных среди покупок с оплатой за сутки до порога брошенной корзины"),
+		lowStockItems: reg.NewGauge("vapeshop_low_stock_items",
+			"Товары в магазинах с остатком на уровне точки дозаказа или ниже"),
+	}
+}
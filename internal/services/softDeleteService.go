@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/lib/pq"
+)
+
+// execer - часть db.Querier для запросов без результата
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// purgeRule - правило окончательного удаления для одной таблицы. References - внешние ключи
+// на эту таблицу в виде "таблица.колонка": пока на запись ссылается хоть одна строка,
+// она сохраняется даже после срока хранения (например, товар из истории заказов).
+type purgeRule struct {
+	table      string
+	references []string
+}
+
+var purgeRules = []purgeRule{
+	// Товары из истории заказов, движений склада и изменений цен остаются навсегда.
+	// Изображения товара удаляет хук сервиса изображений вместе с файлами.
+	{table: "products", references: []string{
+		"purchase_items.product_id", "price_change.product_id", "product_variants.product_id",
+		"supplier_order_items.product_id", "stock_movements.product_id", "reorder_levels.product_id",
+		"low_stock_alerts.product_id", "product_subscriptions.product_id", "store_inventory.product_id",
+		"stocktake_counts.product_id", "return_request_items.product_id", "product_cost_history.product_id",
+	}},
+	{table: "categories", references: []string{"products.category_id", "categories.parent_id", "accessories.category_id"}},
+	{table: "manufacturers", references: []string{"products.manufacturer_id", "liquids.brand_id"}},
+	{table: "stores", references: []string{
+		"categories.store_id", "store_inventory.store_id", "pickup_orders.store_id", "delivery_zones.store_id",
+		"supplier_orders.store_id", "stock_movements.store_id", "return_requests.store_id", "stocktakes.store_id",
+		"reorder_levels.store_id", "low_stock_alerts.store_id",
+	}},
+	// Подписки и настройки уведомлений удаляют хуки, в очереди уведомлений ссылка обнуляется сама
+	{table: "customers", references: []string{"purchases.customer_id", "pickup_orders.customer_id"}},
+}
+
+// unreferenced возвращает условие SQL: на запись таблицы правила не ссылается ни одна строка
+func (r purgeRule) unreferenced() string {
+	conditions := make([]string, len(r.references))
+	for i, ref := range r.references {
+		table, column, _ := strings.Cut(ref, ".")
+		conditions[i] = "NOT EXISTS (SELECT 1 FROM " + table + " r WHERE r." + column + " = " + r.table + ".id)"
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// PurgeHook вызывается в транзакции окончательного удаления перед DELETE и удаляет зависимые
+// записи через tx. Действия вне базы (например, удаление файлов) хук возвращает в after:
+// они выполняются, только если удаление зафиксировано.
+type PurgeHook func(ctx context.Context, tx dbtx, ids []int64) (after func(ctx context.Context), err error)
+
+type PurgeService interface {
+	OnPurge(table string, hook PurgeHook)
+	Purge(ctx context.Context) (map[string]int64, error)
+	RunPurgeWorker(ctx context.Context, interval time.Duration)
+}
+
+type PurgeServiceImpl struct {
+	db        db.Conn       // Ссылка на объект базы данных
+	retention time.Duration // Сколько хранить удалённые записи перед окончательным удалением
+	hooks     map[string][]PurgeHook
+}
+
+func NewPurgeService(db db.Conn, retention time.Duration) *PurgeServiceImpl {
+	return &PurgeServiceImpl{
+		db:        db,
+		retention: retention,
+		hooks:     make(map[string][]PurgeHook),
+	}
+}
+
+// OnPurge регистрирует обработчик, который получит ID записей таблицы перед их удалением.
+// Регистрировать обработчики нужно до запуска RunPurgeWorker.
+func (s *PurgeServiceImpl) OnPurge(table string, hook PurgeHook) {
+	s.hooks[table] = append(s.hooks[table], hook)
+}
+
+// Purge окончательно удаляет записи, помеченные удалёнными раньше срока хранения.
+// Каждая таблица очищается в своей транзакции: ошибка в одной не мешает остальным,
+// ошибки собираются и возвращаются вместе. Возвращает количество удалённых записей по таблицам.
+func (s *PurgeServiceImpl) Purge(ctx context.Context) (map[string]int64, error) {
+	cutoff := time.Now().Add(-s.retention)
+	purged := make(map[string]int64, len(purgeRules))
+
+	var errs []error
+	for _, rule := range purgeRules {
+		affected, err := s.purgeTable(ctx, rule, cutoff)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rule.table, err))
+			continue
+		}
+		if affected > 0 {
+			purged[rule.table] = affected
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// purgeTable удаляет записи одной таблицы. Кандидаты блокируются FOR UPDATE, поэтому
+// новая ссылка на них не появится до конца транзакции.
+func (s *PurgeServiceImpl) purgeTable(ctx context.Context, rule purgeRule, cutoff time.Time) (int64, error) {
+	var affected int64
+	var after []func(ctx context.Context)
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		ids, err := purgeCandidates(ctx, tx, rule, cutoff)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		for _, hook := range s.hooks[rule.table] {
+			fn, err := hook(ctx, tx, ids)
+			if err != nil {
+				return err
+			}
+			if fn != nil {
+				after = append(after, fn)
+			}
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM "+rule.table+" WHERE id = ANY($1)", pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		affected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, fn := range after {
+		fn(ctx)
+	}
+	return affected, nil
+}
+
+func purgeCandidates(ctx context.Context, tx queryer, rule purgeRule, cutoff time.Time) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM "+rule.table+" WHERE deleted_at IS NOT NULL AND deleted_at < $1 AND "+rule.unreferenced()+" FOR UPDATE", cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// RunPurgeWorker периодически вызывает Purge, пока не отменён ctx
+func (s *PurgeServiceImpl) RunPurgeWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.Purge(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "ошибка очистки удалённых записей", "error", err)
+			}
+			for table, n := range purged {
+				if n > 0 {
+					slog.InfoContext(ctx, "удалённые записи очищены", "table", table, "count", n)
+				}
+			}
+		}
+	}
+}
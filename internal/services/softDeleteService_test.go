@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPurgeRuleUnreferenced(t *testing.T) {
+	rule := purgeRule{table: "categories", references: []string{"products.category_id", "categories.parent_id"}}
+	want := "NOT EXISTS (SELECT 1 FROM products r WHERE r.category_id = categories.id) AND " +
+		"NOT EXISTS (SELECT 1 FROM categories r WHERE r.parent_id = categories.id)"
+	if got := rule.unreferenced(); got != want {
+		t.Errorf("unreferenced() = %q, want %q", got, want)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	errDelete := errors.New("нарушение внешнего ключа")
+
+	tests := []struct {
+		name       string
+		failTable  string // Таблица, DELETE в которой завершается ошибкой
+		wantPurged map[string]int64
+		wantAfter  bool // Выполнено ли действие хука товаров после фиксации
+	}{
+		{"без ошибок", "", map[string]int64{"products": 1, "categories": 1}, true},
+		{"ошибка в категориях не мешает товарам", "categories", map[string]int64{"products": 1}, true},
+		{"ошибка в товарах не мешает категориям", "products", map[string]int64{"categories": 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.rows("SELECT id FROM", []string{"id"})
+			stub.rows("SELECT id FROM products", []string{"id"}, []driver.Value{int64(1)})
+			stub.rows("SELECT id FROM categories", []string{"id"}, []driver.Value{int64(2)})
+			stub.on("DELETE FROM", func(args []any) (*stubRows, error) {
+				return rowsOf([]string{"affected"}, []driver.Value{int64(1)}), nil
+			})
+			if tt.failTable != "" {
+				stub.on("DELETE FROM "+tt.failTable, func([]any) (*stubRows, error) { return nil, errDelete })
+			}
+
+			s := NewPurgeService(stubUnitOfWork{conn}, 0)
+			var hookIDs []int64
+			after := false
+			s.OnPurge("products", func(ctx context.Context, tx dbtx, ids []int64) (func(context.Context), error) {
+				hookIDs = ids
+				return func(context.Context) { after = true }, nil
+			})
+
+			purged, err := s.Purge(context.Background())
+			if tt.failTable == "" && err != nil {
+				t.Fatalf("Purge() error = %v", err)
+			}
+			if tt.failTable != "" && (!errors.Is(err, errDelete) || !strings.Contains(err.Error(), tt.failTable)) {
+				t.Fatalf("Purge() error = %v, want ошибку таблицы %s", err, tt.failTable)
+			}
+			if len(purged) != len(tt.wantPurged) {
+				t.Errorf("purged = %v, want %v", purged, tt.wantPurged)
+			}
+			for table, n := range tt.wantPurged {
+				if purged[table] != n {
+					t.Errorf("purged[%s] = %d, want %d", table, purged[table], n)
+				}
+			}
+			if len(hookIDs) != 1 || hookIDs[0] != 1 {
+				t.Errorf("хук получил %v, want [1]", hookIDs)
+			}
+			if after != tt.wantAfter {
+				t.Errorf("действие после удаления выполнено = %v, want %v", after, tt.wantAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// sqlStub - заглушка базы данных для тестов сервисов: отвечает на запросы по подстроке текста
+// и запоминает выполненные изменения. Настоящий PostgreSQL в тестах не нужен.
+type sqlStub struct {
+	mu       sync.Mutex
+	handlers []stubHandler
+	execs    []stubCall
+}
+
+type stubHandler struct {
+	match string
+	fn    func(args []any) (*stubRows, error)
+}
+
+type stubCall struct {
+	query string
+	args  []any
+}
+
+// stubRows - ответ на запрос: столбцы и строки
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+	pos     int
+}
+
+func rowsOf(columns []string, values ...[]driver.Value) *stubRows {
+	return &stubRows{columns: columns, values: values}
+}
+
+func newSQLStub(t *testing.T) (*sqlStub, *sql.DB) {
+	stub := &sqlStub{}
+	conn := sql.OpenDB(stubConnector{stub})
+	t.Cleanup(func() { conn.Close() })
+	return stub, conn
+}
+
+// on задаёт ответ на запросы, содержащие match; более поздние обработчики важнее
+func (s *sqlStub) on(match string, fn func(args []any) (*stubRows, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append([]stubHandler{{match: match, fn: fn}}, s.handlers...)
+}
+
+// rows задаёт постоянный ответ на запросы, содержащие match
+func (s *sqlStub) rows(match string, columns []string, values ...[]driver.Value) {
+	s.on(match, func([]any) (*stubRows, error) { return rowsOf(columns, values...), nil })
+}
+
+// executed возвращает выполненные изменения, содержащие match
+func (s *sqlStub) executed(match string) []stubCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []stubCall
+	for _, call := range s.execs {
+		if strings.Contains(call.query, match) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (s *sqlStub) query(query string, args []driver.NamedValue) (*stubRows, error) {
+	s.mu.Lock()
+	handlers := s.handlers
+	s.mu.Unlock()
+	for _, h := range handlers {
+		if strings.Contains(query, h.match) {
+			return h.fn(plainArgs(args))
+		}
+	}
+	return nil, fmt.Errorf("sqlStub: неожиданный запрос: %s", query)
+}
+
+func (s *sqlStub) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	s.mu.Lock()
+	s.execs = append(s.execs, stubCall{query: query, args: plainArgs(args)})
+	handlers := s.handlers
+	s.mu.Unlock()
+	// Для изменений обработчик необязателен; если он есть, число строк - первое значение ответа
+	for _, h := range handlers {
+		if strings.Contains(query, h.match) {
+			rows, err := h.fn(plainArgs(args))
+			if err != nil {
+				return nil, err
+			}
+			if len(rows.values) > 0 {
+				if n, ok := rows.values[0][0].(int64); ok {
+					return driver.RowsAffected(n), nil
+				}
+			}
+			return driver.RowsAffected(0), nil
+		}
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// stubUnitOfWork - db.Conn поверх заглушки. Транзакции настоящие, но фиксация
+// и откат в заглушке ничего не делают.
+type stubUnitOfWork struct {
+	*sql.DB
+}
+
+func (u stubUnitOfWork) WithTx(ctx context.Context, fn func(tx db.Querier) error) error {
+	tx, err := u.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func plainArgs(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+type stubConnector struct {
+	stub *sqlStub
+}
+
+func (c stubConnector) Connect(context.Context) (driver.Conn, error) {
+	return stubConn{c.stub}, nil
+}
+
+func (c stubConnector) Driver() driver.Driver {
+	return stubDriver{}
+}
+
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("sqlStub: используйте sql.OpenDB")
+}
+
+type stubConn struct {
+	stub *sqlStub
+}
+
+func (c stubConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("sqlStub: подготовленные запросы не поддерживаются")
+}
+
+func (c stubConn) Close() error              { return nil }
+func (c stubConn) Begin() (driver.Tx, error) { return stubTx{}, nil }
+
+func (c stubConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.stub.query(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &stubRows{columns: rows.columns, values: rows.values}, nil
+}
+
+func (c stubConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.stub.exec(query, args)
+}
+
+// Аргументы передаются в заглушку как есть, без приведения к типам драйвера
+func (c stubConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Виды движений товара. Количество в движении знаковое: приход положительный, расход отрицательный.
+const (
+	MovementSale       = "sale"
+	MovementReturn     = "return"
+	MovementReceipt    = "receipt"
+	MovementTransfer   = "transfer"
+	MovementWriteOff   = "write_off"
+	MovementAdjustment = "adjustment"
+)
+
+// Документы, на основании которых выполнено движение
+const (
+	MovementRefPickupOrder   = "pickup_order"
+	MovementRefReturn        = "return_request"
+	MovementRefGoodsReceipt  = "goods_receipt"
+	MovementRefTransfer      = "transfer"
+	MovementRefStocktake     = "stocktake"
+	MovementRefCatalogImport = "catalog_import"
+)
+
+var ErrSameStore = errors.New("магазин-отправитель и магазин-получатель совпадают")
+
+// StockMovement - запись журнала движения товара. Журнал только пополняется:
+// ошибочное движение исправляется новым движением с обратным знаком. Движение без
+// магазина (StoreID 0) меняет общий остаток товара или, если задан VariantID, варианта.
+type StockMovement struct {
+	ID            int64     `json:"id"`
+	StoreID       int64     `json:"storeId,omitempty"`
+	ProductID     int64     `json:"productId"`
+	VariantID     int64     `json:"variantId,omitempty"`
+	Kind          string    `json:"kind"`
+	Quantity      int       `json:"quantity"`
+	ReferenceType string    `json:"referenceType,omitempty"`
+	ReferenceID   int64     `json:"referenceId,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	CreatedBy     string    `json:"createdBy,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type StockMovementFilter struct {
+	StoreID   int64 // 0 - все магазины
+	ProductID int64 // 0 - все товары
+	Kind      string
+	Limit     int
+}
+
+type TransferRequest struct {
+	FromStoreID int64  `json:"fromStoreId" validate:"required"`
+	ToStoreID   int64  `json:"toStoreId" validate:"required"`
+	ProductID   int64  `json:"productId" validate:"required"`
+	Quantity    int    `json:"quantity" validate:"required,min=1"`
+	Note        string `json:"note"`
+	StaffName   string `json:"staffName" validate:"required"`
+}
+
+type WriteOffRequest struct {
+	StoreID   int64  `json:"storeId" validate:"required"`
+	ProductID int64  `json:"productId" validate:"required"`
+	Quantity  int    `json:"quantity" validate:"required,min=1"`
+	Reason    string `json:"reason" validate:"required"`
+	StaffName string `json:"staffName" validate:"required"`
+}
+
+// StockMismatch - расхождение остатка с суммой движений по журналу: остатка магазина
+// или, при StoreID 0, общего остатка товара или варианта
+type StockMismatch struct {
+	StoreID   int64 `json:"storeId,omitempty"`
+	ProductID int64 `json:"productId"`
+	VariantID int64 `json:"variantId,omitempty"`
+	OnHand    int   `json:"onHand"`
+	Ledger    int   `json:"ledger"`
+}
+
+type StockService interface {
+	GetMovements(ctx context.Context, filter StockMovementFilter) ([]StockMovement, error)
+	TransferStock(ctx context.Context, req TransferRequest) error
+	WriteOff(ctx context.Context, req WriteOffRequest) (*StockMovement, error)
+	Reconcile(ctx context.Context, storeID int64) ([]StockMismatch, error)
+}
+
+type StockServiceImpl struct {
+	catalogEmitter
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewStockService(db db.Conn) *StockServiceImpl {
+	return &StockServiceImpl{
+		db: db,
+	}
+}
+
+const (
+	defaultMovementsLimit = 100
+	maxMovementsLimit     = 1000
+)
+
+func (s *StockServiceImpl) GetMovements(ctx context.Context, filter StockMovementFilter) ([]StockMovement, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultMovementsLimit
+	}
+	if limit > maxMovementsLimit {
+		limit = maxMovementsLimit
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, COALESCE(store_id, 0), product_id, COALESCE(variant_id, 0), kind, quantity, COALESCE(reference_type, ''), COALESCE(reference_id, 0), COALESCE(note, ''), COALESCE(created_by, ''), created_at
+		FROM stock_movements
+		WHERE ($1 = 0 OR store_id = $1) AND ($2 = 0 OR product_id = $2) AND ($3 = '' OR kind = $3)
+		ORDER BY created_at DESC, id DESC LIMIT $4`, filter.StoreID, filter.ProductID, filter.Kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []StockMovement{}
+	for rows.Next() {
+		var m StockMovement
+		if err := rows.Scan(&m.ID, &m.StoreID, &m.ProductID, &m.VariantID, &m.Kind, &m.Quantity, &m.ReferenceType, &m.ReferenceID, &m.Note, &m.CreatedBy, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+
+	return movements, rows.Err()
+}
+
+// TransferStock перемещает свободный (не зарезервированный) товар между магазинами
+// двумя движениями с общим номером перемещения
+func (s *StockServiceImpl) TransferStock(ctx context.Context, req TransferRequest) error {
+	if req.FromStoreID == req.ToStoreID {
+		return ErrSameStore
+	}
+
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		var ref int64
+		if err := tx.QueryRowContext(ctx, "SELECT nextval('stock_transfer_seq')").Scan(&ref); err != nil {
+			return err
+		}
+
+		err := applyStockMovement(ctx, tx, StockMovement{
+			StoreID: req.FromStoreID, ProductID: req.ProductID, Kind: MovementTransfer, Quantity: -req.Quantity,
+			ReferenceType: MovementRefTransfer, ReferenceID: ref, Note: req.Note, CreatedBy: req.StaffName,
+		})
+		if err != nil {
+			return err
+		}
+		return applyStockMovement(ctx, tx, StockMovement{
+			StoreID: req.ToStoreID, ProductID: req.ProductID, Kind: MovementTransfer, Quantity: req.Quantity,
+			ReferenceType: MovementRefTransfer, ReferenceID: ref, Note: req.Note, CreatedBy: req.StaffName,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	s.emitStockIncreased(ctx, StockIncreased{ProductID: req.ProductID, StoreID: req.ToStoreID, Quantity: req.Quantity})
+	return nil
+}
+
+// WriteOff списывает свободный товар (брак, порча, недостача вне инвентаризации)
+func (s *StockServiceImpl) WriteOff(ctx context.Context, req WriteOffRequest) (*StockMovement, error) {
+	movement := StockMovement{
+		StoreID: req.StoreID, ProductID: req.ProductID, Kind: MovementWriteOff, Quantity: -req.Quantity,
+		Note: req.Reason, CreatedBy: req.StaffName,
+	}
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		return applyStockMovement(ctx, tx, movement)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// Reconcile сверяет остатки магазина (или всех магазинов, если storeID равен 0) с журналом движений.
+// Без магазина сверяются и общие остатки товаров и вариантов. Пустой результат означает, что
+// все остатки подтверждаются журналом.
+func (s *StockServiceImpl) Reconcile(ctx context.Context, storeID int64) ([]StockMismatch, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT COALESCE(si.store_id, m.store_id), COALESCE(si.product_id, m.product_id), 0, COALESCE(si.quantity, 0), COALESCE(m.total, 0)
+		FROM store_inventory si
+		FULL OUTER JOIN (
+			SELECT store_id, product_id, SUM(quantity) AS total FROM stock_movements WHERE store_id IS NOT NULL GROUP BY store_id, product_id
+		) m ON m.store_id = si.store_id AND m.product_id = si.product_id
+		WHERE COALESCE(si.quantity, 0) <> COALESCE(m.total, 0)
+			AND ($1 = 0 OR COALESCE(si.store_id, m.store_id) = $1)
+		UNION ALL
+		SELECT 0, p.id, 0, COALESCE(p.stock, 0), COALESCE(m.total, 0)
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, SUM(quantity) AS total FROM stock_movements WHERE store_id IS NULL AND variant_id IS NULL GROUP BY product_id
+		) m ON m.product_id = p.id
+		WHERE $1 = 0 AND COALESCE(p.stock, 0) <> COALESCE(m.total, 0)
+		UNION ALL
+		SELECT 0, v.product_id, v.id, v.stock, COALESCE(m.total, 0)
+		FROM product_variants v
+		LEFT JOIN (
+			SELECT variant_id, SUM(quantity) AS total FROM stock_movements WHERE store_id IS NULL AND variant_id IS NOT NULL GROUP BY variant_id
+		) m ON m.variant_id = v.id
+		WHERE $1 = 0 AND v.stock <> COALESCE(m.total, 0)
+		ORDER BY 1, 2, 3`, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mismatches := []StockMismatch{}
+	for rows.Next() {
+		var m StockMismatch
+		if err := rows.Scan(&m.StoreID, &m.ProductID, &m.VariantID, &m.OnHand, &m.Ledger); err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+
+	return mismatches, rows.Err()
+}
+
+// applyStockMovement записывает движение в журнал и меняет остаток магазина на ту же величину.
+// Расход не может затронуть зарезервированный товар - в этом случае возвращается ErrInsufficientStock.
+func applyStockMovement(ctx context.Context, tx db.Querier, m StockMovement) error {
+	if m.Quantity < 0 {
+		result, err := tx.ExecContext(ctx, "UPDATE store_inventory SET quantity = quantity + $1 WHERE store_id = $2 AND product_id = $3 AND quantity - reserved >= $4",
+			m.Quantity, m.StoreID, m.ProductID, -m.Quantity)
+		if err != nil {
+			return err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if affected == 0 {
+			return ErrInsufficientStock
+		}
+	} else {
+		_, err := tx.ExecContext(ctx, "INSERT INTO store_inventory (store_id, product_id, quantity) VALUES ($1, $2, $3) ON CONFLICT (store_id, product_id) DO UPDATE SET quantity = store_inventory.quantity + EXCLUDED.quantity",
+			m.StoreID, m.ProductID, m.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+
+	return recordStockMovement(ctx, tx, m)
+}
+
+// applyCatalogStockMovement - applyStockMovement для общего остатка без магазина: меняет
+// products.stock или, если задан VariantID, product_variants.stock. Остаток не может стать
+// отрицательным - в этом случае возвращается ErrInsufficientStock.
+func applyCatalogStockMovement(ctx context.Context, tx db.Querier, m StockMovement) error {
+	if m.Quantity == 0 {
+		return nil
+	}
+
+	var result sql.Result
+	var err error
+	if m.VariantID != 0 {
+		result, err = tx.ExecContext(ctx, "UPDATE product_variants SET stock = stock + $1, updated_at = NOW() WHERE id = $2 AND stock + $1 >= 0", m.Quantity, m.VariantID)
+	} else {
+		result, err = tx.ExecContext(ctx, "UPDATE products SET stock = COALESCE(stock, 0) + $1 WHERE id = $2 AND COALESCE(stock, 0) + $1 >= 0", m.Quantity, m.ProductID)
+	}
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrInsufficientStock
+	}
+
+	return recordStockMovement(ctx, tx, m)
+}
+
+// recordStockMovement только добавляет запись в журнал - для мест, где остаток
+// меняется вместе с резервом одним запросом (выдача заказа на самовывоз)
+func recordStockMovement(ctx context.Context, tx db.Querier, m StockMovement) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO stock_movements (store_id, product_id, variant_id, kind, quantity, reference_type, reference_id, note, created_by) VALUES (NULLIF($1, 0), $2, NULLIF($3, 0), $4, $5, NULLIF($6, ''), NULLIF($7, 0), NULLIF($8, ''), NULLIF($9, ''))",
+		m.StoreID, m.ProductID, m.VariantID, m.Kind, m.Quantity, m.ReferenceType, m.ReferenceID, m.Note, m.CreatedBy)
+	if err != nil {
+		return err
+	}
+	return publishStockChanged(ctx, tx, StockChangedPayload{ProductID: EventID(m.ProductID), VariantID: EventID(m.VariantID), StoreID: EventID(m.StoreID), Delta: m.Quantity, Reason: m.Kind})
+}
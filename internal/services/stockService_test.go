@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestApplyCatalogStockMovement(t *testing.T) {
+	tests := []struct {
+		name        string
+		movement    StockMovement
+		affected    int64 // Строк, изменённых запросом остатка
+		wantUpdate  string
+		wantErr     error
+		wantRecords int
+	}{
+		{"остаток товара", StockMovement{ProductID: 7, Kind: MovementAdjustment, Quantity: 5}, 1, "UPDATE products SET stock", nil, 1},
+		{"остаток варианта", StockMovement{ProductID: 7, VariantID: 3, Kind: MovementReceipt, Quantity: 2}, 1, "UPDATE product_variants SET stock", nil, 1},
+		{"ниже нуля", StockMovement{ProductID: 7, VariantID: 3, Kind: MovementAdjustment, Quantity: -10}, 0, "UPDATE product_variants SET stock", ErrInsufficientStock, 0},
+		{"без изменения", StockMovement{ProductID: 7, Kind: MovementAdjustment}, 0, "", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			stub.rows("SET stock = ", []string{"affected"}, []driver.Value{tt.affected})
+
+			tx, err := conn.BeginTx(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			err = applyCatalogStockMovement(context.Background(), tx, tt.movement)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyCatalogStockMovement() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantUpdate != "" && len(stub.executed(tt.wantUpdate)) != 1 {
+				t.Errorf("нет запроса %q", tt.wantUpdate)
+			}
+
+			records := stub.executed("INSERT INTO stock_movements")
+			if len(records) != tt.wantRecords {
+				t.Fatalf("записей в журнале = %d, want %d", len(records), tt.wantRecords)
+			}
+			if tt.wantRecords > 0 {
+				// Движение без магазина: store_id пишется как 0 и превращается в NULL запросом
+				args := records[0].args
+				if args[0] != int64(0) || args[1] != tt.movement.ProductID || args[2] != tt.movement.VariantID || args[4] != tt.movement.Quantity {
+					t.Errorf("движение = %v", args)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Статусы инвентаризации
+const (
+	StocktakeOpen      = "open"
+	StocktakeCompleted = "completed"
+	StocktakeCancelled = "cancelled"
+)
+
+var (
+	ErrStocktakeNotFound      = errors.New("инвентаризация не найдена")
+	ErrStocktakeNotOpen       = errors.New("инвентаризация уже завершена или отменена")
+	ErrStocktakeAlreadyOpen   = errors.New("в магазине уже идёт инвентаризация")
+	ErrStocktakeNoCounts      = errors.New("не внесено ни одного пересчёта")
+	ErrStocktakeBelowReserved = errors.New("пересчитано меньше, чем зарезервировано под заказы")
+)
+
+type Stocktake struct {
+	ID          int64      `json:"id"`
+	StoreID     int64      `json:"storeId" validate:"required"`
+	Status      string     `json:"status"`
+	StartedBy   string     `json:"startedBy" validate:"required"`
+	Note        string     `json:"note"`
+	CompletedBy string     `json:"completedBy,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+type StocktakeCount struct {
+	ProductID int64 `json:"productId" validate:"required"`
+	Counted   int   `json:"counted" validate:"min=0"`
+}
+
+type StocktakeCountsRequest struct {
+	StocktakeID int64            `json:"stocktakeId" validate:"required"`
+	CountedBy   string           `json:"countedBy" validate:"required"`
+	Counts      []StocktakeCount `json:"counts" validate:"required,min=1,dive"`
+}
+
+type VarianceLine struct {
+	ProductID    int64   `json:"productId"`
+	ProductName  string  `json:"productName"`
+	Expected     int     `json:"expected"`
+	Counted      int     `json:"counted"`
+	Variance     int     `json:"variance"`     // Пересчитано минус учтено: минус - недостача
+	VarianceCost float64 `json:"varianceCost"` // Расхождение по закупочной цене
+}
+
+// VarianceReport - отчёт о расхождениях. Для незавершённой инвентаризации показывает,
+// какие корректировки будут сделаны при завершении по текущим остаткам.
+type VarianceReport struct {
+	Stocktake         Stocktake      `json:"stocktake"`
+	Lines             []VarianceLine `json:"lines"`
+	TotalVariance     int            `json:"totalVariance"`
+	TotalVarianceCost float64        `json:"totalVarianceCost"`
+}
+
+type StocktakeService interface {
+	StartStocktake(ctx context.Context, stocktake Stocktake) (*Stocktake, error)
+	GetStocktake(ctx context.Context, id int64) (*Stocktake, error)
+	SubmitCounts(ctx context.Context, req StocktakeCountsRequest) error
+	GetVarianceReport(ctx context.Context, id int64) (*VarianceReport, error)
+	CompleteStocktake(ctx context.Context, id int64, staffName string) (*VarianceReport, error)
+	CancelStocktake(ctx context.Context, id int64) error
+}
+
+type StocktakeServiceImpl struct {
+	catalogEmitter
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewStocktakeService(db db.Conn) *StocktakeServiceImpl {
+	return &StocktakeServiceImpl{
+		db: db,
+	}
+}
+
+const stocktakeColumns = "id, store_id, status, started_by, COALESCE(note, ''), COALESCE(completed_by, ''), created_at, completed_at"
+
+func scanStocktake(row interface{ Scan(...any) error }, st *Stocktake) error {
+	return row.Scan(&st.ID, &st.StoreID, &st.Status, &st.StartedBy, &st.Note, &st.CompletedBy, &st.CreatedAt, &st.CompletedAt)
+}
+
+func (s *StocktakeServiceImpl) StartStocktake(ctx context.Context, stocktake Stocktake) (*Stocktake, error) {
+	var open bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM stocktakes WHERE store_id = $1 AND status = $2)", stocktake.StoreID, StocktakeOpen).Scan(&open)
+	if err != nil {
+		return nil, err
+	}
+	if open {
+		return nil, ErrStocktakeAlreadyOpen
+	}
+
+	stocktake.Status = StocktakeOpen
+	err = s.db.QueryRowContext(ctx, "INSERT INTO stocktakes (store_id, status, started_by, note) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		stocktake.StoreID, stocktake.Status, stocktake.StartedBy, stocktake.Note).Scan(&stocktake.ID, &stocktake.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &stocktake, nil
+}
+
+func (s *StocktakeServiceImpl) GetStocktake(ctx context.Context, id int64) (*Stocktake, error) {
+	return getStocktake(ctx, s.db, id, false)
+}
+
+// SubmitCounts сохраняет пересчитанные количества. Повторный пересчёт товара заменяет предыдущий,
+// поэтому считать можно по частям и несколькими сотрудниками.
+func (s *StocktakeServiceImpl) SubmitCounts(ctx context.Context, req StocktakeCountsRequest) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		stocktake, err := getStocktake(ctx, tx, req.StocktakeID, true)
+		if err != nil {
+			return err
+		}
+		if stocktake.Status != StocktakeOpen {
+			return ErrStocktakeNotOpen
+		}
+
+		for _, count := range req.Counts {
+			_, err := tx.ExecContext(ctx, `INSERT INTO stocktake_counts (stocktake_id, product_id, counted_quantity, counted_by) VALUES ($1, $2, $3, $4)
+				ON CONFLICT (stocktake_id, product_id) DO UPDATE SET counted_quantity = EXCLUDED.counted_quantity, counted_by = EXCLUDED.counted_by, counted_at = NOW()`,
+				req.StocktakeID, count.ProductID, count.Counted, req.CountedBy)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *StocktakeServiceImpl) GetVarianceReport(ctx context.Context, id int64) (*VarianceReport, error) {
+	stocktake, err := getStocktake(ctx, s.db, id, false)
+	if err != nil {
+		return nil, err
+	}
+	return buildVarianceReport(ctx, s.db, *stocktake)
+}
+
+// CompleteStocktake фиксирует учётные остатки на момент завершения и проводит
+// корректирующие движения по каждому товару с расхождением. Товары, которые не пересчитывали,
+// не меняются - так можно проводить выборочную инвентаризацию.
+func (s *StocktakeServiceImpl) CompleteStocktake(ctx context.Context, id int64, staffName string) (*VarianceReport, error) {
+	var report *VarianceReport
+	var restocked []StockIncreased
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		stocktake, err := getStocktake(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		if stocktake.Status != StocktakeOpen {
+			return ErrStocktakeNotOpen
+		}
+
+		rows, err := tx.QueryContext(ctx, "SELECT product_id, counted_quantity FROM stocktake_counts WHERE stocktake_id = $1 ORDER BY product_id", id)
+		if err != nil {
+			return err
+		}
+		var counts []StocktakeCount
+		for rows.Next() {
+			var count StocktakeCount
+			if err := rows.Scan(&count.ProductID, &count.Counted); err != nil {
+				rows.Close()
+				return err
+			}
+			counts = append(counts, count)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(counts) == 0 {
+			return ErrStocktakeNoCounts
+		}
+
+		for _, count := range counts {
+			var expected int
+			err := tx.QueryRowContext(ctx, "SELECT quantity FROM store_inventory WHERE store_id = $1 AND product_id = $2 FOR UPDATE", stocktake.StoreID, count.ProductID).Scan(&expected)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, "UPDATE stocktake_counts SET expected_quantity = $1 WHERE stocktake_id = $2 AND product_id = $3", expected, id, count.ProductID); err != nil {
+				return err
+			}
+
+			variance := count.Counted - expected
+			if variance == 0 {
+				continue
+			}
+			err = applyStockMovement(ctx, tx, StockMovement{
+				StoreID: stocktake.StoreID, ProductID: count.ProductID, Kind: MovementAdjustment, Quantity: variance,
+				ReferenceType: MovementRefStocktake, ReferenceID: id, CreatedBy: staffName,
+			})
+			if errors.Is(err, ErrInsufficientStock) {
+				return fmt.Errorf("%w: товар %d", ErrStocktakeBelowReserved, count.ProductID)
+			}
+			if err != nil {
+				return err
+			}
+			if variance > 0 {
+				restocked = append(restocked, StockIncreased{ProductID: count.ProductID, StoreID: stocktake.StoreID, Quantity: variance})
+			}
+		}
+
+		now := time.Now()
+		_, err = tx.ExecContext(ctx, "UPDATE stocktakes SET status = $1, completed_by = $2, completed_at = $3 WHERE id = $4", StocktakeCompleted, staffName, now, id)
+		if err != nil {
+			return err
+		}
+		stocktake.Status = StocktakeCompleted
+		stocktake.CompletedBy = staffName
+		stocktake.CompletedAt = &now
+
+		report, err = buildVarianceReport(ctx, tx, *stocktake)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.emitStockIncreased(ctx, restocked...)
+	return report, nil
+}
+
+func (s *StocktakeServiceImpl) CancelStocktake(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE stocktakes SET status = $1 WHERE id = $2 AND status = $3", StocktakeCancelled, id, StocktakeOpen)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if _, err := s.GetStocktake(ctx, id); err != nil {
+			return err
+		}
+		return ErrStocktakeNotOpen
+	}
+	return nil
+}
+
+func getStocktake(ctx context.Context, q queryer, id int64, forUpdate bool) (*Stocktake, error) {
+	query := "SELECT " + stocktakeColumns + " FROM stocktakes WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var stocktake Stocktake
+	if err := scanStocktake(q.QueryRowContext(ctx, query, id), &stocktake); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrStocktakeNotFound
+		}
+		return nil, err
+	}
+	return &stocktake, nil
+}
+
+// buildVarianceReport сравнивает пересчёт с учётом: для завершённой инвентаризации -
+// с зафиксированными при завершении остатками, для открытой - с текущими
+func buildVarianceReport(ctx context.Context, q queryer, stocktake Stocktake) (*VarianceReport, error) {
+	rows, err := q.QueryContext(ctx, `SELECT c.product_id, p.name, COALESCE(c.expected_quantity, si.quantity, 0), c.counted_quantity, COALESCE(p.cost_price, 0)
+		FROM stocktake_counts c
+		JOIN products p ON p.id = c.product_id
+		LEFT JOIN store_inventory si ON si.store_id = $2 AND si.product_id = c.product_id
+		WHERE c.stocktake_id = $1
+		ORDER BY p.name`, stocktake.ID, stocktake.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &VarianceReport{Stocktake: stocktake, Lines: []VarianceLine{}}
+	for rows.Next() {
+		var line VarianceLine
+		var costPrice float64
+		if err := rows.Scan(&line.ProductID, &line.ProductName, &line.Expected, &line.Counted, &costPrice); err != nil {
+			return nil, err
+		}
+		line.Variance = line.Counted - line.Expected
+		line.VarianceCost = roundMoney(float64(line.Variance) * costPrice)
+
+		report.TotalVariance += line.Variance
+		report.TotalVarianceCost += line.VarianceCost
+		report.Lines = append(report.Lines, line)
+	}
+	report.TotalVarianceCost = roundMoney(report.TotalVarianceCost)
+
+	return report, rows.Err()
+}
@@ -1,93 +1,67 @@
-package services //заменить s.db на фактическое подключение к бд, но это в конце после маина
+package services
 
 import (
 	"context"
 	"errors"
-	"time"
 
-	"database/sql"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 )
 
-type Store struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
-}
+type Store = repository.Store
+
+var ErrStoreNotFound = errors.New("магазин не найден")
 
 type StoreService interface {
-	GetAllStores() ([]Store, error)
-	GetStoreByID(id string) (*Store, error)
-	CreateStore(store Store) (*Store, error)
-	UpdateStore(store Store) error
-	DeleteStore(id string) error
+	GetAllStores(ctx context.Context, includeDeleted bool) ([]Store, error)
+	GetStoreByID(ctx context.Context, id int64) (*Store, error)
+	CreateStore(ctx context.Context, store Store) (*Store, error)
+	UpdateStore(ctx context.Context, store Store) error
+	DeleteStore(ctx context.Context, id int64) error
+	RestoreStore(ctx context.Context, id int64) error
 }
 
 type StoreServiceImpl struct {
-	db *sql.DB // Ссылка на объект базы данных
+	stores repository.StoreRepository
 }
 
-func NewStoreService(db *sql.DB) *StoreServiceImpl {
+func NewStoreService(stores repository.StoreRepository) *StoreServiceImpl {
 	return &StoreServiceImpl{
-		db: db,
+		stores: stores,
 	}
 }
 
-func (s *StoreServiceImpl) GetAllStores() ([]Store, error) {
-	rows, err := s.db.QueryContext(context.Background(), "SELECT * FROM stores")
-	if err != nil {
-		return nil, err
+// storeError заменяет repository.ErrNotFound на ErrStoreNotFound
+func storeError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrStoreNotFound
 	}
-	defer rows.Close()
+	return err
+}
 
-	var stores []Store
-	for rows.Next() {
-		var store Store
-		if err := rows.Scan(&store.ID, &store.Name, &store.Address, &store.CreatedAt, &store.UpdatedAt); err != nil {
-			return nil, err
-		}
-		stores = append(stores, store)
-	}
+func (s *StoreServiceImpl) GetAllStores(ctx context.Context, includeDeleted bool) ([]Store, error) {
+	return s.stores.List(ctx, includeDeleted)
+}
 
-	return stores, nil
+func (s *StoreServiceImpl) GetStoreByID(ctx context.Context, id int64) (*Store, error) {
+	store, err := s.stores.GetByID(ctx, id)
+	return store, storeError(err)
 }
 
-func (s *StoreServiceImpl) GetStoreByID(id string) (*Store, error) {
-	var store Store
-	err := s.db.QueryRowContext(context.Background(), "SELECT * FROM stores WHERE id = $1", id).Scan(&store.ID, &store.Name, &store.Address, &store.CreatedAt, &store.UpdatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("магазин не найден")
-		}
+func (s *StoreServiceImpl) CreateStore(ctx context.Context, store Store) (*Store, error) {
+	if err := s.stores.Create(ctx, &store); err != nil {
 		return nil, err
 	}
 	return &store, nil
 }
 
-func (s *StoreServiceImpl) CreateStore(store Store) (*Store, error) {
-	ctx := context.Background()
-	result, err := s.db.ExecContext(ctx, "INSERT INTO stores (name, address) VALUES ($1, $2)", store.Name, store.Address)
-	if err != nil {
-		return nil, err
-	}
-
-	lastInsertID, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-	store.ID = lastInsertID
-	return &store, nil
+func (s *StoreServiceImpl) UpdateStore(ctx context.Context, store Store) error {
+	return storeError(s.stores.Update(ctx, store))
 }
 
-func (s *StoreServiceImpl) UpdateStore(store Store) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "UPDATE stores SET name = $1, address = $2 WHERE id = $3", store.Name, store.Address, store.ID)
-	return err
+func (s *StoreServiceImpl) DeleteStore(ctx context.Context, id int64) error {
+	return storeError(s.stores.Delete(ctx, id))
 }
 
-func (s *StoreServiceImpl) DeleteStore(id string) error {
-	ctx := context.Background()
-	_, err := s.db.ExecContext(ctx, "DELETE FROM stores WHERE id = $1", id)
-	return err
+func (s *StoreServiceImpl) RestoreStore(ctx context.Context, id int64) error {
+	return storeError(s.stores.Restore(ctx, id))
 }
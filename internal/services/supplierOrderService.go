@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+// Статусы заказа поставщику
+const (
+	SupplierOrderDraft             = "draft"
+	SupplierOrderOrdered           = "ordered"
+	SupplierOrderPartiallyReceived = "partially_received"
+	SupplierOrderReceived          = "received"
+	SupplierOrderClosed            = "closed" // Приёмка завершена с недопоставкой
+	SupplierOrderCancelled         = "cancelled"
+)
+
+// Виды расхождений при приёмке
+const (
+	DiscrepancyShortage = "shortage"
+	DiscrepancyOverage  = "overage"
+	DiscrepancyDamaged  = "damaged"
+)
+
+var (
+	ErrSupplierOrderNotFound     = errors.New("заказ поставщику не найден")
+	ErrSupplierOrderStatus       = errors.New("действие недоступно в текущем статусе заказа")
+	ErrSupplierOrderItemNotFound = errors.New("позиция не относится к заказу")
+)
+
+type SupplierOrderItem struct {
+	ID               int64   `json:"id"`
+	ProductID        int64   `json:"productId" validate:"required"`
+	Quantity         int     `json:"quantity" validate:"required,min=1"`
+	UnitCost         float64 `json:"unitCost" validate:"min=0"`
+	ReceivedQuantity int     `json:"receivedQuantity"`
+}
+
+// SupplierOrder - заказ товара у поставщика для конкретного магазина
+type SupplierOrder struct {
+	ID            int64                `json:"id"`
+	SupplierID    int64                `json:"supplierId" validate:"required"`
+	StoreID       int64                `json:"storeId" validate:"required"`
+	Status        string               `json:"status"`
+	ExpectedAt    *time.Time           `json:"expectedAt,omitempty"`
+	Notes         string               `json:"notes"`
+	Total         float64              `json:"total"`
+	Items         []SupplierOrderItem  `json:"items" validate:"required,min=1,dive"`
+	Receipts      []GoodsReceipt       `json:"receipts,omitempty"`
+	Discrepancies []ReceiptDiscrepancy `json:"discrepancies,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt"`
+}
+
+// GoodsReceiptLine - сколько единиц позиции привезли и сколько из них оказалось повреждено
+type GoodsReceiptLine struct {
+	OrderItemID int64  `json:"orderItemId" validate:"required"`
+	Quantity    int    `json:"quantity" validate:"min=0"`
+	Damaged     int    `json:"damaged" validate:"min=0,ltefield=Quantity"`
+	Note        string `json:"note"`
+}
+
+type GoodsReceiptRequest struct {
+	OrderID    int64              `json:"orderId" validate:"required"`
+	ReceivedBy string             `json:"receivedBy" validate:"required"`
+	Notes      string             `json:"notes"`
+	Lines      []GoodsReceiptLine `json:"lines" validate:"required,min=1,dive"`
+}
+
+type GoodsReceipt struct {
+	ID         int64              `json:"id"`
+	OrderID    int64              `json:"orderId"`
+	ReceivedBy string             `json:"receivedBy"`
+	Notes      string             `json:"notes"`
+	Lines      []GoodsReceiptLine `json:"lines"`
+	ReceivedAt time.Time          `json:"receivedAt"`
+}
+
+type ReceiptDiscrepancy struct {
+	ID          int64     `json:"id"`
+	ReceiptID   int64     `json:"receiptId,omitempty"` // 0 для недопоставки при закрытии заказа
+	OrderItemID int64     `json:"orderItemId"`
+	ProductID   int64     `json:"productId"`
+	Kind        string    `json:"kind"`
+	Quantity    int       `json:"quantity"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ProductMargin - наценка товара относительно средневзвешенной закупочной цены
+type ProductMargin struct {
+	ProductID     int64    `json:"productId"`
+	Price         float64  `json:"price"`
+	CostPrice     *float64 `json:"costPrice"` // Пусто, пока товар ни разу не принимали
+	Margin        float64  `json:"margin"`
+	MarginPercent float64  `json:"marginPercent"`
+}
+
+type SupplierOrderService interface {
+	GetSupplierOrders(ctx context.Context, supplierID int64, status string) ([]SupplierOrder, error)
+	GetSupplierOrderByID(ctx context.Context, id int64) (*SupplierOrder, error)
+	CreateSupplierOrder(ctx context.Context, order SupplierOrder) (*SupplierOrder, error)
+	SubmitSupplierOrder(ctx context.Context, id int64) error
+	CancelSupplierOrder(ctx context.Context, id int64) error
+	ReceiveGoods(ctx context.Context, req GoodsReceiptRequest) (*GoodsReceipt, error)
+	CloseSupplierOrder(ctx context.Context, id int64) error
+	GetProductMargin(ctx context.Context, productID int64) (*ProductMargin, error)
+}
+
+type SupplierOrderServiceImpl struct {
+	catalogEmitter
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewSupplierOrderService(db db.Conn) *SupplierOrderServiceImpl {
+	return &SupplierOrderServiceImpl{
+		db: db,
+	}
+}
+
+const supplierOrderColumns = `id, supplier_id, store_id, status, expected_at, COALESCE(notes, ''), created_at, updated_at,
+	(SELECT COALESCE(SUM(quantity * unit_cost), 0) FROM supplier_order_items WHERE order_id = supplier_orders.id)`
+
+func scanSupplierOrder(row interface{ Scan(...any) error }, order *SupplierOrder) error {
+	return row.Scan(&order.ID, &order.SupplierID, &order.StoreID, &order.Status, &order.ExpectedAt, &order.Notes, &order.CreatedAt, &order.UpdatedAt, &order.Total)
+}
+
+func (s *SupplierOrderServiceImpl) GetSupplierOrders(ctx context.Context, supplierID int64, status string) ([]SupplierOrder, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+supplierOrderColumns+" FROM supplier_orders WHERE ($1 = 0 OR supplier_id = $1) AND ($2 = '' OR status = $2) ORDER BY created_at DESC", supplierID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []SupplierOrder{}
+	for rows.Next() {
+		var order SupplierOrder
+		if err := scanSupplierOrder(rows, &order); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		orders[i].Items, err = s.getOrderItems(ctx, s.db, orders[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// GetSupplierOrderByID возвращает заказ с позициями, приёмками и расхождениями
+func (s *SupplierOrderServiceImpl) GetSupplierOrderByID(ctx context.Context, id int64) (*SupplierOrder, error) {
+	var order SupplierOrder
+	err := scanSupplierOrder(s.db.QueryRowContext(ctx, "SELECT "+supplierOrderColumns+" FROM supplier_orders WHERE id = $1", id), &order)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSupplierOrderNotFound
+		}
+		return nil, err
+	}
+
+	if order.Items, err = s.getOrderItems(ctx, s.db, id); err != nil {
+		return nil, err
+	}
+	if order.Receipts, err = s.getReceipts(ctx, id); err != nil {
+		return nil, err
+	}
+	if order.Discrepancies, err = s.getDiscrepancies(ctx, id); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// CreateSupplierOrder создаёт черновик заказа; поставщику он уходит после SubmitSupplierOrder
+func (s *SupplierOrderServiceImpl) CreateSupplierOrder(ctx context.Context, order SupplierOrder) (*SupplierOrder, error) {
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		order.Status = SupplierOrderDraft
+		err := tx.QueryRowContext(ctx, "INSERT INTO supplier_orders (supplier_id, store_id, status, expected_at, notes) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at",
+			order.SupplierID, order.StoreID, order.Status, order.ExpectedAt, order.Notes).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		order.Total = 0
+		for i := range order.Items {
+			item := &order.Items[i]
+			item.ReceivedQuantity = 0
+			err := tx.QueryRowContext(ctx, "INSERT INTO supplier_order_items (order_id, product_id, quantity, unit_cost) VALUES ($1, $2, $3, $4) RETURNING id",
+				order.ID, item.ProductID, item.Quantity, item.UnitCost).Scan(&item.ID)
+			if err != nil {
+				return err
+			}
+			order.Total += float64(item.Quantity) * item.UnitCost
+		}
+		order.Total = roundMoney(order.Total)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (s *SupplierOrderServiceImpl) SubmitSupplierOrder(ctx context.Context, id int64) error {
+	return s.changeStatus(ctx, id, SupplierOrderOrdered, SupplierOrderDraft)
+}
+
+// CancelSupplierOrder отменяет заказ, по которому ещё ничего не принято
+func (s *SupplierOrderServiceImpl) CancelSupplierOrder(ctx context.Context, id int64) error {
+	return s.changeStatus(ctx, id, SupplierOrderCancelled, SupplierOrderDraft, SupplierOrderOrdered)
+}
+
+func (s *SupplierOrderServiceImpl) changeStatus(ctx context.Context, id int64, status string, from ...string) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		current, _, err := lockSupplierOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !containsString(from, current) {
+			return ErrSupplierOrderStatus
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE supplier_orders SET status = $1, updated_at = NOW() WHERE id = $2", status, id); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// ReceiveGoods проводит приёмку (возможно, частичную): принятые единицы добавляются
+// в остатки магазина, пересчитывается средневзвешенная закупочная цена товара,
+// а повреждённый товар и поставка сверх заказа записываются как расхождения.
+func (s *SupplierOrderServiceImpl) ReceiveGoods(ctx context.Context, req GoodsReceiptRequest) (*GoodsReceipt, error) {
+	receipt := &GoodsReceipt{
+		OrderID:    req.OrderID,
+		ReceivedBy: req.ReceivedBy,
+		Notes:      req.Notes,
+		Lines:      req.Lines,
+	}
+	var restocked []StockIncreased
+	err := s.db.WithTx(ctx, func(tx db.Querier) error {
+		status, storeID, err := lockSupplierOrder(ctx, tx, req.OrderID)
+		if err != nil {
+			return err
+		}
+		if status != SupplierOrderOrdered && status != SupplierOrderPartiallyReceived {
+			return ErrSupplierOrderStatus
+		}
+
+		err = tx.QueryRowContext(ctx, "INSERT INTO goods_receipts (order_id, received_by, notes) VALUES ($1, $2, $3) RETURNING id, received_at",
+			req.OrderID, req.ReceivedBy, req.Notes).Scan(&receipt.ID, &receipt.ReceivedAt)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range req.Lines {
+			var productID int64
+			var ordered, received int
+			var unitCost float64
+			err := tx.QueryRowContext(ctx, "SELECT product_id, quantity, received_quantity, unit_cost FROM supplier_order_items WHERE id = $1 AND order_id = $2 FOR UPDATE",
+				line.OrderItemID, req.OrderID).Scan(&productID, &ordered, &received, &unitCost)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%w: %d", ErrSupplierOrderItemNotFound, line.OrderItemID)
+				}
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO goods_receipt_items (receipt_id, order_item_id, quantity, damaged, note) VALUES ($1, $2, $3, $4, $5)",
+				receipt.ID, line.OrderItemID, line.Quantity, line.Damaged, line.Note)
+			if err != nil {
+				return err
+			}
+
+			if line.Damaged > 0 {
+				if err := recordDiscrepancy(ctx, tx, req.OrderID, receipt.ID, line.OrderItemID, DiscrepancyDamaged, line.Damaged, line.Note); err != nil {
+					return err
+				}
+			}
+
+			accepted := line.Quantity - line.Damaged
+			if accepted == 0 {
+				continue
+			}
+			// Сверх заказа - всё, что превышает заказанное количество с учётом прошлых приёмок
+			over := received + accepted - ordered
+			if over > accepted {
+				over = accepted
+			}
+			if over > 0 {
+				if err := recordDiscrepancy(ctx, tx, req.OrderID, receipt.ID, line.OrderItemID, DiscrepancyOverage, over, line.Note); err != nil {
+					return err
+				}
+			}
+
+			if _, err := tx.ExecContext(ctx, "UPDATE supplier_order_items SET received_quantity = received_quantity + $1 WHERE id = $2", accepted, line.OrderItemID); err != nil {
+				return err
+			}
+			if err := updateCostPrice(ctx, tx, productID, receipt.ID, accepted, unitCost); err != nil {
+				return err
+			}
+			err = applyStockMovement(ctx, tx, StockMovement{
+				StoreID: storeID, ProductID: productID, Kind: MovementReceipt, Quantity: accepted,
+				ReferenceType: MovementRefGoodsReceipt, ReferenceID: receipt.ID, CreatedBy: req.ReceivedBy,
+			})
+			if err != nil {
+				return err
+			}
+			restocked = append(restocked, StockIncreased{ProductID: productID, StoreID: storeID, Quantity: accepted})
+		}
+
+		var outstanding bool
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM supplier_order_items WHERE order_id = $1 AND received_quantity < quantity)", req.OrderID).Scan(&outstanding)
+		if err != nil {
+			return err
+		}
+		status = SupplierOrderReceived
+		if outstanding {
+			status = SupplierOrderPartiallyReceived
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE supplier_orders SET status = $1, updated_at = NOW() WHERE id = $2", status, req.OrderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.emitStockIncreased(ctx, restocked...)
+	return receipt, nil
+}
+
+// CloseSupplierOrder завершает частично принятый заказ, фиксируя недопоставку по каждой позиции
+func (s *SupplierOrderServiceImpl) CloseSupplierOrder(ctx context.Context, id int64) error {
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		status, _, err := lockSupplierOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if status != SupplierOrderOrdered && status != SupplierOrderPartiallyReceived {
+			return ErrSupplierOrderStatus
+		}
+
+		items, err := s.getOrderItems(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if shortage := item.Quantity - item.ReceivedQuantity; shortage > 0 {
+				if err := recordDiscrepancy(ctx, tx, id, 0, item.ID, DiscrepancyShortage, shortage, "недопоставка при закрытии заказа"); err != nil {
+					return err
+				}
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE supplier_orders SET status = $1, updated_at = NOW() WHERE id = $2", SupplierOrderClosed, id); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *SupplierOrderServiceImpl) GetProductMargin(ctx context.Context, productID int64) (*ProductMargin, error) {
+	margin := &ProductMargin{ProductID: productID}
+	err := s.db.QueryRowContext(ctx, "SELECT price, cost_price FROM products WHERE id = $1 AND deleted_at IS NULL", productID).Scan(&margin.Price, &margin.CostPrice)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("продукт не найден")
+		}
+		return nil, err
+	}
+
+	if margin.CostPrice != nil {
+		margin.Margin = roundMoney(margin.Price - *margin.CostPrice)
+		if margin.Price > 0 {
+			margin.MarginPercent = roundMoney(margin.Margin / margin.Price * 100)
+		}
+	}
+	return margin, nil
+}
+
+// updateCostPrice пересчитывает средневзвешенную закупочную цену с учётом уже имеющегося
+// во всех магазинах товара и сохраняет её в истории. Вызывается до увеличения остатков.
+func updateCostPrice(ctx context.Context, tx db.Querier, productID, receiptID int64, quantity int, unitCost float64) error {
+	var current sql.NullFloat64
+	if err := tx.QueryRowContext(ctx, "SELECT cost_price FROM products WHERE id = $1 FOR UPDATE", productID).Scan(&current); err != nil {
+		return err
+	}
+
+	var onHand int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(quantity), 0) FROM store_inventory WHERE product_id = $1", productID).Scan(&onHand); err != nil {
+		return err
+	}
+
+	cost := unitCost
+	if current.Valid && onHand > 0 {
+		cost = (current.Float64*float64(onHand) + unitCost*float64(quantity)) / float64(onHand+quantity)
+	}
+	cost = roundMoney(cost)
+
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET cost_price = $1 WHERE id = $2", cost, productID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO product_cost_history (product_id, receipt_id, unit_cost, cost_price) VALUES ($1, $2, $3, $4)", productID, receiptID, unitCost, cost)
+	return err
+}
+
+func recordDiscrepancy(ctx context.Context, tx db.Querier, orderID, receiptID, orderItemID int64, kind string, quantity int, note string) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO supplier_order_discrepancies (order_id, receipt_id, order_item_id, kind, quantity, note) VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)",
+		orderID, receiptID, orderItemID, kind, quantity, note)
+	return err
+}
+
+func lockSupplierOrder(ctx context.Context, tx db.Querier, id int64) (status string, storeID int64, err error) {
+	err = tx.QueryRowContext(ctx, "SELECT status, store_id FROM supplier_orders WHERE id = $1 FOR UPDATE", id).Scan(&status, &storeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, ErrSupplierOrderNotFound
+	}
+	return status, storeID, err
+}
+
+func (s *SupplierOrderServiceImpl) getOrderItems(ctx context.Context, q queryer, orderID int64) ([]SupplierOrderItem, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, product_id, quantity, unit_cost, received_quantity FROM supplier_order_items WHERE order_id = $1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []SupplierOrderItem{}
+	for rows.Next() {
+		var item SupplierOrderItem
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.UnitCost, &item.ReceivedQuantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *SupplierOrderServiceImpl) getReceipts(ctx context.Context, orderID int64) ([]GoodsReceipt, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT r.id, r.received_by, COALESCE(r.notes, ''), r.received_at, ri.order_item_id, ri.quantity, ri.damaged, COALESCE(ri.note, '')
+		FROM goods_receipts r JOIN goods_receipt_items ri ON ri.receipt_id = r.id
+		WHERE r.order_id = $1 ORDER BY r.received_at, r.id, ri.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []GoodsReceipt{}
+	for rows.Next() {
+		var receipt GoodsReceipt
+		var line GoodsReceiptLine
+		if err := rows.Scan(&receipt.ID, &receipt.ReceivedBy, &receipt.Notes, &receipt.ReceivedAt, &line.OrderItemID, &line.Quantity, &line.Damaged, &line.Note); err != nil {
+			return nil, err
+		}
+		if n := len(receipts); n > 0 && receipts[n-1].ID == receipt.ID {
+			receipts[n-1].Lines = append(receipts[n-1].Lines, line)
+			continue
+		}
+		receipt.OrderID = orderID
+		receipt.Lines = []GoodsReceiptLine{line}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+func (s *SupplierOrderServiceImpl) getDiscrepancies(ctx context.Context, orderID int64) ([]ReceiptDiscrepancy, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT d.id, COALESCE(d.receipt_id, 0), d.order_item_id, i.product_id, d.kind, d.quantity, COALESCE(d.note, ''), d.created_at
+		FROM supplier_order_discrepancies d JOIN supplier_order_items i ON i.id = d.order_item_id
+		WHERE d.order_id = $1 ORDER BY d.created_at, d.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := []ReceiptDiscrepancy{}
+	for rows.Next() {
+		var d ReceiptDiscrepancy
+		if err := rows.Scan(&d.ID, &d.ReceiptID, &d.OrderItemID, &d.ProductID, &d.Kind, &d.Quantity, &d.Note, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies, rows.Err()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+)
+
+var (
+	ErrSupplierNotFound = errors.New("поставщик не найден")
+	ErrSupplierInUse    = errors.New("у поставщика есть заказы, удалить его нельзя")
+)
+
+type Supplier struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name" validate:"required"`
+	ContactName string    `json:"contactName"`
+	Email       string    `json:"email" validate:"omitempty,email"`
+	Phone       string    `json:"phone"`
+	Address     string    `json:"address"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type SupplierService interface {
+	GetAllSuppliers(ctx context.Context) ([]Supplier, error)
+	GetSupplierByID(ctx context.Context, id int64) (*Supplier, error)
+	CreateSupplier(ctx context.Context, supplier Supplier) (*Supplier, error)
+	UpdateSupplier(ctx context.Context, supplier Supplier) error
+	DeleteSupplier(ctx context.Context, id int64) error
+}
+
+type SupplierServiceImpl struct {
+	db db.Conn // Ссылка на объект базы данных
+}
+
+func NewSupplierService(db db.Conn) *SupplierServiceImpl {
+	return &SupplierServiceImpl{
+		db: db,
+	}
+}
+
+const supplierColumns = "id, name, COALESCE(contact_name, ''), COALESCE(email, ''), COALESCE(phone, ''), COALESCE(address, ''), created_at, updated_at"
+
+func scanSupplier(row interface{ Scan(...any) error }, supplier *Supplier) error {
+	return row.Scan(&supplier.ID, &supplier.Name, &supplier.ContactName, &supplier.Email, &supplier.Phone, &supplier.Address, &supplier.CreatedAt, &supplier.UpdatedAt)
+}
+
+func (s *SupplierServiceImpl) GetAllSuppliers(ctx context.Context) ([]Supplier, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+supplierColumns+" FROM suppliers ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppliers := []Supplier{}
+	for rows.Next() {
+		var supplier Supplier
+		if err := scanSupplier(rows, &supplier); err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	return suppliers, rows.Err()
+}
+
+func (s *SupplierServiceImpl) GetSupplierByID(ctx context.Context, id int64) (*Supplier, error) {
+	var supplier Supplier
+	err := scanSupplier(s.db.QueryRowContext(ctx, "SELECT "+supplierColumns+" FROM suppliers WHERE id = $1", id), &supplier)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSupplierNotFound
+		}
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+func (s *SupplierServiceImpl) CreateSupplier(ctx context.Context, supplier Supplier) (*Supplier, error) {
+	err := s.db.QueryRowContext(ctx, "INSERT INTO suppliers (name, contact_name, email, phone, address) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at",
+		supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.Address).Scan(&supplier.ID, &supplier.CreatedAt, &supplier.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &supplier, nil
+}
+
+func (s *SupplierServiceImpl) UpdateSupplier(ctx context.Context, supplier Supplier) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE suppliers SET name = $1, contact_name = $2, email = $3, phone = $4, address = $5, updated_at = NOW() WHERE id = $6",
+		supplier.Name, supplier.ContactName, supplier.Email, supplier.Phone, supplier.Address, supplier.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrSupplierNotFound
+	}
+	return nil
+}
+
+// DeleteSupplier удаляет поставщика без заказов; поставщики с заказами нужны для истории закупок
+func (s *SupplierServiceImpl) DeleteSupplier(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM suppliers WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM supplier_orders so WHERE so.supplier_id = suppliers.id)", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	if _, err := s.GetSupplierByID(ctx, id); err != nil {
+		return err
+	}
+	return ErrSupplierInUse
+}
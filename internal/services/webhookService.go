@@ -0,0 +1,452 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/lib/pq"
+)
+
+// Статусы доставки вебхука
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead" // Исчерпаны попытки; доставку можно повторить вручную
+)
+
+const (
+	webhookBatchSize    = 20
+	webhookTimeout      = 10 * time.Second
+	webhookErrorBodyMax = 512
+	// Срок, на который DeliverPending забирает доставки: с запасом больше времени отправки всей пачки
+	webhookClaimLease = webhookBatchSize*webhookTimeout + time.Minute
+)
+
+// WebhookEventTypes - доменные события, на которые могут подписаться партнёры
+var WebhookEventTypes = []string{EventPurchaseCreated, EventPurchaseStatusChanged, EventDeliveryStatusChanged, EventStockChanged}
+
+var (
+	ErrWebhookNotFound         = errors.New("вебхук не найден")
+	ErrWebhookDeliveryNotFound = errors.New("доставка вебхука не найдена")
+)
+
+// Webhook - адрес партнёра, на который отправляются события выбранных типов.
+// Секрет используется для подписи запросов и возвращается только при создании.
+type Webhook struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url" validate:"required,url"`
+	EventTypes  []string  `json:"eventTypes" validate:"required,min=1,dive,oneof=purchase.created purchase.status_changed delivery.status_changed product.stock_changed"`
+	Secret      string    `json:"secret,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhookId"`
+	EventID        int64      `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode *int       `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// WebhookAttempt - одна попытка доставки в журнале: код ответа партнёра или ошибка соединения
+type WebhookAttempt struct {
+	ID          int64     `json:"id"`
+	DeliveryID  int64     `json:"deliveryId"`
+	StatusCode  *int      `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"durationMs"`
+	AttemptedAt time.Time `json:"attemptedAt"`
+}
+
+type WebhookDeliveryFilter struct {
+	WebhookID int64
+	Status    string
+	Limit     int
+}
+
+type WebhookService interface {
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	CreateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]WebhookDelivery, error)
+	GetDeliveryAttempts(ctx context.Context, deliveryID int64) ([]WebhookAttempt, error)
+	Redeliver(ctx context.Context, deliveryID int64) error
+	HandleEvent(ctx context.Context, tx db.Querier, event DomainEvent) error
+	DeliverPending(ctx context.Context) (int, error)
+	RunDeliveryWorker(ctx context.Context, interval time.Duration)
+}
+
+type WebhookServiceImpl struct {
+	db          db.Conn // Ссылка на объект базы данных
+	client      *http.Client
+	maxAttempts int // После стольких неудачных попыток доставка попадает в список dead
+}
+
+func NewWebhookService(db db.Conn, maxAttempts int) *WebhookServiceImpl {
+	return &WebhookServiceImpl{
+		db:          db,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: maxAttempts,
+	}
+}
+
+func (s *WebhookServiceImpl) GetWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, url, event_types, COALESCE(description, ''), active, created_at, updated_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var wh Webhook
+		if err := rows.Scan(&wh.ID, &wh.URL, pq.Array(&wh.EventTypes), &wh.Description, &wh.Active, &wh.CreatedAt, &wh.UpdatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, wh)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// CreateWebhook регистрирует вебхук. Если секрет не передан, он генерируется.
+func (s *WebhookServiceImpl) CreateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	if webhook.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		webhook.Secret = secret
+	}
+
+	err := s.db.QueryRowContext(ctx, `INSERT INTO webhooks (url, event_types, secret, description, active) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING id, created_at, updated_at`,
+		webhook.URL, pq.Array(webhook.EventTypes), webhook.Secret, webhook.Description, webhook.Active).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// UpdateWebhook меняет настройки вебхука. Пустой секрет оставляет прежний.
+func (s *WebhookServiceImpl) UpdateWebhook(ctx context.Context, webhook Webhook) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE webhooks SET url = $1, event_types = $2, secret = COALESCE(NULLIF($3, ''), secret),
+			description = NULLIF($4, ''), active = $5, updated_at = NOW()
+		WHERE id = $6`,
+		webhook.URL, pq.Array(webhook.EventTypes), webhook.Secret, webhook.Description, webhook.Active, webhook.ID)
+	if err != nil {
+		return err
+	}
+	return webhookAffected(result)
+}
+
+// DeleteWebhook удаляет вебхук вместе с очередью и журналом его доставок
+func (s *WebhookServiceImpl) DeleteWebhook(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return webhookAffected(result)
+}
+
+func webhookAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+const webhookDeliveryColumns = "id, webhook_id, event_id, event_type, status, attempts, last_status_code, COALESCE(last_error, ''), next_attempt_at, created_at, delivered_at"
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }, d *WebhookDelivery) error {
+	return row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt)
+}
+
+// GetDeliveries возвращает журнал доставок; со статусом dead - список недоставленных
+func (s *WebhookServiceImpl) GetDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+webhookDeliveryColumns+` FROM webhook_deliveries
+		WHERE ($1 = 0 OR webhook_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3`, filter.WebhookID, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (s *WebhookServiceImpl) GetDeliveryAttempts(ctx context.Context, deliveryID int64) ([]WebhookAttempt, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, delivery_id, status_code, COALESCE(error, ''), duration_ms, attempted_at
+		FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.StatusCode, &a.Error, &a.DurationMs, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+// Redeliver ставит доставку в очередь заново - например, недоставленную или потерянную партнёром.
+// Журнал прежних попыток сохраняется.
+func (s *WebhookServiceImpl) Redeliver(ctx context.Context, deliveryID int64) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = NOW() WHERE id = $2",
+		WebhookDeliveryPending, deliveryID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// webhookPayload - тело запроса к партнёру. ID события одинаков во всех повторах,
+// по нему партнёр отбрасывает дубликаты.
+type webhookPayload struct {
+	ID        int64           `json:"id,string"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// HandleEvent ставит событие в очередь доставки всем активным вебхукам, подписанным на его тип.
+// Вызывается диспетчером доменных событий в его транзакции.
+func (s *WebhookServiceImpl) HandleEvent(ctx context.Context, tx db.Querier, event DomainEvent) error {
+	body, err := json.Marshal(webhookPayload{ID: event.ID, Type: event.Type, CreatedAt: event.CreatedAt, Data: event.Payload})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, body)
+		SELECT id, $1, $2, $3 FROM webhooks WHERE active AND $2 = ANY(event_types)
+		ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+		event.ID, event.Type, string(body))
+	return err
+}
+
+type pendingWebhook struct {
+	delivery WebhookDelivery
+	url      string
+	secret   string
+	body     string
+}
+
+// DeliverPending отправляет доставки, время попытки которых наступило. Доставки сначала
+// забираются одним запросом (SKIP LOCKED): их next_attempt_at сдвигается на webhookClaimLease,
+// поэтому другие экземпляры сервиса их не возьмут, а если процесс упадёт, доставки вернутся
+// в очередь по истечении этого срока. Запросы к партнёрам выполняются вне транзакций;
+// результат каждой попытки фиксируется в своей короткой транзакции.
+// Доставки отключённых вебхуков ждут их включения. Возвращает число успешных доставок.
+func (s *WebhookServiceImpl) DeliverPending(ctx context.Context) (int, error) {
+	batch, err := s.claimPending(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	var errs []error
+	for _, p := range batch {
+		started := time.Now()
+		statusCode, sendErr := s.send(ctx, p)
+		if err := s.recordAttempt(ctx, p, statusCode, sendErr, time.Since(started)); err != nil {
+			errs = append(errs, fmt.Errorf("доставка %d: %w", p.delivery.ID, err))
+			continue
+		}
+		if sendErr == nil {
+			delivered++
+		} else {
+			slog.WarnContext(ctx, "не удалось доставить вебхук", "delivery_id", p.delivery.ID, "url", p.url, "attempt", p.delivery.Attempts+1, "error", sendErr)
+		}
+	}
+
+	return delivered, errors.Join(errs...)
+}
+
+// claimPending забирает пачку доставок, время попытки которых наступило
+func (s *WebhookServiceImpl) claimPending(ctx context.Context) ([]pendingWebhook, error) {
+	rows, err := s.db.QueryContext(ctx, `WITH claimed AS (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = $1 AND d.next_attempt_at <= NOW() AND w.active
+			ORDER BY d.next_attempt_at, d.id
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at = $3
+		FROM claimed, webhooks w
+		WHERE d.id = claimed.id AND w.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.status, d.attempts, d.last_status_code, COALESCE(d.last_error, ''),
+			d.next_attempt_at, d.created_at, d.delivered_at, w.url, w.secret, d.body`,
+		WebhookDeliveryPending, webhookBatchSize, time.Now().Add(webhookClaimLease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []pendingWebhook
+	for rows.Next() {
+		var p pendingWebhook
+		d := &p.delivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError,
+			&d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt, &p.url, &p.secret, &p.body); err != nil {
+			return nil, err
+		}
+		batch = append(batch, p)
+	}
+
+	return batch, rows.Err()
+}
+
+// recordAttempt записывает попытку в журнал и обновляет доставку в одной транзакции.
+// Если срок захвата истёк и доставку уже обработал другой экземпляр (attempts изменился),
+// статус не трогается - попадает только запись журнала.
+func (s *WebhookServiceImpl) recordAttempt(ctx context.Context, p pendingWebhook, statusCode int, sendErr error, duration time.Duration) error {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	var errText *string
+	if sendErr != nil {
+		text := sendErr.Error()
+		errText = &text
+	}
+
+	return s.db.WithTx(ctx, func(tx db.Querier) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms) VALUES ($1, $2, $3, $4)",
+			p.delivery.ID, code, errText, duration.Milliseconds())
+		if err != nil {
+			return err
+		}
+
+		attempts := p.delivery.Attempts + 1
+		if sendErr == nil {
+			_, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET status = $1, attempts = $2, last_status_code = $3, last_error = NULL, delivered_at = NOW() WHERE id = $4 AND status = $5 AND attempts = $6",
+				WebhookDeliveryDelivered, attempts, code, p.delivery.ID, WebhookDeliveryPending, p.delivery.Attempts)
+		} else {
+			status := WebhookDeliveryPending
+			if attempts >= s.maxAttempts {
+				status = WebhookDeliveryDead
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET status = $1, attempts = $2, last_status_code = $3, last_error = $4, next_attempt_at = $5 WHERE id = $6 AND status = $7 AND attempts = $8",
+				status, attempts, code, *errText, time.Now().Add(outboxRetryDelay(attempts)), p.delivery.ID, WebhookDeliveryPending, p.delivery.Attempts)
+		}
+		return err
+	})
+}
+
+// send отправляет подписанный запрос. Подпись - HMAC-SHA256 от "<timestamp>.<тело>" с секретом вебхука,
+// передаётся в заголовке X-Webhook-Signature как "t=<timestamp>,v1=<hex>". Метка времени в подписи
+// позволяет партнёру отбрасывать перехваченные и повторённые злоумышленником запросы.
+// Возвращает код ответа (0, если ответа не было) и ошибку, если доставка не удалась.
+func (s *WebhookServiceImpl) send(ctx context.Context, p pendingWebhook) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write([]byte(timestamp + "." + p.body))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader([]byte(p.body)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "VapeShop-Webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", p.delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(p.delivery.ID, 10))
+	req.Header.Set("X-Webhook-Signature", "t="+timestamp+",v1="+signature)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyMax))
+		return resp.StatusCode, fmt.Errorf("ответ %d: %s", resp.StatusCode, body)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookErrorBodyMax))
+	return resp.StatusCode, nil
+}
+
+// RunDeliveryWorker периодически вызывает DeliverPending, пока не отменён ctx
+func (s *WebhookServiceImpl) RunDeliveryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Отправляем пачками, пока очередь не опустеет
+			for {
+				n, err := s.DeliverPending(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "ошибка доставки вебхуков", "error", err)
+					break
+				}
+				if n < webhookBatchSize {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliverPending(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Подпись проверяется так же, как у партнёра
+		ts, v1, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("X-Webhook-Signature"), "t="), ",v1=")
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(ts + `.{"id":"1"}`))
+		if v1 != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/fail" {
+			http.Error(w, "упал", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		attempts   int64
+		wantSent   int
+		wantStatus string
+	}{
+		{"доставлено", "/ok", 0, 1, WebhookDeliveryDelivered},
+		{"ошибка партнёра - повтор позже", "/fail", 0, 0, WebhookDeliveryPending},
+		{"последняя попытка", "/fail", 2, 0, WebhookDeliveryDead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, conn := newSQLStub(t)
+			var lease time.Time
+			stub.on("WITH claimed AS", func(args []any) (*stubRows, error) {
+				lease = args[2].(time.Time)
+				return rowsOf([]string{"id", "webhook_id", "event_id", "event_type", "status", "attempts", "last_status_code", "last_error", "next_attempt_at", "created_at", "delivered_at", "url", "secret", "body"},
+					[]driver.Value{int64(5), int64(1), int64(1), EventPurchaseCreated, WebhookDeliveryPending, tt.attempts, nil, "", lease, time.Now(), nil, srv.URL + tt.path, "secret", `{"id":"1"}`}), nil
+			})
+
+			s := NewWebhookService(stubUnitOfWork{conn}, 3)
+			sent, err := s.DeliverPending(context.Background())
+			if err != nil {
+				t.Fatalf("DeliverPending() error = %v", err)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("sent = %d, want %d", sent, tt.wantSent)
+			}
+			if time.Until(lease) < webhookBatchSize*webhookTimeout {
+				t.Errorf("доставки забраны до %v - меньше времени отправки пачки", lease)
+			}
+			if len(stub.executed("INSERT INTO webhook_delivery_attempts")) != 1 {
+				t.Error("попытка не записана в журнал")
+			}
+			updates := stub.executed("UPDATE webhook_deliveries SET status")
+			if len(updates) != 1 || updates[0].args[0] != tt.wantStatus {
+				t.Fatalf("обновления = %+v, want статус %s", updates, tt.wantStatus)
+			}
+			// Обновление учитывает, что доставку мог забрать другой экземпляр после истечения срока
+			if last := updates[0].args[len(updates[0].args)-1]; last != int(tt.attempts) {
+				t.Errorf("условие attempts = %v, want %d", last, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoragePutDelete(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, "/uploads/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := s.Put(ctx, "products/7/main.jpg", strings.NewReader("jpeg"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if url != "/uploads/products/7/main.jpg" {
+		t.Errorf("url = %q", url)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, "products", "7", "main.jpg"))
+	if err != nil || string(body) != "jpeg" {
+		t.Fatalf("файл = %q, %v", body, err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "products", "7"))
+	if len(entries) != 1 {
+		t.Errorf("в каталоге остались временные файлы: %v", entries)
+	}
+
+	if err := s.Delete(ctx, "products/7/main.jpg"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "products", "7", "main.jpg")); !os.IsNotExist(err) {
+		t.Errorf("файл не удалён: %v", err)
+	}
+	if err := s.Delete(ctx, "products/7/main.jpg"); err != nil {
+		t.Errorf("повторный Delete() error = %v", err)
+	}
+}
+
+func TestLocalStoragePath(t *testing.T) {
+	s := &LocalStorage{dir: "/srv/uploads"}
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{"products/1/a.jpg", "/srv/uploads/products/1/a.jpg", false},
+		{"../../etc/passwd", "/srv/uploads/etc/passwd", false},
+		{"products/../../../a.jpg", "/srv/uploads/a.jpg", false},
+		{"/abs/a.jpg", "/srv/uploads/abs/a.jpg", false},
+		{"", "", true},
+		{"..", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := s.path(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("path(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("path(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
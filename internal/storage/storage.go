@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Storage - хранилище загружаемых файлов (изображений товаров и т.п.)
+type Storage interface {
+	// Put сохраняет содержимое под ключом key и возвращает публичный URL файла
+	Put(ctx context.Context, key string, body io.Reader, contentType string) (string, error)
+	// Delete удаляет файл. Отсутствие файла ошибкой не считается.
+	Delete(ctx context.Context, key string) error
+	// URL возвращает публичный URL файла по ключу
+	URL(key string) string
+}
@@ -0,0 +1,360 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Форматы таблиц для импорта и экспорта
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var ErrUnsupportedFormat = errors.New("неподдерживаемый формат таблицы")
+
+// ReadTable читает первую таблицу файла в виде строк. Для CSV разделитель
+// (запятая или точка с запятой, как сохраняет русский Excel) определяется по первой строке.
+func ReadTable(r io.Reader, format string) ([][]string, error) {
+	switch format {
+	case FormatCSV:
+		return readCSV(r)
+	case FormatXLSX:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return readXLSX(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	// BOM, который добавляет Excel при сохранении в UTF-8
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	if first, _ := br.Peek(br.Size()); len(first) > 0 {
+		line, _, _ := bytes.Cut(first, []byte("\n"))
+		if bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+			reader.Comma = ';'
+		}
+	}
+	return reader.ReadAll()
+}
+
+type xlsxRelationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var sb strings.Builder
+	for _, run := range t.Runs {
+		sb.WriteString(run.Text)
+	}
+	return sb.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string        `xml:"r,attr"`
+			Type   string        `xml:"t,attr"`
+			Value  string        `xml:"v"`
+			Inline *xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX читает первый лист книги. Поддерживаются общие и встроенные строки,
+// числа и логические значения; формулы отдаются последним вычисленным значением.
+func readXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxRichText `xml:"si"`
+		}
+		if err := decodeZipXML(f, &sst); err != nil {
+			return nil, err
+		}
+		for _, item := range sst.Items {
+			shared = append(shared, item.String())
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+	var sheet xlsxSheet
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	table := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		var cells []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = columnIndex(cell.Ref)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(shared) {
+					return nil, errors.New("повреждённая ссылка на строку в " + cell.Ref)
+				}
+				cells[col] = shared[idx]
+			case "inlineStr":
+				if cell.Inline != nil {
+					cells[col] = cell.Inline.String()
+				}
+			default:
+				cells[col] = cell.Value
+			}
+		}
+		table = append(table, cells)
+	}
+	return table, nil
+}
+
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	workbook, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", ErrUnsupportedFormat
+	}
+	var wb xlsxWorkbook
+	if err := decodeZipXML(workbook, &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", errors.New("в книге нет листов")
+	}
+
+	rels, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return "xl/worksheets/sheet1.xml", nil
+	}
+	var rel xlsxRelationships
+	if err := decodeZipXML(rels, &rel); err != nil {
+		return "", err
+	}
+	for _, item := range rel.Items {
+		if item.ID == wb.Sheets[0].RelID {
+			if strings.HasPrefix(item.Target, "/") {
+				return strings.TrimPrefix(item.Target, "/"), nil
+			}
+			return path.Join("xl", item.Target), nil
+		}
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// columnIndex переводит ссылку на ячейку ("C12") в номер столбца с нуля
+func columnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
+
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// TableWriter построчно пишет таблицу, не держа её целиком в памяти
+type TableWriter interface {
+	WriteRow(row []string) error
+	Close() error
+}
+
+// NewTableWriter создаёт запись таблицы в нужном формате
+func NewTableWriter(w io.Writer, format string) (TableWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvTableWriter{w: csv.NewWriter(w)}, nil
+	case FormatXLSX:
+		return newXLSXTableWriter(w)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+type csvTableWriter struct {
+	w *csv.Writer
+}
+
+func (t *csvTableWriter) WriteRow(row []string) error {
+	if err := t.w.Write(row); err != nil {
+		return err
+	}
+	t.w.Flush()
+	return t.w.Error()
+}
+
+func (t *csvTableWriter) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+// xlsxTableWriter пишет минимальную книгу с одним листом. Лист - последний файл архива,
+// поэтому строки можно отдавать в ответ по мере чтения из базы.
+type xlsxTableWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+func newXLSXTableWriter(w io.Writer) (*xlsxTableWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+	return &xlsxTableWriter{zw: zw, sheet: sheet}, nil
+}
+
+func (t *xlsxTableWriter) WriteRow(row []string) error {
+	t.rows++
+	var buf bytes.Buffer
+	rowNum := strconv.Itoa(t.rows)
+	buf.WriteString(`<row r="` + rowNum + `">`)
+	for col, value := range row {
+		ref := columnName(col) + rowNum
+		if isPlainNumber(value) {
+			buf.WriteString(`<c r="` + ref + `"><v>` + value + `</v></c>`)
+			continue
+		}
+		buf.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(&buf, []byte(value)); err != nil {
+			return err
+		}
+		buf.WriteString(`</t></is></c>`)
+	}
+	buf.WriteString(`</row>`)
+
+	if _, err := t.sheet.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return t.zw.Flush()
+}
+
+// isPlainNumber сообщает, можно ли записать значение числом. Значения с ведущими нулями
+// (артикулы, индексы) остаются строками, иначе Excel их обрежет.
+func isPlainNumber(value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "" || strings.Trim(digits, "0123456789.") != "" || strings.Count(digits, ".") > 1 {
+		return false
+	}
+	if digits[0] == '.' || digits[len(digits)-1] == '.' {
+		return false
+	}
+	return !(len(digits) > 1 && digits[0] == '0' && digits[1] != '.')
+}
+
+func (t *xlsxTableWriter) Close() error {
+	if _, err := io.WriteString(t.sheet, xlsxSheetFooter); err != nil {
+		return err
+	}
+	return t.zw.Close()
+}
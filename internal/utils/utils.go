@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+var ErrWebPUnavailable = errors.New("кодировщик WebP (cwebp) не найден")
+
+// Thumbnail уменьшает изображение так, чтобы большая сторона не превышала maxSide.
+// Используется усреднение по площади, поэтому мелкие детали не «рвутся» при сильном уменьшении.
+// Изображения меньше maxSide возвращаются без изменений.
+func Thumbnail(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxSide && h <= maxSide {
+		return src
+	}
+
+	dw, dh := maxSide, h*maxSide/w
+	if h > w {
+		dw, dh = w*maxSide/h, maxSide
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := bounds.Min.Y + y*h/dh
+		y1 := bounds.Min.Y + (y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0 := bounds.Min.X + x*w/dw
+			x1 := bounds.Min.X + (x+1)*w/dw
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG кодирует изображение в JPEG
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeWebP конвертирует исходный файл в WebP утилитой cwebp. В стандартной библиотеке
+// нет кодировщика WebP, поэтому при отсутствии cwebp возвращается ErrWebPUnavailable.
+func EncodeWebP(src []byte, quality int) ([]byte, error) {
+	bin, err := exec.LookPath("cwebp")
+	if err != nil {
+		return nil, ErrWebPUnavailable
+	}
+
+	in, err := os.CreateTemp("", "webp-in-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(in.Name())
+	if _, err := in.Write(src); err != nil {
+		in.Close()
+		return nil, err
+	}
+	if err := in.Close(); err != nil {
+		return nil, err
+	}
+
+	out := in.Name() + ".webp"
+	defer os.Remove(out)
+
+	cmd := exec.Command(bin, "-quiet", "-q", strconv.Itoa(quality), in.Name(), "-o", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, errors.New("cwebp: " + err.Error() + ": " + string(output))
+	}
+	return os.ReadFile(out)
+}
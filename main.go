@@ -1,49 +1,602 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Dmitriy4565/VapeShop/internal/cache"
+	"github.com/Dmitriy4565/VapeShop/internal/config"
+	"github.com/Dmitriy4565/VapeShop/internal/controllers"
 	"github.com/Dmitriy4565/VapeShop/internal/db"
+	"github.com/Dmitriy4565/VapeShop/internal/logging"
+	"github.com/Dmitriy4565/VapeShop/internal/metrics"
+	"github.com/Dmitriy4565/VapeShop/internal/notify"
+	"github.com/Dmitriy4565/VapeShop/internal/payments"
+	"github.com/Dmitriy4565/VapeShop/internal/repository"
 	"github.com/Dmitriy4565/VapeShop/internal/services"
+	"github.com/Dmitriy4565/VapeShop/internal/storage"
 	"github.com/gin-gonic/gin" // Используем Gin для HTTP-обработки
 )
 
 type Server struct {
 	router          *gin.Engine
 	categoryService services.CategoryService
+	cfg             *config.Config
+	workers         []func(ctx context.Context) // Фоновые обработчики; работают до отмены ctx
 }
 
-func NewServer(db *db.DB) *Server {
-	router := gin.Default()
+func main() {
+	cfg := config.Load()
+	logging.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat)
 
-	categoryService := services.NewCategoryService(db)
+	// SIGINT/SIGTERM отменяют ctx: прерывают ожидание БД при запуске или запускают остановку сервера
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// После первого сигнала возвращаем обработку по умолчанию: повторный сигнал завершит процесс сразу
+		<-ctx.Done()
+		stop()
+	}()
 
-	categoryController := NewCategoryController(categoryService)
+	// Реестр метрик создаётся до подключения к БД: пул передаёт в него время запросов
+	registry := metrics.NewRegistry()
+	queryDuration := registry.NewHistogram("db_query_duration_seconds",
+		"Время SQL-запросов (для query - до получения первых строк)", metrics.DefBuckets, "operation")
 
-	router.GET("/categories", categoryController.GetCategoriesHandler)
+	database, err := db.NewDB(ctx, cfg.DatabaseURL, cfg.DatabaseReplicaURLs, db.PoolConfig{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DBConnMaxIdleTime,
+		ConnectTimeout:  cfg.DBConnectTimeout,
+
+		SlowQueryThreshold: cfg.DBSlowQueryThreshold,
+		ObserveQuery: func(op string, duration time.Duration) {
+			queryDuration.Observe(duration.Seconds(), op)
+		},
+	})
+	if err != nil {
+		slog.Error("подключение к базе данных", "error", err)
+		os.Exit(1)
+	}
+
+	server, err := NewServer(database, cfg, registry)
+	if err != nil {
+		database.Close()
+		slog.Error("запуск сервера", "error", err)
+		os.Exit(1)
+	}
+	if err := server.Run(ctx); err != nil {
+		slog.Error("сервер остановлен", "error", err)
+	}
+
+	// База данных закрывается последней, когда запросы и фоновые обработчики уже завершены
+	if err := database.Close(); err != nil {
+		slog.Error("закрытие базы данных", "error", err)
+	}
+}
+
+func NewServer(db *db.DB, cfg *config.Config, registry *metrics.Registry) (*Server, error) {
+	// Вместо access-лога gin строку о каждом запросе пишет logging.Middleware.
+	// withMetrics и logging.Middleware стоят перед gin.Recovery, чтобы учесть и записать в лог
+	// запросы, завершившиеся паникой, вместе с их request_id.
+	router := gin.New()
+	router.Use(withMetrics(registry), logging.Middleware(), gin.Recovery(), withDBSession())
+
+	registerPoolMetrics(registry, db)
+	shopMetrics := services.NewShopMetrics(registry)
+	router.GET("/metrics", gin.WrapF(metricsHandler(registry, cfg.MetricsToken)))
+
+	healthController := controllers.NewHealthController(db, cfg.DBReadyTimeout)
+
+	router.GET("/healthz", gin.WrapF(healthController.HealthzHandler))
+	router.GET("/readyz", gin.WrapF(healthController.ReadyzHandler))
+	router.GET("/admin/db/stats", gin.WrapF(healthController.GetPoolStatsHandler))
+
+	notificationService := services.NewNotificationService(db, newNotifiers(cfg), cfg.NotificationMaxAttempts)
+	notificationController := controllers.NewNotificationController(notificationService)
+
+	router.GET("/customers/notification-preferences", gin.WrapF(notificationController.GetPreferencesHandler))
+	router.PUT("/customers/notification-preferences", gin.WrapF(notificationController.SetPreferencesHandler))
+	router.GET("/admin/notifications", gin.WrapF(notificationController.GetOutboxHandler))
+	router.POST("/admin/notifications/retry", gin.WrapF(notificationController.RetryMessageHandler))
+
+	categoryRepository := repository.NewCategoryRepository(db, db.Reader())
+	productRepository := repository.NewProductRepository(db, db.Reader())
+	purchaseRepository := repository.NewPurchaseRepository(db)
+	purchaseService := services.NewPurchaseService(db, purchaseRepository, productRepository, shopMetrics, cfg.CheckoutAbandonAfter)
+
+	catalogCache := services.NewCatalogCache(newCache(cfg), cfg.CacheTTL)
+
+	categoryService := services.NewCategoryService(db, categoryRepository, catalogCache)
+	categoryController := controllers.NewCategoryController(categoryService)
+
+	router.GET("/categories", gin.WrapF(categoryController.GetCategoriesHandler))
+	router.GET("/categories/tree", gin.WrapF(categoryController.GetCategoryTreeHandler))
+	router.POST("/categories", gin.WrapF(categoryController.CreateCategoryHandler))
+	router.PUT("/categories", gin.WrapF(categoryController.UpdateCategoryHandler))
+	router.POST("/categories/move", gin.WrapF(categoryController.MoveCategoryHandler))
+	router.DELETE("/categories", gin.WrapF(categoryController.DeleteCategoryHandler))
+	router.POST("/categories/restore", gin.WrapF(categoryController.RestoreCategoryHandler))
+
+	productService := services.NewProductService(db, productRepository, categoryRepository, catalogCache)
+	productController := controllers.NewProductController(productService)
+
+	router.GET("/products", gin.WrapF(productController.GetProductsHandler))
+	router.GET("/products/by-id", gin.WrapF(productController.GetProductByIDHandler))
+	router.GET("/products/by-category", gin.WrapF(productController.GetProductsByCategoryHandler))
+	router.POST("/products", gin.WrapF(productController.CreateProductHandler))
+	router.PUT("/products", gin.WrapF(productController.UpdateProductHandler))
+	router.DELETE("/products", gin.WrapF(productController.DeleteProductHandler))
+	router.POST("/products/restore", gin.WrapF(productController.RestoreProductHandler))
+
+	variantService := services.NewProductVariantService(db, productService)
+	variantController := controllers.NewProductVariantController(variantService)
+
+	router.GET("/products/:id/page", withPathParams(variantController.GetProductPageHandler))
+	router.GET("/products/variants", gin.WrapF(variantController.GetVariantsHandler))
+	router.POST("/products/variants", gin.WrapF(variantController.CreateVariantHandler))
+	router.PUT("/products/variants", gin.WrapF(variantController.UpdateVariantHandler))
+	router.PUT("/products/variants/stock", gin.WrapF(variantController.SetVariantStockHandler))
+	router.DELETE("/products/variants", gin.WrapF(variantController.DeleteVariantHandler))
+
+	fileStorage, err := newStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.StorageDriver == "local" {
+		router.Static(cfg.UploadURL, cfg.UploadDir)
+	}
+
+	imageService := services.NewProductImageService(db, fileStorage)
+	imageController := controllers.NewProductImageController(imageService)
+
+	router.GET("/products/images", gin.WrapF(imageController.GetImagesHandler))
+	router.POST("/products/images", gin.WrapF(imageController.UploadImagesHandler))
+	router.PUT("/products/images/order", gin.WrapF(imageController.ReorderImagesHandler))
+	router.DELETE("/products/images", gin.WrapF(imageController.DeleteImageHandler))
+
+	importService := services.NewCatalogImportService(db)
+	importController := controllers.NewCatalogImportController(importService)
+
+	router.POST("/admin/products/import", gin.WrapF(importController.ImportProductsHandler))
+	router.GET("/admin/products/export", gin.WrapF(importController.ExportProductsHandler))
+
+	supplierService := services.NewSupplierService(db)
+	supplierController := controllers.NewSupplierController(supplierService)
+
+	router.GET("/suppliers", gin.WrapF(supplierController.GetSuppliersHandler))
+	router.GET("/suppliers/by-id", gin.WrapF(supplierController.GetSupplierByIDHandler))
+	router.POST("/suppliers", gin.WrapF(supplierController.CreateSupplierHandler))
+	router.PUT("/suppliers", gin.WrapF(supplierController.UpdateSupplierHandler))
+	router.DELETE("/suppliers", gin.WrapF(supplierController.DeleteSupplierHandler))
+
+	supplierOrderService := services.NewSupplierOrderService(db)
+	supplierOrderController := controllers.NewSupplierOrderController(supplierOrderService)
+
+	router.GET("/supplier-orders", gin.WrapF(supplierOrderController.GetSupplierOrdersHandler))
+	router.POST("/supplier-orders", gin.WrapF(supplierOrderController.CreateSupplierOrderHandler))
+	router.POST("/supplier-orders/submit", gin.WrapF(supplierOrderController.SubmitSupplierOrderHandler))
+	router.POST("/supplier-orders/cancel", gin.WrapF(supplierOrderController.CancelSupplierOrderHandler))
+	router.POST("/supplier-orders/close", gin.WrapF(supplierOrderController.CloseSupplierOrderHandler))
+	router.POST("/supplier-orders/receive", gin.WrapF(supplierOrderController.ReceiveGoodsHandler))
+	router.GET("/products/margin", gin.WrapF(supplierOrderController.GetProductMarginHandler))
+
+	stockService := services.NewStockService(db)
+	stockController := controllers.NewStockController(stockService)
+
+	router.GET("/stock/movements", gin.WrapF(stockController.GetMovementsHandler))
+	router.POST("/stock/transfer", gin.WrapF(stockController.TransferStockHandler))
+	router.POST("/stock/write-off", gin.WrapF(stockController.WriteOffHandler))
+	router.GET("/stock/reconcile", gin.WrapF(stockController.ReconcileHandler))
+
+	stocktakeService := services.NewStocktakeService(db)
+	stocktakeController := controllers.NewStocktakeController(stocktakeService)
+
+	router.GET("/stocktakes", gin.WrapF(stocktakeController.GetStocktakeHandler))
+	router.POST("/stocktakes", gin.WrapF(stocktakeController.StartStocktakeHandler))
+	router.POST("/stocktakes/counts", gin.WrapF(stocktakeController.SubmitCountsHandler))
+	router.GET("/stocktakes/variance", gin.WrapF(stocktakeController.GetVarianceReportHandler))
+	router.POST("/stocktakes/complete", gin.WrapF(stocktakeController.CompleteStocktakeHandler))
+	router.POST("/stocktakes/cancel", gin.WrapF(stocktakeController.CancelStocktakeHandler))
+
+	reorderService := services.NewReorderService(db, cfg.ReorderAlertRecipient, cfg.SalesVelocityDays, shopMetrics)
+	reorderController := controllers.NewReorderController(reorderService)
+
+	router.GET("/admin/reorder-levels", gin.WrapF(reorderController.GetReorderLevelsHandler))
+	router.PUT("/admin/reorder-levels", gin.WrapF(reorderController.SetReorderLevelHandler))
+	router.DELETE("/admin/reorder-levels", gin.WrapF(reorderController.DeleteReorderLevelHandler))
+	router.GET("/admin/reorder-suggestions", gin.WrapF(reorderController.GetReorderSuggestionsHandler))
+
+	manufacturerService := services.NewManufacturerService(repository.NewManufacturerRepository(db, db.Reader()), db.Reader(), catalogCache)
+	manufacturerController := controllers.NewManufacturerController(manufacturerService)
+
+	router.GET("/manufacturers", gin.WrapF(manufacturerController.GetManufacturersHandler))
+	router.GET("/manufacturers/by-id", gin.WrapF(manufacturerController.GetManufacturerByIDHandler))
+	router.GET("/manufacturers/:id/summary", withPathParams(manufacturerController.GetManufacturerSummaryHandler))
+	router.POST("/manufacturers", gin.WrapF(manufacturerController.CreateManufacturerHandler))
+	router.PUT("/manufacturers", gin.WrapF(manufacturerController.UpdateManufacturerHandler))
+	router.DELETE("/manufacturers", gin.WrapF(manufacturerController.DeleteManufacturerHandler))
+	router.POST("/manufacturers/restore", gin.WrapF(manufacturerController.RestoreManufacturerHandler))
+
+	storeService := services.NewStoreService(repository.NewStoreRepository(db))
+	storeController := controllers.NewStoreController(storeService)
+
+	router.GET("/stores", gin.WrapF(storeController.GetStoresHandler))
+	router.GET("/stores/by-id", gin.WrapF(storeController.GetStoreByIDHandler))
+	router.POST("/stores", gin.WrapF(storeController.CreateStoreHandler))
+	router.PUT("/stores", gin.WrapF(storeController.UpdateStoreHandler))
+	router.DELETE("/stores", gin.WrapF(storeController.DeleteStoreHandler))
+	router.POST("/stores/restore", gin.WrapF(storeController.RestoreStoreHandler))
+
+	customerService := services.NewCustomerService(db, repository.NewCustomerRepository(db))
+	customerController := controllers.NewCustomerController(customerService)
+
+	router.GET("/customers", gin.WrapF(customerController.GetCustomersHandler))
+	router.GET("/customers/by-id", gin.WrapF(customerController.GetCustomerByIDHandler))
+	router.POST("/customers", gin.WrapF(customerController.CreateCustomerHandler))
+	router.PUT("/customers", gin.WrapF(customerController.UpdateCustomerHandler))
+	router.DELETE("/customers", gin.WrapF(customerController.DeleteCustomerHandler))
+	router.POST("/customers/restore", gin.WrapF(customerController.RestoreCustomerHandler))
+
+	purchaseController := controllers.NewPurchaseController(purchaseService)
+
+	router.GET("/purchases", gin.WrapF(purchaseController.GetPurchasesHandler))
+	router.GET("/purchases/by-id", gin.WrapF(purchaseController.GetPurchaseByIDHandler))
+	router.POST("/purchases", gin.WrapF(purchaseController.CreatePurchaseHandler))
+	router.PUT("/purchases", gin.WrapF(purchaseController.UpdatePurchaseHandler))
+	router.DELETE("/purchases", gin.WrapF(purchaseController.DeletePurchaseHandler))
+
+	deliveryService := services.NewDeliveryService(db, repository.NewDeliveryRepository(db), purchaseRepository)
+	deliveryController := controllers.NewDeliveryController(deliveryService)
+
+	router.GET("/deliveries", gin.WrapF(deliveryController.GetDeliveriesHandler))
+	router.GET("/deliveries/by-id", gin.WrapF(deliveryController.GetDeliveryByIDHandler))
+	router.POST("/deliveries", gin.WrapF(deliveryController.CreateDeliveryHandler))
+	router.PUT("/deliveries", gin.WrapF(deliveryController.UpdateDeliveryHandler))
+	router.PUT("/deliveries/status", gin.WrapF(deliveryController.UpdateDeliveryStatusHandler))
+	router.DELETE("/deliveries", gin.WrapF(deliveryController.DeleteDeliveryHandler))
+
+	deliveryZoneService := services.NewDeliveryZoneService(db)
+	deliveryZoneController := controllers.NewDeliveryZoneController(deliveryZoneService)
+
+	router.POST("/delivery/quote", gin.WrapF(deliveryZoneController.QuoteHandler))
+	router.GET("/delivery/methods", gin.WrapF(deliveryZoneController.GetMethodsHandler))
+	router.POST("/delivery/methods", gin.WrapF(deliveryZoneController.CreateMethodHandler))
+	router.GET("/delivery/zones", gin.WrapF(deliveryZoneController.GetZonesHandler))
+	router.POST("/delivery/zones", gin.WrapF(deliveryZoneController.CreateZoneHandler))
+	router.DELETE("/delivery/zones", gin.WrapF(deliveryZoneController.DeleteZoneHandler))
+	router.GET("/delivery/rates", gin.WrapF(deliveryZoneController.GetRatesHandler))
+	router.POST("/delivery/rates", gin.WrapF(deliveryZoneController.CreateRateHandler))
+	router.DELETE("/delivery/rates", gin.WrapF(deliveryZoneController.DeleteRateHandler))
+
+	pickupService := services.NewPickupService(db, cfg.PickupHoldPeriod)
+	pickupController := controllers.NewPickupController(pickupService)
+
+	router.POST("/pickup", gin.WrapF(pickupController.CreatePickupOrderHandler))
+	router.GET("/pickup", gin.WrapF(pickupController.GetPickupOrderHandler))
+	router.POST("/pickup/collect", gin.WrapF(pickupController.CollectHandler))
+	router.DELETE("/pickup", gin.WrapF(pickupController.CancelHandler))
+
+	paymentService := services.NewPaymentService(db, payments.NewFakeProvider(cfg.PaymentWebhookSecret), cfg.Currency)
+	paymentController := controllers.NewPaymentController(paymentService)
+
+	router.POST("/payments", gin.WrapF(paymentController.CreatePaymentHandler))
+	router.GET("/payments", gin.WrapF(paymentController.GetPaymentsHandler))
+	router.POST("/payments/capture", gin.WrapF(paymentController.CaptureHandler))
+	router.POST("/payments/refund", gin.WrapF(paymentController.RefundHandler))
+	router.POST("/payments/webhook", gin.WrapF(paymentController.WebhookHandler))
+
+	returnService := services.NewReturnService(db, paymentService)
+	returnController := controllers.NewReturnController(returnService)
+
+	router.POST("/returns", gin.WrapF(returnController.CreateReturnHandler))
+	router.GET("/returns", gin.WrapF(returnController.GetReturnsHandler))
+	router.POST("/returns/approve", gin.WrapF(returnController.ApproveReturnHandler))
+	router.POST("/returns/reject", gin.WrapF(returnController.RejectReturnHandler))
+	router.POST("/returns/refund", gin.WrapF(returnController.RetryRefundHandler))
+	router.GET("/purchases/history", gin.WrapF(returnController.GetPurchaseHistoryHandler))
+
+	subscriptionService := services.NewProductSubscriptionService(db)
+	subscriptionController := controllers.NewProductSubscriptionController(subscriptionService)
+
+	router.GET("/subscriptions", gin.WrapF(subscriptionController.GetSubscriptionsHandler))
+	router.POST("/subscriptions", gin.WrapF(subscriptionController.SubscribeHandler))
+	router.DELETE("/subscriptions", gin.WrapF(subscriptionController.UnsubscribeHandler))
+
+	// Подписчики узнают о пополнении и снижении цены от всех сервисов, меняющих остатки и цены
+	productService.OnPriceChanged(subscriptionService.HandlePriceChanged)
+	variantService.OnPriceChanged(subscriptionService.HandlePriceChanged)
+	variantService.OnStockIncreased(subscriptionService.HandleStockIncreased)
+	importService.OnPriceChanged(subscriptionService.HandlePriceChanged)
+	importService.OnStockIncreased(subscriptionService.HandleStockIncreased)
+	supplierOrderService.OnStockIncreased(subscriptionService.HandleStockIncreased)
+	stockService.OnStockIncreased(subscriptionService.HandleStockIncreased)
+	stocktakeService.OnStockIncreased(subscriptionService.HandleStockIncreased)
+	returnService.OnStockIncreased(subscriptionService.HandleStockIncreased)
+
+	// Кэш каталога сбрасывается при изменениях в обход ProductService; свои изменения
+	// ProductService сбрасывает сам
+	variantService.OnPriceChanged(catalogCache.HandlePriceChanged)
+	importService.OnPriceChanged(catalogCache.HandlePriceChanged)
+	importService.OnCatalogChanged(catalogCache.HandleCatalogChanged)
+
+	webhookService := services.NewWebhookService(db, cfg.WebhookMaxAttempts)
+	webhookController := controllers.NewWebhookController(webhookService)
+
+	router.GET("/admin/webhooks", gin.WrapF(webhookController.GetWebhooksHandler))
+	router.POST("/admin/webhooks", gin.WrapF(webhookController.CreateWebhookHandler))
+	router.PUT("/admin/webhooks", gin.WrapF(webhookController.UpdateWebhookHandler))
+	router.DELETE("/admin/webhooks", gin.WrapF(webhookController.DeleteWebhookHandler))
+	router.GET("/admin/webhooks/deliveries", gin.WrapF(webhookController.GetDeliveriesHandler))
+	router.GET("/admin/webhooks/deliveries/attempts", gin.WrapF(webhookController.GetDeliveryAttemptsHandler))
+	router.POST("/admin/webhooks/deliveries/redeliver", gin.WrapF(webhookController.RedeliverHandler))
+
+	// Доменные события из таблицы domain_events: подписчики получают их после фиксации изменения
+	eventDispatcher := services.NewEventDispatcher(db, cfg.EventMaxAttempts)
+	eventDispatcher.Subscribe("notifications", notificationService.HandleEvent, services.NotificationEventTypes...)
+	eventDispatcher.Subscribe("webhooks", webhookService.HandleEvent, services.WebhookEventTypes...)
+	eventDispatcher.Subscribe("metrics", purchaseService.HandleEvent, services.PurchaseMetricsEventTypes...)
+	if err := eventDispatcher.Register(context.Background()); err != nil {
+		return nil, fmt.Errorf("регистрация подписчиков событий: %w", err)
+	}
+	eventController := controllers.NewEventController(eventDispatcher)
+
+	router.GET("/admin/events/failed", gin.WrapF(eventController.GetFailedDeliveriesHandler))
+	router.POST("/admin/events/retry", gin.WrapF(eventController.RetryDeliveryHandler))
+
+	purgeService := services.NewPurgeService(db, cfg.SoftDeleteRetention)
+	purgeService.OnPurge("products", imageService.DeleteProductImages)
+	purgeService.OnPurge("customers", subscriptionService.DeleteCustomerSubscriptions)
+	purgeService.OnPurge("customers", notificationService.DeleteCustomerPreferences)
+
+	workers := []func(ctx context.Context){
+		func(ctx context.Context) { pickupService.RunExpiryWorker(ctx, time.Minute) },
+		func(ctx context.Context) { purgeService.RunPurgeWorker(ctx, time.Hour) },
+		func(ctx context.Context) { reorderService.RunLowStockWorker(ctx, cfg.LowStockCheckInterval) },
+		func(ctx context.Context) { notificationService.RunOutboxWorker(ctx, cfg.NotificationInterval) },
+		func(ctx context.Context) { eventDispatcher.RunDispatcher(ctx, cfg.EventDispatchInterval) },
+		func(ctx context.Context) { webhookService.RunDeliveryWorker(ctx, cfg.WebhookInterval) },
+		func(ctx context.Context) { db.MonitorReplicas(ctx, cfg.DBReplicaCheckPeriod) },
+		func(ctx context.Context) { purchaseService.RunMetricsWorker(ctx, cfg.MetricsRefreshPeriod) },
+	}
 
 	return &Server{
 		router:          router,
 		categoryService: categoryService,
+		cfg:             cfg,
+		workers:         workers,
+	}, nil
+}
+
+// Run запускает фоновые обработчики и HTTP-серверы (HTTP и, если задан сертификат, HTTPS)
+// и работает до отмены ctx. Остановка идёт по порядку в пределах ShutdownTimeout: серверы
+// перестают принимать соединения и дожидаются текущих запросов, затем останавливаются
+// фоновые обработчики. Базу данных после возврата закрывает вызывающий.
+func (s *Server) Run(ctx context.Context) error {
+	servers, listeners := s.listeners()
+	if len(listeners) == 0 {
+		return errors.New("не задан ни HTTP_ADDR, ни TLS_CERT_FILE")
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	for _, worker := range s.workers {
+		workers.Add(1)
+		go func(worker func(ctx context.Context)) {
+			defer workers.Done()
+			worker(workerCtx)
+		}(worker)
+	}
+
+	serveErr := make(chan error, len(listeners))
+	for _, listen := range listeners {
+		go func(listen func() error) {
+			if err := listen(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}(listen)
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("получен сигнал остановки, завершаем текущие запросы")
+	case runErr = <-serveErr:
+		slog.Error("ошибка HTTP-сервера, останавливаемся", "error", runErr)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("не все запросы завершились до таймаута", "addr", server.Addr, "error", err)
+			server.Close()
+		}
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		slog.Warn("фоновые обработчики не остановились до таймаута")
+	}
+
+	return runErr
+}
+
+// listeners создаёт HTTP-серверы по настройкам и функции, запускающие их приём соединений
+func (s *Server) listeners() ([]*http.Server, []func() error) {
+	var servers []*http.Server
+	var listeners []func() error
+
+	newServer := func(addr string) *http.Server {
+		server := &http.Server{
+			Addr:         addr,
+			Handler:      s.router,
+			ReadTimeout:  s.cfg.HTTPReadTimeout,
+			WriteTimeout: s.cfg.HTTPWriteTimeout,
+			IdleTimeout:  s.cfg.HTTPIdleTimeout,
+		}
+		servers = append(servers, server)
+		return server
+	}
+
+	if s.cfg.HTTPAddr != "" {
+		server := newServer(s.cfg.HTTPAddr)
+		listeners = append(listeners, func() error {
+			slog.Info("HTTP-сервер слушает", "addr", server.Addr)
+			return server.ListenAndServe()
+		})
+	}
+	if s.cfg.TLSCertFile != "" {
+		server := newServer(s.cfg.HTTPSAddr)
+		listeners = append(listeners, func() error {
+			slog.Info("HTTPS-сервер слушает", "addr", server.Addr)
+			return server.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		})
 	}
+	return servers, listeners
 }
 
-func (s *Server) Run(addr string) error {
-	return http.ListenAndServe(addr, s.router)
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.StorageDriver {
+	case "local":
+		return storage.NewLocalStorage(cfg.UploadDir, cfg.UploadURL)
+	case "s3":
+		return storage.NewS3Storage(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PublicURL), nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.StorageDriver)
+	}
 }
 
-func NewCategoryController(categoryService services.CategoryService) *CategoryController {
-	return &CategoryController{
-		categoryService: categoryService,
+// newCache выбирает хранилище кэша каталога: память процесса или общий Redis
+func newCache(cfg *config.Config) cache.Cache {
+	if cfg.CacheDriver == "redis" {
+		return cache.NewRedisCache(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.RedisTimeout)
 	}
+	return cache.NewMemoryCache(cfg.CacheSize)
 }
 
-func (c *CategoryController) GetCategoriesHandler(ctx *gin.Context) {
-	categories, err := c.categoryService.GetAllCategories(ctx)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// withPathParams передаёт параметры пути gin (например, :id) в query-строку,
+// откуда их читают обработчики контроллеров
+func withPathParams(handler http.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := ctx.Request.URL.Query()
+		for _, param := range ctx.Params {
+			query.Set(param.Key, param.Value)
+		}
+		ctx.Request.URL.RawQuery = query.Encode()
+		handler(ctx.Writer, ctx.Request)
+	}
+}
+
+// withDBSession открывает для каждого запроса сессию чтения: после первой записи
+// остальные чтения этого запроса идут на основной сервер, а не на реплики
+func withDBSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(db.WithSession(ctx.Request.Context()))
+		ctx.Next()
 	}
-	ctx.JSON(http.StatusOK, categories)
 }
 
+// withMetrics считает запросы и их длительность по методу, шаблону маршрута и статусу.
+// Берётся шаблон (/products/:id), а не путь, чтобы ID в пути не плодили ряды метрик.
+func withMetrics(registry *metrics.Registry) gin.HandlerFunc {
+	requests := registry.NewCounter("http_requests_total", "Обработанные HTTP-запросы", "method", "route", "status")
+	duration := registry.NewHistogram("http_request_duration_seconds", "Время обработки HTTP-запросов", metrics.DefBuckets, "method", "route", "status")
+
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+		requests.Inc(ctx.Request.Method, route, status)
+		duration.Observe(time.Since(start).Seconds(), ctx.Request.Method, route, status)
+	}
+}
+
+// registerPoolMetrics снимает статистику пулов соединений (основного и реплик) при каждом запросе /metrics
+func registerPoolMetrics(registry *metrics.Registry, db *db.DB) {
+	connections := registry.NewGauge("db_connections", "Соединения пула по состоянию (in_use, idle)", "pool", "state")
+	maxOpen := registry.NewGauge("db_connections_max_open", "Предел открытых соединений основного пула (0 - без предела)")
+	waits := registry.NewCounter("db_wait_count_total", "Сколько раз запрос ждал свободного соединения", "pool")
+	waitSeconds := registry.NewCounter("db_wait_duration_seconds_total", "Суммарное время ожидания соединений основного пула")
+	healthy := registry.NewGauge("db_replica_healthy", "1, если реплика отвечает и используется для чтения", "replica")
+
+	registry.OnCollect(func() {
+		stats := db.PoolStats()
+		connections.Set(float64(stats.InUse), "primary", "in_use")
+		connections.Set(float64(stats.Idle), "primary", "idle")
+		maxOpen.Set(float64(stats.MaxOpenConnections))
+		waits.Set(float64(stats.WaitCount), "primary")
+		waitSeconds.Set(float64(stats.WaitDurationMs) / 1000)
+
+		for _, replica := range stats.Replicas {
+			connections.Set(float64(replica.InUse), replica.URL, "in_use")
+			connections.Set(float64(replica.OpenConnections-replica.InUse), replica.URL, "idle")
+			waits.Set(float64(replica.WaitCount), replica.URL)
+			value := 0.0
+			if replica.Healthy {
+				value = 1
+			}
+			healthy.Set(value, replica.URL)
+		}
+	})
+}
+
+// metricsHandler отдаёт метрики; если задан token, только с заголовком Authorization: Bearer <token>,
+// потому что среди метрик есть выручка. Запрос с верным токеном попадает в лог с principal "metrics".
+func metricsHandler(registry *metrics.Registry, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+				http.Error(w, "Неверный токен метрик", http.StatusUnauthorized)
+				return
+			}
+			logging.SetPrincipal(r.Context(), "metrics")
+		}
+		registry.Handler(w, r)
+	}
+}
+
+// newNotifiers выбирает реализацию для каждого канала уведомлений. Ненастроенные каналы пишут в лог.
+func newNotifiers(cfg *config.Config) map[string]notify.Notifier {
+	logNotifier := notify.NewLogNotifier()
+	channels := map[string]notify.Notifier{
+		notify.ChannelEmail:    logNotifier,
+		notify.ChannelSMS:      logNotifier,
+		notify.ChannelTelegram: logNotifier,
+	}
+	if cfg.SMTPHost != "" {
+		channels[notify.ChannelEmail] = notify.NewSMTPNotifier(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	}
+	if cfg.SMSAPIURL != "" {
+		channels[notify.ChannelSMS] = notify.NewSMSNotifier(cfg.SMSAPIURL, cfg.SMSAPIKey, cfg.SMSSender)
+	}
+	if cfg.TelegramBotToken != "" {
+		channels[notify.ChannelTelegram] = notify.NewTelegramNotifier(cfg.TelegramBotToken)
+	}
+	return channels
+}